@@ -52,7 +52,9 @@ import (
 	"k8s.io/kops/upup/pkg/fi/cloudup/aliup"
 	"k8s.io/kops/upup/pkg/fi/cloudup/awsup"
 	"k8s.io/kops/upup/pkg/fi/cloudup/gce"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 	"k8s.io/kops/upup/pkg/fi/utils"
+	"k8s.io/kops/util/pkg/vfs"
 	"k8s.io/kubernetes/pkg/kubectl/cmd/templates"
 	"k8s.io/kubernetes/pkg/kubectl/util/i18n"
 )
@@ -912,30 +914,28 @@ func RunCreateCluster(f *util.Factory, out io.Writer, c *CreateClusterOptions) e
 			if cluster.Spec.CloudConfig == nil {
 				cluster.Spec.CloudConfig = &api.CloudConfiguration{}
 			}
-			provider := "haproxy"
-			if c.OpenstackLBOctavia {
-				provider = "octavia"
-			}
 			cluster.Spec.CloudConfig.Openstack = &api.OpenstackConfiguration{
 				Router: &api.OpenstackRouter{
 					ExternalNetwork: fi.String(c.OpenstackExternalNet),
 				},
 				Loadbalancer: &api.OpenstackLoadbalancerConfig{
 					FloatingNetwork: fi.String(c.OpenstackExternalNet),
-					Method:          fi.String("ROUND_ROBIN"),
-					Provider:        fi.String(provider),
 					UseOctavia:      fi.Bool(c.OpenstackLBOctavia),
 				},
 				BlockStorage: &api.OpenstackBlockStorageConfig{
-					Version:  fi.String("v2"),
 					IgnoreAZ: fi.Bool(c.OpenstackStorageIgnoreAZ),
 				},
-				Monitor: &api.OpenstackMonitor{
-					Delay:      fi.String("1m"),
-					Timeout:    fi.String("30s"),
-					MaxRetries: fi.Int(3),
-				},
 			}
+			if !c.OpenstackLBOctavia {
+				useOctavia, err := vfs.OpenstackConfig{}.GetUseOctavia()
+				if err != nil {
+					return err
+				}
+				if useOctavia != nil {
+					cluster.Spec.CloudConfig.Openstack.Loadbalancer.UseOctavia = useOctavia
+				}
+			}
+			openstack.ApplyDefaults(&cluster.Spec)
 			if c.OpenstackDNSServers != "" {
 				cluster.Spec.CloudConfig.Openstack.Router.DNSServers = fi.String(c.OpenstackDNSServers)
 			}
@@ -17,10 +17,8 @@ limitations under the License.
 package designate
 
 import (
-	"crypto/tls"
 	"fmt"
 	"io"
-	"net/http"
 
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack"
@@ -41,7 +39,7 @@ func init() {
 
 func newDesignate(_ io.Reader) (*Interface, error) {
 	oc := vfs.OpenstackConfig{}
-	ao, err := oc.GetCredential()
+	credentialProvider, ao, err := oc.GetCredentialProvider()
 	if err != nil {
 		return nil, err
 	}
@@ -57,27 +55,28 @@ func newDesignate(_ io.Reader) (*Interface, error) {
 		return nil, fmt.Errorf("error building openstack provider client: %v", err)
 	}
 
-	tlsconfig := &tls.Config{}
-	tlsconfig.InsecureSkipVerify = true
-	transport := &http.Transport{TLSClientConfig: tlsconfig}
-	provider.HTTPClient = http.Client{
-		Transport: transport,
+	provider.HTTPClient, err = oc.NewHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error building openstack http client: %v", err)
 	}
 
 	glog.V(2).Info("authenticating to keystone")
 
-	err = openstack.Authenticate(provider, ao)
+	err = vfs.AuthenticateOpenstackClient(provider, credentialProvider, ao)
 	if err != nil {
 		return nil, fmt.Errorf("error building openstack authenticated client: %v", err)
 	}
 
-	endpointOpt, err := oc.GetServiceConfig("Designate")
-	if err != nil {
-		return nil, err
+	region := oc.GetServiceRegion("dns")
+	if region == "" {
+		region, err = oc.GetRegion()
+		if err != nil {
+			return nil, fmt.Errorf("error finding openstack region: %v", err)
+		}
 	}
-	sc, err := openstack.NewDNSV2(provider, endpointOpt)
+	sc, err := openstack.NewDNSV2(provider, oc.GetServiceEndpoint("Designate", "dns", region))
 	if err != nil {
-
+		return nil, fmt.Errorf("error building dns client: %v", err)
 	}
 	return New(sc), nil
 }
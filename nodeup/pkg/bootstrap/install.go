@@ -148,6 +148,9 @@ func (i *Installation) buildSystemdJob() *nodetasks.Service {
 			"OS_DOMAIN_NAME", "OS_DOMAIN_ID",
 			"OS_USERNAME",
 			"OS_PASSWORD",
+			"OS_APPLICATION_CREDENTIAL_ID",
+			"OS_APPLICATION_CREDENTIAL_NAME",
+			"OS_APPLICATION_CREDENTIAL_SECRET",
 			"OS_AUTH_URL",
 			"OS_REGION_NAME",
 		} {
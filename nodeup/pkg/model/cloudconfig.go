@@ -127,8 +127,14 @@ func (b *CloudConfigBuilder) Build(c *fi.ModelBuilderContext) error {
 			fmt.Sprintf("tenant-name=\"%s\"", tenantName),
 			fmt.Sprintf("domain-name=\"%s\"", os.Getenv("OS_DOMAIN_NAME")),
 			fmt.Sprintf("domain-id=\"%s\"", os.Getenv("OS_DOMAIN_ID")),
-			"",
 		)
+		if appCredID := os.Getenv("OS_APPLICATION_CREDENTIAL_ID"); appCredID != "" {
+			lines = append(lines,
+				fmt.Sprintf("application-credential-id=\"%s\"", appCredID),
+				fmt.Sprintf("application-credential-secret=\"%s\"", os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET")),
+			)
+		}
+		lines = append(lines, "")
 
 		if lb := osc.Loadbalancer; lb != nil {
 			lines = append(lines,
@@ -149,6 +149,15 @@ type InstanceGroupSpec struct {
 	IAM *IAMProfileSpec `json:"iam,omitempty"`
 	// SecurityGroupOverride overrides the default security group created by Kops for this IG (AWS only).
 	SecurityGroupOverride *string `json:"securityGroupOverride,omitempty"`
+	// ServerGroupPolicy is the OpenStack server group policy of the instance group: anti-affinity (default),
+	// soft-anti-affinity, affinity or soft-affinity (OpenStack only).
+	ServerGroupPolicy *string `json:"serverGroupPolicy,omitempty"`
+	// SchedulerHints are additional hints for the OpenStack scheduler when creating the instances, e.g. to place them
+	// on a host aggregate. They are merged with the server group of the instance group (OpenStack only).
+	SchedulerHints map[string]string `json:"schedulerHints,omitempty"`
+	// ConfigDrive provides the metadata to the instances through a config drive instead of the metadata service,
+	// overriding the setting of the cluster (OpenStack only).
+	ConfigDrive *bool `json:"configDrive,omitempty"`
 }
 
 const (
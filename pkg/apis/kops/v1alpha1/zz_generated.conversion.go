@@ -593,6 +593,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*OpenstackBackoff)(nil), (*kops.OpenstackBackoff)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(a.(*OpenstackBackoff), b.(*kops.OpenstackBackoff), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*kops.OpenstackBackoff)(nil), (*OpenstackBackoff)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(a.(*kops.OpenstackBackoff), b.(*OpenstackBackoff), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*OpenstackBlockStorageConfig)(nil), (*kops.OpenstackBlockStorageConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_OpenstackBlockStorageConfig_To_kops_OpenstackBlockStorageConfig(a.(*OpenstackBlockStorageConfig), b.(*kops.OpenstackBlockStorageConfig), scope)
 	}); err != nil {
@@ -623,6 +633,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*OpenstackMetadata)(nil), (*kops.OpenstackMetadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata(a.(*OpenstackMetadata), b.(*kops.OpenstackMetadata), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*kops.OpenstackMetadata)(nil), (*OpenstackMetadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata(a.(*kops.OpenstackMetadata), b.(*OpenstackMetadata), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*OpenstackMonitor)(nil), (*kops.OpenstackMonitor)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_OpenstackMonitor_To_kops_OpenstackMonitor(a.(*OpenstackMonitor), b.(*kops.OpenstackMonitor), scope)
 	}); err != nil {
@@ -643,6 +663,26 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*OpenstackTrunk)(nil), (*kops.OpenstackTrunk)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk(a.(*OpenstackTrunk), b.(*kops.OpenstackTrunk), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*kops.OpenstackTrunk)(nil), (*OpenstackTrunk)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk(a.(*kops.OpenstackTrunk), b.(*OpenstackTrunk), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*OpenstackTrunkSubPort)(nil), (*kops.OpenstackTrunkSubPort)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort(a.(*OpenstackTrunkSubPort), b.(*kops.OpenstackTrunkSubPort), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*kops.OpenstackTrunkSubPort)(nil), (*OpenstackTrunkSubPort)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort(a.(*kops.OpenstackTrunkSubPort), b.(*OpenstackTrunkSubPort), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*RBACAuthorizationSpec)(nil), (*kops.RBACAuthorizationSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_RBACAuthorizationSpec_To_kops_RBACAuthorizationSpec(a.(*RBACAuthorizationSpec), b.(*kops.RBACAuthorizationSpec), scope)
 	}); err != nil {
@@ -2331,6 +2371,7 @@ func autoConvert_v1alpha1_ExternalDNSConfig_To_kops_ExternalDNSConfig(in *Extern
 	out.Disable = in.Disable
 	out.WatchIngress = in.WatchIngress
 	out.WatchNamespace = in.WatchNamespace
+	out.TTL = in.TTL
 	return nil
 }
 
@@ -2343,6 +2384,7 @@ func autoConvert_kops_ExternalDNSConfig_To_v1alpha1_ExternalDNSConfig(in *kops.E
 	out.Disable = in.Disable
 	out.WatchIngress = in.WatchIngress
 	out.WatchNamespace = in.WatchNamespace
+	out.TTL = in.TTL
 	return nil
 }
 
@@ -2749,6 +2791,9 @@ func autoConvert_v1alpha1_InstanceGroupSpec_To_kops_InstanceGroupSpec(in *Instan
 		out.IAM = nil
 	}
 	out.SecurityGroupOverride = in.SecurityGroupOverride
+	out.ServerGroupPolicy = in.ServerGroupPolicy
+	out.SchedulerHints = in.SchedulerHints
+	out.ConfigDrive = in.ConfigDrive
 	return nil
 }
 
@@ -2869,6 +2914,9 @@ func autoConvert_kops_InstanceGroupSpec_To_v1alpha1_InstanceGroupSpec(in *kops.I
 		out.IAM = nil
 	}
 	out.SecurityGroupOverride = in.SecurityGroupOverride
+	out.ServerGroupPolicy = in.ServerGroupPolicy
+	out.SchedulerHints = in.SchedulerHints
+	out.ConfigDrive = in.ConfigDrive
 	return nil
 }
 
@@ -3988,10 +4036,40 @@ func Convert_kops_NodeAuthorizerSpec_To_v1alpha1_NodeAuthorizerSpec(in *kops.Nod
 	return autoConvert_kops_NodeAuthorizerSpec_To_v1alpha1_NodeAuthorizerSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(in *OpenstackBackoff, out *kops.OpenstackBackoff, s conversion.Scope) error {
+	out.Duration = in.Duration
+	out.Factor = in.Factor
+	out.Jitter = in.Jitter
+	out.Steps = in.Steps
+	return nil
+}
+
+// Convert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff is an autogenerated conversion function.
+func Convert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(in *OpenstackBackoff, out *kops.OpenstackBackoff, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(in, out, s)
+}
+
+func autoConvert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(in *kops.OpenstackBackoff, out *OpenstackBackoff, s conversion.Scope) error {
+	out.Duration = in.Duration
+	out.Factor = in.Factor
+	out.Jitter = in.Jitter
+	out.Steps = in.Steps
+	return nil
+}
+
+// Convert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff is an autogenerated conversion function.
+func Convert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(in *kops.OpenstackBackoff, out *OpenstackBackoff, s conversion.Scope) error {
+	return autoConvert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(in, out, s)
+}
+
 func autoConvert_v1alpha1_OpenstackBlockStorageConfig_To_kops_OpenstackBlockStorageConfig(in *OpenstackBlockStorageConfig, out *kops.OpenstackBlockStorageConfig, s conversion.Scope) error {
 	out.Version = in.Version
 	out.IgnoreAZ = in.IgnoreAZ
 	out.OverrideAZ = in.OverrideAZ
+	out.EtcdVolumeSize = in.EtcdVolumeSize
+	out.EtcdVolumeType = in.EtcdVolumeType
+	out.BootFromVolume = in.BootFromVolume
+	out.BootVolumeDeleteOnTermination = in.BootVolumeDeleteOnTermination
 	return nil
 }
 
@@ -4004,6 +4082,10 @@ func autoConvert_kops_OpenstackBlockStorageConfig_To_v1alpha1_OpenstackBlockStor
 	out.Version = in.Version
 	out.IgnoreAZ = in.IgnoreAZ
 	out.OverrideAZ = in.OverrideAZ
+	out.EtcdVolumeSize = in.EtcdVolumeSize
+	out.EtcdVolumeType = in.EtcdVolumeType
+	out.BootFromVolume = in.BootFromVolume
+	out.BootVolumeDeleteOnTermination = in.BootVolumeDeleteOnTermination
 	return nil
 }
 
@@ -4049,6 +4131,45 @@ func autoConvert_v1alpha1_OpenstackConfiguration_To_kops_OpenstackConfiguration(
 	} else {
 		out.BlockStorage = nil
 	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(kops.OpenstackMetadata)
+		if err := Convert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Metadata = nil
+	}
+	if in.Trunk != nil {
+		in, out := &in.Trunk, &out.Trunk
+		*out = new(kops.OpenstackTrunk)
+		if err := Convert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Trunk = nil
+	}
+	if in.ReadBackoff != nil {
+		in, out := &in.ReadBackoff, &out.ReadBackoff
+		*out = new(kops.OpenstackBackoff)
+		if err := Convert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ReadBackoff = nil
+	}
+	if in.WriteBackoff != nil {
+		in, out := &in.WriteBackoff, &out.WriteBackoff
+		*out = new(kops.OpenstackBackoff)
+		if err := Convert_v1alpha1_OpenstackBackoff_To_kops_OpenstackBackoff(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.WriteBackoff = nil
+	}
+	out.ComputeMicroversion = in.ComputeMicroversion
+	out.BlockStorageMicroversion = in.BlockStorageMicroversion
+	out.ServerConcurrency = in.ServerConcurrency
 	return nil
 }
 
@@ -4094,6 +4215,45 @@ func autoConvert_kops_OpenstackConfiguration_To_v1alpha1_OpenstackConfiguration(
 	} else {
 		out.BlockStorage = nil
 	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(OpenstackMetadata)
+		if err := Convert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Metadata = nil
+	}
+	if in.Trunk != nil {
+		in, out := &in.Trunk, &out.Trunk
+		*out = new(OpenstackTrunk)
+		if err := Convert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.Trunk = nil
+	}
+	if in.ReadBackoff != nil {
+		in, out := &in.ReadBackoff, &out.ReadBackoff
+		*out = new(OpenstackBackoff)
+		if err := Convert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.ReadBackoff = nil
+	}
+	if in.WriteBackoff != nil {
+		in, out := &in.WriteBackoff, &out.WriteBackoff
+		*out = new(OpenstackBackoff)
+		if err := Convert_kops_OpenstackBackoff_To_v1alpha1_OpenstackBackoff(*in, *out, s); err != nil {
+			return err
+		}
+	} else {
+		out.WriteBackoff = nil
+	}
+	out.ComputeMicroversion = in.ComputeMicroversion
+	out.BlockStorageMicroversion = in.BlockStorageMicroversion
+	out.ServerConcurrency = in.ServerConcurrency
 	return nil
 }
 
@@ -4111,6 +4271,7 @@ func autoConvert_v1alpha1_OpenstackLoadbalancerConfig_To_kops_OpenstackLoadbalan
 	out.FloatingSubnet = in.FloatingSubnet
 	out.SubnetID = in.SubnetID
 	out.ManageSecGroups = in.ManageSecGroups
+	out.AvailabilityZone = in.AvailabilityZone
 	return nil
 }
 
@@ -4128,6 +4289,7 @@ func autoConvert_kops_OpenstackLoadbalancerConfig_To_v1alpha1_OpenstackLoadbalan
 	out.FloatingSubnet = in.FloatingSubnet
 	out.SubnetID = in.SubnetID
 	out.ManageSecGroups = in.ManageSecGroups
+	out.AvailabilityZone = in.AvailabilityZone
 	return nil
 }
 
@@ -4136,10 +4298,33 @@ func Convert_kops_OpenstackLoadbalancerConfig_To_v1alpha1_OpenstackLoadbalancerC
 	return autoConvert_kops_OpenstackLoadbalancerConfig_To_v1alpha1_OpenstackLoadbalancerConfig(in, out, s)
 }
 
+func autoConvert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata(in *OpenstackMetadata, out *kops.OpenstackMetadata, s conversion.Scope) error {
+	out.ConfigDrive = in.ConfigDrive
+	out.InjectRoute = in.InjectRoute
+	return nil
+}
+
+// Convert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata is an autogenerated conversion function.
+func Convert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata(in *OpenstackMetadata, out *kops.OpenstackMetadata, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OpenstackMetadata_To_kops_OpenstackMetadata(in, out, s)
+}
+
+func autoConvert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata(in *kops.OpenstackMetadata, out *OpenstackMetadata, s conversion.Scope) error {
+	out.ConfigDrive = in.ConfigDrive
+	out.InjectRoute = in.InjectRoute
+	return nil
+}
+
+// Convert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata is an autogenerated conversion function.
+func Convert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata(in *kops.OpenstackMetadata, out *OpenstackMetadata, s conversion.Scope) error {
+	return autoConvert_kops_OpenstackMetadata_To_v1alpha1_OpenstackMetadata(in, out, s)
+}
+
 func autoConvert_v1alpha1_OpenstackMonitor_To_kops_OpenstackMonitor(in *OpenstackMonitor, out *kops.OpenstackMonitor, s conversion.Scope) error {
 	out.Delay = in.Delay
 	out.Timeout = in.Timeout
 	out.MaxRetries = in.MaxRetries
+	out.Type = in.Type
 	return nil
 }
 
@@ -4152,6 +4337,7 @@ func autoConvert_kops_OpenstackMonitor_To_v1alpha1_OpenstackMonitor(in *kops.Ope
 	out.Delay = in.Delay
 	out.Timeout = in.Timeout
 	out.MaxRetries = in.MaxRetries
+	out.Type = in.Type
 	return nil
 }
 
@@ -4164,6 +4350,8 @@ func autoConvert_v1alpha1_OpenstackRouter_To_kops_OpenstackRouter(in *OpenstackR
 	out.ExternalNetwork = in.ExternalNetwork
 	out.DNSServers = in.DNSServers
 	out.ExternalSubnet = in.ExternalSubnet
+	out.IPv6AddressMode = in.IPv6AddressMode
+	out.IPv6RAMode = in.IPv6RAMode
 	return nil
 }
 
@@ -4176,6 +4364,8 @@ func autoConvert_kops_OpenstackRouter_To_v1alpha1_OpenstackRouter(in *kops.Opens
 	out.ExternalNetwork = in.ExternalNetwork
 	out.DNSServers = in.DNSServers
 	out.ExternalSubnet = in.ExternalSubnet
+	out.IPv6AddressMode = in.IPv6AddressMode
+	out.IPv6RAMode = in.IPv6RAMode
 	return nil
 }
 
@@ -4184,6 +4374,70 @@ func Convert_kops_OpenstackRouter_To_v1alpha1_OpenstackRouter(in *kops.Openstack
 	return autoConvert_kops_OpenstackRouter_To_v1alpha1_OpenstackRouter(in, out, s)
 }
 
+func autoConvert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk(in *OpenstackTrunk, out *kops.OpenstackTrunk, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	if in.SubPorts != nil {
+		in, out := &in.SubPorts, &out.SubPorts
+		*out = make([]kops.OpenstackTrunkSubPort, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.SubPorts = nil
+	}
+	return nil
+}
+
+// Convert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk is an autogenerated conversion function.
+func Convert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk(in *OpenstackTrunk, out *kops.OpenstackTrunk, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OpenstackTrunk_To_kops_OpenstackTrunk(in, out, s)
+}
+
+func autoConvert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk(in *kops.OpenstackTrunk, out *OpenstackTrunk, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	if in.SubPorts != nil {
+		in, out := &in.SubPorts, &out.SubPorts
+		*out = make([]OpenstackTrunkSubPort, len(*in))
+		for i := range *in {
+			if err := Convert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.SubPorts = nil
+	}
+	return nil
+}
+
+// Convert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk is an autogenerated conversion function.
+func Convert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk(in *kops.OpenstackTrunk, out *OpenstackTrunk, s conversion.Scope) error {
+	return autoConvert_kops_OpenstackTrunk_To_v1alpha1_OpenstackTrunk(in, out, s)
+}
+
+func autoConvert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort(in *OpenstackTrunkSubPort, out *kops.OpenstackTrunkSubPort, s conversion.Scope) error {
+	out.Network = in.Network
+	out.SegmentationID = in.SegmentationID
+	return nil
+}
+
+// Convert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort is an autogenerated conversion function.
+func Convert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort(in *OpenstackTrunkSubPort, out *kops.OpenstackTrunkSubPort, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OpenstackTrunkSubPort_To_kops_OpenstackTrunkSubPort(in, out, s)
+}
+
+func autoConvert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort(in *kops.OpenstackTrunkSubPort, out *OpenstackTrunkSubPort, s conversion.Scope) error {
+	out.Network = in.Network
+	out.SegmentationID = in.SegmentationID
+	return nil
+}
+
+// Convert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort is an autogenerated conversion function.
+func Convert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort(in *kops.OpenstackTrunkSubPort, out *OpenstackTrunkSubPort, s conversion.Scope) error {
+	return autoConvert_kops_OpenstackTrunkSubPort_To_v1alpha1_OpenstackTrunkSubPort(in, out, s)
+}
+
 func autoConvert_v1alpha1_RBACAuthorizationSpec_To_kops_RBACAuthorizationSpec(in *RBACAuthorizationSpec, out *kops.RBACAuthorizationSpec, s conversion.Scope) error {
 	return nil
 }
@@ -563,12 +563,23 @@ type OpenstackLoadbalancerConfig struct {
 	FloatingSubnet    *string `json:"floatingSubnet,omitempty"`
 	SubnetID          *string `json:"subnetID,omitempty"`
 	ManageSecGroups   *bool   `json:"manageSecurityGroups,omitempty"`
+	// AvailabilityZone is the Octavia availability zone the loadbalancer of the API is created in
+	AvailabilityZone *string `json:"availabilityZone,omitempty"`
 }
 
 type OpenstackBlockStorageConfig struct {
 	Version    *string `json:"bs-version,omitempty"`
 	IgnoreAZ   *bool   `json:"ignore-volume-az,omitempty"`
 	OverrideAZ *string `json:"override-volume-az,omitempty"`
+	// EtcdVolumeSize overrides the size in GB of the volumes created for etcd
+	EtcdVolumeSize *int32 `json:"etcd-volume-size,omitempty"`
+	// EtcdVolumeType overrides the volume type of the volumes created for etcd
+	EtcdVolumeType *string `json:"etcd-volume-type,omitempty"`
+	// BootFromVolume boots the instances from a Cinder volume created from their image, sized and typed
+	// by the rootVolumeSize and rootVolumeType of the instance group
+	BootFromVolume *bool `json:"boot-from-volume,omitempty"`
+	// BootVolumeDeleteOnTermination deletes the boot volume together with its instance, defaults to true
+	BootVolumeDeleteOnTermination *bool `json:"boot-volume-delete-on-termination,omitempty"`
 }
 
 // OpenstackMonitor defines the config for a health monitor
@@ -576,6 +587,8 @@ type OpenstackMonitor struct {
 	Delay      *string `json:"delay,omitempty"`
 	Timeout    *string `json:"timeout,omitempty"`
 	MaxRetries *int    `json:"maxRetries,omitempty"`
+	// Type is the health check of the members of the API loadbalancer, TCP or HTTPS, defaults to TCP
+	Type *string `json:"type,omitempty"`
 }
 
 // OpenstackRouter defines the config for a router
@@ -583,6 +596,47 @@ type OpenstackRouter struct {
 	ExternalNetwork *string `json:"externalNetwork,omitempty"`
 	DNSServers      *string `json:"dnsServers,omitempty"`
 	ExternalSubnet  *string `json:"externalSubnet,omitempty"`
+	// IPv6AddressMode is how instances get their addresses on IPv6 subnets: slaac (the default), dhcpv6-stateful or dhcpv6-stateless
+	IPv6AddressMode *string `json:"ipv6AddressMode,omitempty"`
+	// IPv6RAMode is how the router advertises IPv6 subnets: slaac (the default), dhcpv6-stateful or dhcpv6-stateless
+	IPv6RAMode *string `json:"ipv6RAMode,omitempty"`
+}
+
+// OpenstackMetadata defines how instances reach the metadata service
+type OpenstackMetadata struct {
+	// ConfigDrive provides the metadata to instances through a config drive instead of the metadata service
+	ConfigDrive *bool `json:"configDrive,omitempty"`
+	// InjectRoute adds a host route to the metadata service to the subnets created by kops
+	InjectRoute *bool `json:"injectRoute,omitempty"`
+}
+
+// OpenstackTrunk makes the ports of the instances parent ports of Neutron trunks, which is only needed by CNIs
+// attaching pods to Neutron ports of their own, e.g. Kuryr in nested mode
+type OpenstackTrunk struct {
+	// Enabled creates a trunk on the port of every instance, it requires the trunk extension of Neutron
+	Enabled *bool `json:"enabled,omitempty"`
+	// SubPorts are the additional networks carried by the trunks of the instances
+	SubPorts []OpenstackTrunkSubPort `json:"subPorts,omitempty"`
+}
+
+// OpenstackTrunkSubPort is a network carried by the trunks of the instances as a VLAN
+type OpenstackTrunkSubPort struct {
+	// Network is the name or ID of the network
+	Network string `json:"network"`
+	// SegmentationID is the VLAN ID of the network on the trunk
+	SegmentationID int `json:"segmentationID"`
+}
+
+// OpenstackBackoff overrides the retry strategy of OpenStack API calls, unset fields keep their default
+type OpenstackBackoff struct {
+	// Duration is the wait before the first retry, e.g. "1s"
+	Duration *string `json:"duration,omitempty"`
+	// Factor multiplies the wait after each retry, e.g. "1.5"
+	Factor *string `json:"factor,omitempty"`
+	// Jitter adds a random fraction of the wait, e.g. "0.1"
+	Jitter *string `json:"jitter,omitempty"`
+	// Steps is the maximum number of attempts
+	Steps *int `json:"steps,omitempty"`
 }
 
 // OpenstackConfiguration defines cloud config elements for the openstack cloud provider
@@ -591,6 +645,22 @@ type OpenstackConfiguration struct {
 	Monitor      *OpenstackMonitor            `json:"monitor,omitempty"`
 	Router       *OpenstackRouter             `json:"router,omitempty"`
 	BlockStorage *OpenstackBlockStorageConfig `json:"blockStorage,omitempty"`
+	Metadata     *OpenstackMetadata           `json:"metadata,omitempty"`
+	// Trunk creates Neutron trunks on the ports of the instances
+	Trunk *OpenstackTrunk `json:"trunk,omitempty"`
+	// ReadBackoff overrides the retry strategy of read requests
+	ReadBackoff *OpenstackBackoff `json:"readBackoff,omitempty"`
+	// WriteBackoff overrides the retry strategy of write requests
+	WriteBackoff *OpenstackBackoff `json:"writeBackoff,omitempty"`
+	// ComputeMicroversion is the Nova API microversion requested, e.g. 2.15 for soft-anti-affinity server groups.
+	// It is ignored when the cloud does not support it.
+	ComputeMicroversion *string `json:"computeMicroversion,omitempty"`
+	// BlockStorageMicroversion is the Cinder API microversion requested, e.g. 3.50 for multiattach volumes.
+	// It is ignored when the cloud does not support it.
+	BlockStorageMicroversion *string `json:"blockStorageMicroversion,omitempty"`
+	// ServerConcurrency is the number of servers fetched at once when listing the instances of the cluster,
+	// 10 if not set. Clouds which rate limit the compute API may need a lower value.
+	ServerConcurrency *int `json:"serverConcurrency,omitempty"`
 }
 
 // CloudConfiguration defines the cloud provider configuration
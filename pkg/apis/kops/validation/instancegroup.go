@@ -51,6 +51,14 @@ func ValidateInstanceGroup(g *kops.InstanceGroup) error {
 		}
 	}
 
+	if g.Spec.ServerGroupPolicy != nil {
+		switch fi.StringValue(g.Spec.ServerGroupPolicy) {
+		case "anti-affinity", "soft-anti-affinity", "affinity", "soft-affinity":
+		default:
+			return field.Invalid(field.NewPath("ServerGroupPolicy"), fi.StringValue(g.Spec.ServerGroupPolicy), "Unknown server group policy. Must be anti-affinity, soft-anti-affinity, affinity or soft-affinity.")
+		}
+	}
+
 	if g.Spec.MaxSize != nil && g.Spec.MinSize != nil {
 		if *g.Spec.MaxSize < *g.Spec.MinSize {
 			return field.Invalid(field.NewPath("MaxSize"), *g.Spec.MaxSize, "maxSize must be greater than or equal to minSize.")
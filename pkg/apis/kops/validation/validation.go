@@ -102,6 +102,10 @@ func validateClusterSpec(spec *kops.ClusterSpec, fieldPath *field.Path) field.Er
 		}
 	}
 
+	if spec.ExternalDNS != nil && spec.ExternalDNS.TTL != nil && *spec.ExternalDNS.TTL < 1 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("externalDNS", "ttl"), *spec.ExternalDNS.TTL, "must be at least 1 second"))
+	}
+
 	// IAM additionalPolicies
 	if spec.AdditionalPolicies != nil {
 		for k, v := range *spec.AdditionalPolicies {
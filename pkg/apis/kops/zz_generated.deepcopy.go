@@ -1277,6 +1277,11 @@ func (in *ExternalDNSConfig) DeepCopyInto(out *ExternalDNSConfig) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(int32)
+		**out = **in
+	}
 	return
 }
 
@@ -1652,6 +1657,23 @@ func (in *InstanceGroupSpec) DeepCopyInto(out *InstanceGroupSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ServerGroupPolicy != nil {
+		in, out := &in.ServerGroupPolicy, &out.ServerGroupPolicy
+		*out = new(string)
+		**out = **in
+	}
+	if in.SchedulerHints != nil {
+		in, out := &in.SchedulerHints, &out.SchedulerHints
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConfigDrive != nil {
+		in, out := &in.ConfigDrive, &out.ConfigDrive
+		*out = new(bool)
+		**out = **in
+	}
 	return
 }
 
@@ -2939,6 +2961,42 @@ func (in *NoopStatusStore) DeepCopy() *NoopStatusStore {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OpenstackBackoff) DeepCopyInto(out *OpenstackBackoff) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(string)
+		**out = **in
+	}
+	if in.Factor != nil {
+		in, out := &in.Factor, &out.Factor
+		*out = new(string)
+		**out = **in
+	}
+	if in.Jitter != nil {
+		in, out := &in.Jitter, &out.Jitter
+		*out = new(string)
+		**out = **in
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = new(int)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenstackBackoff.
+func (in *OpenstackBackoff) DeepCopy() *OpenstackBackoff {
+	if in == nil {
+		return nil
+	}
+	out := new(OpenstackBackoff)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenstackBlockStorageConfig) DeepCopyInto(out *OpenstackBlockStorageConfig) {
 	*out = *in
@@ -2957,6 +3015,26 @@ func (in *OpenstackBlockStorageConfig) DeepCopyInto(out *OpenstackBlockStorageCo
 		*out = new(string)
 		**out = **in
 	}
+	if in.EtcdVolumeSize != nil {
+		in, out := &in.EtcdVolumeSize, &out.EtcdVolumeSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.EtcdVolumeType != nil {
+		in, out := &in.EtcdVolumeType, &out.EtcdVolumeType
+		*out = new(string)
+		**out = **in
+	}
+	if in.BootFromVolume != nil {
+		in, out := &in.BootFromVolume, &out.BootFromVolume
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BootVolumeDeleteOnTermination != nil {
+		in, out := &in.BootVolumeDeleteOnTermination, &out.BootVolumeDeleteOnTermination
+		*out = new(bool)
+		**out = **in
+	}
 	return
 }
 
@@ -2993,6 +3071,41 @@ func (in *OpenstackConfiguration) DeepCopyInto(out *OpenstackConfiguration) {
 		*out = new(OpenstackBlockStorageConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Metadata != nil {
+		in, out := &in.Metadata, &out.Metadata
+		*out = new(OpenstackMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Trunk != nil {
+		in, out := &in.Trunk, &out.Trunk
+		*out = new(OpenstackTrunk)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadBackoff != nil {
+		in, out := &in.ReadBackoff, &out.ReadBackoff
+		*out = new(OpenstackBackoff)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WriteBackoff != nil {
+		in, out := &in.WriteBackoff, &out.WriteBackoff
+		*out = new(OpenstackBackoff)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ComputeMicroversion != nil {
+		in, out := &in.ComputeMicroversion, &out.ComputeMicroversion
+		*out = new(string)
+		**out = **in
+	}
+	if in.BlockStorageMicroversion != nil {
+		in, out := &in.BlockStorageMicroversion, &out.BlockStorageMicroversion
+		*out = new(string)
+		**out = **in
+	}
+	if in.ServerConcurrency != nil {
+		in, out := &in.ServerConcurrency, &out.ServerConcurrency
+		*out = new(int)
+		**out = **in
+	}
 	return
 }
 
@@ -3049,6 +3162,11 @@ func (in *OpenstackLoadbalancerConfig) DeepCopyInto(out *OpenstackLoadbalancerCo
 		*out = new(bool)
 		**out = **in
 	}
+	if in.AvailabilityZone != nil {
+		in, out := &in.AvailabilityZone, &out.AvailabilityZone
+		*out = new(string)
+		**out = **in
+	}
 	return
 }
 
@@ -3062,6 +3180,32 @@ func (in *OpenstackLoadbalancerConfig) DeepCopy() *OpenstackLoadbalancerConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OpenstackMetadata) DeepCopyInto(out *OpenstackMetadata) {
+	*out = *in
+	if in.ConfigDrive != nil {
+		in, out := &in.ConfigDrive, &out.ConfigDrive
+		*out = new(bool)
+		**out = **in
+	}
+	if in.InjectRoute != nil {
+		in, out := &in.InjectRoute, &out.InjectRoute
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenstackMetadata.
+func (in *OpenstackMetadata) DeepCopy() *OpenstackMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(OpenstackMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpenstackMonitor) DeepCopyInto(out *OpenstackMonitor) {
 	*out = *in
@@ -3080,6 +3224,11 @@ func (in *OpenstackMonitor) DeepCopyInto(out *OpenstackMonitor) {
 		*out = new(int)
 		**out = **in
 	}
+	if in.Type != nil {
+		in, out := &in.Type, &out.Type
+		*out = new(string)
+		**out = **in
+	}
 	return
 }
 
@@ -3111,6 +3260,16 @@ func (in *OpenstackRouter) DeepCopyInto(out *OpenstackRouter) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.IPv6AddressMode != nil {
+		in, out := &in.IPv6AddressMode, &out.IPv6AddressMode
+		*out = new(string)
+		**out = **in
+	}
+	if in.IPv6RAMode != nil {
+		in, out := &in.IPv6RAMode, &out.IPv6RAMode
+		*out = new(string)
+		**out = **in
+	}
 	return
 }
 
@@ -3124,6 +3283,48 @@ func (in *OpenstackRouter) DeepCopy() *OpenstackRouter {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OpenstackTrunk) DeepCopyInto(out *OpenstackTrunk) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SubPorts != nil {
+		in, out := &in.SubPorts, &out.SubPorts
+		*out = make([]OpenstackTrunkSubPort, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenstackTrunk.
+func (in *OpenstackTrunk) DeepCopy() *OpenstackTrunk {
+	if in == nil {
+		return nil
+	}
+	out := new(OpenstackTrunk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OpenstackTrunkSubPort) DeepCopyInto(out *OpenstackTrunkSubPort) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenstackTrunkSubPort.
+func (in *OpenstackTrunkSubPort) DeepCopy() *OpenstackTrunkSubPort {
+	if in == nil {
+		return nil
+	}
+	out := new(OpenstackTrunkSubPort)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RBACAuthorizationSpec) DeepCopyInto(out *RBACAuthorizationSpec) {
 	*out = *in
@@ -48,6 +48,8 @@ type CloudInstanceGroupMember struct {
 	Node *v1.Node
 	// CloudInstanceGroup is the managing CloudInstanceGroup
 	CloudInstanceGroup *CloudInstanceGroup
+	// Stopped is set if the cloud reports the instance as powered off, although it is expected to be running
+	Stopped bool
 }
 
 // NewCloudInstanceGroupMember creates a new CloudInstanceGroupMember
@@ -80,6 +80,9 @@ func (b *BootstrapScript) buildEnvironmentVariables(cluster *kops.Cluster) (map[
 			"OS_DOMAIN_NAME", "OS_DOMAIN_ID",
 			"OS_USERNAME",
 			"OS_PASSWORD",
+			"OS_APPLICATION_CREDENTIAL_ID",
+			"OS_APPLICATION_CREDENTIAL_NAME",
+			"OS_APPLICATION_CREDENTIAL_SECRET",
 			"OS_AUTH_URL",
 			"OS_REGION_NAME",
 		} {
@@ -247,7 +247,9 @@ func (b *MasterVolumeBuilder) addVSphereVolume(c *fi.ModelBuilderContext, name s
 
 func (b *MasterVolumeBuilder) addOpenstackVolume(c *fi.ModelBuilderContext, name string, volumeSize int32, zone string, etcd *kops.EtcdClusterSpec, m *kops.EtcdMemberSpec, allMembers []string) error {
 	volumeType := fi.StringValue(m.VolumeType)
-	if volumeType == "" {
+	blockStorage := b.Cluster.Spec.CloudConfig.Openstack.BlockStorage
+	encrypted := fi.BoolValue(m.EncryptedVolume)
+	if volumeType == "" && !encrypted && (blockStorage == nil || blockStorage.EtcdVolumeType == nil) {
 		return fmt.Errorf("must set ETCDMemberSpec.VolumeType on Openstack platform")
 	}
 
@@ -263,16 +265,26 @@ func (b *MasterVolumeBuilder) addOpenstackVolume(c *fi.ModelBuilderContext, name
 	tags[openstack.TagNameRolePrefix+"master"] = "1"
 
 	// override zone
-	if b.Cluster.Spec.CloudConfig.Openstack.BlockStorage != nil && b.Cluster.Spec.CloudConfig.Openstack.BlockStorage.OverrideAZ != nil {
-		zone = fi.StringValue(b.Cluster.Spec.CloudConfig.Openstack.BlockStorage.OverrideAZ)
+	if blockStorage != nil && blockStorage.OverrideAZ != nil {
+		zone = fi.StringValue(blockStorage.OverrideAZ)
 	}
 	t := &openstacktasks.Volume{
 		Name:             s(name),
 		AvailabilityZone: s(zone),
-		VolumeType:       s(volumeType),
 		SizeGB:           fi.Int64(int64(volumeSize)),
 		Tags:             tags,
 		Lifecycle:        b.Lifecycle,
+		Encrypted:        m.EncryptedVolume,
+	}
+	// without a volume type, an encrypted volume gets the first encrypted volume type of the cloud
+	if volumeType != "" {
+		t.VolumeType = s(volumeType)
+	}
+	if blockStorage != nil {
+		if blockStorage.EtcdVolumeSize != nil {
+			t.EtcdVolumeSize = fi.Int64(int64(fi.Int32Value(blockStorage.EtcdVolumeSize)))
+		}
+		t.EtcdVolumeType = blockStorage.EtcdVolumeType
 	}
 	c.AddTask(t)
 
@@ -17,8 +17,10 @@ limitations under the License.
 package openstackmodel
 
 import (
+	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/model"
 	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
 )
 
@@ -26,6 +28,37 @@ type OpenstackModelContext struct {
 	*model.KopsModelContext
 }
 
+// ClusterTags returns the Neutron tags of the networking resources of the cluster, which keep apart
+// the resources of clusters sharing a project
+func (c *OpenstackModelContext) ClusterTags() []string {
+	return []string{openstack.ClusterTag(c.ClusterName())}
+}
+
+// configDrive returns whether the instances of the instance group read their metadata from a config drive,
+// the setting of the instance group overrides the one of the cluster
+func (c *OpenstackModelContext) configDrive(ig *kops.InstanceGroup) *bool {
+	if ig.Spec.ConfigDrive != nil {
+		return ig.Spec.ConfigDrive
+	}
+	if c.Cluster.Spec.CloudConfig != nil && c.Cluster.Spec.CloudConfig.Openstack != nil && c.Cluster.Spec.CloudConfig.Openstack.Metadata != nil {
+		return c.Cluster.Spec.CloudConfig.Openstack.Metadata.ConfigDrive
+	}
+	return nil
+}
+
+// usesMetadataService returns true if an instance group placed in the subnet reads its metadata from the
+// metadata service instead of a config drive
+func (c *OpenstackModelContext) usesMetadataService(subnet string) bool {
+	for _, ig := range c.InstanceGroups {
+		for _, name := range ig.Spec.Subnets {
+			if name == subnet && !fi.BoolValue(c.configDrive(ig)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *OpenstackModelContext) LinkToNetwork() *openstacktasks.Network {
 	return &openstacktasks.Network{Name: s(c.ClusterName())}
 }
@@ -445,6 +445,7 @@ func (b *FirewallModelBuilder) Build(c *fi.ModelBuilderContext) error {
 	if b.UseLoadBalancerForAPI() {
 		sg := &openstacktasks.SecurityGroup{
 			Name:      s(b.Cluster.Spec.MasterPublicName),
+			Tags:      b.ClusterTags(),
 			Lifecycle: b.Lifecycle,
 		}
 		c.AddTask(sg)
@@ -456,6 +457,7 @@ func (b *FirewallModelBuilder) Build(c *fi.ModelBuilderContext) error {
 		groupName := b.SecurityGroupName(role)
 		sg := &openstacktasks.SecurityGroup{
 			Name:      s(groupName),
+			Tags:      b.ClusterTags(),
 			Lifecycle: b.Lifecycle,
 		}
 		c.AddTask(sg)
@@ -17,12 +17,22 @@ limitations under the License.
 package openstackmodel
 
 import (
+	"net"
 	"strings"
 
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
 )
 
+// ipv6SLAAC is the default address and router advertisement mode of IPv6 subnets
+const ipv6SLAAC = "slaac"
+
+// isIPv6CIDR returns true if the CIDR is an IPv6 network
+func isIPv6CIDR(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
+
 // NetworkModelBuilder configures network objects
 type NetworkModelBuilder struct {
 	*OpenstackModelContext
@@ -41,6 +51,10 @@ func (b *NetworkModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			ID:        s(b.Cluster.Spec.NetworkID),
 			Lifecycle: b.Lifecycle,
 		}
+		if b.Cluster.Spec.NetworkID == "" {
+			// existing networks are not tagged
+			t.Tags = b.ClusterTags()
+		}
 
 		c.AddTask(t)
 	}
@@ -48,28 +62,50 @@ func (b *NetworkModelBuilder) Build(c *fi.ModelBuilderContext) error {
 	{
 		t := &openstacktasks.Router{
 			Name:      s(routerName),
+			Tags:      b.ClusterTags(),
 			Lifecycle: b.Lifecycle,
 		}
 
 		c.AddTask(t)
 	}
 
+	// the router settings are optional, clusters without them use the defaults of the cloud
+	router := b.Cluster.Spec.CloudConfig.Openstack.Router
 	for _, sp := range b.Cluster.Spec.Subnets {
 		subnetName := sp.Name + "." + b.ClusterName()
 		t := &openstacktasks.Subnet{
 			Name:      s(subnetName),
 			Network:   b.LinkToNetwork(),
 			CIDR:      s(sp.CIDR),
+			Tags:      b.ClusterTags(),
 			Lifecycle: b.Lifecycle,
+
+			CheckMetadataService: fi.Bool(b.usesMetadataService(sp.Name)),
 		}
-		if b.Cluster.Spec.CloudConfig.Openstack.Router.DNSServers != nil {
-			dnsSplitted := strings.Split(fi.StringValue(b.Cluster.Spec.CloudConfig.Openstack.Router.DNSServers), ",")
+		if router != nil && router.DNSServers != nil {
+			dnsSplitted := strings.Split(fi.StringValue(router.DNSServers), ",")
 			dnsNameSrv := make([]*string, len(dnsSplitted))
 			for i, ns := range dnsSplitted {
 				dnsNameSrv[i] = fi.String(ns)
 			}
 			t.DNSServers = dnsNameSrv
 		}
+		if metadata := b.Cluster.Spec.CloudConfig.Openstack.Metadata; metadata != nil {
+			t.MetadataRoute = metadata.InjectRoute
+		}
+		if isIPv6CIDR(sp.CIDR) {
+			t.IPVersion = fi.Int(6)
+			t.IPv6AddressMode = s(ipv6SLAAC)
+			t.IPv6RAMode = s(ipv6SLAAC)
+			if router != nil {
+				if router.IPv6AddressMode != nil {
+					t.IPv6AddressMode = router.IPv6AddressMode
+				}
+				if router.IPv6RAMode != nil {
+					t.IPv6RAMode = router.IPv6RAMode
+				}
+			}
+		}
 		c.AddTask(t)
 
 		t1 := &openstacktasks.RouterInterface{
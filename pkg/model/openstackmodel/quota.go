@@ -0,0 +1,205 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstackmodel
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	l3floatingip "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/model"
+	"k8s.io/kops/pkg/model/defaults"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// CheckQuota checks that the quotas of the project leave room for the resources the cluster still needs,
+// so that an apply fails before creating anything instead of deep into the creation of the cluster
+func (c *OpenstackModelContext) CheckQuota(cloud openstack.OpenstackCloud) error {
+	planned, err := c.PlannedResources(cloud)
+	if err != nil {
+		return err
+	}
+	used := c.UsedResources(cloud)
+	return openstack.CheckQuota(cloud, planned.Subtract(used))
+}
+
+// PlannedResources returns the resources limited by quotas which the model creates for the cluster
+func (c *OpenstackModelContext) PlannedResources(cloud openstack.OpenstackCloud) (*openstack.ResourceRequest, error) {
+	planned := &openstack.ResourceRequest{}
+	blockStorage := c.blockStorage()
+
+	flavorList, err := cloud.ListFlavors(flavors.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	for _, ig := range c.InstanceGroups {
+		count := int(fi.Int32Value(ig.Spec.MinSize))
+		if count == 0 {
+			continue
+		}
+		flavor, err := openstack.FindFlavor(flavorList, ig.Spec.MachineType)
+		if err != nil {
+			return nil, fmt.Errorf("error finding flavor of instance group %s: %v", ig.Name, err)
+		}
+		planned.Instances += count
+		planned.Cores += count * flavor.VCPUs
+		planned.RAM += count * flavor.RAM
+
+		if blockStorage != nil && fi.BoolValue(blockStorage.BootFromVolume) {
+			size := fi.Int32Value(ig.Spec.RootVolumeSize)
+			if size == 0 {
+				size, err = defaults.DefaultInstanceGroupVolumeSize(ig.Spec.Role)
+				if err != nil {
+					return nil, err
+				}
+			}
+			planned.Volumes += count
+			planned.VolumeGigabytes += count * int(size)
+		}
+
+		// the floating IPs match those of the server group model
+		switch ig.Spec.Role {
+		case kops.InstanceGroupRoleBastion:
+			planned.FloatingIPs += count
+		case kops.InstanceGroupRoleMaster:
+			if !c.UseLoadBalancerForAPI() {
+				planned.FloatingIPs += count
+			}
+		default:
+			if !c.UsesSSHBastion() {
+				planned.FloatingIPs += count
+			}
+		}
+	}
+	if c.UseLoadBalancerForAPI() {
+		planned.FloatingIPs++
+	}
+
+	for _, etcd := range c.Cluster.Spec.EtcdClusters {
+		for _, m := range etcd.Members {
+			size := int(fi.Int32Value(m.VolumeSize))
+			if size == 0 {
+				size = model.DefaultEtcdVolumeSize
+			}
+			if blockStorage != nil && blockStorage.EtcdVolumeSize != nil {
+				size = int(fi.Int32Value(blockStorage.EtcdVolumeSize))
+			}
+			planned.Volumes++
+			planned.VolumeGigabytes += size
+		}
+	}
+	return planned, nil
+}
+
+// UsedResources returns the resources limited by quotas which the cluster already uses, they are part of the
+// usage of the project and do not need to be created again. Resources which cannot be listed are not counted,
+// which can only make the check stricter, so the failures are reported as warnings.
+func (c *OpenstackModelContext) UsedResources(cloud openstack.OpenstackCloud) *openstack.ResourceRequest {
+	used := &openstack.ResourceRequest{}
+
+	instances, err := cloud.ListClusterInstances(c.ClusterName())
+	if err != nil {
+		glog.Warningf("error listing instances of the cluster, their usage is not counted: %v", err)
+		return used
+	}
+	if len(instances) == 0 {
+		// the cluster is being created
+		return used
+	}
+
+	flavorList, err := cloud.ListFlavors(flavors.ListOpts{})
+	if err != nil {
+		glog.Warningf("error listing flavors, the cores and RAM of the instances are not counted: %v", err)
+	}
+	clusterInstances := make(map[string]bool)
+	addresses := make(map[string]bool)
+	for _, instance := range instances {
+		clusterInstances[instance.ID] = true
+		used.Instances++
+		if id, ok := instance.Flavor["id"].(string); ok && flavorList != nil {
+			if flavor, err := openstack.FindFlavor(flavorList, id); err == nil {
+				used.Cores += flavor.VCPUs
+				used.RAM += flavor.RAM
+			}
+		}
+		for addr := range openstack.ServerAddresses(&instance) {
+			addresses[addr] = true
+		}
+	}
+
+	err = cloud.EachVolume(cinder.ListOpts{}, func(volume cinder.Volume) error {
+		attached := false
+		for _, attachment := range volume.Attachments {
+			attached = attached || clusterInstances[attachment.ServerID]
+		}
+		if attached || volume.Metadata[openstack.TagClusterName] == c.ClusterName() {
+			used.Volumes++
+			used.VolumeGigabytes += volume.Size
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("error listing volumes, their usage is not counted: %v", err)
+	}
+
+	lbPorts := make(map[string]bool)
+	if c.UseLoadBalancerForAPI() {
+		lbs, err := cloud.ListLBs(loadbalancers.ListOpts{Name: c.Cluster.Spec.MasterPublicName})
+		if err != nil {
+			glog.Warningf("error listing loadbalancers, the floating IP of the API is not counted: %v", err)
+		}
+		for _, lb := range lbs {
+			lbPorts[lb.VipPortID] = true
+		}
+	}
+
+	// The floating IPs are listed from neutron, the nova API does not list them from microversion 2.36 on.
+	// Besides those tagged with the cluster, floating IPs created before kops tagged them are found by the
+	// address of the instance or loadbalancer they are associated with.
+	fips, err := cloud.ListL3FloatingIPs(l3floatingip.ListOpts{})
+	if err != nil {
+		glog.Warningf("error listing floating IPs, their usage is not counted: %v", err)
+	}
+	clusterTag := openstack.ClusterTag(c.ClusterName())
+	for _, fip := range fips {
+		if addresses[fip.FloatingIP] || lbPorts[fip.PortID] {
+			used.FloatingIPs++
+			continue
+		}
+		for _, tag := range fip.Tags {
+			if tag == clusterTag {
+				used.FloatingIPs++
+				break
+			}
+		}
+	}
+
+	return used
+}
+
+// blockStorage returns the block storage configuration of the cluster, nil if there is none
+func (c *OpenstackModelContext) blockStorage() *kops.OpenstackBlockStorageConfig {
+	if c.Cluster.Spec.CloudConfig == nil || c.Cluster.Spec.CloudConfig.Openstack == nil {
+		return nil
+	}
+	return c.Cluster.Spec.CloudConfig.Openstack.BlockStorage
+}
@@ -19,11 +19,15 @@ package openstackmodel
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/dns"
 	"k8s.io/kops/pkg/model"
+	"k8s.io/kops/pkg/model/defaults"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
@@ -39,6 +43,21 @@ type ServerGroupModelBuilder struct {
 
 var _ fi.ModelBuilder = &ServerGroupModelBuilder{}
 
+// CheckFlavors checks that the machine types of the instance groups are flavors of the cloud, so an unknown
+// flavor fails the apply before the ports of the instances are created
+func (c *OpenstackModelContext) CheckFlavors(cloud openstack.OpenstackCloud) error {
+	flavorList, err := cloud.ListFlavors(flavors.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("error listing flavors: %v", err)
+	}
+	for _, ig := range c.InstanceGroups {
+		if _, err := openstack.FindFlavor(flavorList, ig.Spec.MachineType); err != nil {
+			return fmt.Errorf("invalid machine type of instance group %s: %v", ig.Name, err)
+		}
+	}
+	return nil
+}
+
 func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *openstacktasks.ServerGroup, ig *kops.InstanceGroup) error {
 
 	sshKeyNameFull, err := b.SSHKeyName()
@@ -48,7 +67,7 @@ func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *
 
 	sshKeyName := strings.Replace(sshKeyNameFull, ":", "_", -1)
 
-	clusterTag := "KubernetesCluster:" + strings.Replace(b.ClusterName(), ".", "-", -1)
+	clusterTag := openstack.ClusterTag(b.ClusterName())
 
 	var igUserData *string
 	igMeta := make(map[string]string)
@@ -58,7 +77,9 @@ func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *
 
 		igMeta[openstack.TagClusterName] = b.ClusterName()
 	}
-	igMeta["k8s"] = b.ClusterName()
+	igMeta[openstack.TagServerClusterName] = b.ClusterName()
+	igMeta[openstack.TagKopsInstanceGroup] = ig.Name
+	igMeta[openstack.TagNameRolePrefix+strings.ToLower(string(ig.Spec.Role))] = "1"
 
 	startupScript, err := b.BootstrapScript.ResourceNodeUp(ig, b.Cluster)
 	if err != nil {
@@ -86,23 +107,22 @@ func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *
 
 		securityGroupName := b.SecurityGroupName(ig.Spec.Role)
 		securityGroup := b.LinkToSecurityGroup(securityGroupName)
-		var az *string
-		if len(ig.Spec.Subnets) > 0 {
-			// bastion subnet name is not actual zone name, it contains "utility-" prefix
-			if ig.Spec.Role == kops.InstanceGroupRoleBastion {
-				az = fi.String(strings.Replace(ig.Spec.Subnets[int(i)%len(ig.Spec.Subnets)], "utility-", "", 1))
-			} else {
-				az = fi.String(ig.Spec.Subnets[int(i)%len(ig.Spec.Subnets)])
-			}
-		}
+		az := b.instanceZone(ig, int(i))
 		// Create instance port task
 		portTask := &openstacktasks.Port{
-			Name:           fi.String(fmt.Sprintf("%s-%s", "port", *instanceName)),
-			Network:        b.LinkToNetwork(),
-			SecurityGroups: append([]*openstacktasks.SecurityGroup{}, securityGroup),
-			Lifecycle:      b.Lifecycle,
+			Name:                     fi.String(fmt.Sprintf("%s-%s", "port", *instanceName)),
+			Network:                  b.LinkToNetwork(),
+			SecurityGroups:           append([]*openstacktasks.SecurityGroup{}, securityGroup),
+			Subnets:                  b.dualStackSubnets(ig, az),
+			AllowedAddressPairs:      b.podAddressPairs(),
+			AdditionalSecurityGroups: ig.Spec.AdditionalSecurityGroups,
+			Tags:                     b.ClusterTags(),
+			Lifecycle:                b.Lifecycle,
 		}
 		c.AddTask(portTask)
+		if trunkTask := b.buildTrunk(portTask, fi.StringValue(instanceName)); trunkTask != nil {
+			c.AddTask(trunkTask)
+		}
 
 		instanceTask := &openstacktasks.Instance{
 			Name:             instanceName,
@@ -116,10 +136,18 @@ func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *
 			Port:             portTask,
 			Metadata:         igMeta,
 			AvailabilityZone: az,
+			Status:           fi.String(openstack.InstanceStatusActive),
+			Description:      fi.String(fmt.Sprintf("kops %s instance of instance group %s in cluster %s", strings.ToLower(string(ig.Spec.Role)), ig.Name, b.ClusterName())),
 		}
 		if igUserData != nil {
 			instanceTask.UserData = igUserData
 		}
+		instanceTask.ConfigDrive = b.configDrive(ig)
+		instanceTask.AdditionalSecurityGroups = ig.Spec.AdditionalSecurityGroups
+		instanceTask.SchedulerHints = ig.Spec.SchedulerHints
+		if err := b.configureBootVolume(instanceTask, ig); err != nil {
+			return err
+		}
 		c.AddTask(instanceTask)
 
 		// Associate a floating IP to the master and bastion always, associate it to a node if bastion is not used
@@ -155,6 +183,109 @@ func (b *ServerGroupModelBuilder) buildInstances(c *fi.ModelBuilderContext, sg *
 	return nil
 }
 
+// buildTrunk returns the trunk on the port of the instance, or nil if the cluster does not use trunks
+func (b *ServerGroupModelBuilder) buildTrunk(port *openstacktasks.Port, instanceName string) *openstacktasks.Trunk {
+	if b.Cluster.Spec.CloudConfig == nil || b.Cluster.Spec.CloudConfig.Openstack == nil {
+		return nil
+	}
+	trunk := b.Cluster.Spec.CloudConfig.Openstack.Trunk
+	if trunk == nil || !fi.BoolValue(trunk.Enabled) {
+		return nil
+	}
+	t := &openstacktasks.Trunk{
+		Name:      fi.String(fmt.Sprintf("%s-%s", "trunk", instanceName)),
+		Port:      port,
+		Lifecycle: b.Lifecycle,
+	}
+	for _, sp := range trunk.SubPorts {
+		t.SubPorts = append(t.SubPorts, &openstacktasks.TrunkSubPort{
+			Network:        fi.String(sp.Network),
+			SegmentationID: fi.Int(sp.SegmentationID),
+		})
+	}
+	return t
+}
+
+// configureBootVolume makes the instance boot from a volume when the cluster requests it, the volume is sized
+// and typed by the root volume of the instance group
+func (b *ServerGroupModelBuilder) configureBootVolume(instance *openstacktasks.Instance, ig *kops.InstanceGroup) error {
+	if b.Cluster.Spec.CloudConfig == nil || b.Cluster.Spec.CloudConfig.Openstack == nil || b.Cluster.Spec.CloudConfig.Openstack.BlockStorage == nil {
+		return nil
+	}
+	blockStorage := b.Cluster.Spec.CloudConfig.Openstack.BlockStorage
+	if !fi.BoolValue(blockStorage.BootFromVolume) {
+		return nil
+	}
+
+	size := fi.Int32Value(ig.Spec.RootVolumeSize)
+	if size == 0 {
+		var err error
+		size, err = defaults.DefaultInstanceGroupVolumeSize(ig.Spec.Role)
+		if err != nil {
+			return err
+		}
+	}
+	instance.BootVolumeSize = fi.Int(int(size))
+	instance.BootVolumeType = ig.Spec.RootVolumeType
+	instance.BootVolumeDeleteOnTermination = fi.Bool(true)
+	if blockStorage.BootVolumeDeleteOnTermination != nil {
+		instance.BootVolumeDeleteOnTermination = blockStorage.BootVolumeDeleteOnTermination
+	}
+	return nil
+}
+
+// instanceZone returns the availability zone of the i-th instance of the instance group.
+// The instances are spread round-robin over the zones of the subnets of the instance group,
+// so an instance group with a single subnet keeps all its instances in one zone.
+func (b *ServerGroupModelBuilder) instanceZone(ig *kops.InstanceGroup, i int) *string {
+	if len(ig.Spec.Subnets) == 0 {
+		return nil
+	}
+	subnetName := ig.Spec.Subnets[i%len(ig.Spec.Subnets)]
+	for _, subnet := range b.Cluster.Spec.Subnets {
+		if subnet.Name == subnetName && subnet.Zone != "" {
+			return fi.String(subnet.Zone)
+		}
+	}
+	// bastion subnet name is not actual zone name, it contains "utility-" prefix
+	return fi.String(strings.TrimPrefix(subnetName, "utility-"))
+}
+
+// dualStackSubnets returns the subnets of the instance group in the zone when one of them is an IPv6 subnet,
+// so the ports of dual-stack instances get both an IPv4 and an IPv6 fixed IP.
+// Ports of IPv4 only instance groups are not pinned to a subnet.
+func (b *ServerGroupModelBuilder) dualStackSubnets(ig *kops.InstanceGroup, zone *string) []*openstacktasks.Subnet {
+	var links []*openstacktasks.Subnet
+	dualStack := false
+	for _, name := range ig.Spec.Subnets {
+		for _, subnet := range b.Cluster.Spec.Subnets {
+			if subnet.Name != name || (subnet.Zone != "" && subnet.Zone != fi.StringValue(zone)) {
+				continue
+			}
+			if isIPv6CIDR(subnet.CIDR) {
+				dualStack = true
+			}
+			links = append(links, b.LinkToSubnet(s(subnet.Name+"."+b.ClusterName())))
+		}
+	}
+	if !dualStack {
+		return nil
+	}
+	return links
+}
+
+// podAddressPairs returns the allowed address pairs for the pod network when kube-router is used,
+// kube-router routes the pod traffic between the instances without encapsulation
+func (b *ServerGroupModelBuilder) podAddressPairs() []ports.AddressPair {
+	if b.Cluster.Spec.Networking == nil || b.Cluster.Spec.Networking.Kuberouter == nil {
+		return nil
+	}
+	if b.Cluster.Spec.KubeControllerManager == nil || b.Cluster.Spec.KubeControllerManager.ClusterCIDR == "" {
+		return nil
+	}
+	return []ports.AddressPair{{IPAddress: b.Cluster.Spec.KubeControllerManager.ClusterCIDR}}
+}
+
 func (b *ServerGroupModelBuilder) Build(c *fi.ModelBuilderContext) error {
 	clusterName := b.ClusterName()
 
@@ -165,7 +296,7 @@ func (b *ServerGroupModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Name:        s(fmt.Sprintf("%s-%s", clusterName, ig.Name)),
 			ClusterName: s(clusterName),
 			IGName:      s(ig.Name),
-			Policies:    []string{"anti-affinity"},
+			Policies:    []string{fi.StringValue(serverGroupPolicy(ig))},
 			Lifecycle:   b.Lifecycle,
 			MaxSize:     ig.Spec.MaxSize,
 		}
@@ -189,6 +320,18 @@ func (b *ServerGroupModelBuilder) Build(c *fi.ModelBuilderContext) error {
 			Lifecycle:     b.Lifecycle,
 			SecurityGroup: b.LinkToSecurityGroup(b.Cluster.Spec.MasterPublicName),
 		}
+		useOctavia := b.Cluster.Spec.CloudConfig != nil &&
+			b.Cluster.Spec.CloudConfig.Openstack != nil &&
+			b.Cluster.Spec.CloudConfig.Openstack.Loadbalancer != nil &&
+			fi.BoolValue(b.Cluster.Spec.CloudConfig.Openstack.Loadbalancer.UseOctavia)
+		if useOctavia {
+			lbTask.Provider = b.Cluster.Spec.CloudConfig.Openstack.Loadbalancer.Provider
+			lbTask.Tags = openstack.LBTags(b.ClusterName(), openstack.LBRoleAPI)
+		}
+		if b.Cluster.Spec.CloudConfig != nil && b.Cluster.Spec.CloudConfig.Openstack != nil && b.Cluster.Spec.CloudConfig.Openstack.Loadbalancer != nil {
+			// the loadbalancer task reports availability zones on clouds without Octavia
+			lbTask.AvailabilityZone = b.Cluster.Spec.CloudConfig.Openstack.Loadbalancer.AvailabilityZone
+		}
 		c.AddTask(lbTask)
 
 		lbfipTask := &openstacktasks.FloatingIP{
@@ -217,11 +360,26 @@ func (b *ServerGroupModelBuilder) Build(c *fi.ModelBuilderContext) error {
 		}
 		c.AddTask(poolTask)
 
+		monitorTask, err := b.buildPoolMonitor(poolTask)
+		if err != nil {
+			return err
+		}
+		if monitorTask != nil {
+			c.AddTask(monitorTask)
+		}
+
 		listenerTask := &openstacktasks.LBListener{
 			Name:      lbTask.Name,
 			Lifecycle: b.Lifecycle,
 			Pool:      poolTask,
 		}
+		if useOctavia {
+			allowedCIDRs, err := b.apiAllowedCIDRs()
+			if err != nil {
+				return err
+			}
+			listenerTask.AllowedCIDRs = allowedCIDRs
+		}
 		c.AddTask(listenerTask)
 
 		for _, mastersg := range masters {
@@ -241,3 +399,96 @@ func (b *ServerGroupModelBuilder) Build(c *fi.ModelBuilderContext) error {
 
 	return nil
 }
+
+// apiAllowedCIDRs returns the sources allowed to reach the API loadbalancer, nil when the API is open to all sources.
+// The cluster network is always allowed, as the nodes reach the API through the loadbalancer.
+func (b *ServerGroupModelBuilder) apiAllowedCIDRs() ([]string, error) {
+	var cidrs []string
+	for _, cidr := range b.Cluster.Spec.KubernetesAPIAccess {
+		if cidr == "0.0.0.0/0" {
+			return nil, nil
+		}
+		if strings.Contains(cidr, ":") {
+			// the VIP of the loadbalancer is IPv4, like the security group rules of the API
+			glog.Warningf("ignoring IPv6 range %s of kubernetesApiAccess, the API loadbalancer only accepts IPv4 sources", cidr)
+			continue
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	if len(cidrs) == 0 {
+		if len(b.Cluster.Spec.KubernetesAPIAccess) > 0 {
+			// opening the API to all sources would be the opposite of what the IPv6 ranges ask for
+			return nil, fmt.Errorf("kubernetesApiAccess must contain an IPv4 range, the API loadbalancer only accepts IPv4 sources")
+		}
+		return nil, nil
+	}
+	if b.Cluster.Spec.NetworkCIDR != "" {
+		cidrs = append(cidrs, b.Cluster.Spec.NetworkCIDR)
+	}
+	return cidrs, nil
+}
+
+// buildPoolMonitor returns the health monitor of the API pool, configured from the openstack monitor settings
+func (b *ServerGroupModelBuilder) buildPoolMonitor(pool *openstacktasks.LBPool) (*openstacktasks.PoolMonitor, error) {
+	if b.Cluster.Spec.CloudConfig == nil ||
+		b.Cluster.Spec.CloudConfig.Openstack == nil ||
+		b.Cluster.Spec.CloudConfig.Openstack.Monitor == nil {
+		return nil, nil
+	}
+	monitor := b.Cluster.Spec.CloudConfig.Openstack.Monitor
+
+	delay, err := monitorSeconds("delay", monitor.Delay)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := monitorSeconds("timeout", monitor.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &openstacktasks.PoolMonitor{
+		Name:       pool.Name,
+		Pool:       pool,
+		Type:       fi.String(monitorTypeTCP),
+		Delay:      delay,
+		Timeout:    timeout,
+		MaxRetries: monitor.MaxRetries,
+		Lifecycle:  b.Lifecycle,
+	}
+	switch fi.StringValue(monitor.Type) {
+	case "", monitorTypeTCP:
+	case monitorTypeHTTPS:
+		// the API server answers the health check of anonymous clients
+		t.Type = fi.String(monitorTypeHTTPS)
+		t.URLPath = fi.String("/healthz")
+	default:
+		return nil, fmt.Errorf("invalid openstack monitor type %q, expected %s or %s", fi.StringValue(monitor.Type), monitorTypeTCP, monitorTypeHTTPS)
+	}
+	return t, nil
+}
+
+// The health monitor types of the API loadbalancer
+const (
+	monitorTypeTCP   = "TCP"
+	monitorTypeHTTPS = "HTTPS"
+)
+
+// monitorSeconds converts a monitor duration like "1m" into whole seconds
+func monitorSeconds(field string, value *string) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(fi.StringValue(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid openstack monitor %s %q: %v", field, fi.StringValue(value), err)
+	}
+	return fi.Int(int(d.Seconds())), nil
+}
+
+// serverGroupPolicy returns the server group policy of the instance group, defaults to anti-affinity
+func serverGroupPolicy(ig *kops.InstanceGroup) *string {
+	if ig.Spec.ServerGroupPolicy != nil {
+		return ig.Spec.ServerGroupPolicy
+	}
+	return fi.String("anti-affinity")
+}
@@ -19,8 +19,8 @@ package openstack
 import (
 	"fmt"
 
-	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
 	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"k8s.io/kops/pkg/dns"
 	"k8s.io/kops/pkg/resources"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
@@ -35,10 +35,13 @@ func (os *clusterDiscoveryOS) ListDNSRecordsets() ([]*resources.Resource, error)
 		Name: os.clusterName,
 	}
 
-	// if dnsclient does not exist (designate disabled)
-	if os.osCloud.DNSClient() == nil {
+	// gossip clusters have no records in designate
+	if dns.IsGossipHostname(os.clusterName) {
 		return nil, nil
 	}
+	if _, err := os.osCloud.DNSClient(); err != nil {
+		return nil, err
+	}
 
 	zs, err := os.osCloud.ListDNSZones(zopts)
 	if err != nil {
@@ -69,8 +72,7 @@ func (os *clusterDiscoveryOS) ListDNSRecordsets() ([]*resources.Resource, error)
 			ID:   rr.ID,
 			Type: typeDNSRecord,
 			Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
-				// TODO: not tested and this should have retry similar to what we have in another resources
-				return recordsets.Delete(cloud.(openstack.OpenstackCloud).DNSClient(), z.ID, rr.ID).ExtractErr()
+				return cloud.(openstack.OpenstackCloud).DeleteDNSRecordset(z.ID, r.ID)
 			},
 			Obj: rr,
 		}
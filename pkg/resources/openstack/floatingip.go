@@ -55,6 +55,34 @@ func (os *clusterDiscoveryOS) listL3FloatingIPs(routerID string) ([]*resources.R
 	return resourceTrackers, nil
 }
 
+// ListFloatingIPs lists the unassociated floating IPs tagged with the cluster, which are deleted with the cluster
+func (os *clusterDiscoveryOS) ListFloatingIPs() ([]*resources.Resource, error) {
+	var resourceTrackers []*resources.Resource
+	tagged, err := os.osCloud.HasExtension(openstack.ServiceNetwork, openstack.ExtensionTags)
+	if err != nil || !tagged {
+		return resourceTrackers, err
+	}
+	floatingIPs, err := os.osCloud.ListL3FloatingIPs(l3floatingip.ListOpts{
+		Tags: openstack.ClusterTag(os.clusterName),
+	})
+	if err != nil {
+		return resourceTrackers, err
+	}
+	for _, floatingIP := range floatingIPs {
+		if floatingIP.PortID != "" {
+			continue
+		}
+		resourceTracker := &resources.Resource{
+			Name:    floatingIP.FloatingIP,
+			ID:      floatingIP.ID,
+			Type:    typeFloatingIP,
+			Deleter: DeleteL3FloatingIP,
+		}
+		resourceTrackers = append(resourceTrackers, resourceTracker)
+	}
+	return resourceTrackers, nil
+}
+
 func (os *clusterDiscoveryOS) listFloatingIPs(instanceID string) ([]*resources.Resource, error) {
 	var resourceTrackers []*resources.Resource
 	floatingIPs, err := os.osCloud.ListFloatingIPs()
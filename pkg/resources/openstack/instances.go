@@ -17,7 +17,6 @@ limitations under the License.
 package openstack
 
 import (
-	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"k8s.io/kops/pkg/resources"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
@@ -29,31 +28,28 @@ const (
 
 func (os *clusterDiscoveryOS) ListInstances() ([]*resources.Resource, error) {
 	var resourceTrackers []*resources.Resource
-	instances, err := os.osCloud.ListInstances(servers.ListOpts{})
+	instances, err := os.osCloud.ListClusterInstances(os.clusterName)
 	if err != nil {
 		return resourceTrackers, err
 	}
 
 	for _, instance := range instances {
-		val, ok := instance.Metadata["k8s"]
-		if ok && val == os.clusterName {
-			// Clean up any bound floating IP's
-			floatingIPs, err := os.listFloatingIPs(instance.ID)
-			if err != nil {
-				return resourceTrackers, err
-			}
-			resourceTrackers = append(resourceTrackers, floatingIPs...)
-
-			resourceTracker := &resources.Resource{
-				Name: instance.Name,
-				ID:   instance.ID,
-				Type: typeInstance,
-				Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
-					return cloud.(openstack.OpenstackCloud).DeleteInstanceWithID(r.ID)
-				},
-			}
-			resourceTrackers = append(resourceTrackers, resourceTracker)
+		// Clean up any bound floating IP's
+		floatingIPs, err := os.listFloatingIPs(instance.ID)
+		if err != nil {
+			return resourceTrackers, err
 		}
+		resourceTrackers = append(resourceTrackers, floatingIPs...)
+
+		resourceTracker := &resources.Resource{
+			Name: instance.Name,
+			ID:   instance.ID,
+			Type: typeInstance,
+			Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
+				return cloud.(openstack.OpenstackCloud).DeleteInstanceWithID(r.ID)
+			},
+		}
+		resourceTrackers = append(resourceTrackers, resourceTracker)
 	}
 	return resourceTrackers, nil
 }
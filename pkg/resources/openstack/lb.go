@@ -36,10 +36,7 @@ const (
 
 func (os *clusterDiscoveryOS) ListLB() ([]*resources.Resource, error) {
 	var resourceTrackers []*resources.Resource
-	opts := loadbalancers.ListOpts{
-		Name: "api." + os.clusterName,
-	}
-	lbs, err := os.osCloud.ListLBs(opts)
+	lbs, err := os.osCloud.ListClusterLBs(os.clusterName)
 	if err != nil {
 		return nil, err
 	}
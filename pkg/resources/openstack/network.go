@@ -88,6 +88,8 @@ func (os *clusterDiscoveryOS) ListNetwork() ([]*resources.Resource, error) {
 					Name: router.ID,
 					ID:   subnet.ID,
 					Type: typeRouterIF,
+					// the interface must be removed before its router and subnet can be deleted
+					Blocks: []string{typeRouter + ":" + router.ID, typeSubnet + ":" + subnet.ID},
 					Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
 						opts := osrouter.RemoveInterfaceOpts{
 							SubnetID: r.ID,
@@ -98,9 +100,10 @@ func (os *clusterDiscoveryOS) ListNetwork() ([]*resources.Resource, error) {
 				resourceTrackers = append(resourceTrackers, resourceTracker)
 			}
 			resourceTracker := &resources.Resource{
-				Name: subnet.Name,
-				ID:   subnet.ID,
-				Type: typeSubnet,
+				Name:   subnet.Name,
+				ID:     subnet.ID,
+				Type:   typeSubnet,
+				Blocks: []string{typeNetwork + ":" + network.ID},
 				Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
 					return cloud.(openstack.OpenstackCloud).DeleteSubnet(r.ID)
 				},
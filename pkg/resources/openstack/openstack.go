@@ -50,9 +50,11 @@ func ListResources(cloud openstack.OpenstackCloud, clusterName string) (map[stri
 		os.ListLBListener,
 		os.ListLBPools,
 		os.ListLB,
+		os.ListTrunks,
 		os.ListPorts,
 		os.ListSecurityGroups,
 		os.ListNetwork,
+		os.ListFloatingIPs,
 		os.ListDNSRecordsets,
 	}
 	for _, fn := range listFunctions {
@@ -19,6 +19,7 @@ package openstack
 import (
 	"strings"
 
+	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"k8s.io/kops/pkg/resources"
 	"k8s.io/kops/upup/pkg/fi"
@@ -37,19 +38,46 @@ func (os *clusterDiscoveryOS) ListPorts() ([]*resources.Resource, error) {
 		return nil, err
 	}
 
+	clusteReplaced := strings.Replace(os.clusterName, ".", "-", -1)
 	for _, port := range ports {
-		clusteReplaced := strings.Replace(os.clusterName, ".", "-", -1)
-		if strings.HasSuffix(port.Name, clusteReplaced) {
-			resourceTracker := &resources.Resource{
-				Name: port.Name,
-				ID:   port.ID,
-				Type: typePort,
-				Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
-					return cloud.(openstack.OpenstackCloud).DeletePort(r.ID)
-				},
-			}
-			resourceTrackers = append(resourceTrackers, resourceTracker)
+		if !strings.HasSuffix(port.Name, clusteReplaced) || isNeutronOwnedPort(&port) {
+			continue
 		}
+		resourceTracker := &resources.Resource{
+			Name:    port.Name,
+			ID:      port.ID,
+			Type:    typePort,
+			Deleter: deletePort,
+		}
+		// neutron refuses to delete a subnet which still has ports
+		for _, ip := range port.FixedIPs {
+			resourceTracker.Blocks = append(resourceTracker.Blocks, typeSubnet+":"+ip.SubnetID)
+		}
+		resourceTrackers = append(resourceTrackers, resourceTracker)
 	}
 	return resourceTrackers, nil
 }
+
+// isNeutronOwnedPort returns true for ports which are managed by neutron itself,
+// they are removed together with the router interface or network they belong to
+func isNeutronOwnedPort(port *ports.Port) bool {
+	return strings.HasPrefix(port.DeviceOwner, "network:")
+}
+
+// deletePort deletes the port after verifying that it is still a port of the cluster
+func deletePort(cloud fi.Cloud, r *resources.Resource) error {
+	c := cloud.(openstack.OpenstackCloud)
+	port, err := c.GetPort(r.ID)
+	if err != nil {
+		return err
+	}
+	if port == nil {
+		glog.V(2).Infof("Port %s was already deleted", r.ID)
+		return nil
+	}
+	if port.Name != r.Name || isNeutronOwnedPort(port) {
+		glog.Warningf("Not deleting port %s, it no longer belongs to the cluster (name %q, device owner %q)", r.ID, port.Name, port.DeviceOwner)
+		return nil
+	}
+	return c.DeletePort(r.ID)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"strings"
+
+	"k8s.io/kops/pkg/resources"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+const (
+	typeTrunk = "Trunk"
+)
+
+// ListTrunks lists the trunks on the ports of the instances, clouds without the trunk extension have none
+func (os *clusterDiscoveryOS) ListTrunks() ([]*resources.Resource, error) {
+	var resourceTrackers []*resources.Resource
+
+	supported, err := os.osCloud.HasExtension(openstack.ServiceNetwork, openstack.ExtensionTrunk)
+	if err != nil || !supported {
+		return resourceTrackers, err
+	}
+	trunks, err := os.osCloud.ListTrunks(openstack.TrunkListOpts{})
+	if err != nil {
+		return resourceTrackers, err
+	}
+
+	clusterReplaced := strings.Replace(os.clusterName, ".", "-", -1)
+	for _, trunk := range trunks {
+		if !strings.HasSuffix(trunk.Name, clusterReplaced) {
+			continue
+		}
+		resourceTracker := &resources.Resource{
+			Name: trunk.Name,
+			ID:   trunk.ID,
+			Type: typeTrunk,
+			Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
+				return cloud.(openstack.OpenstackCloud).DeleteTrunk(r.ID)
+			},
+			// neutron refuses to delete the ports of a trunk
+			Blocks: []string{typePort + ":" + trunk.PortID},
+		}
+		for _, sp := range trunk.SubPorts {
+			resourceTracker.Blocks = append(resourceTracker.Blocks, typePort+":"+sp.PortID)
+		}
+		resourceTrackers = append(resourceTrackers, resourceTracker)
+	}
+	return resourceTrackers, nil
+}
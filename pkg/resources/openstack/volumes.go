@@ -32,21 +32,17 @@ func (os *clusterDiscoveryOS) ListVolumes() ([]*resources.Resource, error) {
 	opt := cinder.ListOpts{
 		Metadata: map[string]string{"KubernetesCluster": os.clusterName},
 	}
-	volumes, err := os.osCloud.ListVolumes(opt)
-	if err != nil {
-		return resourceTrackers, err
-	}
-
-	for _, volume := range volumes {
+	err := os.osCloud.EachVolume(opt, func(volume cinder.Volume) error {
 		resourceTracker := &resources.Resource{
 			Name: volume.Name,
 			ID:   volume.ID,
 			Type: typeVolume,
 			Deleter: func(cloud fi.Cloud, r *resources.Resource) error {
-				return cloud.(openstack.OpenstackCloud).DeleteVolume(r.ID)
+				return cloud.(openstack.OpenstackCloud).DeleteVolume(r.ID, true)
 			},
 		}
 		resourceTrackers = append(resourceTrackers, resourceTracker)
-	}
-	return resourceTrackers, nil
+		return nil
+	})
+	return resourceTrackers, err
 }
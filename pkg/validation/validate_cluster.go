@@ -234,6 +234,14 @@ func (v *ValidationCluster) validateNodes(cloudGroups map[string]*cloudinstances
 		for _, member := range allMembers {
 			node := member.Node
 
+			if member.Stopped {
+				v.addError(&ValidationError{
+					Kind:    "Machine",
+					Name:    member.ID,
+					Message: fmt.Sprintf("machine %q is stopped but is expected to be running", member.ID),
+				})
+			}
+
 			if node == nil {
 				nodeExpectedToJoin := true
 				if cloudGroup.InstanceGroup.Spec.Role == kops.InstanceGroupRoleBastion {
@@ -230,3 +230,33 @@ func Test_ValidateBastionNodes(t *testing.T) {
 	}
 
 }
+
+func Test_ValidateStoppedMachine(t *testing.T) {
+	groups := make(map[string]*cloudinstances.CloudInstanceGroup)
+	groups["bastion"] = &cloudinstances.CloudInstanceGroup{
+		InstanceGroup: &kopsapi.InstanceGroup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "bastion",
+			},
+			Spec: kopsapi.InstanceGroupSpec{
+				Role: kopsapi.InstanceGroupRoleBastion,
+			},
+		},
+		Ready: []*cloudinstances.CloudInstanceGroupMember{
+			{
+				ID:      "i-00001",
+				Stopped: true,
+			},
+		},
+	}
+
+	v := &ValidationCluster{}
+	v.validateNodes(groups)
+	if len(v.Failures) != 1 {
+		printDebug(t, v)
+		t.Fatal("Stopped machine not caught")
+	} else if v.Failures[0].Message != "machine \"i-00001\" is stopped but is expected to be running" {
+		printDebug(t, v)
+		t.Fatalf("unexpected validation failure: %+v", v.Failures[0])
+	}
+}
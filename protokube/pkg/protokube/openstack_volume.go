@@ -61,6 +61,9 @@ type OpenstackVolumes struct {
 	instanceName string
 	internalIP   net.IP
 	storageZone  string
+
+	// requestedDevices holds the device names requested for the volumes, by volume id
+	requestedDevices map[string]string
 }
 
 var _ Volumes = &OpenstackVolumes{}
@@ -173,6 +176,9 @@ func (a *OpenstackVolumes) discoverTags() error {
 	// Internal IP
 	{
 		server, err := a.cloud.GetInstance(strings.TrimSpace(a.meta.ServerID))
+		if err != nil {
+			return fmt.Errorf("error getting server %q: %v", a.meta.ServerID, err)
+		}
 		ip, err := openstack.GetServerFixedIP(server, a.clusterName)
 		if err != nil {
 			return fmt.Errorf("error querying InternalIP from name: %v", err)
@@ -195,6 +201,13 @@ func (v *OpenstackVolumes) buildOpenstackVolume(d *cinderv2.Volume) (*Volume, er
 
 	vol.Status = d.Status
 
+	if device := d.Metadata[openstack.TagVolumeDevice]; device != "" {
+		if v.requestedDevices == nil {
+			v.requestedDevices = make(map[string]string)
+		}
+		v.requestedDevices[d.ID] = device
+	}
+
 	for _, attachedTo := range d.Attachments {
 		vol.AttachedTo = attachedTo.HostName
 		if attachedTo.ServerID == v.meta.ServerID {
@@ -264,6 +277,7 @@ func (v *OpenstackVolumes) FindMountedVolume(volume *Volume) (string, error) {
 func (v *OpenstackVolumes) AttachVolume(volume *Volume) error {
 	opts := volumeattach.CreateOpts{
 		VolumeID: volume.ID,
+		Device:   v.requestedDevices[volume.ID],
 	}
 	attachment, err := v.cloud.AttachVolume(v.meta.ServerID, opts)
 	if err != nil {
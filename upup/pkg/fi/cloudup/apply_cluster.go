@@ -808,6 +808,20 @@ func (c *ApplyClusterCmd) Run() error {
 			Lifecycle:             &clusterLifecycle,
 		})
 
+		// Fail before creating the ports of the instances when a machine type is not a flavor of the cloud
+		if clusterLifecycle != fi.LifecycleIgnore {
+			if err := openstackModelContext.CheckFlavors(cloud.(openstack.OpenstackCloud)); err != nil {
+				return err
+			}
+		}
+
+		// Fail before creating anything when the quotas of the project can not fit the cluster
+		if c.TargetName == TargetDirect && clusterLifecycle != fi.LifecycleIgnore {
+			if err := openstackModelContext.CheckQuota(cloud.(openstack.OpenstackCloud)); err != nil {
+				return err
+			}
+		}
+
 	default:
 		return fmt.Errorf("unknown cloudprovider %q", cluster.Spec.CloudProvider)
 	}
@@ -896,6 +910,19 @@ func (c *ApplyClusterCmd) Run() error {
 	}
 	c.Target = target
 
+	// The completed spec of the previous update tells whether the designate records of the cluster have to be removed
+	var previousCluster *kops.Cluster
+	if c.TargetName == TargetDirect && kops.CloudProviderID(cluster.Spec.CloudProvider) == kops.CloudProviderOpenstack {
+		previousCluster = &kops.Cluster{}
+		err = registry.ReadConfigDeprecated(configBase.Join(registry.PathClusterCompleted), previousCluster)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				glog.Warningf("unable to read the completed cluster spec of the previous update: %v", err)
+			}
+			previousCluster = nil
+		}
+	}
+
 	if !dryRun {
 		err = registry.WriteConfigDeprecated(cluster, configBase.Join(registry.PathClusterCompleted), c.Cluster)
 		if err != nil {
@@ -946,6 +973,18 @@ func (c *ApplyClusterCmd) Run() error {
 		}
 	}
 
+	// Point the designate records of the API at the current masters, so that replaced masters do not leave stale records
+	if c.TargetName == TargetDirect && kops.CloudProviderID(cluster.Spec.CloudProvider) == kops.CloudProviderOpenstack && !dns.IsGossipHostname(cluster.Name) {
+		if err := openstack.ReconcileMasterDNSRecords(cloud.(openstack.OpenstackCloud), cluster); err != nil {
+			glog.Warningf("unable to update the DNS records of the masters: %v", err)
+		}
+	}
+	if previousCluster != nil {
+		if err := openstack.CleanupDesignateAfterGossipTransition(cloud.(openstack.OpenstackCloud), &previousCluster.Spec, &cluster.Spec); err != nil {
+			glog.Warningf("unable to remove the DNS records of the cluster after switching to gossip: %v", err)
+		}
+	}
+
 	err = target.Finish(taskMap) //This will finish the apply, and print the changes
 	if err != nil {
 		return fmt.Errorf("error closing target: %v", err)
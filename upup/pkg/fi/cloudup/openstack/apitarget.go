@@ -17,11 +17,20 @@ limitations under the License.
 package openstack
 
 import (
+	"sync"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"k8s.io/kops/upup/pkg/fi"
 )
 
 type OpenstackAPITarget struct {
 	Cloud OpenstackCloud
+
+	// serverGroups are the server groups of the project, listed once per target so that
+	// the server group tasks do not list them again for every instance group
+	serverGroupsMutex sync.Mutex
+	serverGroups      []servergroups.ServerGroup
+	serverGroupsFound bool
 }
 
 var _ fi.Target = &OpenstackAPITarget{}
@@ -39,3 +48,44 @@ func (t *OpenstackAPITarget) Finish(taskMap map[string]fi.Task) error {
 func (t *OpenstackAPITarget) ProcessDeletions() bool {
 	return true
 }
+
+// ListServerGroups returns the server groups of the project, which are listed on the first call only.
+// The server groups created through CreateServerGroup are added to the list.
+func (t *OpenstackAPITarget) ListServerGroups() ([]servergroups.ServerGroup, error) {
+	t.serverGroupsMutex.Lock()
+	defer t.serverGroupsMutex.Unlock()
+
+	if !t.serverGroupsFound {
+		groups, err := t.Cloud.ListServerGroups()
+		if err != nil {
+			return nil, err
+		}
+		t.serverGroups = groups
+		t.serverGroupsFound = true
+	}
+	return append([]servergroups.ServerGroup(nil), t.serverGroups...), nil
+}
+
+// GetServerGroupByName returns the server group of the target with the given name, or ErrServerGroupNotFound
+func (t *OpenstackAPITarget) GetServerGroupByName(name string) (*servergroups.ServerGroup, error) {
+	groups, err := t.ListServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	return FindServerGroupByName(groups, name)
+}
+
+// CreateServerGroup creates the server group and adds it to the server groups of the target
+func (t *OpenstackAPITarget) CreateServerGroup(opt servergroups.CreateOptsBuilder) (*servergroups.ServerGroup, error) {
+	g, err := t.Cloud.CreateServerGroup(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	t.serverGroupsMutex.Lock()
+	defer t.serverGroupsMutex.Unlock()
+	if t.serverGroupsFound {
+		t.serverGroups = append(t.serverGroups, *g)
+	}
+	return g, nil
+}
@@ -22,16 +22,15 @@ import (
 	"github.com/gophercloud/gophercloud"
 	az "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) ListAvailabilityZones(serviceClient *gophercloud.ServiceClient) (azList []az.AvailabilityZone, err error) {
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		azPage, err := az.List(serviceClient).AllPages()
 
 		if err != nil {
-			return false, fmt.Errorf("Failed to list storage availability zones: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to list storage availability zones: %v", withRequestID(err))
 		}
 		azList, err = az.ExtractAvailabilityZones(azPage)
 		if err != nil {
@@ -46,13 +45,17 @@ func (c *openstackCloud) ListAvailabilityZones(serviceClient *gophercloud.Servic
 		}
 		return azList, err
 	}
-	return azList, nil
+	return azList, err
 }
 
 func (c *openstackCloud) GetStorageAZFromCompute(computeAZ string) (*az.AvailabilityZone, error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
 	// TODO: This is less than desirable, but openstack differs here
 	// Check to see if the availability zone exists.
-	azList, err := c.ListAvailabilityZones(c.BlockStorageClient())
+	azList, err := c.ListAvailabilityZones(client)
 	if err != nil {
 		return nil, fmt.Errorf("Volume.RenderOpenstack: %v", err)
 	}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetStorageAZFromCompute(t *testing.T) {
+	grid := []struct {
+		zones       string
+		computeZone string
+		expected    string
+	}{
+		{zones: `"zone-1", "zone-2"`, computeZone: "zone-2", expected: "zone-2"},
+		{zones: `"nova"`, computeZone: "zone-2", expected: "nova"},
+		{zones: `"zone-1", "zone-2"`, computeZone: "zone-3"},
+	}
+	for _, g := range grid {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/os-availability-zone" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var zones []string
+			for _, name := range strings.Split(g.zones, ", ") {
+				zones = append(zones, fmt.Sprintf(`{"zoneName": %s, "zoneState": {"available": true}}`, name))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"availabilityZoneInfo": [%s]}`, strings.Join(zones, ", "))
+		}))
+
+		c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+		zone, err := c.GetStorageAZFromCompute(g.computeZone)
+		server.Close()
+		if g.expected == "" {
+			if err == nil {
+				t.Errorf("expected error for compute zone %s with storage zones %s, got %+v", g.computeZone, g.zones, zone)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if zone.ZoneName != g.expected {
+			t.Errorf("expected storage zone %s for compute zone %s, got %s", g.expected, g.computeZone, zone.ZoneName)
+		}
+	}
+}
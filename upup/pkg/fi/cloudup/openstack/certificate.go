@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// TLSContainerTypeCertificate is the Barbican container type expected by the loadbalancer service
+	TLSContainerTypeCertificate = "certificate"
+)
+
+// TLSContainer is the subset of a Barbican container which is used to terminate TLS on loadbalancer listeners
+type TLSContainer struct {
+	ContainerRef string `json:"container_ref"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Type         string `json:"type"`
+}
+
+// GetTLSContainer will return the Barbican container found at the given reference
+func (c *openstackCloud) GetTLSContainer(ref string) (container *TLSContainer, err error) {
+	if c.barbicanClient == nil {
+		return nil, fmt.Errorf("cannot validate TLS container %s: no key-manager (barbican) service found in region %q", ref, c.region)
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r TLSContainer
+		_, err := c.barbicanClient.Get(ref, &r, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if isNotFound(err) {
+			return true, fmt.Errorf("TLS container %s not found", ref)
+		}
+		if err != nil {
+			return false, fmt.Errorf("error fetching TLS container %s: %v", ref, withRequestID(err))
+		}
+		container = &r
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return container, err
+	}
+	return container, err
+}
+
+// ValidateTLSContainer checks that the reference points to a Barbican certificate container
+func ValidateTLSContainer(cloud OpenstackCloud, ref string) error {
+	container, err := cloud.GetTLSContainer(ref)
+	if err != nil {
+		return err
+	}
+	if container.Type != TLSContainerTypeCertificate {
+		return fmt.Errorf("TLS container %s has type %q, expected %q", ref, container.Type, TLSContainerTypeCertificate)
+	}
+	return nil
+}
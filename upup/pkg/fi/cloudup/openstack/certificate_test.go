@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestValidateTLSContainer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/containers/cert":
+			fmt.Fprint(w, `{"container_ref": "cert", "name": "api", "status": "ACTIVE", "type": "certificate"}`)
+		case "/v1/containers/generic":
+			fmt.Fprint(w, `{"container_ref": "generic", "name": "other", "status": "ACTIVE", "type": "generic"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code": 404, "title": "Not Found"}`)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		barbicanClient: newTestServiceClient(server),
+		readBackoff:    wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+	}
+	grid := []struct {
+		ref   string
+		error string
+	}{
+		{ref: server.URL + "/v1/containers/cert"},
+		{ref: server.URL + "/v1/containers/generic", error: "expected \"certificate\""},
+		{ref: server.URL + "/v1/containers/missing", error: "not found"},
+	}
+	for _, g := range grid {
+		err := ValidateTLSContainer(c, g.ref)
+		if g.error == "" && err != nil {
+			t.Errorf("unexpected error for %s: %v", g.ref, err)
+		}
+		if g.error != "" && (err == nil || !strings.Contains(err.Error(), g.error)) {
+			t.Errorf("expected error containing %q for %s, got %v", g.error, g.ref, err)
+		}
+	}
+}
+
+func TestGetTLSContainerWithoutKeyManager(t *testing.T) {
+	c := &openstackCloud{region: "RegionOne"}
+	_, err := c.GetTLSContainer("https://barbican/v1/containers/cert")
+	if err == nil || !strings.Contains(err.Error(), "no key-manager") {
+		t.Errorf("expected error about the missing key-manager service, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// tokenRefreshMargin is how long before its expiry a cached token is renewed
+const tokenRefreshMargin = 5 * time.Minute
+
+// openstackClients is an authenticated provider client and the service clients derived from it
+type openstackClients struct {
+	mutex    sync.Mutex
+	provider *gophercloud.ProviderClient
+	services map[string]*gophercloud.ServiceClient
+}
+
+// serviceClient returns the service client with the given name, building it from the provider client on first use
+func (o *openstackClients) serviceClient(name string, build func(*gophercloud.ProviderClient) (*gophercloud.ServiceClient, error)) (*gophercloud.ServiceClient, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if client := o.services[name]; client != nil {
+		return client, nil
+	}
+	client, err := build(o.provider)
+	if err != nil {
+		return nil, err
+	}
+	o.services[name] = client
+	registerServiceEndpoint(client.Endpoint, name)
+	return client, nil
+}
+
+// lazyServiceClient builds the client of an optional service on first use, so that clouds which do not expose
+// the service only fail once the cluster uses a feature needing it. It is shared by the copies of a cloud.
+type lazyServiceClient struct {
+	mutex   sync.Mutex
+	service string
+	build   func() (*gophercloud.ServiceClient, error)
+	client  *gophercloud.ServiceClient
+}
+
+func newLazyServiceClient(service string, build func() (*gophercloud.ServiceClient, error)) *lazyServiceClient {
+	return &lazyServiceClient{service: service, build: build}
+}
+
+// get returns the client of the service, building it on the first call. Only a client which could be built
+// is kept, a failure such as an unreachable keystone is retried on the next call.
+func (l *lazyServiceClient) get() (*gophercloud.ServiceClient, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.client != nil {
+		return l.client, nil
+	}
+	client, err := l.build()
+	if _, ok := err.(*gophercloud.ErrEndpointNotFound); ok {
+		return nil, fmt.Errorf("this cluster requires the %s service which your cloud does not expose", l.service)
+	} else if err != nil {
+		return nil, fmt.Errorf("error building %s client: %v", l.service, err)
+	}
+	l.client = client
+	return client, nil
+}
+
+// clientCache holds the authenticated clients, keyed by region and credentials,
+// so the clouds built during a single kops invocation share one keystone token
+var clientCache = struct {
+	sync.Mutex
+	entries map[string]*openstackClients
+}{
+	entries: make(map[string]*openstackClients),
+}
+
+// clientCacheKey returns the cache key of a region and credentials, credentials are hashed so they are not kept in clear
+func clientCacheKey(region string, opt gophercloud.AuthOptions) string {
+	fields := []string{
+		region,
+		opt.IdentityEndpoint,
+		opt.Username,
+		opt.UserID,
+		opt.Password,
+		opt.DomainID,
+		opt.DomainName,
+		opt.TenantID,
+		opt.TenantName,
+		opt.TokenID,
+		opt.ApplicationCredentialID,
+		opt.ApplicationCredentialName,
+		opt.ApplicationCredentialSecret,
+	}
+	if opt.Scope != nil {
+		fields = append(fields, opt.Scope.ProjectID, opt.Scope.ProjectName, opt.Scope.DomainID, opt.Scope.DomainName)
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// cachedOpenstackClients returns the clients for the region and credentials. The authenticate function
+// is only called when no clients are cached, or when the cached token can not be renewed.
+func cachedOpenstackClients(region string, opt gophercloud.AuthOptions, authenticate func() (*gophercloud.ProviderClient, error)) (*openstackClients, error) {
+	key := clientCacheKey(region, opt)
+
+	clientCache.Lock()
+	defer clientCache.Unlock()
+
+	if entry := clientCache.entries[key]; entry != nil {
+		err := refreshToken(entry.provider)
+		if err == nil {
+			glog.V(4).Infof("reusing cached openstack clients for region %q", region)
+			return entry, nil
+		}
+		glog.V(2).Infof("cached openstack token could not be renewed, authenticating again: %v", err)
+		delete(clientCache.entries, key)
+	}
+
+	provider, err := authenticate()
+	if err != nil {
+		return nil, err
+	}
+	entry := &openstackClients{
+		provider: provider,
+		services: make(map[string]*gophercloud.ServiceClient),
+	}
+	clientCache.entries[key] = entry
+	return entry, nil
+}
+
+// refreshToken renews the token of the provider client when it is about to expire
+func refreshToken(pc *gophercloud.ProviderClient) error {
+	expiry, found := tokenExpiry(pc)
+	if !found || time.Now().Add(tokenRefreshMargin).Before(expiry) {
+		return nil
+	}
+	if pc.ReauthFunc == nil {
+		return fmt.Errorf("token expires at %s and reauthentication is not allowed", expiry)
+	}
+	glog.V(2).Infof("openstack token expires at %s, reauthenticating", expiry)
+	return pc.Reauthenticate(pc.Token())
+}
+
+// tokenExpiry returns the expiry of the token of the provider client, if it is known
+func tokenExpiry(pc *gophercloud.ProviderClient) (time.Time, bool) {
+	switch r := pc.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		token, err := r.ExtractToken()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return token.ExpiresAt, true
+	case tokens2.CreateResult:
+		token, err := r.ExtractToken()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return token.ExpiresAt, true
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// newExpiringProviderClient returns a provider client holding a token which expires after the given duration
+func newExpiringProviderClient(t *testing.T, expiresIn time.Duration, reauths *int) *gophercloud.ProviderClient {
+	pc := &gophercloud.ProviderClient{}
+	result := tokens3.CreateResult{}
+	result.Body = map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": time.Now().Add(expiresIn).UTC().Format(time.RFC3339),
+		},
+	}
+	if err := pc.SetTokenAndAuthResult(result); err != nil {
+		t.Fatalf("unexpected error setting token: %v", err)
+	}
+	pc.ReauthFunc = func() error {
+		*reauths++
+		return nil
+	}
+	return pc
+}
+
+func withEmptyClientCache(f func()) {
+	clientCache.Lock()
+	saved := clientCache.entries
+	clientCache.entries = make(map[string]*openstackClients)
+	clientCache.Unlock()
+
+	defer func() {
+		clientCache.Lock()
+		clientCache.entries = saved
+		clientCache.Unlock()
+	}()
+	f()
+}
+
+func TestCachedOpenstackClientsReusesProvider(t *testing.T) {
+	withEmptyClientCache(func() {
+		authentications, reauths := 0, 0
+		authenticate := func() (*gophercloud.ProviderClient, error) {
+			authentications++
+			return newExpiringProviderClient(t, time.Hour, &reauths), nil
+		}
+		opt := gophercloud.AuthOptions{IdentityEndpoint: "https://keystone/v3", Username: "user", Password: "secret"}
+
+		first, err := cachedOpenstackClients("region", opt, authenticate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := cachedOpenstackClients("region", opt, authenticate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if first != second || authentications != 1 {
+			t.Errorf("expected cached clients to be reused, got %d authentications", authentications)
+		}
+
+		if _, err := cachedOpenstackClients("other-region", opt, authenticate); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		opt.Password = "other"
+		if _, err := cachedOpenstackClients("region", opt, authenticate); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if authentications != 3 {
+			t.Errorf("expected a new authentication per region and credentials, got %d", authentications)
+		}
+		if reauths != 0 {
+			t.Errorf("valid tokens should not be renewed, got %d reauthentications", reauths)
+		}
+	})
+}
+
+func TestCachedOpenstackClientsRenewsExpiringToken(t *testing.T) {
+	withEmptyClientCache(func() {
+		authentications, reauths := 0, 0
+		authenticate := func() (*gophercloud.ProviderClient, error) {
+			authentications++
+			return newExpiringProviderClient(t, time.Minute, &reauths), nil
+		}
+		opt := gophercloud.AuthOptions{IdentityEndpoint: "https://keystone/v3", Username: "user", Password: "secret"}
+
+		for i := 0; i < 2; i++ {
+			if _, err := cachedOpenstackClients("region", opt, authenticate); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if authentications != 1 || reauths != 1 {
+			t.Errorf("expected the expiring token to be renewed, got %d authentications and %d reauthentications", authentications, reauths)
+		}
+	})
+}
+
+func TestOpenstackClientsServiceClientBuiltOnce(t *testing.T) {
+	clients := &openstackClients{
+		provider: &gophercloud.ProviderClient{},
+		services: make(map[string]*gophercloud.ServiceClient),
+	}
+	builds := 0
+	build := func(pc *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+		builds++
+		return &gophercloud.ServiceClient{ProviderClient: pc}, nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := clients.serviceClient("nova", build); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if builds != 1 {
+		t.Errorf("expected the service client to be built once, got %d", builds)
+	}
+}
+
+func TestLazyServiceClientMissingEndpoint(t *testing.T) {
+	builds := 0
+	c := &openstackCloud{
+		lazyCinder: newLazyServiceClient("volume (cinder)", func() (*gophercloud.ServiceClient, error) {
+			builds++
+			return nil, &gophercloud.ErrEndpointNotFound{}
+		}),
+	}
+	if builds != 0 {
+		t.Fatalf("expected the client not to be built before it is used")
+	}
+
+	expected := "this cluster requires the volume (cinder) service which your cloud does not expose"
+	for i := 0; i < 2; i++ {
+		_, err := c.ListVolumes(cinder.ListOpts{})
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+	if builds != 2 {
+		t.Errorf("expected the failed build to be retried, got %d builds", builds)
+	}
+	if client, err := c.BlockStorageClient(); client != nil || err == nil {
+		t.Errorf("expected an error and no client for a missing endpoint, got %v", client)
+	}
+}
+
+func TestLazyServiceClientKeepsBuiltClient(t *testing.T) {
+	builds := 0
+	lazy := newLazyServiceClient("dns (designate)", func() (*gophercloud.ServiceClient, error) {
+		builds++
+		if builds == 1 {
+			return nil, fmt.Errorf("keystone unreachable")
+		}
+		return &gophercloud.ServiceClient{}, nil
+	})
+	if _, err := lazy.get(); err == nil {
+		t.Fatalf("expected the failed build to be returned")
+	}
+	for i := 0; i < 2; i++ {
+		if client, err := lazy.get(); err != nil || client == nil {
+			t.Fatalf("expected a client, got %v: %v", client, err)
+		}
+	}
+	if builds != 2 {
+		t.Errorf("expected the client to be built again after the failure and then kept, got %d builds", builds)
+	}
+}
+
+func TestLazyServiceClientNotUsed(t *testing.T) {
+	c := &openstackCloud{}
+	_, err := c.ListDNSZones(zones.ListOpts{})
+	expected := "this cluster does not use the dns (designate) service"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package openstack
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,11 +36,13 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
 	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/monitors"
 	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
 	l3floatingip "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
@@ -48,6 +52,7 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/dnsprovider/pkg/dnsprovider"
 	"k8s.io/kops/dnsprovider/pkg/dnsprovider/providers/openstack/designate"
@@ -60,21 +65,30 @@ import (
 const TagNameEtcdClusterPrefix = "k8s.io/etcd/"
 const TagNameRolePrefix = "k8s.io/role/"
 const TagClusterName = "KubernetesCluster"
+
+// TagVolumeDevice is the volume metadata holding the device name requested when attaching the volume
+const TagVolumeDevice = "k8s.io/device"
 const TagRoleMaster = "master"
 
+// TagServerClusterName is the server metadata holding the name of the cluster the server belongs to
+const TagServerClusterName = "k8s"
+
+// TagKopsInstanceGroup is the server metadata holding the name of the instance group the server belongs to
+const TagKopsInstanceGroup = "KopsInstanceGroup"
+
 // ErrNotFound is used to inform that the object is not found
 var ErrNotFound = "Resource not found"
 
-// readBackoff is the backoff strategy for openstack read retries.
-var readBackoff = wait.Backoff{
+// defaultReadBackoff is the default backoff strategy for openstack read retries.
+var defaultReadBackoff = wait.Backoff{
 	Duration: time.Second,
 	Factor:   1.5,
 	Jitter:   0.1,
 	Steps:    4,
 }
 
-// writeBackoff is the backoff strategy for openstack write retries.
-var writeBackoff = wait.Backoff{
+// defaultWriteBackoff is the default backoff strategy for openstack write retries.
+var defaultWriteBackoff = wait.Backoff{
 	Duration: time.Second,
 	Factor:   1.5,
 	Jitter:   0.1,
@@ -84,11 +98,21 @@ var writeBackoff = wait.Backoff{
 type OpenstackCloud interface {
 	fi.Cloud
 
+	// WithContext will return a copy of the cloud whose requests and retries are aborted once the context is done
+	WithContext(ctx context.Context) OpenstackCloud
+
 	ComputeClient() *gophercloud.ServiceClient
-	BlockStorageClient() *gophercloud.ServiceClient
+	// BlockStorageClient returns the Cinder client, or an error if it cannot be built
+	BlockStorageClient() (*gophercloud.ServiceClient, error)
 	NetworkingClient() *gophercloud.ServiceClient
-	LoadBalancerClient() *gophercloud.ServiceClient
-	DNSClient() *gophercloud.ServiceClient
+	// LoadBalancerClient returns the Octavia or Neutron-LBaaS client, or an error if it cannot be built
+	LoadBalancerClient() (*gophercloud.ServiceClient, error)
+	// DNSClient returns the Designate client, or an error if it cannot be built or the cluster uses gossip
+	DNSClient() (*gophercloud.ServiceClient, error)
+	// ImageClient returns the Glance client, it is nil when the cloud has no image service
+	ImageClient() *gophercloud.ServiceClient
+	// KeyManagerClient returns the Barbican client, it is nil when the cloud has no key-manager service
+	KeyManagerClient() *gophercloud.ServiceClient
 	UseOctavia() bool
 
 	// Region returns the region which cloud will run on
@@ -97,31 +121,109 @@ type OpenstackCloud interface {
 	// GetInstance will return a openstack server provided its ID
 	GetInstance(id string) (*servers.Server, error)
 
+	// GetServers will return the openstack servers by ID, fetching at most concurrency servers at once
+	GetServers(serverIDs []string, concurrency int) (map[string]*servers.Server, error)
+
 	// ListInstances will return a slice of openstack servers provided list opts
 	ListInstances(servers.ListOptsBuilder) ([]servers.Server, error)
 
+	// EachInstance will call fn for the openstack servers which match the list opts, page by page
+	EachInstance(opt servers.ListOptsBuilder, fn func(servers.Server) error) error
+
+	// ListClusterInstances will return the openstack servers tagged with the cluster name
+	ListClusterInstances(clusterName string) ([]servers.Server, error)
+
 	// CreateInstance will create an openstack server provided create opts
 	CreateInstance(servers.CreateOptsBuilder) (*servers.Server, error)
 
 	//DeleteInstanceWithID will delete instance
 	DeleteInstanceWithID(instanceID string) error
 
+	// TerminateInstance will detach the instance from all loadbalancer pools, wait for connections to drain and delete it
+	TerminateInstance(serverID string, drainTimeout time.Duration) error
+
+	// StartInstance will power on a stopped instance and wait until it is ACTIVE
+	StartInstance(instanceID string) error
+
+	// StartServer will power on the server and wait until it is ACTIVE
+	StartServer(serverID string) error
+
+	// StopServer will power off the server and wait until it is SHUTOFF
+	StopServer(serverID string) error
+
+	// RebootServer will reboot the server and wait until it is ACTIVE again
+	RebootServer(serverID string, how servers.RebootMethod) error
+
+	// SetServerMetadata will add or update the metadata of the server
+	SetServerMetadata(serverID string, md map[string]string) error
+
+	// ResizeServer will change the flavor of the server and confirm the resize, reverting it if it can not be confirmed
+	ResizeServer(serverID, flavorID string) error
+
 	// SetVolumeTags will set the tags for the Cinder volume
 	SetVolumeTags(id string, tags map[string]string) error
 
+	// SetResourceTags will replace the tags of the Neutron resource, resourceType is e.g. ResourceTypeNetwork
+	SetResourceTags(resourceType string, resourceID string, tags []string) error
+
+	// ListRegions will return the regions of the service catalog
+	ListRegions() ([]string, error)
+
+	// ServiceRegions will return the region used for each service, by service name
+	ServiceRegions() map[string]string
+
 	// GetCloudTags will return the tags attached on cloud
 	GetCloudTags() map[string]string
 
 	// ListVolumes will return the Cinder volumes which match the options
 	ListVolumes(opt cinder.ListOptsBuilder) ([]cinder.Volume, error)
 
+	// EachVolume will call fn for the Cinder volumes which match the options, page by page
+	EachVolume(opt cinder.ListOptsBuilder, fn func(cinder.Volume) error) error
+
 	// CreateVolume will create a new Cinder Volume
 	CreateVolume(opt cinder.CreateOptsBuilder) (*cinder.Volume, error)
 
 	AttachVolume(serverID string, opt volumeattach.CreateOpts) (*volumeattach.VolumeAttachment, error)
 
-	//DeleteVolume will delete volume
-	DeleteVolume(volumeID string) error
+	//DeleteVolume will delete volume, detaching it from its servers first when detach is set
+	DeleteVolume(volumeID string, detach bool) error
+
+	// DetachVolume will detach the volume from the server
+	DetachVolume(serverID, volumeID string) error
+
+	// WaitForVolumeDeleted will wait until the volume is no longer listed
+	WaitForVolumeDeleted(volumeID string) error
+
+	// WaitForVolumeAvailable will wait until the volume can be attached or booted from
+	WaitForVolumeAvailable(volumeID string) error
+
+	// WaitForVolumeStatus will wait until the volume reaches the status, or fail when it reaches an error status
+	WaitForVolumeStatus(volumeID, status string, timeout time.Duration) error
+
+	// ListOrphanedVolumes will return the volumes tagged for the cluster which are not attached to any existing server
+	ListOrphanedVolumes(clusterName string) ([]cinder.Volume, error)
+
+	// ListVolumeTypes will return the Cinder volume types
+	ListVolumeTypes() ([]VolumeType, error)
+
+	// VolumeTypeEncrypted will return true if the volume type has an encryption type
+	VolumeTypeEncrypted(typeID string) (bool, error)
+
+	// GetVolume will return the Cinder volume with the given id
+	GetVolume(volumeID string) (*cinder.Volume, error)
+
+	// ResizeVolume will extend the Cinder volume to the new size in GB
+	ResizeVolume(volumeID string, newSizeGB int) error
+
+	// CreateSnapshot will create a Cinder snapshot of a volume, optionally waiting until it is available
+	CreateSnapshot(opts SnapshotCreateOpts, waitAvailable bool) (*VolumeSnapshot, error)
+
+	// ListSnapshots will return the Cinder snapshots which match the options
+	ListSnapshots(opts SnapshotListOpts) ([]VolumeSnapshot, error)
+
+	// DeleteSnapshot will delete a Cinder snapshot
+	DeleteSnapshot(snapshotID string) error
 
 	//ListSecurityGroups will return the Neutron security groups which match the options
 	ListSecurityGroups(opt sg.ListOpts) ([]sg.SecGroup, error)
@@ -129,7 +231,7 @@ type OpenstackCloud interface {
 	//CreateSecurityGroup will create a new Neutron security group
 	CreateSecurityGroup(opt sg.CreateOptsBuilder) (*sg.SecGroup, error)
 
-	//DeleteSecurityGroup will delete securitygroup
+	//DeleteSecurityGroup will delete the Neutron security group, returning the conflict error if it is still in use
 	DeleteSecurityGroup(sgID string) error
 
 	//ListSecurityGroupRules will return the Neutron security group rules which match the options
@@ -138,12 +240,21 @@ type OpenstackCloud interface {
 	//CreateSecurityGroupRule will create a new Neutron security group rule
 	CreateSecurityGroupRule(opt sgr.CreateOptsBuilder) (*sgr.SecGroupRule, error)
 
+	//EnsureSecurityGroupRule will create the Neutron security group rule, or return the existing rule with the same fingerprint
+	EnsureSecurityGroupRule(opt sgr.CreateOpts) (*sgr.SecGroupRule, error)
+
+	//DeleteSecurityGroupRule will delete the Neutron security group rule
+	DeleteSecurityGroupRule(ruleID string) error
+
 	//GetNetwork will return the Neutron network which match the id
 	GetNetwork(networkID string) (*networks.Network, error)
 
 	//ListNetworks will return the Neutron networks which match the options
 	ListNetworks(opt networks.ListOptsBuilder) ([]networks.Network, error)
 
+	// EachNetwork will call fn for the networks which match the list opts, page by page
+	EachNetwork(opt networks.ListOptsBuilder, fn func(networks.Network) error) error
+
 	//ListExternalNetworks will return the Neutron networks with the router:external property
 	GetExternalNetwork() (*networks.Network, error)
 
@@ -156,7 +267,7 @@ type OpenstackCloud interface {
 	//CreateNetwork will create a new Neutron network
 	CreateNetwork(opt networks.CreateOptsBuilder) (*networks.Network, error)
 
-	//DeleteNetwork will delete neutron network
+	//DeleteNetwork will delete neutron network, all subnets of the network have to be deleted first
 	DeleteNetwork(networkID string) error
 
 	//ListRouters will return the Neutron routers which match the options
@@ -165,10 +276,10 @@ type OpenstackCloud interface {
 	//CreateRouter will create a new Neutron router
 	CreateRouter(opt routers.CreateOptsBuilder) (*routers.Router, error)
 
-	//DeleteRouter will delete neutron router
+	//DeleteRouter will delete neutron router, all router interfaces have to be deleted first
 	DeleteRouter(routerID string) error
 
-	//DeleteSubnet will delete neutron subnet
+	//DeleteSubnet will delete neutron subnet, its router interfaces have to be deleted first and the network afterwards
 	DeleteSubnet(subnetID string) error
 
 	//ListSubnets will return the Neutron subnets which match the options
@@ -191,19 +302,40 @@ type OpenstackCloud interface {
 
 	CreatePort(opt ports.CreateOptsBuilder) (*ports.Port, error)
 
-	//GetPort will return a Neutron port by ID
+	//GetPort will return a Neutron port by ID, or nil if the port does not exist
 	GetPort(id string) (*ports.Port, error)
 
+	//UpdatePort will update the Neutron port
+	UpdatePort(id string, opt ports.UpdateOptsBuilder) (*ports.Port, error)
+
+	//GetPortSecurityEnabled will return whether port security is enabled on the Neutron port
+	GetPortSecurityEnabled(id string) (*bool, error)
+
 	//ListPorts will return the Neutron ports which match the options
 	ListPorts(opt ports.ListOptsBuilder) ([]ports.Port, error)
 
 	// DeletePort will delete a neutron port
 	DeletePort(portID string) error
 
+	//CreateTrunk will create a Neutron trunk on the parent port of the options
+	CreateTrunk(opts TrunkCreateOpts) (*Trunk, error)
+
+	//ListTrunks will return the Neutron trunks which match the options
+	ListTrunks(opts TrunkListOpts) ([]Trunk, error)
+
+	//AddTrunkSubPorts will add the subports to the Neutron trunk
+	AddTrunkSubPorts(trunkID string, subPorts []SubPort) (*Trunk, error)
+
+	//DeleteTrunk will delete the Neutron trunk, leaving its ports in place
+	DeleteTrunk(trunkID string) error
+
+	//HasExtension will return true if the service, e.g. network, has the extension with the given alias
+	HasExtension(service string, alias string) (bool, error)
+
 	//CreateRouterInterface will create a new Neutron router interface
 	CreateRouterInterface(routerID string, opt routers.AddInterfaceOptsBuilder) (*routers.InterfaceInfo, error)
 
-	//DeleteRouterInterface will delete router interface from subnet
+	//DeleteRouterInterface will delete router interface from subnet, this has to happen before the router or subnet are deleted
 	DeleteRouterInterface(routerID string, opt routers.RemoveInterfaceOptsBuilder) error
 
 	// CreateServerGroup will create a new server group.
@@ -212,31 +344,79 @@ type OpenstackCloud interface {
 	// ListServerGroups will list available server groups
 	ListServerGroups() ([]servergroups.ServerGroup, error)
 
+	// GetServerGroupByName will return the server group with the given name, or ErrServerGroupNotFound
+	GetServerGroupByName(name string) (*servergroups.ServerGroup, error)
+
 	// DeleteServerGroup will delete a nova server group
 	DeleteServerGroup(groupID string) error
 
+	// CreateDNSZone will create a primary or secondary DNS zone
+	CreateDNSZone(opt zones.CreateOpts) (*zones.Zone, error)
+
 	// ListDNSZones will list available DNS zones
 	ListDNSZones(opt zones.ListOptsBuilder) ([]zones.Zone, error)
 
 	// ListDNSRecordsets will list the DNS recordsets for the given zone id
 	ListDNSRecordsets(zoneID string, opt recordsets.ListOptsBuilder) ([]recordsets.RecordSet, error)
 
+	// CreateDNSRecordset will create the DNS recordset in the given zone, or update the existing recordset of the same name and type
+	CreateDNSRecordset(zoneID string, opt recordsets.CreateOpts) (*recordsets.RecordSet, error)
+
+	// DeleteDNSRecordset will delete the DNS recordset from the given zone
+	DeleteDNSRecordset(zoneID string, rrsetID string) error
+
 	GetLB(loadbalancerID string) (*loadbalancers.LoadBalancer, error)
 
 	CreateLB(opt loadbalancers.CreateOptsBuilder) (*loadbalancers.LoadBalancer, error)
 
+	// UpdateLB will update the mutable attributes of a loadbalancer
+	UpdateLB(lbID string, opts loadbalancers.UpdateOpts) (*loadbalancers.LoadBalancer, error)
+
 	ListLBs(opt loadbalancers.ListOptsBuilder) ([]loadbalancers.LoadBalancer, error)
 
-	// DeleteLB will delete loadbalancer
+	// ListClusterLBs will list the loadbalancers of the cluster by their tags, or by name without Octavia
+	ListClusterLBs(clusterName string) ([]loadbalancers.LoadBalancer, error)
+
+	// ListLoadBalancerAvailabilityZones will list the availability zones of Octavia
+	ListLoadBalancerAvailabilityZones() ([]LBAvailabilityZone, error)
+
+	// GetLBAvailabilityZone will return the Octavia availability zone of the loadbalancer
+	GetLBAvailabilityZone(lbID string) (string, error)
+
+	// WaitForLoadBalancerActive will wait until the loadbalancer reaches the ACTIVE provisioning status
+	WaitForLoadBalancerActive(lbID string) error
+
+	// DeleteLB will delete the loadbalancer and wait until it is gone, Cascade also deletes its listeners and pools
 	DeleteLB(lbID string, opt loadbalancers.DeleteOpts) error
 
 	GetApiIngressStatus(cluster *kops.Cluster) ([]kops.ApiIngressStatus, error)
 
 	FindClusterStatus(cluster *kops.Cluster) (*kops.ClusterStatus, error)
 
+	// GetComputeQuota will return the instance, core and RAM quotas of the project
+	GetComputeQuota() (*ComputeQuota, error)
+
+	// GetNetworkQuota will return the floating IP and port quotas of the project
+	GetNetworkQuota() (*NetworkQuota, error)
+
+	// GetVolumeQuota will return the volume and gigabyte quotas of the project
+	GetVolumeQuota() (*VolumeQuota, error)
+
 	// DefaultInstanceType determines a suitable instance type for the specified instance group
 	DefaultInstanceType(cluster *kops.Cluster, ig *kops.InstanceGroup) (string, error)
 
+	// ListFlavors will return the Nova flavors which match the options
+	ListFlavors(opt flavors.ListOpts) ([]flavors.Flavor, error)
+
+	// GetFlavor will return the Nova flavor with the given name or ID
+	GetFlavor(name string) (*flavors.Flavor, error)
+
+	// ListImages will return the Glance images which match the options
+	ListImages(opts ImageListOpts) ([]Image, error)
+
+	// GetImage will return the active Glance image with the given name or ID
+	GetImage(nameOrID string) (*Image, error)
+
 	// Returns the availability zones for the service client passed (compute, volume, network)
 	ListAvailabilityZones(serviceClient *gophercloud.ServiceClient) ([]az.AvailabilityZone, error)
 
@@ -248,12 +428,51 @@ type OpenstackCloud interface {
 
 	ListPools(v2pools.ListOpts) ([]v2pools.Pool, error)
 
+	// GetLBPool will return the loadbalancer pool with the given id
+	GetLBPool(poolID string) (*v2pools.Pool, error)
+
+	// ListPoolMembers will list the members of a loadbalancer pool
+	ListPoolMembers(poolID string, opts v2pools.ListMembersOpts) ([]v2pools.Member, error)
+
+	// UpdatePoolMember will update a member of a loadbalancer pool, e.g. its weight
+	UpdatePoolMember(poolID string, memberID string, opts v2pools.UpdateMemberOpts) (*v2pools.Member, error)
+
+	// DeletePoolMember will remove a member from a loadbalancer pool
+	DeletePoolMember(poolID string, memberID string) error
+
+	// CreateMonitor will create a health monitor for a loadbalancer pool
+	CreateMonitor(opts monitors.CreateOpts) (*monitors.Monitor, error)
+
+	// ListMonitors will return the health monitors which match the options
+	ListMonitors(opts monitors.ListOpts) ([]monitors.Monitor, error)
+
+	// UpdatePoolMonitor will update the timings of a health monitor
+	UpdatePoolMonitor(monitorID string, opts monitors.UpdateOpts) (*monitors.Monitor, error)
+
 	// DeletePool will delete loadbalancer pool
 	DeletePool(poolID string) error
 
 	ListListeners(opts listeners.ListOpts) ([]listeners.Listener, error)
 
-	CreateListener(opts listeners.CreateOpts) (*listeners.Listener, error)
+	CreateListener(opts listeners.CreateOptsBuilder) (*listeners.Listener, error)
+
+	// UpdateListener will update a loadbalancer listener
+	UpdateListener(listenerID string, opts listeners.UpdateOptsBuilder) (*listeners.Listener, error)
+
+	// SupportsLBTags returns true if the loadbalancer service can tag loadbalancers
+	SupportsLBTags() (bool, error)
+
+	// SupportsListenerAllowedCIDRs returns true if the loadbalancer service can restrict the sources of listeners
+	SupportsListenerAllowedCIDRs() (bool, error)
+
+	// GetListenerAllowedCIDRs will return the sources the listener accepts connections from, empty if all are allowed
+	GetListenerAllowedCIDRs(listenerID string) ([]string, error)
+
+	// LBProviderCapabilities will return the capabilities of the given Octavia loadbalancer provider
+	LBProviderCapabilities(provider string) (*LBProviderCapabilities, error)
+
+	// GetTLSContainer will return the Barbican container found at the given reference
+	GetTLSContainer(ref string) (*TLSContainer, error)
 
 	// DeleteListener will delete loadbalancer listener
 	DeleteListener(listenerID string) error
@@ -264,10 +483,17 @@ type OpenstackCloud interface {
 
 	AssociateFloatingIPToInstance(serverID string, opts floatingips.AssociateOpts) (err error)
 
+	// DisassociateFloatingIP will remove the floating IP from the server
+	DisassociateFloatingIP(serverID string, opts floatingips.DisassociateOpts) (err error)
+
 	ListFloatingIPs() (fips []floatingips.FloatingIP, err error)
 	ListL3FloatingIPs(opts l3floatingip.ListOpts) (fips []l3floatingip.FloatingIP, err error)
 	CreateFloatingIP(opts floatingips.CreateOpts) (*floatingips.FloatingIP, error)
 	CreateL3FloatingIP(opts l3floatingip.CreateOpts) (fip *l3floatingip.FloatingIP, err error)
+	// EnsureFloatingIP will return a floating IP of the external network, reusing an unassociated floating IP of the cluster
+	EnsureFloatingIP(networkID string) (*l3floatingip.FloatingIP, error)
+	// AssociateL3FloatingIPToPort will associate the Neutron floating IP with the port, e.g. the VIP port of a loadbalancer
+	AssociateL3FloatingIPToPort(fipID string, portID string) error
 	DeleteFloatingIP(id string) error
 	DeleteL3FloatingIP(id string) error
 }
@@ -278,12 +504,43 @@ type openstackCloud struct {
 	novaClient     *gophercloud.ServiceClient
 	dnsClient      *gophercloud.ServiceClient
 	lbClient       *gophercloud.ServiceClient
+	imageClient    *gophercloud.ServiceClient
+	barbicanClient *gophercloud.ServiceClient
 	extNetworkName *string
 	extSubnetName  *string
 	floatingSubnet *string
 	tags           map[string]string
 	region         string
 	useOctavia     bool
+	// ctx aborts requests and retries once it is done, set with WithContext
+	ctx context.Context
+	// readBackoff and writeBackoff are the backoff strategies for read and write retries
+	readBackoff  wait.Backoff
+	writeBackoff wait.Backoff
+	// images caches the images resolved by GetImage
+	images *imageCache
+	// regions are the regions of the service catalog
+	regions []string
+	// serviceRegions are the regions used for the services, by service name
+	serviceRegions map[string]string
+	// floatingNetwork and floatingNetworkID select the external network of the loadbalancer floating IPs
+	floatingNetwork   *string
+	floatingNetworkID *string
+	// floatingIPs holds the floating IPs handed out by EnsureFloatingIP
+	floatingIPs *floatingIPClaims
+	// extensions caches the extensions of the services
+	extensions *extensionCache
+	// projectID is the project the token is scoped to
+	projectID string
+	// lazyCinder, lazyLB and lazyDNS build the clients of the optional services on first use,
+	// they are only used when cinderClient, lbClient and dnsClient are not set
+	lazyCinder *lazyServiceClient
+	lazyLB     *lazyServiceClient
+	lazyDNS    *lazyServiceClient
+	// blockStorageMicroversion is the microversion requested from cinder
+	blockStorageMicroversion string
+	// serverConcurrency is the number of servers fetched at once, GetServers picks its default when 0
+	serverConcurrency int
 }
 
 var _ fi.Cloud = &openstackCloud{}
@@ -291,141 +548,232 @@ var _ fi.Cloud = &openstackCloud{}
 func NewOpenstackCloud(tags map[string]string, spec *kops.ClusterSpec) (OpenstackCloud, error) {
 	config := vfs.OpenstackConfig{}
 
-	authOption, err := config.GetCredential()
+	credentialProvider, authOption, err := config.GetCredentialProvider()
 	if err != nil {
 		return nil, err
 	}
 
-	/*
-		provider, err := os.AuthenticatedClient(authOption)
-		if err != nil {
-			return nil, fmt.Errorf("error building openstack authenticated client: %v", err)
-		}*/
-
-	provider, err := os.NewClient(authOption.IdentityEndpoint)
-	if err != nil {
-		return nil, fmt.Errorf("error building openstack provider client: %v", err)
-	}
-
 	region, err := config.GetRegion()
 	if err != nil {
 		return nil, fmt.Errorf("error finding openstack region: %v", err)
 	}
 
-	tlsconfig := &tls.Config{}
-	tlsconfig.InsecureSkipVerify = true
-	transport := &http.Transport{TLSClientConfig: tlsconfig}
-	provider.HTTPClient = http.Client{
-		Transport: transport,
-	}
+	clients, err := cachedOpenstackClients(region, authOption, func() (*gophercloud.ProviderClient, error) {
+		provider, err := os.NewClient(authOption.IdentityEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("error building openstack provider client: %v", err)
+		}
 
-	glog.V(2).Info("authenticating to keystone")
+		provider.HTTPClient, err = config.NewHTTPClient()
+		if err != nil {
+			return nil, fmt.Errorf("error building openstack http client: %v", err)
+		}
+		provider.HTTPClient = withRetryAfterTransport(withRequestIDTransport(withMetricsTransport(provider.HTTPClient)))
+		registerServiceEndpoint(provider.IdentityBase, "keystone")
 
-	err = os.Authenticate(provider, authOption)
+		glog.V(2).Info("authenticating to keystone")
+
+		err = vfs.AuthenticateOpenstackClient(provider, credentialProvider, authOption)
+		if err != nil {
+			return nil, fmt.Errorf("error building openstack authenticated client: %v", withRequestID(err))
+		}
+		return provider, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error building openstack authenticated client: %v", err)
+		return nil, err
 	}
 
-	//TODO: maybe try v2, and v3?
-	cinderClient, err := os.NewBlockStorageV2(provider, gophercloud.EndpointOpts{
-		Type:   "volumev2",
-		Region: region,
-	})
+	// an unknown region would only surface as missing endpoints of the services
+	regions, err := catalogRegions(clients.provider)
 	if err != nil {
-		return nil, fmt.Errorf("error building cinder client: %v", err)
+		return nil, err
+	}
+	if err := validateRegion(region, regions); err != nil {
+		return nil, err
+	}
+	serviceRegions, err := resolveServiceRegions(config, region, regions)
+	if err != nil {
+		return nil, err
+	}
+	projectID, err := authProjectID(clients.provider)
+	if err != nil {
+		// only the network quota check needs the project
+		glog.V(2).Infof("unable to determine the project of the token: %v", err)
 	}
 
-	neutronClient, err := os.NewNetworkV2(provider, gophercloud.EndpointOpts{
-		Type:   "network",
-		Region: region,
+	neutronClient, err := clients.serviceClient("neutron", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+		return os.NewNetworkV2(provider, gophercloud.EndpointOpts{
+			Type:   "network",
+			Region: serviceRegions["network"],
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error building neutron client: %v", err)
 	}
 
-	novaClient, err := os.NewComputeV2(provider, gophercloud.EndpointOpts{
-		Type:   "compute",
-		Region: region,
+	novaClient, err := clients.serviceClient("nova", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+		return os.NewComputeV2(provider, gophercloud.EndpointOpts{
+			Type:   "compute",
+			Region: serviceRegions["compute"],
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error building nova client: %v", err)
 	}
 
-	var dnsClient *gophercloud.ServiceClient
-	if !dns.IsGossipHostname(tags[TagClusterName]) {
-		//TODO: This should be replaced with the environment variable methods as done above
-		endpointOpt, err := config.GetServiceConfig("Designate")
+	imageClient, err := clients.serviceClient("glance", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+		return os.NewImageServiceV2(provider, gophercloud.EndpointOpts{
+			Type:   "image",
+			Region: serviceRegions["image"],
+		})
+	})
+	if _, ok := err.(*gophercloud.ErrEndpointNotFound); ok {
+		// images are looked up through the deprecated image proxy of nova instead
+		glog.Warningf("no image service found in region %q, using the image API of nova", serviceRegions["image"])
+		imageClient = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error building glance client: %v", err)
+	}
+
+	barbicanClient, err := clients.serviceClient("barbican", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+		return os.NewKeyManagerV1(provider, gophercloud.EndpointOpts{
+			Type:   "key-manager",
+			Region: serviceRegions["key-manager"],
+		})
+	})
+	if _, ok := err.(*gophercloud.ErrEndpointNotFound); ok {
+		// the key-manager is only required by listeners terminating TLS
+		glog.V(2).Infof("no key-manager service found in region %q", serviceRegions["key-manager"])
+		barbicanClient = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error building barbican client: %v", err)
+	}
+
+	c := &openstackCloud{
+		neutronClient:  neutronClient,
+		novaClient:     novaClient,
+		imageClient:    imageClient,
+		barbicanClient: barbicanClient,
+		images:         newImageCache(),
+		floatingIPs:    newFloatingIPClaims(),
+		extensions:     newExtensionCache(),
+		regions:        regions,
+		serviceRegions: serviceRegions,
+		projectID:      projectID,
+		tags:           tags,
+		region:         region,
+		useOctavia:     false,
+		readBackoff:    defaultReadBackoff,
+		writeBackoff:   defaultWriteBackoff,
+	}
+	if err := c.configureFromSpec(spec); err != nil {
+		return nil, err
+	}
+	if spec == nil || spec.CloudConfig == nil || spec.CloudConfig.Openstack == nil ||
+		spec.CloudConfig.Openstack.Loadbalancer == nil || spec.CloudConfig.Openstack.Loadbalancer.UseOctavia == nil {
+		useOctavia, err := config.GetUseOctavia()
 		if err != nil {
 			return nil, err
 		}
+		if useOctavia != nil {
+			c.useOctavia = *useOctavia
+		}
+	}
 
-		dnsClient, err = os.NewDNSV2(provider, endpointOpt)
+	// cinder, the loadbalancer service and designate are only built once a feature of the cluster needs them,
+	// so that clusters which do not use them can be deployed to clouds without these services
+	c.lazyCinder = newLazyServiceClient("volume (cinder)", func() (*gophercloud.ServiceClient, error) {
+		microversion := c.blockStorageMicroversion
+		client, err := clients.serviceClient(cinderClientName(microversion), func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+			return newCinderClient(provider, serviceRegions["volume"], microversion)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("error building dns client: %v", err)
+			return nil, err
 		}
+		return selectMicroversion(client, microversion), nil
+	})
+
+	if c.useOctavia {
+		glog.V(2).Infof("Openstack using Octavia lbaasv2 api")
+		c.lazyLB = newLazyServiceClient("load-balancer (octavia)", func() (*gophercloud.ServiceClient, error) {
+			return clients.serviceClient("octavia", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+				return os.NewLoadBalancerV2(provider, gophercloud.EndpointOpts{
+					Type:   "load-balancer",
+					Region: serviceRegions["load-balancer"],
+				})
+			})
+		})
+	} else {
+		glog.V(2).Infof("Openstack using deprecated lbaasv2 api")
+		c.lazyLB = newLazyServiceClient("network (neutron-lbaas)", func() (*gophercloud.ServiceClient, error) {
+			return clients.serviceClient("neutron-lbaas", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+				return os.NewNetworkV2(provider, gophercloud.EndpointOpts{
+					Region: serviceRegions["network"],
+				})
+			})
+		})
 	}
 
-	c := &openstackCloud{
-		cinderClient:  cinderClient,
-		neutronClient: neutronClient,
-		novaClient:    novaClient,
-		dnsClient:     dnsClient,
-		tags:          tags,
-		region:        region,
-		useOctavia:    false,
+	if !dns.IsGossipHostname(tags[TagClusterName]) {
+		endpointOpt := config.GetServiceEndpoint("Designate", "dns", serviceRegions["dns"])
+		serviceRegions["dns"] = endpointOpt.Region
+
+		c.lazyDNS = newLazyServiceClient("dns (designate)", func() (*gophercloud.ServiceClient, error) {
+			return clients.serviceClient("designate", func(provider *gophercloud.ProviderClient) (*gophercloud.ServiceClient, error) {
+				return os.NewDNSV2(provider, endpointOpt)
+			})
+		})
 	}
+	return c, nil
+}
 
-	octavia := false
-	if spec != nil &&
-		spec.CloudConfig != nil &&
-		spec.CloudConfig.Openstack != nil &&
-		spec.CloudConfig.Openstack.Router != nil {
+// configureFromSpec reads the cloud configuration from the OpenstackConfiguration of the cluster spec.
+// The spec is only read, derived and default values are populated by ApplyDefaults and PopulateFloatingNetworkID.
+func (c *openstackCloud) configureFromSpec(spec *kops.ClusterSpec) error {
+	if spec == nil || spec.CloudConfig == nil || spec.CloudConfig.Openstack == nil {
+		return nil
+	}
+	osc := spec.CloudConfig.Openstack
 
-		c.extNetworkName = spec.CloudConfig.Openstack.Router.ExternalNetwork
+	if osc.Router != nil {
+		c.extNetworkName = osc.Router.ExternalNetwork
+		c.extSubnetName = osc.Router.ExternalSubnet
+	}
+	if osc.Loadbalancer != nil {
+		c.useOctavia = fi.BoolValue(osc.Loadbalancer.UseOctavia)
+		c.floatingSubnet = osc.Loadbalancer.FloatingSubnet
+		c.floatingNetwork = osc.Loadbalancer.FloatingNetwork
+		c.floatingNetworkID = osc.Loadbalancer.FloatingNetworkID
+	}
 
-		if spec.CloudConfig.Openstack.Router.ExternalSubnet != nil {
-			c.extSubnetName = spec.CloudConfig.Openstack.Router.ExternalSubnet
-		}
-		if spec.CloudConfig.Openstack.Loadbalancer != nil &&
-			spec.CloudConfig.Openstack.Loadbalancer.FloatingNetworkID == nil &&
-			spec.CloudConfig.Openstack.Loadbalancer.FloatingNetwork != nil {
-			// This field is derived
-			lbNet, err := c.ListNetworks(networks.ListOpts{
-				Name: fi.StringValue(spec.CloudConfig.Openstack.Loadbalancer.FloatingNetwork),
-			})
-			if err != nil || len(lbNet) != 1 {
-				return c, fmt.Errorf("could not establish floating network id.")
+	var err error
+	c.readBackoff, err = backoffFromSpec(c.readBackoff, osc.ReadBackoff)
+	if err != nil {
+		return fmt.Errorf("invalid openstack readBackoff: %v", err)
+	}
+	c.writeBackoff, err = backoffFromSpec(c.writeBackoff, osc.WriteBackoff)
+	if err != nil {
+		return fmt.Errorf("invalid openstack writeBackoff: %v", err)
+	}
+
+	for _, v := range []*string{osc.ComputeMicroversion, osc.BlockStorageMicroversion} {
+		if v != nil {
+			if _, _, ok := parseMicroversion(*v); !ok {
+				return fmt.Errorf("invalid openstack microversion %q, expected major.minor", *v)
 			}
-			spec.CloudConfig.Openstack.Loadbalancer.FloatingNetworkID = fi.String(lbNet[0].ID)
-		}
-		if spec.CloudConfig.Openstack.Loadbalancer.UseOctavia != nil {
-			octavia = fi.BoolValue(spec.CloudConfig.Openstack.Loadbalancer.UseOctavia)
-		}
-		if spec.CloudConfig.Openstack.Loadbalancer.FloatingSubnet != nil {
-			c.floatingSubnet = spec.CloudConfig.Openstack.Loadbalancer.FloatingSubnet
 		}
 	}
-	c.useOctavia = octavia
-	var lbClient *gophercloud.ServiceClient
-	if octavia {
-		glog.V(2).Infof("Openstack using Octavia lbaasv2 api")
-		lbClient, err = os.NewLoadBalancerV2(provider, gophercloud.EndpointOpts{
-			Region: region,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error building lb client: %v", err)
-		}
-	} else {
-		glog.V(2).Infof("Openstack using deprecated lbaasv2 api")
-		lbClient, err = os.NewNetworkV2(provider, gophercloud.EndpointOpts{
-			Region: region,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error building lb client: %v", err)
+	c.novaClient = selectMicroversion(c.novaClient, fi.StringValue(osc.ComputeMicroversion))
+	// the cinder client is built on first use, which selects the microversion
+	c.blockStorageMicroversion = fi.StringValue(osc.BlockStorageMicroversion)
+
+	if osc.ServerConcurrency != nil {
+		if *osc.ServerConcurrency <= 0 {
+			return fmt.Errorf("invalid openstack serverConcurrency %d, expected a positive number", *osc.ServerConcurrency)
 		}
+		c.serverConcurrency = *osc.ServerConcurrency
 	}
-	c.lbClient = lbClient
-	return c, nil
+	return nil
 }
 
 func (c *openstackCloud) UseOctavia() bool {
@@ -436,20 +784,50 @@ func (c *openstackCloud) ComputeClient() *gophercloud.ServiceClient {
 	return c.novaClient
 }
 
-func (c *openstackCloud) BlockStorageClient() *gophercloud.ServiceClient {
-	return c.cinderClient
-}
-
 func (c *openstackCloud) NetworkingClient() *gophercloud.ServiceClient {
 	return c.neutronClient
 }
 
-func (c *openstackCloud) LoadBalancerClient() *gophercloud.ServiceClient {
-	return c.lbClient
+// BlockStorageClient returns the cinder client, which is built on first use
+func (c *openstackCloud) BlockStorageClient() (*gophercloud.ServiceClient, error) {
+	return c.optionalServiceClient("volume (cinder)", c.cinderClient, c.lazyCinder)
 }
 
-func (c *openstackCloud) DNSClient() *gophercloud.ServiceClient {
-	return c.dnsClient
+// LoadBalancerClient returns the loadbalancer client, which is built on first use
+func (c *openstackCloud) LoadBalancerClient() (*gophercloud.ServiceClient, error) {
+	return c.optionalServiceClient("load-balancer", c.lbClient, c.lazyLB)
+}
+
+// DNSClient returns the designate client, which is built on first use
+func (c *openstackCloud) DNSClient() (*gophercloud.ServiceClient, error) {
+	return c.optionalServiceClient("dns (designate)", c.dnsClient, c.lazyDNS)
+}
+
+// optionalServiceClient returns the client of the service if it is set, otherwise builds it on first use
+// and binds it to the context of the cloud
+func (c *openstackCloud) optionalServiceClient(service string, client *gophercloud.ServiceClient, lazy *lazyServiceClient) (*gophercloud.ServiceClient, error) {
+	if client != nil {
+		return client, nil
+	}
+	if lazy == nil {
+		return nil, fmt.Errorf("this cluster does not use the %s service", service)
+	}
+	client, err := lazy.get()
+	if err != nil {
+		return nil, err
+	}
+	if c.ctx != nil {
+		client = contextServiceClient(c.ctx, client)
+	}
+	return client, nil
+}
+
+func (c *openstackCloud) ImageClient() *gophercloud.ServiceClient {
+	return c.imageClient
+}
+
+func (c *openstackCloud) KeyManagerClient() *gophercloud.ServiceClient {
+	return c.barbicanClient
 }
 
 func (c *openstackCloud) Region() string {
@@ -472,39 +850,106 @@ func (c *openstackCloud) FindVPCInfo(id string) (*fi.VPCInfo, error) {
 	return nil, fmt.Errorf("openstackCloud::FindVPCInfo not implemented")
 }
 
-// DeleteGroup in openstack will delete servergroup, instances and ports
+// DeleteGroup in openstack will delete the instances of the group with their floating IPs, the trunks, the ports and the servergroup.
+// Resources which are already gone are skipped, so a deletion which failed halfway can be run again.
 func (c *openstackCloud) DeleteGroup(g *cloudinstances.CloudInstanceGroup) error {
 	grp := g.Raw.(*servergroups.ServerGroup)
 
-	for _, id := range grp.Members {
+	instanceIDs := sets.NewString(grp.Members...)
+	for _, member := range append(g.Ready, g.NeedUpdate...) {
+		instanceIDs.Insert(member.ID)
+	}
+
+	ports, err := c.ListPorts(ports.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("Could not list ports %v", err)
+	}
+	portIDs := sets.NewString()
+	for _, port := range ports {
+		if instanceIDs.Has(port.DeviceID) || strings.Contains(port.Name, grp.Name) || isInstanceGroupPort(port.Name, grp.Name, g.InstanceGroup) {
+			portIDs.Insert(port.ID)
+		}
+	}
+
+	fips, err := c.ListFloatingIPs()
+	if err != nil {
+		return fmt.Errorf("Could not list floating IPs: %v", err)
+	}
+	for _, fip := range fips {
+		if instanceIDs.Has(fip.InstanceID) {
+			if err := c.DeleteFloatingIP(fip.ID); err != nil {
+				return fmt.Errorf("Could not delete floating IP %q: %v", fip.ID, err)
+			}
+		}
+	}
+	if portIDs.Len() > 0 {
+		l3fips, err := c.ListL3FloatingIPs(l3floatingip.ListOpts{})
+		if err != nil {
+			return fmt.Errorf("Could not list L3 floating IPs: %v", err)
+		}
+		for _, fip := range l3fips {
+			if portIDs.Has(fip.PortID) {
+				if err := c.DeleteL3FloatingIP(fip.ID); err != nil {
+					return fmt.Errorf("Could not delete L3 floating IP %q: %v", fip.ID, err)
+				}
+			}
+		}
+	}
+
+	for _, id := range instanceIDs.List() {
 		err := c.DeleteInstanceWithID(id)
 		if err != nil {
 			return fmt.Errorf("Could not delete instance %q: %v", id, err)
 		}
 	}
 
-	ports, err := c.ListPorts(ports.ListOpts{})
+	subPortIDs, err := c.deleteTrunksOfPorts(portIDs)
 	if err != nil {
-		return fmt.Errorf("Could not list ports %v", err)
+		return err
 	}
+	portIDs.Insert(subPortIDs...)
 
-	for _, port := range ports {
-		if strings.Contains(port.Name, grp.Name) {
-			err := c.DeletePort(port.ID)
-			if err != nil {
-				return fmt.Errorf("Could not delete port %q: %v", port.ID, err)
-			}
+	for _, id := range portIDs.List() {
+		err := c.DeletePort(id)
+		if err != nil {
+			return fmt.Errorf("Could not delete port %q: %v", id, err)
 		}
 	}
 
-	err = c.DeleteServerGroup(grp.ID)
+	// nova refuses to delete the server group while the deleted instances are still its members
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := c.DeleteServerGroup(grp.ID)
+		if isConflict(err) {
+			return false, nil
+		}
+		return true, err
+	})
+	if err == nil && !done {
+		err = wait.ErrWaitTimeout
+	}
 	if err != nil {
-		return fmt.Errorf("Could not server group %q: %v", grp.ID, err)
+		return fmt.Errorf("Could not delete server group %q: %v", grp.ID, err)
 	}
 
 	return nil
 }
 
+// isInstanceGroupPort returns true for the ports the model creates for the instances of the group,
+// they are named port-<ig>-<n>-<cluster>, with the dots of the cluster name replaced by dashes
+func isInstanceGroupPort(name string, groupName string, ig *kops.InstanceGroup) bool {
+	if ig == nil {
+		return false
+	}
+	clusterName := strings.TrimSuffix(groupName, "-"+ig.ObjectMeta.Name)
+	prefix := strings.ToLower("port-" + ig.ObjectMeta.Name + "-")
+	suffix := strings.ToLower("-" + strings.Replace(clusterName, ".", "-", -1))
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+		return false
+	}
+	_, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+	return err == nil
+}
+
 func (c *openstackCloud) GetCloudGroups(cluster *kops.Cluster, instancegroups []*kops.InstanceGroup, warnUnmatched bool, nodes []v1.Node) (map[string]*cloudinstances.CloudInstanceGroup, error) {
 	nodeMap := cloudinstances.GetNodeMap(nodes, cluster)
 	groups := make(map[string]*cloudinstances.CloudInstanceGroup)
@@ -515,6 +960,7 @@ func (c *openstackCloud) GetCloudGroups(cluster *kops.Cluster, instancegroups []
 	}
 
 	for _, grp := range serverGrps {
+		grp := grp
 		name := grp.Name
 		instancegroup, err := matchInstanceGroup(name, cluster.ObjectMeta.Name, instancegroups)
 		if err != nil {
@@ -531,6 +977,11 @@ func (c *openstackCloud) GetCloudGroups(cluster *kops.Cluster, instancegroups []
 			return nil, fmt.Errorf("error getting cloud instance group %q: %v", instancegroup.ObjectMeta.Name, err)
 		}
 	}
+
+	err = c.addTaggedInstances(cluster, instancegroups, groups, warnUnmatched, nodeMap)
+	if err != nil {
+		return nil, err
+	}
 	return groups, nil
 }
 
@@ -538,6 +989,9 @@ func (c *openstackCloud) GetCloudTags() map[string]string {
 	return c.tags
 }
 
+// GetApiIngressStatus returns the addresses the API is reached at. With a loadbalancer these are the floating IPs
+// of the loadbalancers, or their VIPs when they have no floating IP or are internal. Without a loadbalancer,
+// e.g. with gossip, these are the addresses of the masters, their floating IPs where they have one.
 func (c *openstackCloud) GetApiIngressStatus(cluster *kops.Cluster) ([]kops.ApiIngressStatus, error) {
 	var ingresses []kops.ApiIngressStatus
 	if cluster.Spec.MasterPublicName != "" {
@@ -547,29 +1001,104 @@ func (c *openstackCloud) GetApiIngressStatus(cluster *kops.Cluster) ([]kops.ApiI
 			Name: cluster.Spec.MasterPublicName,
 		})
 		if err != nil {
-			return ingresses, fmt.Errorf("GetApiIngressStatus: Failed to list openstack loadbalancers: %v", err)
-		}
-		// Must Find Floating IP related to this lb
-		fips, err := c.ListFloatingIPs()
-		if err != nil {
-			return ingresses, fmt.Errorf("GetApiIngressStatus: Failed to list floating IP's: %v", err)
+			return ingresses, fmt.Errorf("GetApiIngressStatus: Failed to list openstack loadbalancers: %v", withRequestID(err))
 		}
-
-		for _, lb := range lbList {
-			for _, fip := range fips {
-				if fip.FixedIP == lb.VipAddress {
-
+		if len(lbList) > 0 {
+			internal := cluster.Spec.API != nil && cluster.Spec.API.LoadBalancer != nil && cluster.Spec.API.LoadBalancer.Type == kops.LoadBalancerTypeInternal
+			for _, lb := range lbList {
+				found := false
+				if !internal && lb.VipPortID != "" {
+					// the floating IP of the API is associated with the VIP port of the loadbalancer
+					fips, err := c.ListL3FloatingIPs(l3floatingip.ListOpts{
+						PortID: lb.VipPortID,
+					})
+					if err != nil {
+						return ingresses, fmt.Errorf("GetApiIngressStatus: Failed to list floating IP's: %v", err)
+					}
+					for _, fip := range fips {
+						ingresses = append(ingresses, kops.ApiIngressStatus{
+							IP: fip.FloatingIP,
+						})
+						found = true
+					}
+				}
+				if !found && lb.VipAddress != "" {
+					// an internal loadbalancer is reached at its VIP
 					ingresses = append(ingresses, kops.ApiIngressStatus{
-						IP: fip.IP,
+						IP: lb.VipAddress,
 					})
 				}
 			}
+			return ingresses, nil
 		}
 	}
 
+	glog.V(2).Infof("Querying Openstack to find the masters for API (%q)", cluster.Name)
+	instances, err := c.ListClusterInstances(cluster.Name)
+	if err != nil {
+		return ingresses, fmt.Errorf("GetApiIngressStatus: Failed to list instances: %v", err)
+	}
+	for i := range instances {
+		if instances[i].Metadata[TagNameRolePrefix+strings.ToLower(string(kops.InstanceGroupRoleMaster))] != "1" {
+			continue
+		}
+		if ip := serverIngressAddress(&instances[i]); ip != "" {
+			ingresses = append(ingresses, kops.ApiIngressStatus{
+				IP: ip,
+			})
+		}
+	}
+	sort.Slice(ingresses, func(i, j int) bool {
+		return ingresses[i].IP < ingresses[j].IP
+	})
 	return ingresses, nil
 }
 
+// serverIngressAddress returns the floating IP of the server, or its fixed IP if it has none
+func serverIngressAddress(server *servers.Server) string {
+	floating, fixed := serverFloatingAndFixedIP(server)
+	if floating != "" {
+		return floating
+	}
+	return fixed
+}
+
+// serverFloatingAndFixedIP returns the first floating and the first fixed IP of the server, ordered by network name
+func serverFloatingAndFixedIP(server *servers.Server) (floating string, fixed string) {
+	networks := make([]string, 0, len(server.Addresses))
+	for network := range server.Addresses {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		addrList, ok := server.Addresses[network].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, addr := range addrList {
+			addrMap, ok := addr.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ip, ok := addrMap[openstackAddress].(string)
+			if !ok {
+				continue
+			}
+			switch addrMap[openstackExternalIPType] {
+			case openstackAddressFloating:
+				if floating == "" {
+					floating = ip
+				}
+			case openstackAddressFixed:
+				if fixed == "" {
+					fixed = ip
+				}
+			}
+		}
+	}
+	return floating, fixed
+}
+
 func isNotFound(err error) bool {
 	if _, ok := err.(gophercloud.ErrDefault404); ok {
 		return true
@@ -583,3 +1112,88 @@ func isNotFound(err error) bool {
 
 	return false
 }
+
+// isForbidden returns true if the policy of the cloud does not allow the request
+func isForbidden(err error) bool {
+	if _, ok := err.(gophercloud.ErrDefault403); ok {
+		return true
+	}
+
+	if errCode, ok := err.(gophercloud.ErrUnexpectedResponseCode); ok {
+		if errCode.Actual == http.StatusForbidden {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isConflict returns true if the request was refused because of the current state of the resource,
+// e.g. a security group which is still in use
+func isConflict(err error) bool {
+	if errCode, ok := err.(gophercloud.ErrUnexpectedResponseCode); ok {
+		if errCode.Actual == http.StatusConflict {
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectStatusMessages are fragments of the 403 response body returned by
+// OpenStack services when the project has been suspended or made read-only.
+var projectStatusMessages = []string{
+	"suspended",
+	"read-only",
+	"read only",
+	"readonly",
+}
+
+// forbiddenMessages mark the messages of the gophercloud 403 errors, the response body follows them
+var forbiddenMessages = []string{
+	"Request forbidden: ",
+	"but got 403 instead\n",
+}
+
+// isProjectStatusError returns true if the error reports that the project is suspended or read-only.
+// Writes will keep failing until an operator changes the project status, so there is no point in
+// retrying them. The conditions of retryWithBackoff format the gophercloud errors into their own
+// messages, so the response body is also looked up in the message of other errors.
+func isProjectStatusError(err error) bool {
+	if e, ok := err.(*requestIDError); ok {
+		err = e.err
+	}
+
+	var body string
+	switch e := err.(type) {
+	case nil:
+		return false
+	case gophercloud.ErrDefault403:
+		body = string(e.Body)
+	case gophercloud.ErrUnexpectedResponseCode:
+		if e.Actual != http.StatusForbidden {
+			return false
+		}
+		body = string(e.Body)
+	default:
+		msg := err.Error()
+		for _, m := range forbiddenMessages {
+			if i := strings.Index(msg, m); i >= 0 {
+				body = msg[i+len(m):]
+				break
+			}
+		}
+	}
+
+	msg := strings.ToLower(body)
+	for _, s := range projectStatusMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func newProjectStatusError(err error) error {
+	return fmt.Errorf("openstack project is suspended/read-only, write operations are not permitted: %v", err)
+}
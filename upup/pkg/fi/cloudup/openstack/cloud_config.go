@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+const (
+	defaultLBMethod            = "ROUND_ROBIN"
+	defaultLBProvider          = "haproxy"
+	defaultOctaviaLBProvider   = "octavia"
+	defaultBlockStorageVersion = "v2"
+	defaultMonitorDelay        = "1m"
+	defaultMonitorTimeout      = "30s"
+	defaultMonitorMaxRetries   = 3
+)
+
+// ApplyDefaults populates unset fields of the OpenstackConfiguration with their default values
+func ApplyDefaults(spec *kops.ClusterSpec) {
+	if spec.CloudConfig == nil || spec.CloudConfig.Openstack == nil {
+		return
+	}
+	osc := spec.CloudConfig.Openstack
+
+	if osc.Loadbalancer == nil {
+		osc.Loadbalancer = &kops.OpenstackLoadbalancerConfig{}
+	}
+	if osc.Loadbalancer.Method == nil {
+		osc.Loadbalancer.Method = fi.String(defaultLBMethod)
+	}
+	if osc.Loadbalancer.Provider == nil {
+		if fi.BoolValue(osc.Loadbalancer.UseOctavia) {
+			osc.Loadbalancer.Provider = fi.String(defaultOctaviaLBProvider)
+		} else {
+			osc.Loadbalancer.Provider = fi.String(defaultLBProvider)
+		}
+	}
+
+	if osc.BlockStorage == nil {
+		osc.BlockStorage = &kops.OpenstackBlockStorageConfig{}
+	}
+	if osc.BlockStorage.Version == nil {
+		osc.BlockStorage.Version = fi.String(defaultBlockStorageVersion)
+	}
+
+	if osc.Monitor == nil {
+		osc.Monitor = &kops.OpenstackMonitor{}
+	}
+	if osc.Monitor.Delay == nil {
+		osc.Monitor.Delay = fi.String(defaultMonitorDelay)
+	}
+	if osc.Monitor.Timeout == nil {
+		osc.Monitor.Timeout = fi.String(defaultMonitorTimeout)
+	}
+	if osc.Monitor.MaxRetries == nil {
+		osc.Monitor.MaxRetries = fi.Int(defaultMonitorMaxRetries)
+	}
+}
+
+// backoffFromSpec overrides the fields of the backoff which are set in the spec
+func backoffFromSpec(backoff wait.Backoff, spec *kops.OpenstackBackoff) (wait.Backoff, error) {
+	if spec == nil {
+		return backoff, nil
+	}
+	if spec.Duration != nil {
+		d, err := time.ParseDuration(fi.StringValue(spec.Duration))
+		if err != nil {
+			return backoff, fmt.Errorf("invalid duration %q: %v", fi.StringValue(spec.Duration), err)
+		}
+		backoff.Duration = d
+	}
+	if spec.Factor != nil {
+		f, err := strconv.ParseFloat(fi.StringValue(spec.Factor), 64)
+		if err != nil || f < 1 {
+			return backoff, fmt.Errorf("invalid factor %q, must be a number of at least 1", fi.StringValue(spec.Factor))
+		}
+		backoff.Factor = f
+	}
+	if spec.Jitter != nil {
+		j, err := strconv.ParseFloat(fi.StringValue(spec.Jitter), 64)
+		if err != nil || j < 0 {
+			return backoff, fmt.Errorf("invalid jitter %q, must be a positive number", fi.StringValue(spec.Jitter))
+		}
+		backoff.Jitter = j
+	}
+	if spec.Steps != nil {
+		if fi.IntValue(spec.Steps) < 1 {
+			return backoff, fmt.Errorf("invalid steps %d, must be at least 1", fi.IntValue(spec.Steps))
+		}
+		backoff.Steps = fi.IntValue(spec.Steps)
+	}
+	return backoff, nil
+}
+
+// PopulateFloatingNetworkID sets the derived loadbalancer FloatingNetworkID from the FloatingNetwork name
+func PopulateFloatingNetworkID(cloud OpenstackCloud, spec *kops.ClusterSpec) error {
+	if spec.CloudConfig == nil || spec.CloudConfig.Openstack == nil {
+		return nil
+	}
+	lb := spec.CloudConfig.Openstack.Loadbalancer
+	if lb == nil || lb.FloatingNetworkID != nil || lb.FloatingNetwork == nil {
+		return nil
+	}
+
+	lbNet, err := cloud.ListNetworks(networks.ListOpts{
+		Name: fi.StringValue(lb.FloatingNetwork),
+	})
+	if err != nil || len(lbNet) != 1 {
+		return fmt.Errorf("could not establish floating network id.")
+	}
+	lb.FloatingNetworkID = fi.String(lbNet[0].ID)
+	return nil
+}
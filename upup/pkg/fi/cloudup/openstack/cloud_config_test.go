@@ -0,0 +1,245 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestConfigureFromSpecDoesNotMutateSpec(t *testing.T) {
+	spec := &kops.ClusterSpec{
+		CloudConfig: &kops.CloudConfiguration{
+			Openstack: &kops.OpenstackConfiguration{
+				Router: &kops.OpenstackRouter{
+					ExternalNetwork: fi.String("ext-net"),
+					ExternalSubnet:  fi.String("ext-subnet"),
+				},
+				Loadbalancer: &kops.OpenstackLoadbalancerConfig{
+					FloatingNetwork: fi.String("ext-net"),
+					FloatingSubnet:  fi.String("lb-subnet"),
+					UseOctavia:      fi.Bool(true),
+				},
+			},
+		},
+	}
+	original := spec.DeepCopy()
+
+	c := &openstackCloud{}
+	c.configureFromSpec(spec)
+
+	if !reflect.DeepEqual(spec, original) {
+		t.Errorf("spec was mutated while configuring the cloud")
+	}
+	if fi.StringValue(c.extNetworkName) != "ext-net" {
+		t.Errorf("unexpected external network %q", fi.StringValue(c.extNetworkName))
+	}
+	if fi.StringValue(c.extSubnetName) != "ext-subnet" {
+		t.Errorf("unexpected external subnet %q", fi.StringValue(c.extSubnetName))
+	}
+	if fi.StringValue(c.floatingSubnet) != "lb-subnet" {
+		t.Errorf("unexpected floating subnet %q", fi.StringValue(c.floatingSubnet))
+	}
+	if !c.useOctavia {
+		t.Errorf("expected octavia to be used")
+	}
+}
+
+func TestConfigureFromSpecWithoutLoadbalancer(t *testing.T) {
+	spec := &kops.ClusterSpec{
+		CloudConfig: &kops.CloudConfiguration{
+			Openstack: &kops.OpenstackConfiguration{
+				Router: &kops.OpenstackRouter{
+					ExternalNetwork: fi.String("ext-net"),
+				},
+			},
+		},
+	}
+
+	c := &openstackCloud{}
+	c.configureFromSpec(spec)
+
+	if c.useOctavia {
+		t.Errorf("expected octavia not to be used")
+	}
+	if spec.CloudConfig.Openstack.Loadbalancer != nil {
+		t.Errorf("spec was mutated while configuring the cloud")
+	}
+}
+
+func TestConfigureFromSpecServerConcurrency(t *testing.T) {
+	for _, concurrency := range []int{0, -1} {
+		spec := &kops.ClusterSpec{
+			CloudConfig: &kops.CloudConfiguration{
+				Openstack: &kops.OpenstackConfiguration{ServerConcurrency: fi.Int(concurrency)},
+			},
+		}
+		if err := (&openstackCloud{}).configureFromSpec(spec); err == nil {
+			t.Errorf("expected serverConcurrency %d to be rejected", concurrency)
+		}
+	}
+
+	spec := &kops.ClusterSpec{
+		CloudConfig: &kops.CloudConfiguration{
+			Openstack: &kops.OpenstackConfiguration{ServerConcurrency: fi.Int(3)},
+		},
+	}
+	c := &openstackCloud{}
+	if err := c.configureFromSpec(spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.serverConcurrency != 3 {
+		t.Errorf("expected a server concurrency of 3, got %d", c.serverConcurrency)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	grid := []struct {
+		useOctavia       bool
+		expectedProvider string
+	}{
+		{
+			useOctavia:       false,
+			expectedProvider: "haproxy",
+		},
+		{
+			useOctavia:       true,
+			expectedProvider: "octavia",
+		},
+	}
+	for _, g := range grid {
+		spec := &kops.ClusterSpec{
+			CloudConfig: &kops.CloudConfiguration{
+				Openstack: &kops.OpenstackConfiguration{
+					Loadbalancer: &kops.OpenstackLoadbalancerConfig{
+						UseOctavia: fi.Bool(g.useOctavia),
+					},
+				},
+			},
+		}
+		ApplyDefaults(spec)
+
+		expected := &kops.OpenstackConfiguration{
+			Loadbalancer: &kops.OpenstackLoadbalancerConfig{
+				Method:     fi.String("ROUND_ROBIN"),
+				Provider:   fi.String(g.expectedProvider),
+				UseOctavia: fi.Bool(g.useOctavia),
+			},
+			BlockStorage: &kops.OpenstackBlockStorageConfig{
+				Version: fi.String("v2"),
+			},
+			Monitor: &kops.OpenstackMonitor{
+				Delay:      fi.String("1m"),
+				Timeout:    fi.String("30s"),
+				MaxRetries: fi.Int(3),
+			},
+		}
+		if !reflect.DeepEqual(spec.CloudConfig.Openstack, expected) {
+			t.Errorf("unexpected defaults for octavia=%v: %+v", g.useOctavia, spec.CloudConfig.Openstack)
+		}
+	}
+}
+
+func TestApplyDefaultsKeepsExplicitValues(t *testing.T) {
+	spec := &kops.ClusterSpec{
+		CloudConfig: &kops.CloudConfiguration{
+			Openstack: &kops.OpenstackConfiguration{
+				Loadbalancer: &kops.OpenstackLoadbalancerConfig{
+					Method:   fi.String("LEAST_CONNECTIONS"),
+					Provider: fi.String("amphora"),
+				},
+				Monitor: &kops.OpenstackMonitor{
+					MaxRetries: fi.Int(5),
+				},
+			},
+		},
+	}
+	ApplyDefaults(spec)
+
+	osc := spec.CloudConfig.Openstack
+	if fi.StringValue(osc.Loadbalancer.Method) != "LEAST_CONNECTIONS" {
+		t.Errorf("loadbalancer method was overwritten: %q", fi.StringValue(osc.Loadbalancer.Method))
+	}
+	if fi.StringValue(osc.Loadbalancer.Provider) != "amphora" {
+		t.Errorf("loadbalancer provider was overwritten: %q", fi.StringValue(osc.Loadbalancer.Provider))
+	}
+	if fi.IntValue(osc.Monitor.MaxRetries) != 5 {
+		t.Errorf("monitor max retries was overwritten: %d", fi.IntValue(osc.Monitor.MaxRetries))
+	}
+	if fi.StringValue(osc.Monitor.Delay) != "1m" {
+		t.Errorf("expected default monitor delay, got %q", fi.StringValue(osc.Monitor.Delay))
+	}
+}
+
+func TestBackoffFromSpec(t *testing.T) {
+	defaults := wait.Backoff{Duration: time.Second, Factor: 1.5, Jitter: 0.1, Steps: 4}
+	grid := []struct {
+		spec     *kops.OpenstackBackoff
+		expected wait.Backoff
+		err      bool
+	}{
+		{
+			spec:     nil,
+			expected: defaults,
+		},
+		{
+			spec:     &kops.OpenstackBackoff{Steps: fi.Int(10)},
+			expected: wait.Backoff{Duration: time.Second, Factor: 1.5, Jitter: 0.1, Steps: 10},
+		},
+		{
+			spec: &kops.OpenstackBackoff{
+				Duration: fi.String("500ms"),
+				Factor:   fi.String("2"),
+				Jitter:   fi.String("0"),
+			},
+			expected: wait.Backoff{Duration: 500 * time.Millisecond, Factor: 2, Jitter: 0, Steps: 4},
+		},
+		{
+			spec: &kops.OpenstackBackoff{Duration: fi.String("soon")},
+			err:  true,
+		},
+		{
+			spec: &kops.OpenstackBackoff{Factor: fi.String("0.5")},
+			err:  true,
+		},
+		{
+			spec: &kops.OpenstackBackoff{Steps: fi.Int(0)},
+			err:  true,
+		},
+	}
+	for i, g := range grid {
+		actual, err := backoffFromSpec(defaults, g.spec)
+		if g.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, g.expected) {
+			t.Errorf("case %d: expected %+v, got %+v", i, g.expected, actual)
+		}
+	}
+}
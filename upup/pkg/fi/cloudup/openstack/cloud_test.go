@@ -0,0 +1,342 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+)
+
+// newTestServiceClient returns a service client which sends all requests to the given test server
+func newTestServiceClient(server *httptest.Server) *gophercloud.ServiceClient {
+	return &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       server.URL + "/",
+	}
+}
+
+func TestIsProjectStatusError(t *testing.T) {
+	grid := []struct {
+		err      error
+		expected bool
+	}{
+		{
+			err: gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusForbidden,
+				Body:   []byte(`{"forbidden": {"message": "Project 1234 is suspended"}}`),
+			}},
+			expected: true,
+		},
+		{
+			err: &requestIDError{err: gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusForbidden,
+				Body:   []byte(`{"forbidden": {"message": "Project 1234 is suspended"}}`),
+			}}, requestID: "req-1"},
+			expected: true,
+		},
+		{
+			err: fmt.Errorf("error deleting volume: %v", gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Method: "DELETE",
+				URL:    "http://cinder/volumes/1",
+				Actual: http.StatusForbidden,
+				Body:   []byte(`{"forbidden": {"message": "Project 1234 is suspended"}}`),
+			}}),
+			expected: true,
+		},
+		{
+			err:      fmt.Errorf("error creating volume: %v", gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusConflict, Body: []byte(`volume is read-only`)}),
+			expected: false,
+		},
+		{
+			err: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusForbidden,
+				Body:   []byte(`{"error": "project is in Read-Only mode"}`),
+			},
+			expected: true,
+		},
+		{
+			err: gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusForbidden,
+				Body:   []byte(`{"forbidden": {"message": "Policy doesn't allow this operation"}}`),
+			}},
+			expected: false,
+		},
+		{
+			err: gophercloud.ErrUnexpectedResponseCode{
+				Actual: http.StatusConflict,
+				Body:   []byte(`{"error": "volume is read-only"}`),
+			},
+			expected: false,
+		},
+		{
+			err:      nil,
+			expected: false,
+		},
+	}
+	for _, g := range grid {
+		actual := isProjectStatusError(g.err)
+		if actual != g.expected {
+			t.Errorf("unexpected result for %v: expected %v, got %v", g.err, g.expected, actual)
+		}
+	}
+}
+
+func TestSuspendedProjectSkipsRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"forbidden": {"message": "Project is suspended", "code": 403}}`))
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+	}
+
+	_, err := c.CreateVolume(cinder.CreateOpts{Size: 1})
+	if err == nil {
+		t.Fatalf("expected error creating volume in suspended project")
+	}
+	if !strings.Contains(err.Error(), "suspended/read-only") {
+		t.Errorf("expected descriptive error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	var deleted []string
+	serverGroupDeletes := 0
+	trunkDeletes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "DELETE" {
+			switch r.URL.Path {
+			case "/servers/srv-2":
+				// already deleted
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"itemNotFound": {"code": 404, "message": "Instance srv-2 could not be found."}}`)
+				return
+			case "/os-server-groups/sg-1":
+				serverGroupDeletes++
+				if serverGroupDeletes == 1 {
+					w.WriteHeader(http.StatusConflict)
+					fmt.Fprint(w, `{"conflictingRequest": {"code": 409, "message": "Server group sg-1 still has members."}}`)
+					return
+				}
+			case "/trunks/trunk-1":
+				trunkDeletes++
+				if trunkDeletes == 1 {
+					w.WriteHeader(http.StatusConflict)
+					fmt.Fprint(w, `{"NeutronError": {"type": "TrunkInUse", "message": "Trunk trunk-1 is currently in use."}}`)
+					return
+				}
+			}
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		switch r.URL.Path {
+		case "/os-floating-ips":
+			fmt.Fprint(w, `{"floating_ips": [
+				{"id": "fip-1", "instance_id": "srv-1", "ip": "10.0.0.1"},
+				{"id": "fip-9", "instance_id": "srv-9", "ip": "10.0.0.9"}
+			]}`)
+		case "/ports":
+			fmt.Fprint(w, `{"ports": [
+				{"id": "port-1", "name": "port-nodes-1-my-k8s", "device_id": "srv-1"},
+				{"id": "port-2", "name": "port-nodes-2-my-k8s"},
+				{"id": "port-8", "name": "port-nodes-extra-1-my-k8s"},
+				{"id": "port-9", "name": "port-masters-1-my-k8s", "device_id": "srv-9"}
+			]}`)
+		case "/floatingips":
+			fmt.Fprint(w, `{"floatingips": [
+				{"id": "l3fip-1", "port_id": "port-1"},
+				{"id": "l3fip-9", "port_id": "port-9"}
+			]}`)
+		case "/extensions":
+			fmt.Fprint(w, `{"extensions": [{"alias": "trunk", "name": "Trunk Extension"}]}`)
+		case "/trunks":
+			fmt.Fprint(w, `{"trunks": [
+				{"id": "trunk-1", "port_id": "port-1", "sub_ports": [{"port_id": "port-sub-1", "segmentation_type": "vlan", "segmentation_id": 100}]},
+				{"id": "trunk-9", "port_id": "port-9"}
+			]}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		novaClient:    newTestServiceClient(server),
+		neutronClient: newTestServiceClient(server),
+		writeBackoff:  wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+		readBackoff:   wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+	}
+	g := &cloudinstances.CloudInstanceGroup{
+		InstanceGroup: &kops.InstanceGroup{ObjectMeta: metav1.ObjectMeta{Name: "nodes"}},
+		Raw:           &servergroups.ServerGroup{ID: "sg-1", Name: "my.k8s-nodes", Members: []string{"srv-1", "srv-2"}},
+		Ready: []*cloudinstances.CloudInstanceGroupMember{
+			{ID: "srv-3"},
+		},
+	}
+	if err := c.DeleteGroup(g); err != nil {
+		t.Fatalf("unexpected error deleting group: %v", err)
+	}
+
+	expected := []string{
+		"/floatingips/l3fip-1",
+		"/os-floating-ips/fip-1",
+		"/os-server-groups/sg-1",
+		"/ports/port-1",
+		"/ports/port-2",
+		"/ports/port-sub-1",
+		"/servers/srv-1",
+		"/servers/srv-3",
+		"/trunks/trunk-1",
+	}
+	sort.Strings(deleted)
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deletions: expected %v, got %v", expected, deleted)
+	}
+	if serverGroupDeletes != 2 {
+		t.Errorf("expected the server group deletion to be retried once, got %d requests", serverGroupDeletes)
+	}
+	if trunkDeletes != 2 {
+		t.Errorf("expected the trunk deletion to be retried once, got %d requests", trunkDeletes)
+	}
+}
+
+func newIngressTestCloud(t *testing.T, lbs string) (*openstackCloud, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/lbaas/loadbalancers":
+			fmt.Fprint(w, lbs)
+		case "/floatingips":
+			if r.URL.Query().Get("port_id") == "vip-port-1" {
+				fmt.Fprint(w, `{"floatingips": [
+					{"id": "fip-1", "fixed_ip_address": "10.0.0.5", "floating_ip_address": "172.24.4.5", "port_id": "vip-port-1"}
+				]}`)
+				return
+			}
+			fmt.Fprint(w, `{"floatingips": []}`)
+		case "/servers/detail":
+			fmt.Fprint(w, `{"servers": [
+				{"id": "srv-1", "metadata": {"k8s": "my.k8s.local", "k8s.io/role/master": "1"},
+				 "addresses": {"my.k8s.local": [{"addr": "10.0.0.11", "OS-EXT-IPS:type": "fixed"}, {"addr": "172.24.4.11", "OS-EXT-IPS:type": "floating"}]}},
+				{"id": "srv-2", "metadata": {"k8s": "my.k8s.local", "k8s.io/role/master": "1"},
+				 "addresses": {"my.k8s.local": [{"addr": "10.0.0.12", "OS-EXT-IPS:type": "fixed"}]}},
+				{"id": "srv-3", "metadata": {"k8s": "my.k8s.local", "k8s.io/role/node": "1"},
+				 "addresses": {"my.k8s.local": [{"addr": "10.0.0.13", "OS-EXT-IPS:type": "fixed"}]}},
+				{"id": "srv-4", "metadata": {"k8s": "other.k8s.local", "k8s.io/role/master": "1"},
+				 "addresses": {"other.k8s.local": [{"addr": "10.0.1.11", "OS-EXT-IPS:type": "fixed"}]}}
+			]}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	c := &openstackCloud{
+		novaClient:    newTestServiceClient(server),
+		neutronClient: newTestServiceClient(server),
+		lbClient:      newTestServiceClient(server),
+	}
+	return c, server.Close
+}
+
+func TestGetApiIngressStatus(t *testing.T) {
+	grid := []struct {
+		name             string
+		masterPublicName string
+		lbType           kops.LoadBalancerType
+		lbs              string
+		expected         []string
+	}{
+		{
+			name:             "loadbalancer with floating ip",
+			masterPublicName: "api.my.k8s.local",
+			lbs:              `{"loadbalancers": [{"id": "lb-1", "vip_address": "10.0.0.5", "vip_port_id": "vip-port-1"}]}`,
+			expected:         []string{"172.24.4.5"},
+		},
+		{
+			name:             "loadbalancer without floating ip",
+			masterPublicName: "api.my.k8s.local",
+			lbs:              `{"loadbalancers": [{"id": "lb-1", "vip_address": "10.0.0.6", "vip_port_id": "vip-port-2"}]}`,
+			expected:         []string{"10.0.0.6"},
+		},
+		{
+			name:             "internal loadbalancer",
+			masterPublicName: "api.my.k8s.local",
+			lbType:           kops.LoadBalancerTypeInternal,
+			lbs:              `{"loadbalancers": [{"id": "lb-1", "vip_address": "10.0.0.5", "vip_port_id": "vip-port-1"}]}`,
+			expected:         []string{"10.0.0.5"},
+		},
+		{
+			name:             "masters without loadbalancer",
+			masterPublicName: "api.my.k8s.local",
+			lbs:              `{"loadbalancers": []}`,
+			expected:         []string{"10.0.0.12", "172.24.4.11"},
+		},
+		{
+			name:     "gossip",
+			expected: []string{"10.0.0.12", "172.24.4.11"},
+		},
+	}
+	for _, g := range grid {
+		t.Run(g.name, func(t *testing.T) {
+			c, done := newIngressTestCloud(t, g.lbs)
+			defer done()
+			cluster := &kops.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "my.k8s.local"},
+				Spec:       kops.ClusterSpec{MasterPublicName: g.masterPublicName},
+			}
+			if g.lbType != "" {
+				cluster.Spec.API = &kops.AccessSpec{LoadBalancer: &kops.LoadBalancerAccessSpec{Type: g.lbType}}
+			}
+			ingresses, err := c.GetApiIngressStatus(cluster)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var ips []string
+			for _, ingress := range ingresses {
+				ips = append(ips, ingress.IP)
+			}
+			if !reflect.DeepEqual(ips, g.expected) {
+				t.Errorf("expected ingress %v, got %v", g.expected, ips)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// contextTransport binds the requests to a context, so they are aborted once the context is done
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// contextServiceClient returns a copy of the service client whose requests are bound to the context.
+// The copy shares the token of the original provider and reauthenticates through it.
+func contextServiceClient(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	if client == nil {
+		return nil
+	}
+	parent := client.ProviderClient
+
+	provider := &gophercloud.ProviderClient{
+		IdentityBase:     parent.IdentityBase,
+		IdentityEndpoint: parent.IdentityEndpoint,
+		EndpointLocator:  parent.EndpointLocator,
+		HTTPClient:       parent.HTTPClient,
+		UserAgent:        parent.UserAgent,
+		TokenID:          parent.Token(),
+	}
+	base := provider.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	provider.HTTPClient.Transport = &contextTransport{ctx: ctx, base: base}
+	if parent.ReauthFunc != nil {
+		provider.ReauthFunc = func() error {
+			if err := parent.Reauthenticate(""); err != nil {
+				return err
+			}
+			provider.TokenID = parent.Token()
+			return nil
+		}
+	}
+
+	c := *client
+	c.ProviderClient = provider
+	return &c
+}
+
+// WithContext returns a copy of the cloud whose requests and retries are aborted once the context is done
+func (c *openstackCloud) WithContext(ctx context.Context) OpenstackCloud {
+	cloud := *c
+	cloud.ctx = ctx
+	cloud.cinderClient = contextServiceClient(ctx, c.cinderClient)
+	cloud.neutronClient = contextServiceClient(ctx, c.neutronClient)
+	cloud.novaClient = contextServiceClient(ctx, c.novaClient)
+	cloud.dnsClient = contextServiceClient(ctx, c.dnsClient)
+	cloud.lbClient = contextServiceClient(ctx, c.lbClient)
+	cloud.imageClient = contextServiceClient(ctx, c.imageClient)
+	cloud.barbicanClient = contextServiceClient(ctx, c.barbicanClient)
+	return &cloud
+}
+
+// context returns the context the requests of the cloud are bound to
+func (c *openstackCloud) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// retryWithBackoff retries the condition with the backoff, until the context of the cloud is done. Requests to
+// a suspended or read-only project are not retried, as they keep failing until the project status is changed.
+func (c *openstackCloud) retryWithBackoff(backoff wait.Backoff, condition func() (bool, error)) (bool, error) {
+	return vfs.RetryWithBackoffContext(c.context(), backoff, func() (bool, error) {
+		done, err := condition()
+		if isProjectStatusError(err) {
+			return true, newProjectStatusError(err)
+		}
+		return done, err
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+)
+
+func TestWithContextAbortsHungRequest(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+		readBackoff:  defaultReadBackoff,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.WithContext(ctx).ListVolumes(cinder.ListOpts{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline of the context to be returned, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected listing to be aborted with the context, took %v", elapsed)
+	}
+}
+
+func TestWithContextKeepsToken(t *testing.T) {
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Auth-Token")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"volumes": []}`))
+	}))
+	defer server.Close()
+
+	client := newTestServiceClient(server)
+	client.ProviderClient.TokenID = "token-1"
+	c := &openstackCloud{cinderClient: client}
+
+	if _, err := c.WithContext(context.Background()).ListVolumes(cinder.ListOpts{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "token-1" {
+		t.Errorf("expected the token of the cloud to be used, got %q", token)
+	}
+	if c.cinderClient.HTTPClient.Transport != nil {
+		t.Errorf("expected the client of the original cloud not to be modified")
+	}
+}
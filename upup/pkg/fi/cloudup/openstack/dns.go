@@ -18,21 +18,104 @@ package openstack
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
 	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
+	"k8s.io/kops/pkg/apis/kops"
 )
 
+const (
+	// DNSZoneTypePrimary is a zone whose records are managed in designate
+	DNSZoneTypePrimary = "PRIMARY"
+	// DNSZoneTypeSecondary is a zone transferred from external master servers
+	DNSZoneTypeSecondary = "SECONDARY"
+
+	// DefaultDNSRecordTTL is the TTL of the DNS records for the API server, kept low for a fast master failover
+	DefaultDNSRecordTTL = 60
+	// maxDNSRecordTTL is the largest TTL accepted by designate
+	maxDNSRecordTTL = math.MaxInt32
+)
+
+// minTTLMessage matches the minimum TTL reported by designate when the TTL of a recordset is too low
+var minTTLMessage = regexp.MustCompile(`TTL is below the minimum: ([0-9]+)`)
+
+// DNSRecordTTL returns the TTL of the DNS records for the API server of the cluster
+func DNSRecordTTL(spec *kops.ClusterSpec) int {
+	if spec == nil || spec.ExternalDNS == nil || spec.ExternalDNS.TTL == nil {
+		return DefaultDNSRecordTTL
+	}
+	return int(*spec.ExternalDNS.TTL)
+}
+
+// CreateDNSZone will create a primary or secondary DNS zone
+func (c *openstackCloud) CreateDNSZone(opt zones.CreateOpts) (*zones.Zone, error) {
+	client, err := c.DNSClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDNSZoneCreateOpts(&opt); err != nil {
+		return nil, err
+	}
+
+	var z *zones.Zone
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := zones.Create(client, opt).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error creating dns zone %s: %v", opt.Name, withRequestID(err))
+		}
+		z = v
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return z, err
+	}
+	return z, err
+}
+
+// validateDNSZoneCreateOpts normalizes the zone type and checks that secondary zones name their masters
+func validateDNSZoneCreateOpts(opt *zones.CreateOpts) error {
+	zoneType := strings.ToUpper(opt.Type)
+	if zoneType == "" {
+		zoneType = DNSZoneTypePrimary
+	}
+	switch zoneType {
+	case DNSZoneTypePrimary:
+		if len(opt.Masters) != 0 {
+			return fmt.Errorf("primary dns zone %s must not specify master servers", opt.Name)
+		}
+	case DNSZoneTypeSecondary:
+		if len(opt.Masters) == 0 {
+			return fmt.Errorf("secondary dns zone %s must specify at least one master server", opt.Name)
+		}
+	default:
+		return fmt.Errorf("unknown dns zone type %q for zone %s, expected %s or %s", opt.Type, opt.Name, DNSZoneTypePrimary, DNSZoneTypeSecondary)
+	}
+	opt.Type = zoneType
+	return nil
+}
+
 // ListDNSZones will list available DNS zones
 func (c *openstackCloud) ListDNSZones(opt zones.ListOptsBuilder) ([]zones.Zone, error) {
+	client, err := c.DNSClient()
+	if err != nil {
+		return nil, err
+	}
 	var zs []zones.Zone
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		allPages, err := zones.List(c.dnsClient, opt).AllPages()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := zones.List(client, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("failed to list dns zones: %s", err)
+			return !isRetryable(err), fmt.Errorf("failed to list dns zones: %v", withRequestID(err))
 		}
 		r, err := zones.ExtractZones(allPages)
 		if err != nil {
@@ -52,12 +135,16 @@ func (c *openstackCloud) ListDNSZones(opt zones.ListOptsBuilder) ([]zones.Zone,
 
 // ListDNSRecordsets will list DNS recordsets
 func (c *openstackCloud) ListDNSRecordsets(zoneID string, opt recordsets.ListOptsBuilder) ([]recordsets.RecordSet, error) {
+	client, err := c.DNSClient()
+	if err != nil {
+		return nil, err
+	}
 	var rrs []recordsets.RecordSet
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		allPages, err := recordsets.ListByZone(c.dnsClient, zoneID, opt).AllPages()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := recordsets.ListByZone(client, zoneID, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("failed to list dns recordsets: %s", err)
+			return !isRetryable(err), fmt.Errorf("failed to list dns recordsets: %v", withRequestID(err))
 		}
 		r, err := recordsets.ExtractRecordSets(allPages)
 		if err != nil {
@@ -74,3 +161,140 @@ func (c *openstackCloud) ListDNSRecordsets(zoneID string, opt recordsets.ListOpt
 		return rrs, wait.ErrWaitTimeout
 	}
 }
+
+// CreateDNSRecordset will create a DNS recordset, or update the existing recordset of the same name and type,
+// so that repeated reconciles converge on the requested records
+func (c *openstackCloud) CreateDNSRecordset(zoneID string, opt recordsets.CreateOpts) (*recordsets.RecordSet, error) {
+	client, err := c.DNSClient()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(opt.Name, ".") {
+		opt.Name = opt.Name + "."
+	}
+	if opt.Type == "" {
+		opt.Type = "A"
+	}
+	if opt.TTL == 0 {
+		opt.TTL = DefaultDNSRecordTTL
+	}
+	if opt.TTL < 1 || opt.TTL > maxDNSRecordTTL {
+		return nil, fmt.Errorf("invalid TTL %d for dns recordset %s, expected between 1 and %d seconds", opt.TTL, opt.Name, maxDNSRecordTTL)
+	}
+
+	existing, err := c.ListDNSRecordsets(zoneID, recordsets.ListOpts{
+		Name: opt.Name,
+		Type: opt.Type,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 1 {
+		return nil, fmt.Errorf("found multiple dns recordsets %s of type %s", opt.Name, opt.Type)
+	}
+
+	var rrs *recordsets.RecordSet
+	if len(existing) == 1 {
+		current := &existing[0]
+		if equalRecords(current.Records, opt.Records) && current.TTL == opt.TTL {
+			return current, nil
+		}
+		updateOpts := recordsets.UpdateOpts{
+			TTL:     opt.TTL,
+			Records: opt.Records,
+		}
+		if opt.Description != "" {
+			updateOpts.Description = &opt.Description
+		}
+		done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+			v, err := recordsets.Update(client, zoneID, current.ID, updateOpts).Extract()
+			if ttlErr := minTTLError(err, zoneID, opt); ttlErr != nil {
+				return true, ttlErr
+			}
+			if err != nil {
+				return !isRetryable(err), fmt.Errorf("error updating dns recordset %s: %v", opt.Name, withRequestID(err))
+			}
+			rrs = v
+			return true, nil
+		})
+		if !done {
+			if err == nil {
+				err = wait.ErrWaitTimeout
+			}
+			return rrs, err
+		}
+		return rrs, err
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := recordsets.Create(client, zoneID, opt).Extract()
+		if ttlErr := minTTLError(err, zoneID, opt); ttlErr != nil {
+			return true, ttlErr
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error creating dns recordset %s: %v", opt.Name, withRequestID(err))
+		}
+		rrs = v
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return rrs, err
+	}
+	return rrs, err
+}
+
+// minTTLError returns a descriptive error if designate rejected the recordset because its TTL is below
+// the minimum TTL of the zone, nil otherwise
+func minTTLError(err error, zoneID string, opt recordsets.CreateOpts) error {
+	var body []byte
+	switch e := err.(type) {
+	case gophercloud.ErrDefault400:
+		body = e.Body
+	case gophercloud.ErrUnexpectedResponseCode:
+		body = e.Body
+	default:
+		return nil
+	}
+	match := minTTLMessage.FindSubmatch(body)
+	if match == nil {
+		return nil
+	}
+	return fmt.Errorf("TTL %d of dns recordset %s is below the minimum TTL of %s seconds of dns zone %s", opt.TTL, opt.Name, match[1], zoneID)
+}
+
+// equalRecords returns true if both lists hold the same records, regardless of their order
+func equalRecords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	return reflect.DeepEqual(sortedA, sortedB)
+}
+
+// DeleteDNSRecordset will delete a DNS recordset, a missing recordset is not an error
+func (c *openstackCloud) DeleteDNSRecordset(zoneID string, rrsetID string) error {
+	client, err := c.DNSClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := recordsets.Delete(client, zoneID, rrsetID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("failed to delete dns recordset %s: %v", rrsetID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
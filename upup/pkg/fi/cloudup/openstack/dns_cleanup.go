@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/dns"
+)
+
+// IsGossipTransition returns true if the cluster used designate for its names and now uses gossip
+func IsGossipTransition(previous, current *kops.ClusterSpec) bool {
+	if previous == nil || current == nil {
+		return false
+	}
+	return previous.MasterInternalName != "" && !dns.IsGossipHostname(previous.MasterInternalName) &&
+		dns.IsGossipHostname(current.MasterInternalName)
+}
+
+// isKopsManagedRecord returns true if kops or dns-controller publishes the record for the cluster domain
+func isKopsManagedRecord(name string, domain string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	switch name {
+	case "api." + domain, "api.internal." + domain, "bastion." + domain:
+		return true
+	}
+	return strings.HasSuffix(name, ".internal."+domain)
+}
+
+// CleanupDesignateAfterGossipTransition removes the records kops published in designate once the cluster uses gossip.
+// Records which were not created by kops are kept. The zone itself is kept as well, kops never creates it.
+func CleanupDesignateAfterGossipTransition(cloud OpenstackCloud, previous, current *kops.ClusterSpec) error {
+	if !IsGossipTransition(previous, current) {
+		return nil
+	}
+	if _, err := cloud.DNSClient(); err != nil {
+		return fmt.Errorf("designate is required to remove the dns records of the cluster: %v", err)
+	}
+
+	domain := strings.TrimPrefix(previous.MasterInternalName, "api.internal.")
+	zoneName := previous.DNSZone
+	if zoneName == "" {
+		zoneName = domain
+	}
+	zoneName = strings.TrimSuffix(zoneName, ".") + "."
+
+	zs, err := cloud.ListDNSZones(zones.ListOpts{Name: zoneName})
+	if err != nil {
+		return err
+	}
+	if len(zs) == 0 {
+		glog.V(2).Infof("dns zone %s not found, nothing to clean up", zoneName)
+		return nil
+	}
+	if len(zs) > 1 {
+		return fmt.Errorf("found multiple dns zones with name %s", zoneName)
+	}
+	zone := zs[0]
+
+	rrs, err := cloud.ListDNSRecordsets(zone.ID, nil)
+	if err != nil {
+		return err
+	}
+	for _, rr := range rrs {
+		if rr.Type == "SOA" || rr.Type == "NS" {
+			continue
+		}
+		if !isKopsManagedRecord(rr.Name, domain) {
+			glog.V(2).Infof("keeping dns record %s (%s) which is not managed by kops", rr.Name, rr.Type)
+			continue
+		}
+		glog.Infof("deleting dns record %s (%s) after switching to gossip", rr.Name, rr.Type)
+		if err := cloud.DeleteDNSRecordset(zone.ID, rr.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
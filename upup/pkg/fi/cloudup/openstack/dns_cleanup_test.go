@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// newDNSCleanupTestServer serves a zone with kops-managed and foreign records and records the deletions
+func newDNSCleanupTestServer(zoneName string, records string, deleted *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodDelete {
+			*deleted = append(*deleted, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/zones":
+			fmt.Fprintf(w, `{"zones": [{"id": "zone-1", "name": %q}]}`, zoneName)
+		case "/zones/zone-1/recordsets":
+			fmt.Fprintf(w, `{"recordsets": [%s]}`, records)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func designateToGossip(dnsZone string) (*kops.ClusterSpec, *kops.ClusterSpec) {
+	previous := &kops.ClusterSpec{DNSZone: dnsZone, MasterInternalName: "api.internal.my.example.com"}
+	current := &kops.ClusterSpec{MasterInternalName: "api.internal.my.k8s.local"}
+	return previous, current
+}
+
+func TestCleanupDesignateKeepsForeignRecords(t *testing.T) {
+	var deleted []string
+	server := newDNSCleanupTestServer("example.com.", `
+		{"id": "soa", "name": "example.com.", "type": "SOA"},
+		{"id": "api", "name": "api.my.example.com.", "type": "A"},
+		{"id": "internal", "name": "api.internal.my.example.com.", "type": "A"},
+		{"id": "etcd", "name": "etcd-a.internal.my.example.com.", "type": "A"},
+		{"id": "www", "name": "www.example.com.", "type": "A"},
+		{"id": "other", "name": "app.my.example.com.", "type": "A"}`, &deleted)
+	defer server.Close()
+
+	c := &openstackCloud{dnsClient: newTestServiceClient(server)}
+	previous, current := designateToGossip("example.com")
+	if err := CleanupDesignateAfterGossipTransition(c, previous, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"/zones/zone-1/recordsets/api",
+		"/zones/zone-1/recordsets/internal",
+		"/zones/zone-1/recordsets/etcd",
+	}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deletions, expected %v, got %v", expected, deleted)
+	}
+}
+
+func TestCleanupDesignateKeepsDedicatedZone(t *testing.T) {
+	var deleted []string
+	server := newDNSCleanupTestServer("my.example.com.", `
+		{"id": "soa", "name": "my.example.com.", "type": "SOA"},
+		{"id": "ns", "name": "my.example.com.", "type": "NS"},
+		{"id": "api", "name": "api.my.example.com.", "type": "A"}`, &deleted)
+	defer server.Close()
+
+	c := &openstackCloud{dnsClient: newTestServiceClient(server)}
+	previous, current := designateToGossip("my.example.com")
+	if err := CleanupDesignateAfterGossipTransition(c, previous, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the zone is kept even when only its SOA and NS records are left
+	expected := []string{
+		"/zones/zone-1/recordsets/api",
+	}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deletions, expected %v, got %v", expected, deleted)
+	}
+}
+
+func TestCleanupDesignateWithoutTransition(t *testing.T) {
+	spec := &kops.ClusterSpec{MasterInternalName: "api.internal.my.example.com"}
+	// without a transition designate is not contacted at all
+	c := &openstackCloud{dnsClient: &gophercloud.ServiceClient{}}
+	if err := CleanupDesignateAfterGossipTransition(c, spec, spec); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/dns"
+)
+
+// masterDNSNames returns the API names of the cluster which resolve to the masters, the public name
+// resolves to the loadbalancer instead when the API uses one
+func masterDNSNames(cluster *kops.Cluster) []string {
+	var names []string
+	if cluster.Spec.MasterPublicName != "" && (cluster.Spec.API == nil || cluster.Spec.API.LoadBalancer == nil) {
+		names = append(names, cluster.Spec.MasterPublicName)
+	}
+	if cluster.Spec.MasterInternalName != "" {
+		names = append(names, cluster.Spec.MasterInternalName)
+	}
+	return names
+}
+
+// masterDNSRecords returns the addresses of the running masters for the API names of the cluster.
+// The internal name resolves to the fixed IPs of the masters, the public name to their floating IPs,
+// or fixed IPs for masters without one.
+func masterDNSRecords(cluster *kops.Cluster, masters []servers.Server) map[string][]string {
+	records := make(map[string][]string)
+	for i := range masters {
+		server := &masters[i]
+		if server.Status != InstanceStatusActive {
+			continue
+		}
+		floating, fixed := serverFloatingAndFixedIP(server)
+		for _, name := range masterDNSNames(cluster) {
+			ip := fixed
+			if name == cluster.Spec.MasterPublicName && floating != "" {
+				ip = floating
+			}
+			if ip != "" {
+				records[name] = append(records[name], ip)
+			}
+		}
+	}
+	for name := range records {
+		sort.Strings(records[name])
+	}
+	return records
+}
+
+// ReconcileMasterDNSRecords points the designate records of the API names at the running masters,
+// so that records of replaced masters are removed and new masters are added. Only the A records
+// of the API names are touched, and records of a name are kept while no master is running.
+func ReconcileMasterDNSRecords(cloud OpenstackCloud, cluster *kops.Cluster) error {
+	if dns.IsGossipHostname(cluster.Name) {
+		return nil
+	}
+	if _, err := cloud.DNSClient(); err != nil {
+		return fmt.Errorf("designate is required to update the dns records of the masters: %v", err)
+	}
+
+	zoneName := cluster.Spec.DNSZone
+	if zoneName == "" {
+		zoneName = cluster.Name
+	}
+	zoneName = strings.TrimSuffix(zoneName, ".") + "."
+
+	zs, err := cloud.ListDNSZones(zones.ListOpts{Name: zoneName})
+	if err != nil {
+		return err
+	}
+	if len(zs) == 0 {
+		return fmt.Errorf("dns zone %s not found", zoneName)
+	}
+	if len(zs) > 1 {
+		return fmt.Errorf("found multiple dns zones with name %s", zoneName)
+	}
+	zone := zs[0]
+
+	instances, err := cloud.ListClusterInstances(cluster.Name)
+	if err != nil {
+		return fmt.Errorf("error listing the instances of the cluster: %v", err)
+	}
+	var masters []servers.Server
+	for _, instance := range instances {
+		if instance.Metadata[TagNameRolePrefix+strings.ToLower(string(kops.InstanceGroupRoleMaster))] == "1" {
+			masters = append(masters, instance)
+		}
+	}
+	records := masterDNSRecords(cluster, masters)
+
+	for _, name := range masterDNSNames(cluster) {
+		fqdn := strings.TrimSuffix(name, ".") + "."
+		if fqdn != zoneName && !strings.HasSuffix(fqdn, "."+zoneName) {
+			glog.Warningf("dns record %s is not part of dns zone %s, not updating it", name, zoneName)
+			continue
+		}
+		ips, ok := records[name]
+		if !ok {
+			glog.Warningf("no running master found for dns record %s, keeping its current records", name)
+			continue
+		}
+		glog.V(2).Infof("updating dns record %s to %v", name, ips)
+		if _, err := cloud.CreateDNSRecordset(zone.ID, recordsets.CreateOpts{
+			Name:    fqdn,
+			Type:    "A",
+			TTL:     DNSRecordTTL(&cluster.Spec),
+			Records: ips,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
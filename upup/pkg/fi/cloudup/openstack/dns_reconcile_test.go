@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// newDNSReconcileTestServer serves a zone with a stale internal record and records the writes to designate
+func newDNSReconcileTestServer(t *testing.T, writes *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			body := make(map[string]interface{})
+			json.NewDecoder(r.Body).Decode(&body)
+			*writes = append(*writes, fmt.Sprintf("%s %s %v", r.Method, r.URL.Path, body["records"]))
+			body["id"] = "rrset"
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(body)
+			return
+		}
+		switch r.URL.Path {
+		case "/zones":
+			fmt.Fprint(w, `{"zones": [{"id": "zone-1", "name": "example.com."}]}`)
+		case "/zones/zone-1/recordsets":
+			// designate filters the recordsets by name, the foreign record is never returned for the API names
+			switch r.URL.Query().Get("name") {
+			case "api.internal.my.example.com.":
+				fmt.Fprint(w, `{"recordsets": [{"id": "internal", "name": "api.internal.my.example.com.", "type": "A", "ttl": 60, "records": ["10.0.0.4", "10.0.0.5"]}]}`)
+			case "":
+				t.Errorf("unexpected listing of all recordsets")
+				fallthrough
+			default:
+				fmt.Fprint(w, `{"recordsets": []}`)
+			}
+		case "/servers/detail":
+			fmt.Fprint(w, `{"servers": [
+				{"id": "srv-1", "status": "ACTIVE", "metadata": {"k8s": "my.example.com", "k8s.io/role/master": "1"},
+				 "addresses": {"net": [{"addr": "10.0.0.5", "OS-EXT-IPS:type": "fixed"}, {"addr": "172.24.4.5", "OS-EXT-IPS:type": "floating"}]}},
+				{"id": "srv-2", "status": "ACTIVE", "metadata": {"k8s": "my.example.com", "k8s.io/role/master": "1"},
+				 "addresses": {"net": [{"addr": "10.0.0.7", "OS-EXT-IPS:type": "fixed"}]}},
+				{"id": "srv-3", "status": "ERROR", "metadata": {"k8s": "my.example.com", "k8s.io/role/master": "1"},
+				 "addresses": {"net": [{"addr": "10.0.0.8", "OS-EXT-IPS:type": "fixed"}]}},
+				{"id": "srv-4", "status": "ACTIVE", "metadata": {"k8s": "my.example.com", "k8s.io/role/node": "1"},
+				 "addresses": {"net": [{"addr": "10.0.0.9", "OS-EXT-IPS:type": "fixed"}]}}
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newDNSReconcileTestCluster() *kops.Cluster {
+	cluster := &kops.Cluster{}
+	cluster.Name = "my.example.com"
+	cluster.Spec.DNSZone = "example.com"
+	cluster.Spec.MasterPublicName = "api.my.example.com"
+	cluster.Spec.MasterInternalName = "api.internal.my.example.com"
+	return cluster
+}
+
+func TestReconcileMasterDNSRecords(t *testing.T) {
+	grid := []struct {
+		name     string
+		api      *kops.AccessSpec
+		expected []string
+	}{
+		{
+			name: "dns api",
+			expected: []string{
+				"POST /zones/zone-1/recordsets [10.0.0.7 172.24.4.5]",
+				"PUT /zones/zone-1/recordsets/internal [10.0.0.5 10.0.0.7]",
+			},
+		},
+		{
+			name: "loadbalancer api",
+			api:  &kops.AccessSpec{LoadBalancer: &kops.LoadBalancerAccessSpec{}},
+			expected: []string{
+				"PUT /zones/zone-1/recordsets/internal [10.0.0.5 10.0.0.7]",
+			},
+		},
+	}
+	for _, g := range grid {
+		t.Run(g.name, func(t *testing.T) {
+			var writes []string
+			server := newDNSReconcileTestServer(t, &writes)
+			defer server.Close()
+
+			c := &openstackCloud{
+				novaClient: newTestServiceClient(server),
+				dnsClient:  newTestServiceClient(server),
+			}
+			cluster := newDNSReconcileTestCluster()
+			cluster.Spec.API = g.api
+			if err := ReconcileMasterDNSRecords(c, cluster); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(writes, g.expected) {
+				t.Errorf("unexpected writes, expected %v, got %v", g.expected, writes)
+			}
+		})
+	}
+}
+
+func TestReconcileMasterDNSRecordsIsIdempotent(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/zones":
+			fmt.Fprint(w, `{"zones": [{"id": "zone-1", "name": "example.com."}]}`)
+		case "/zones/zone-1/recordsets":
+			fmt.Fprintf(w, `{"recordsets": [{"id": "rrset", "name": %q, "type": "A", "ttl": 60, "records": ["10.0.0.5"]}]}`, r.URL.Query().Get("name"))
+		case "/servers/detail":
+			fmt.Fprint(w, `{"servers": [
+				{"id": "srv-1", "status": "ACTIVE", "metadata": {"k8s": "my.example.com", "k8s.io/role/master": "1"},
+				 "addresses": {"net": [{"addr": "10.0.0.5", "OS-EXT-IPS:type": "fixed"}]}}
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		novaClient: newTestServiceClient(server),
+		dnsClient:  newTestServiceClient(server),
+	}
+	if err := ReconcileMasterDNSRecords(c, newDNSReconcileTestCluster()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(writes) != 0 {
+		t.Errorf("expected no writes for records matching the masters, got %v", writes)
+	}
+}
+
+func TestReconcileMasterDNSRecordsWithGossip(t *testing.T) {
+	cluster := newDNSReconcileTestCluster()
+	cluster.Name = "my.k8s.local"
+	// gossip clusters do not contact designate at all
+	c := &openstackCloud{dnsClient: &gophercloud.ServiceClient{}}
+	if err := ReconcileMasterDNSRecords(c, cluster); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/openstack/dns/v2/zones"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// newDNSZoneTestServer returns a server that echoes created zones and records the request bodies
+func newDNSZoneTestServer(requests *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, body)
+		body["id"] = "zone-id"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(body)
+	}))
+}
+
+func TestCreateDNSZone(t *testing.T) {
+	grid := []struct {
+		opts            zones.CreateOpts
+		expectedType    string
+		expectedMasters []string
+	}{
+		{
+			opts: zones.CreateOpts{
+				Name:  "example.com.",
+				Email: "admin@example.com",
+			},
+			expectedType: "PRIMARY",
+		},
+		{
+			opts: zones.CreateOpts{
+				Name:    "example.com.",
+				Type:    "secondary",
+				Masters: []string{"10.0.0.1", "10.0.0.2"},
+			},
+			expectedType:    "SECONDARY",
+			expectedMasters: []string{"10.0.0.1", "10.0.0.2"},
+		},
+	}
+	for _, g := range grid {
+		var requests []map[string]interface{}
+		server := newDNSZoneTestServer(&requests)
+
+		c := &openstackCloud{
+			dnsClient: newTestServiceClient(server),
+		}
+		zone, err := c.CreateDNSZone(g.opts)
+		server.Close()
+		if err != nil {
+			t.Errorf("error creating %s zone: %v", g.expectedType, err)
+			continue
+		}
+		if len(requests) != 1 {
+			t.Errorf("expected a single request, got %d", len(requests))
+			continue
+		}
+		if requests[0]["type"] != g.expectedType {
+			t.Errorf("expected zone type %s to be requested, got %v", g.expectedType, requests[0]["type"])
+		}
+		if zone.Type != g.expectedType {
+			t.Errorf("expected zone type %s, got %s", g.expectedType, zone.Type)
+		}
+		if !reflect.DeepEqual(zone.Masters, g.expectedMasters) {
+			t.Errorf("expected masters %v, got %v", g.expectedMasters, zone.Masters)
+		}
+	}
+}
+
+func TestCreateDNSZoneValidation(t *testing.T) {
+	grid := []zones.CreateOpts{
+		{
+			Name: "example.com.",
+			Type: "SECONDARY",
+		},
+		{
+			Name:    "example.com.",
+			Type:    "PRIMARY",
+			Masters: []string{"10.0.0.1"},
+		},
+		{
+			Name: "example.com.",
+			Type: "TERTIARY",
+		},
+	}
+	for _, opts := range grid {
+		var requests []map[string]interface{}
+		server := newDNSZoneTestServer(&requests)
+
+		c := &openstackCloud{
+			dnsClient: newTestServiceClient(server),
+		}
+		_, err := c.CreateDNSZone(opts)
+		server.Close()
+		if err == nil {
+			t.Errorf("expected error creating zone with type %q and masters %v", opts.Type, opts.Masters)
+		}
+		if len(requests) != 0 {
+			t.Errorf("expected invalid zone %q not to be requested", opts.Type)
+		}
+	}
+}
+
+func TestCreateDNSRecordset(t *testing.T) {
+	grid := []struct {
+		existing string
+		records  []string
+		expected []string
+	}{
+		{
+			existing: ``,
+			records:  []string{"203.0.113.10"},
+			expected: []string{"POST /zones/zone-1/recordsets"},
+		},
+		{
+			existing: `{"id": "rrs-1", "name": "api.example.com.", "type": "A", "ttl": 300, "records": ["203.0.113.11", "203.0.113.10"]}`,
+			records:  []string{"203.0.113.10", "203.0.113.11"},
+		},
+		{
+			existing: `{"id": "rrs-1", "name": "api.example.com.", "type": "A", "ttl": 300, "records": ["203.0.113.9"]}`,
+			records:  []string{"203.0.113.10"},
+			expected: []string{"PUT /zones/zone-1/recordsets/rrs-1"},
+		},
+	}
+	for _, g := range grid {
+		var writes []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "GET" {
+				if r.URL.Query().Get("name") != "api.example.com." || r.URL.Query().Get("type") != "A" {
+					t.Errorf("unexpected recordset query %s", r.URL.RawQuery)
+				}
+				fmt.Fprintf(w, `{"recordsets": [%s], "links": {}}`, g.existing)
+				return
+			}
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			body := make(map[string]interface{})
+			json.NewDecoder(r.Body).Decode(&body)
+			if !reflect.DeepEqual(body["records"], []interface{}{g.records[0]}) {
+				t.Errorf("unexpected records %v", body["records"])
+			}
+			body["id"] = "rrs-1"
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(body)
+		}))
+
+		c := &openstackCloud{
+			dnsClient: newTestServiceClient(server),
+		}
+		_, err := c.CreateDNSRecordset("zone-1", recordsets.CreateOpts{
+			Name:    "api.example.com",
+			Records: g.records,
+			TTL:     300,
+		})
+		server.Close()
+		if err != nil {
+			t.Errorf("unexpected error creating recordset: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(writes, g.expected) {
+			t.Errorf("expected requests %v, got %v", g.expected, writes)
+		}
+	}
+}
+
+func TestCreateDNSRecordsetTTL(t *testing.T) {
+	grid := []struct {
+		ttl         int
+		minTTL      int
+		expectedTTL float64
+		error       string
+	}{
+		{ttl: 0, expectedTTL: 60},
+		{ttl: 300, expectedTTL: 300},
+		{ttl: 30, minTTL: 120, expectedTTL: 30, error: "minimum TTL of 120 seconds"},
+		{ttl: -1, error: "invalid TTL"},
+	}
+	for _, g := range grid {
+		var requested []float64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "GET" {
+				fmt.Fprint(w, `{"recordsets": [], "links": {}}`)
+				return
+			}
+			body := make(map[string]interface{})
+			json.NewDecoder(r.Body).Decode(&body)
+			ttl, _ := body["ttl"].(float64)
+			requested = append(requested, ttl)
+			if g.minTTL != 0 && int(ttl) < g.minTTL {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"code": 400, "type": "invalid_ttl", "message": "TTL is below the minimum: %d"}`, g.minTTL)
+				return
+			}
+			body["id"] = "rrs-1"
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(body)
+		}))
+
+		c := &openstackCloud{
+			dnsClient: newTestServiceClient(server),
+		}
+		_, err := c.CreateDNSRecordset("zone-1", recordsets.CreateOpts{
+			Name:    "api.example.com.",
+			Records: []string{"203.0.113.10"},
+			TTL:     g.ttl,
+		})
+		server.Close()
+		if g.error == "" && err != nil {
+			t.Errorf("unexpected error creating recordset with TTL %d: %v", g.ttl, err)
+		}
+		if g.error != "" && (err == nil || !strings.Contains(err.Error(), g.error)) {
+			t.Errorf("expected error containing %q for TTL %d, got %v", g.error, g.ttl, err)
+		}
+		if g.expectedTTL == 0 {
+			if len(requested) != 0 {
+				t.Errorf("expected invalid TTL %d not to be requested", g.ttl)
+			}
+			continue
+		}
+		if len(requested) != 1 || requested[0] != g.expectedTTL {
+			t.Errorf("expected a single request with TTL %v, got %v", g.expectedTTL, requested)
+		}
+	}
+}
+
+func TestDNSRecordTTL(t *testing.T) {
+	if ttl := DNSRecordTTL(&kops.ClusterSpec{}); ttl != DefaultDNSRecordTTL {
+		t.Errorf("expected default TTL %d, got %d", DefaultDNSRecordTTL, ttl)
+	}
+	ttl := int32(300)
+	spec := &kops.ClusterSpec{ExternalDNS: &kops.ExternalDNSConfig{TTL: &ttl}}
+	if actual := DNSRecordTTL(spec); actual != 300 {
+		t.Errorf("expected TTL 300 from the cluster spec, got %d", actual)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The services whose extensions HasExtension looks up, named like the service types of the catalog
+const (
+	ServiceCompute = "compute"
+	ServiceNetwork = "network"
+	ServiceVolume  = "volume"
+)
+
+// The aliases of the Neutron extensions kops depends on
+const (
+	ExtensionTags                = "standard-attr-tag"
+	ExtensionTrunk               = "trunk"
+	ExtensionPortSecurity        = "port-security"
+	ExtensionAllowedAddressPairs = "allowed-address-pairs"
+	ExtensionL3                  = "router"
+)
+
+// extensionCache holds the aliases of the extensions by service endpoint, it is shared by the copies of a cloud
+type extensionCache struct {
+	sync.Mutex
+	aliases map[string]sets.String
+}
+
+func newExtensionCache() *extensionCache {
+	return &extensionCache{aliases: make(map[string]sets.String)}
+}
+
+// HasExtension returns true if the service has the extension with the alias. The extensions are listed
+// once per service endpoint, a service without an extensions endpoint has no extensions.
+func (c *openstackCloud) HasExtension(service string, alias string) (bool, error) {
+	var client *gophercloud.ServiceClient
+	switch service {
+	case ServiceCompute:
+		client = c.novaClient
+	case ServiceNetwork:
+		client = c.neutronClient
+	case ServiceVolume:
+		volumeClient, err := c.BlockStorageClient()
+		if err != nil {
+			return false, err
+		}
+		client = volumeClient
+	default:
+		return false, fmt.Errorf("unknown service %q", service)
+	}
+	if client == nil {
+		return false, fmt.Errorf("the cloud does not expose the %s service", service)
+	}
+
+	if c.extensions != nil {
+		c.extensions.Lock()
+		defer c.extensions.Unlock()
+		if aliases, found := c.extensions.aliases[client.Endpoint]; found {
+			return aliases.Has(alias), nil
+		}
+	}
+
+	aliases, err := c.listExtensions(service, client)
+	if err != nil {
+		return false, err
+	}
+	glog.V(4).Infof("extensions of the %s service: %v", service, aliases.List())
+	if c.extensions != nil {
+		c.extensions.aliases[client.Endpoint] = aliases
+	}
+	return aliases.Has(alias), nil
+}
+
+// listExtensions returns the aliases of the extensions of the service
+func (c *openstackCloud) listExtensions(service string, client *gophercloud.ServiceClient) (sets.String, error) {
+	aliases := sets.NewString()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Extensions []struct {
+				Alias string `json:"alias"`
+			} `json:"extensions"`
+		}
+		_, err := client.Get(client.ServiceURL("extensions"), &r, nil)
+		if isNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing the extensions of the %s service: %v", service, withRequestID(err))
+		}
+		for _, e := range r.Extensions {
+			aliases.Insert(e.Alias)
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return aliases, err
+	}
+	return aliases, err
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHasExtension(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/extensions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		fmt.Fprint(w, `{"extensions": [{"alias": "standard-attr-tag"}, {"alias": "port-security"}]}`)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		neutronClient: newTestServiceClient(server),
+		extensions:    newExtensionCache(),
+	}
+	grid := []struct {
+		alias    string
+		expected bool
+	}{
+		{alias: ExtensionTags, expected: true},
+		{alias: ExtensionPortSecurity, expected: true},
+		{alias: ExtensionTrunk, expected: false},
+	}
+	for _, g := range grid {
+		found, err := c.HasExtension(ServiceNetwork, g.alias)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if found != g.expected {
+			t.Errorf("expected extension %s to be found: %v, got %v", g.alias, g.expected, found)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the extensions to be listed once, got %d requests", requests)
+	}
+}
+
+func TestHasExtensionWithoutExtensionsEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+		extensions:   newExtensionCache(),
+	}
+	found, err := c.HasExtension(ServiceVolume, "os-extended-snapshot-attributes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found {
+		t.Errorf("expected no extension without an extensions endpoint")
+	}
+	if _, err := c.HasExtension(ServiceCompute, "os-keypairs"); err == nil {
+		t.Errorf("expected an error for a service the cloud does not expose")
+	}
+}
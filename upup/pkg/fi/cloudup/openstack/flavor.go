@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func (c *openstackCloud) ListFlavors(opt flavors.ListOpts) ([]flavors.Flavor, error) {
+	var fs []flavors.Flavor
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := flavors.ListDetail(c.novaClient, opt).AllPages()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing flavors: %v", withRequestID(err))
+		}
+		r, err := flavors.ExtractFlavors(allPages)
+		if err != nil {
+			return false, fmt.Errorf("error extracting flavors from pages: %v", err)
+		}
+		fs = r
+		return true, nil
+	})
+	if err != nil {
+		return fs, err
+	} else if done {
+		return fs, nil
+	} else {
+		return fs, wait.ErrWaitTimeout
+	}
+}
+
+// GetFlavor returns the flavor with the given name or ID. The error of an unknown flavor lists the
+// available flavors, so a typo in the machine type is easily spotted.
+func (c *openstackCloud) GetFlavor(name string) (*flavors.Flavor, error) {
+	fs, err := c.ListFlavors(flavors.ListOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return FindFlavor(fs, name)
+}
+
+// FindFlavor returns the flavor with the ID or name from the list of flavors
+func FindFlavor(fs []flavors.Flavor, name string) (*flavors.Flavor, error) {
+	var matches []*flavors.Flavor
+	var names []string
+	for i := range fs {
+		if fs[i].ID == name {
+			return &fs[i], nil
+		}
+		if fs[i].Name == name {
+			matches = append(matches, &fs[i])
+		}
+		names = append(names, fs[i].Name)
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		sort.Strings(names)
+		return nil, fmt.Errorf("flavor %q not found, available flavors are: %s", name, strings.Join(names, ", "))
+	default:
+		return nil, fmt.Errorf("found multiple flavors with name %q, use the flavor ID instead", name)
+	}
+}
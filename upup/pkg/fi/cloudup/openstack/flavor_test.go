@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+func TestDefaultInstanceType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/flavors/detail" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"flavors": [
+			{"id": "1", "name": "m1.xlarge", "vcpus": 8, "ram": 16384, "disk": 160},
+			{"id": "2", "name": "m1.small", "vcpus": 1, "ram": 2048, "disk": 20},
+			{"id": "3", "name": "m1.medium-b", "vcpus": 2, "ram": 4096, "disk": 40},
+			{"id": "4", "name": "m1.medium-a", "vcpus": 2, "ram": 4096, "disk": 40},
+			{"id": "5", "name": "m1.medium-ssd", "vcpus": 2, "ram": 4096, "disk": 20},
+			{"id": "6", "name": "c1.large", "vcpus": 4, "ram": 4096, "disk": 40}
+		]}`)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	grid := []struct {
+		role        kops.InstanceGroupRole
+		machineType string
+		expected    string
+	}{
+		{role: kops.InstanceGroupRoleMaster, expected: "m1.medium-ssd"},
+		{role: kops.InstanceGroupRoleNode, expected: "m1.medium-ssd"},
+		{role: kops.InstanceGroupRoleBastion, expected: "m1.small"},
+		{role: kops.InstanceGroupRoleNode, machineType: "custom.flavor", expected: "custom.flavor"},
+	}
+	for _, g := range grid {
+		ig := &kops.InstanceGroup{Spec: kops.InstanceGroupSpec{Role: g.role, MachineType: g.machineType}}
+		actual, err := c.DefaultInstanceType(nil, ig)
+		if err != nil {
+			t.Fatalf("unexpected error for role %s: %v", g.role, err)
+		}
+		if actual != g.expected {
+			t.Errorf("expected flavor %q for role %s, got %q", g.expected, g.role, actual)
+		}
+	}
+}
+
+func TestDefaultInstanceTypeNoSuitableFlavor(t *testing.T) {
+	fList := flavorList{{Name: "m1.tiny", VCPUs: 1, RAM: 512}, {Name: "m1.small", VCPUs: 1, RAM: 2048}}
+	_, err := smallestFlavor(fList, flavorRequirements[kops.InstanceGroupRoleNode], kops.InstanceGroupRoleNode)
+	if err == nil {
+		t.Fatalf("expected error without a suitable flavor")
+	}
+	if !strings.Contains(err.Error(), "at least 2 vCPUs and 4096 MB RAM") {
+		t.Errorf("expected the requirement in the error, got %v", err)
+	}
+}
+
+func TestGetFlavor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"flavors": [
+			{"id": "1", "name": "m1.small", "vcpus": 1, "ram": 2048},
+			{"id": "2", "name": "m1.large", "vcpus": 4, "ram": 8192},
+			{"id": "3", "name": "shared", "vcpus": 2, "ram": 4096},
+			{"id": "4", "name": "shared", "vcpus": 2, "ram": 4096}
+		]}`)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	grid := []struct {
+		name       string
+		expectedID string
+		err        string
+	}{
+		{name: "m1.large", expectedID: "2"},
+		{name: "1", expectedID: "1"},
+		{name: "4", expectedID: "4"},
+		{name: "m1.larg", err: `flavor "m1.larg" not found, available flavors are: m1.large, m1.small, shared, shared`},
+		{name: "shared", err: "found multiple flavors"},
+	}
+	for _, g := range grid {
+		flavor, err := c.GetFlavor(g.name)
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("%q: expected error %q, got %v", g.name, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", g.name, err)
+			continue
+		}
+		if flavor.ID != g.expectedID {
+			t.Errorf("%q: expected flavor %s, got %s", g.name, g.expectedID, flavor.ID)
+		}
+	}
+}
@@ -18,19 +18,21 @@ package openstack
 
 import (
 	"fmt"
+	"sync"
 
+	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
 	l3floatingip "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) GetFloatingIP(id string) (fip *floatingips.FloatingIP, err error) {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 
 		fip, err = floatingips.Get(c.ComputeClient(), id).Extract()
 		if err != nil {
-			return false, fmt.Errorf("GetFloatingIP: fetching floating IP failed: %v", err)
+			return false, fmt.Errorf("GetFloatingIP: fetching floating IP failed: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -44,11 +46,11 @@ func (c *openstackCloud) GetFloatingIP(id string) (fip *floatingips.FloatingIP,
 }
 
 func (c *openstackCloud) CreateFloatingIP(opts floatingips.CreateOpts) (fip *floatingips.FloatingIP, err error) {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 
 		fip, err = floatingips.Create(c.ComputeClient(), opts).Extract()
 		if err != nil {
-			return false, fmt.Errorf("CreateFloatingIP: create floating IP failed: %v", err)
+			return !isRetryable(err), fmt.Errorf("CreateFloatingIP: create floating IP failed: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -58,11 +60,27 @@ func (c *openstackCloud) CreateFloatingIP(opts floatingips.CreateOpts) (fip *flo
 		}
 		return fip, err
 	}
-	return fip, nil
+	return fip, err
 }
 
+// AssociateFloatingIPToInstance associates the floating IP with the server, unless it is already associated with it
 func (c *openstackCloud) AssociateFloatingIPToInstance(serverID string, opts floatingips.AssociateOpts) (err error) {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	fips, err := c.ListFloatingIPs()
+	if err != nil {
+		return err
+	}
+	for _, fip := range fips {
+		if fip.IP != opts.FloatingIP || fip.InstanceID == "" {
+			continue
+		}
+		if fip.InstanceID == serverID && (opts.FixedIP == "" || opts.FixedIP == fip.FixedIP) {
+			glog.V(2).Infof("Floating IP %s is already associated with server %s", fip.IP, serverID)
+			return nil
+		}
+		glog.V(2).Infof("Reassociating floating IP %s from server %s to server %s", fip.IP, fip.InstanceID, serverID)
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err = floatingips.AssociateInstance(c.ComputeClient(), serverID, opts).ExtractErr()
 		if err != nil {
 			return false, err
@@ -77,11 +95,11 @@ func (c *openstackCloud) AssociateFloatingIPToInstance(serverID string, opts flo
 }
 
 func (c *openstackCloud) CreateL3FloatingIP(opts l3floatingip.CreateOpts) (fip *l3floatingip.FloatingIP, err error) {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 
 		fip, err = l3floatingip.Create(c.NetworkingClient(), opts).Extract()
 		if err != nil {
-			return false, fmt.Errorf("CreateL3FloatingIP: create L3 floating IP failed: %v", err)
+			return !isRetryable(err), fmt.Errorf("CreateL3FloatingIP: create L3 floating IP failed: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -91,15 +109,103 @@ func (c *openstackCloud) CreateL3FloatingIP(opts l3floatingip.CreateOpts) (fip *
 		}
 		return fip, err
 	}
+	return fip, err
+}
+
+// floatingIPClaims holds the floating IPs handed out by EnsureFloatingIP, so that tasks running in parallel
+// do not reuse the same unassociated floating IP. It is shared by the copies of a cloud.
+type floatingIPClaims struct {
+	sync.Mutex
+	claimed sets.String
+}
+
+func newFloatingIPClaims() *floatingIPClaims {
+	return &floatingIPClaims{claimed: sets.NewString()}
+}
+
+// EnsureFloatingIP returns a floating IP of the external network for the cluster. An unassociated floating IP
+// tagged with the cluster is reused before a new one is allocated, which spares the floating IP quota.
+func (c *openstackCloud) EnsureFloatingIP(networkID string) (*l3floatingip.FloatingIP, error) {
+	clusterTag := ClusterTag(c.tags[TagClusterName])
+
+	// without tags the floating IPs of the cluster are not known, so none are reused
+	tagged, err := c.HasExtension(ServiceNetwork, ExtensionTags)
+	if err != nil {
+		return nil, err
+	}
+
+	c.floatingIPs.Lock()
+	defer c.floatingIPs.Unlock()
+
+	if tagged {
+		fips, err := c.ListL3FloatingIPs(l3floatingip.ListOpts{
+			FloatingNetworkID: networkID,
+			Tags:              clusterTag,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range fips {
+			fip := &fips[i]
+			if fip.PortID != "" || c.floatingIPs.claimed.Has(fip.ID) {
+				continue
+			}
+			glog.V(2).Infof("Reusing unassociated floating IP %s (%s)", fip.FloatingIP, fip.ID)
+			c.floatingIPs.claimed.Insert(fip.ID)
+			return fip, nil
+		}
+	}
+
+	fip, err := c.CreateL3FloatingIP(l3floatingip.CreateOpts{
+		FloatingNetworkID: networkID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.floatingIPs.claimed.Insert(fip.ID)
+	if !tagged {
+		return fip, nil
+	}
+	// the tag lets the next runs reuse the floating IP once it is released
+	if err := c.SetResourceTags(ResourceTypeFloatingIP, fip.ID, []string{clusterTag}); err != nil {
+		// an untagged floating IP would neither be reused nor deleted with the cluster
+		c.floatingIPs.claimed.Delete(fip.ID)
+		if derr := c.DeleteL3FloatingIP(fip.ID); derr != nil {
+			glog.Warningf("Failed to delete untagged floating IP %s: %v", fip.ID, derr)
+		}
+		return nil, err
+	}
+	fip.Tags = []string{clusterTag}
 	return fip, nil
 }
 
+// AssociateL3FloatingIPToPort associates the Neutron floating IP with the port. Unlike AssociateFloatingIPToInstance
+// it does not need a server, which the VIP of a loadbalancer is not.
+func (c *openstackCloud) AssociateL3FloatingIPToPort(fipID string, portID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := l3floatingip.Update(c.NetworkingClient(), fipID, l3floatingip.UpdateOpts{
+			PortID: &portID,
+		}).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("Failed to associate floating ip %s to port %s: %v", fipID, portID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
+
 func (c *openstackCloud) ListFloatingIPs() (fips []floatingips.FloatingIP, err error) {
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		pages, err := floatingips.List(c.ComputeClient()).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("Failed to list floating ip: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to list floating ip: %v", withRequestID(err))
 		}
 		fips, err = floatingips.ExtractFloatingIPs(pages)
 		if err != nil {
@@ -113,15 +219,15 @@ func (c *openstackCloud) ListFloatingIPs() (fips []floatingips.FloatingIP, err e
 		}
 		return fips, err
 	}
-	return fips, nil
+	return fips, err
 }
 
 func (c *openstackCloud) ListL3FloatingIPs(opts l3floatingip.ListOpts) (fips []l3floatingip.FloatingIP, err error) {
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		page, err := l3floatingip.List(c.NetworkingClient(), opts).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("Failed to list L3 floating ip: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to list L3 floating ip: %v", withRequestID(err))
 		}
 		fips, err = l3floatingip.ExtractFloatingIPs(page)
 		if err != nil {
@@ -135,15 +241,31 @@ func (c *openstackCloud) ListL3FloatingIPs(opts l3floatingip.ListOpts) (fips []l
 		}
 		return fips, err
 	}
-	return fips, nil
+	return fips, err
+}
+
+// DisassociateFloatingIP removes the floating IP from the server, a server which no longer exists is ignored
+func (c *openstackCloud) DisassociateFloatingIP(serverID string, opts floatingips.DisassociateOpts) (err error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err = floatingips.DisassociateInstance(c.ComputeClient(), serverID, opts).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("Failed to disassociate floating ip %s from server %s: %v", opts.FloatingIP, serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done && err == nil {
+		err = wait.ErrWaitTimeout
+	}
+	return err
 }
 
+// DeleteFloatingIP releases the compute floating IP, a floating IP which no longer exists is ignored
 func (c *openstackCloud) DeleteFloatingIP(id string) (err error) {
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		err = l3floatingip.Delete(c.ComputeClient(), id).ExtractErr()
-		if err != nil {
-			return false, fmt.Errorf("Failed to delete floating ip %s: %v", id, err)
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err = floatingips.Delete(c.ComputeClient(), id).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("Failed to delete floating ip %s: %v", id, withRequestID(err))
 		}
 		return true, nil
 	})
@@ -153,12 +275,13 @@ func (c *openstackCloud) DeleteFloatingIP(id string) (err error) {
 	return err
 }
 
+// DeleteL3FloatingIP releases the neutron floating IP, a floating IP which no longer exists is ignored
 func (c *openstackCloud) DeleteL3FloatingIP(id string) (err error) {
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err = l3floatingip.Delete(c.NetworkingClient(), id).ExtractErr()
-		if err != nil {
-			return false, fmt.Errorf("Failed to delete L3 floating ip %s: %v", id, err)
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("Failed to delete L3 floating ip %s: %v", id, withRequestID(err))
 		}
 		return true, nil
 	})
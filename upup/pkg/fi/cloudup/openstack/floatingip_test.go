@@ -0,0 +1,297 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
+)
+
+func TestAssociateFloatingIPToInstance(t *testing.T) {
+	grid := []struct {
+		description    string
+		instanceID     string
+		fixedIP        string
+		opts           floatingips.AssociateOpts
+		expectedAction bool
+	}{
+		{
+			description:    "unassociated",
+			opts:           floatingips.AssociateOpts{FloatingIP: "172.24.4.10"},
+			expectedAction: true,
+		},
+		{
+			description:    "already associated",
+			instanceID:     "server-1",
+			fixedIP:        "10.0.0.5",
+			opts:           floatingips.AssociateOpts{FloatingIP: "172.24.4.10"},
+			expectedAction: false,
+		},
+		{
+			description:    "already associated with the fixed ip",
+			instanceID:     "server-1",
+			fixedIP:        "10.0.0.5",
+			opts:           floatingips.AssociateOpts{FloatingIP: "172.24.4.10", FixedIP: "10.0.0.5"},
+			expectedAction: false,
+		},
+		{
+			description:    "associated with another fixed ip",
+			instanceID:     "server-1",
+			fixedIP:        "10.0.0.5",
+			opts:           floatingips.AssociateOpts{FloatingIP: "172.24.4.10", FixedIP: "10.0.1.5"},
+			expectedAction: true,
+		},
+		{
+			description:    "associated with another server",
+			instanceID:     "server-2",
+			fixedIP:        "10.0.0.6",
+			opts:           floatingips.AssociateOpts{FloatingIP: "172.24.4.10"},
+			expectedAction: true,
+		},
+	}
+	for _, g := range grid {
+		actions := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/os-floating-ips":
+				fmt.Fprintf(w, `{"floating_ips": [{"id": "fip-1", "ip": "172.24.4.10", "instance_id": %q, "fixed_ip": %q}]}`, g.instanceID, g.fixedIP)
+			case r.Method == http.MethodPost && r.URL.Path == "/servers/server-1/action":
+				actions++
+				w.WriteHeader(http.StatusAccepted)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		c := &openstackCloud{
+			novaClient: newTestServiceClient(server),
+		}
+		err := c.AssociateFloatingIPToInstance("server-1", g.opts)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", g.description, err)
+			continue
+		}
+		if g.expectedAction && actions != 1 {
+			t.Errorf("%s: expected floating ip to be associated, got %d requests", g.description, actions)
+		}
+		if !g.expectedAction && actions != 0 {
+			t.Errorf("%s: expected association to be skipped, got %d requests", g.description, actions)
+		}
+	}
+}
+
+func TestDisassociateFloatingIP(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/servers/server-1/action" {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		novaClient: newTestServiceClient(server),
+	}
+	if err := c.DisassociateFloatingIP("server-1", floatingips.DisassociateOpts{FloatingIP: "172.24.4.10"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(body, `"removeFloatingIp"`) || !strings.Contains(body, "172.24.4.10") {
+		t.Errorf("expected removeFloatingIp action, got %s", body)
+	}
+	if err := c.DisassociateFloatingIP("server-2", floatingips.DisassociateOpts{FloatingIP: "172.24.4.10"}); err != nil {
+		t.Errorf("expected missing server to be ignored, got %v", err)
+	}
+}
+
+func TestDeleteFloatingIPIgnoresNotFound(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		deleted = append(deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{
+		novaClient:    newTestServiceClient(server),
+		neutronClient: networking,
+	}
+	if err := c.DeleteFloatingIP("fip-1"); err != nil {
+		t.Errorf("unexpected error deleting floating ip: %v", err)
+	}
+	if err := c.DeleteL3FloatingIP("fip-2"); err != nil {
+		t.Errorf("unexpected error deleting L3 floating ip: %v", err)
+	}
+	expected := []string{"/os-floating-ips/fip-1", "/v2.0/floatingips/fip-2"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected requests %v, got %v", expected, deleted)
+	}
+}
+
+func TestEnsureFloatingIPReusesUnassociated(t *testing.T) {
+	var query string
+	var created, tagged []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2.0/extensions":
+			fmt.Fprint(w, `{"extensions": [{"alias": "standard-attr-tag"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2.0/floatingips":
+			query = r.URL.RawQuery
+			fmt.Fprint(w, `{"floatingips": [
+				{"id": "fip-1", "floating_ip_address": "172.24.4.10", "port_id": "port-1"},
+				{"id": "fip-2", "floating_ip_address": "172.24.4.11", "port_id": ""}
+			]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2.0/floatingips":
+			b, _ := ioutil.ReadAll(r.Body)
+			created = append(created, string(b))
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"floatingip": {"id": "fip-3", "floating_ip_address": "172.24.4.12"}}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2.0/floatingips/fip-3/tags":
+			b, _ := ioutil.ReadAll(r.Body)
+			tagged = append(tagged, string(b))
+			fmt.Fprint(w, `{"tags": ["KubernetesCluster:test-k8s-local"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{
+		neutronClient: networking,
+		tags:          map[string]string{TagClusterName: "test.k8s.local"},
+		floatingIPs:   newFloatingIPClaims(),
+	}
+
+	fip, err := c.EnsureFloatingIP("ext-net")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fip.ID != "fip-2" {
+		t.Errorf("expected unassociated floating ip fip-2 to be reused, got %s", fip.ID)
+	}
+	if !strings.Contains(query, "floating_network_id=ext-net") || !strings.Contains(query, "tags=KubernetesCluster%3Atest-k8s-local") {
+		t.Errorf("expected floating ips to be filtered by network and cluster tag, got %q", query)
+	}
+	if len(created) != 0 {
+		t.Errorf("expected no floating ip to be created, got %v", created)
+	}
+
+	// fip-2 is claimed by the first call, so a new floating ip has to be allocated
+	fip, err = c.EnsureFloatingIP("ext-net")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fip.ID != "fip-3" {
+		t.Errorf("expected floating ip fip-3 to be created, got %s", fip.ID)
+	}
+	if len(created) != 1 || !strings.Contains(created[0], `"floating_network_id":"ext-net"`) {
+		t.Errorf("expected a floating ip to be created on ext-net, got %v", created)
+	}
+	if len(tagged) != 1 || !strings.Contains(tagged[0], "KubernetesCluster:test-k8s-local") {
+		t.Errorf("expected the created floating ip to be tagged with the cluster, got %v", tagged)
+	}
+}
+
+func TestEnsureFloatingIPDeletesUntagged(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2.0/extensions":
+			fmt.Fprint(w, `{"extensions": [{"alias": "standard-attr-tag"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2.0/floatingips":
+			fmt.Fprint(w, `{"floatingips": []}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2.0/floatingips":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"floatingip": {"id": "fip-1", "floating_ip_address": "172.24.4.10"}}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2.0/floatingips/fip-1/tags":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2.0/floatingips/fip-1":
+			deleted = append(deleted, "fip-1")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{
+		neutronClient: networking,
+		tags:          map[string]string{TagClusterName: "test.k8s.local"},
+		floatingIPs:   newFloatingIPClaims(),
+	}
+
+	if _, err := c.EnsureFloatingIP("ext-net"); err == nil {
+		t.Fatalf("expected the failure to tag the floating ip to be returned")
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected the untagged floating ip to be deleted, got %v", deleted)
+	}
+	if c.floatingIPs.claimed.Has("fip-1") {
+		t.Errorf("expected the deleted floating ip not to stay claimed")
+	}
+}
+
+func TestAssociateL3FloatingIPToPort(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPut && r.URL.Path == "/v2.0/floatingips/fip-1" {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			fmt.Fprint(w, `{"floatingip": {"id": "fip-1", "port_id": "vip-port"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{
+		neutronClient: networking,
+	}
+	if err := c.AssociateL3FloatingIPToPort("fip-1", "vip-port"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(body, `"port_id":"vip-port"`) {
+		t.Errorf("expected floating ip to be associated to the port, got %s", body)
+	}
+}
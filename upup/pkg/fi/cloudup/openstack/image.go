@@ -0,0 +1,215 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	novaimages "github.com/gophercloud/gophercloud/openstack/compute/v2/images"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const imageStatusActive = "active"
+
+// Image is a Glance image
+type Image struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Visibility string `json:"visibility"`
+	// MinDisk is the minimum disk size in GB a server booted from the image needs
+	MinDisk int `json:"min_disk"`
+	// MinRAM is the minimum RAM in MB a server booted from the image needs
+	MinRAM int `json:"min_ram"`
+}
+
+// ImageListOpts filters the listed images
+type ImageListOpts struct {
+	Name       string `q:"name"`
+	Status     string `q:"status"`
+	Visibility string `q:"visibility"`
+}
+
+// imageCache holds the images resolved by name or ID, it is shared by the copies of a cloud
+type imageCache struct {
+	sync.Mutex
+	images map[string]*Image
+}
+
+func newImageCache() *imageCache {
+	return &imageCache{images: make(map[string]*Image)}
+}
+
+// ListImages returns the images which match the options, following the pages of the Glance v2 API
+func (c *openstackCloud) ListImages(opts ImageListOpts) (images []Image, err error) {
+	if c.imageClient == nil {
+		return c.listNovaImages(opts)
+	}
+	query, err := gophercloud.BuildQueryString(opts)
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		images = nil
+		url := c.imageClient.ServiceURL("images") + query.String()
+		for url != "" {
+			var r struct {
+				Images []Image `json:"images"`
+				Next   string  `json:"next"`
+			}
+			_, err := c.imageClient.Get(url, &r, nil)
+			if err != nil {
+				return !isRetryable(err), fmt.Errorf("error listing images: %v", withRequestID(err))
+			}
+			images = append(images, r.Images...)
+			url = ""
+			if r.Next != "" {
+				// the next link is relative to the endpoint and includes the version, e.g. /v2/images?marker=...
+				url = strings.TrimSuffix(c.imageClient.Endpoint, "/") + r.Next
+			}
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return images, err
+	}
+	return images, err
+}
+
+// GetImage returns the active image with the given name or ID. Images are resolved once per cloud,
+// so the instances of a cluster do not look up the same image each.
+func (c *openstackCloud) GetImage(nameOrID string) (*Image, error) {
+	if c.images != nil {
+		c.images.Lock()
+		defer c.images.Unlock()
+		if image := c.images.images[nameOrID]; image != nil {
+			return image, nil
+		}
+	}
+
+	image, err := c.findImage(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	if image.Status != imageStatusActive {
+		return nil, fmt.Errorf("image %q (%s) can not be used, its status is %s", nameOrID, image.ID, image.Status)
+	}
+	glog.V(4).Infof("resolved image %q to %s", nameOrID, image.ID)
+	if c.images != nil {
+		c.images.images[nameOrID] = image
+	}
+	return image, nil
+}
+
+// findImage looks the image up by name, and by ID when no image has the name
+func (c *openstackCloud) findImage(nameOrID string) (*Image, error) {
+	images, err := c.ListImages(ImageListOpts{Name: nameOrID})
+	if err != nil {
+		return nil, err
+	}
+	switch len(images) {
+	case 1:
+		return &images[0], nil
+	case 0:
+	default:
+		return nil, fmt.Errorf("found multiple images with name %q, use the image ID instead", nameOrID)
+	}
+
+	var image *Image
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r Image
+		var err error
+		if c.imageClient == nil {
+			var v *novaimages.Image
+			v, err = novaimages.Get(c.novaClient, nameOrID).Extract()
+			if err == nil {
+				r = imageFromNova(*v)
+			}
+		} else {
+			_, err = c.imageClient.Get(c.imageClient.ServiceURL("images", nameOrID), &r, nil)
+		}
+		if isNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting image %s: %v", nameOrID, withRequestID(err))
+		}
+		image = &r
+		return true, nil
+	})
+	if !done && err == nil {
+		err = wait.ErrWaitTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, fmt.Errorf("image %q not found", nameOrID)
+	}
+	return image, nil
+}
+
+// listNovaImages lists the images through the image proxy of nova, for clouds without an image service
+func (c *openstackCloud) listNovaImages(opts ImageListOpts) (images []Image, err error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := novaimages.ListDetail(c.novaClient, novaimages.ListOpts{Name: opts.Name}).AllPages()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing images: %v", withRequestID(err))
+		}
+		r, err := novaimages.ExtractImages(allPages)
+		if err != nil {
+			return false, fmt.Errorf("error extracting images from pages: %v", err)
+		}
+		images = nil
+		for _, image := range r {
+			images = append(images, imageFromNova(image))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return images, err
+	}
+	var filtered []Image
+	for _, image := range images {
+		if opts.Status != "" && image.Status != opts.Status {
+			continue
+		}
+		filtered = append(filtered, image)
+	}
+	return filtered, err
+}
+
+// imageFromNova converts an image of the nova image proxy, which reports the status in upper case
+func imageFromNova(image novaimages.Image) Image {
+	return Image{
+		ID:      image.ID,
+		Name:    image.Name,
+		Status:  strings.ToLower(image.Status),
+		MinDisk: image.MinDisk,
+		MinRAM:  image.MinRAM,
+	}
+}
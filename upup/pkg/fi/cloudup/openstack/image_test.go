@@ -0,0 +1,152 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestImageServer serves a Glance v2 API with two pages of images
+func newTestImageServer(requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v2/images" && r.URL.Query().Get("marker") == "":
+			name := r.URL.Query().Get("name")
+			if name == "ubuntu" {
+				fmt.Fprint(w, `{"images": [{"id": "image-1", "name": "ubuntu", "status": "active"}]}`)
+				return
+			}
+			if name == "" {
+				fmt.Fprint(w, `{"images": [{"id": "image-1", "name": "ubuntu", "status": "active"}], "next": "/v2/images?marker=image-1"}`)
+				return
+			}
+			if name == "queued" {
+				fmt.Fprint(w, `{"images": [{"id": "image-3", "name": "queued", "status": "queued"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"images": []}`)
+		case r.URL.Path == "/v2/images":
+			fmt.Fprint(w, `{"images": [{"id": "image-2", "name": "centos", "status": "active"}]}`)
+		case r.URL.Path == "/v2/images/image-2":
+			fmt.Fprint(w, `{"id": "image-2", "name": "centos", "status": "active"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestImageCloud(server *httptest.Server) *openstackCloud {
+	client := newTestServiceClient(server)
+	client.ResourceBase = server.URL + "/v2/"
+	return &openstackCloud{imageClient: client, images: newImageCache()}
+}
+
+func TestListImagesFollowsPages(t *testing.T) {
+	var requests []string
+	server := newTestImageServer(&requests)
+	defer server.Close()
+
+	images, err := newTestImageCloud(server).ListImages(ImageListOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error listing images: %v", err)
+	}
+	if len(images) != 2 || images[0].ID != "image-1" || images[1].ID != "image-2" {
+		t.Errorf("expected the images of both pages, got %+v", images)
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	var requests []string
+	server := newTestImageServer(&requests)
+	defer server.Close()
+	c := newTestImageCloud(server)
+
+	grid := []struct {
+		nameOrID   string
+		expectedID string
+		err        string
+	}{
+		{nameOrID: "ubuntu", expectedID: "image-1"},
+		{nameOrID: "image-2", expectedID: "image-2"},
+		{nameOrID: "missing", err: `image "missing" not found`},
+		{nameOrID: "queued", err: "its status is queued"},
+	}
+	for _, g := range grid {
+		image, err := c.GetImage(g.nameOrID)
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("%q: expected error %q, got %v", g.nameOrID, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", g.nameOrID, err)
+			continue
+		}
+		if image.ID != g.expectedID {
+			t.Errorf("%q: expected image %s, got %s", g.nameOrID, g.expectedID, image.ID)
+		}
+	}
+
+	requests = nil
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetImage("ubuntu"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Errorf("expected the resolved image to be cached, got requests %v", requests)
+	}
+}
+
+func TestGetImageWithoutImageService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/images/detail":
+			if r.URL.Query().Get("name") == "ubuntu" {
+				fmt.Fprint(w, `{"images": [{"id": "image-1", "name": "ubuntu", "status": "ACTIVE"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"images": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	if c.ImageClient() != nil {
+		t.Fatalf("expected no image client")
+	}
+	image, err := c.GetImage("ubuntu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if image.ID != "image-1" || image.Status != "active" {
+		t.Errorf("unexpected image %+v", image)
+	}
+	if _, err := c.GetImage("missing"); err == nil || !strings.Contains(err.Error(), `image "missing" not found`) {
+		t.Errorf("expected missing image error, got %v", err)
+	}
+}
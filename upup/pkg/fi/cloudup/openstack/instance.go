@@ -18,21 +18,52 @@ package openstack
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/pagination"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/pkg/cloudinstances"
-	"k8s.io/kops/util/pkg/vfs"
+	"k8s.io/kops/pkg/featureflag"
 )
 
+const (
+	// InstanceStatusShutoff is the nova status of a server which has been powered off
+	InstanceStatusShutoff = "SHUTOFF"
+	// InstanceStatusActive is the nova status of a running server
+	InstanceStatusActive = "ACTIVE"
+	// instanceStatusVerifyResize is the nova status of a resized server waiting for the resize to be confirmed
+	instanceStatusVerifyResize = "VERIFY_RESIZE"
+	// instanceStatusError is the nova status of a server which failed an operation
+	instanceStatusError = "ERROR"
+)
+
+// serverResizeTimeout is how long to wait for a server to be resized, the disk of the server may be copied
+var serverResizeTimeout = 15 * time.Minute
+
+// serverPowerTimeout is how long to wait for a server to be started, stopped or rebooted
+var serverPowerTimeout = 5 * time.Minute
+
+// serverStatusInterval is the interval at which the status of a server is polled
+var serverStatusInterval = 2 * time.Second
+
+// StartStoppedInstances if set will power on the instances which kops update cluster finds in SHUTOFF state.
+// When not set, such instances are only reported during validation.
+var StartStoppedInstances = featureflag.New("OpenstackStartStoppedInstances", featureflag.Bool(false))
+
+// drainSleep waits for the connections of detached pool members to drain, replaced in tests
+var drainSleep = time.Sleep
+
 func (c *openstackCloud) CreateInstance(opt servers.CreateOptsBuilder) (*servers.Server, error) {
 	var server *servers.Server
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := servers.Create(c.novaClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating server %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error creating server %v: %v", opt, withRequestID(err))
 		}
 		server = v
 		return true, nil
@@ -51,17 +82,88 @@ func (c *openstackCloud) DeleteInstance(i *cloudinstances.CloudInstanceGroupMemb
 	return c.DeleteInstanceWithID(i.ID)
 }
 
+// DeleteInstanceWithID deletes the server, a server which no longer exists is ignored
 func (c *openstackCloud) DeleteInstanceWithID(instanceID string) error {
-	return servers.Delete(c.novaClient, instanceID).ExtractErr()
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := servers.Delete(c.novaClient, instanceID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("error deleting server %s: %v", instanceID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done && err == nil {
+		err = wait.ErrWaitTimeout
+	}
+	return err
+}
+
+// TerminateInstance removes the server from all loadbalancer pools it is a member of, waits drainTimeout
+// for the loadbalancer to drain the existing connections and then deletes the server.
+func (c *openstackCloud) TerminateInstance(serverID string, drainTimeout time.Duration) error {
+	server, err := c.GetInstance(serverID)
+	if err != nil {
+		return fmt.Errorf("error getting server %s: %v", serverID, err)
+	}
+	addresses := ServerAddresses(server)
+
+	pools, err := c.ListPools(v2pools.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("error listing loadbalancer pools: %v", err)
+	}
+	detached := false
+	for _, pool := range pools {
+		members, err := c.ListPoolMembers(pool.ID, v2pools.ListMembersOpts{})
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if !addresses[member.Address] {
+				continue
+			}
+			glog.V(2).Infof("Removing server %s from loadbalancer pool %s", serverID, pool.ID)
+			if err := c.DeletePoolMember(pool.ID, member.ID); err != nil {
+				return err
+			}
+			detached = true
+		}
+	}
+
+	if detached && drainTimeout > 0 {
+		glog.Infof("Waiting %v for connections to server %s to drain", drainTimeout, serverID)
+		drainSleep(drainTimeout)
+	}
+
+	return c.DeleteInstanceWithID(serverID)
+}
+
+// ServerAddresses returns the set of fixed and floating ip addresses of the server
+func ServerAddresses(server *servers.Server) map[string]bool {
+	addresses := make(map[string]bool)
+	for _, networkAddresses := range server.Addresses {
+		addrList, ok := networkAddresses.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, addr := range addrList {
+			addrMap, ok := addr.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if ip, ok := addrMap[openstackAddress].(string); ok {
+				addresses[ip] = true
+			}
+		}
+	}
+	return addresses
 }
 
 func (c *openstackCloud) GetInstance(id string) (*servers.Server, error) {
 	var server *servers.Server
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		instance, err := servers.Get(c.novaClient, id).Extract()
 		if err != nil {
-			return false, err
+			return !isRetryable(err), err
 		}
 		server = instance
 		return true, nil
@@ -75,13 +177,72 @@ func (c *openstackCloud) GetInstance(id string) (*servers.Server, error) {
 	}
 }
 
+// defaultServerConcurrency is the number of servers GetServers fetches at once unless told otherwise
+const defaultServerConcurrency = 10
+
+// GetServers fetches the servers with at most concurrency requests in flight, 10 if concurrency is not positive.
+// Servers which no longer exist are left out of the result. Every request is retried like GetInstance, the first
+// failing request aborts the servers which are not fetched yet.
+func (c *openstackCloud) GetServers(serverIDs []string, concurrency int) (map[string]*servers.Server, error) {
+	if concurrency <= 0 {
+		concurrency = defaultServerConcurrency
+	}
+	if concurrency > len(serverIDs) {
+		concurrency = len(serverIDs)
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	result := make(map[string]*servers.Server)
+
+	ids := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				mutex.Lock()
+				failed := firstErr != nil
+				mutex.Unlock()
+				if failed {
+					continue
+				}
+
+				server, err := c.GetInstance(id)
+				if isNotFound(err) {
+					continue
+				}
+
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("error getting server %s: %v", id, err)
+				} else if err == nil {
+					result[id] = server
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, id := range serverIDs {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
+
 func (c *openstackCloud) ListInstances(opt servers.ListOptsBuilder) ([]servers.Server, error) {
 	var instances []servers.Server
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := servers.List(c.novaClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing servers %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error listing servers %v: %v", opt, withRequestID(err))
 		}
 
 		ss, err := servers.ExtractServers(allPages)
@@ -99,3 +260,269 @@ func (c *openstackCloud) ListInstances(opt servers.ListOptsBuilder) ([]servers.S
 		return instances, wait.ErrWaitTimeout
 	}
 }
+
+// EachInstance calls fn for the servers which match the options page by page, without holding all servers in memory.
+// An error returned by fn stops the iteration and is returned.
+func (c *openstackCloud) EachInstance(opt servers.ListOptsBuilder, fn func(servers.Server) error) error {
+	return c.eachPage("servers", func() pagination.Pager {
+		return servers.List(c.novaClient, opt)
+	}, func(page pagination.Page) (bool, error) {
+		instances, err := servers.ExtractServers(page)
+		if err != nil {
+			return false, fmt.Errorf("error extracting servers from page: %v", err)
+		}
+		for _, instance := range instances {
+			if err := fn(instance); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// ListClusterInstances walks all servers and keeps the ones whose metadata carries the cluster name.
+// The metadata is filtered client-side, the list filters of nova do not reliably match server metadata.
+func (c *openstackCloud) ListClusterInstances(clusterName string) ([]servers.Server, error) {
+	var clusterInstances []servers.Server
+	err := c.EachInstance(servers.ListOpts{}, func(instance servers.Server) error {
+		if instance.Metadata[TagServerClusterName] == clusterName {
+			clusterInstances = append(clusterInstances, instance)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clusterInstances, nil
+}
+
+// StartInstance powers on the stopped server and waits until it is ACTIVE
+func (c *openstackCloud) StartInstance(instanceID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := c.novaClient.Post(c.novaClient.ServiceURL("servers", instanceID, "action"), map[string]interface{}{"os-start": nil}, nil, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error starting server %s: %v", instanceID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.waitForServerStatus(instanceID, InstanceStatusActive, serverPowerTimeout)
+	return err
+}
+
+// SetServerMetadata adds the metadata to the server, existing metadata which is not part of md is kept
+func (c *openstackCloud) SetServerMetadata(serverID string, md map[string]string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := servers.UpdateMetadata(c.novaClient, serverID, servers.MetadataOpts(md)).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error setting metadata of server %s: %v", serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
+
+// StartServer powers on the server and waits until it is ACTIVE, a server which is already ACTIVE is left as is
+func (c *openstackCloud) StartServer(serverID string) error {
+	server, err := c.GetInstance(serverID)
+	if err != nil {
+		return fmt.Errorf("error getting server %s: %v", serverID, err)
+	}
+	if server.Status == InstanceStatusActive {
+		return nil
+	}
+	return c.StartInstance(serverID)
+}
+
+// StopServer powers off the server and waits until it is SHUTOFF, a server which is already SHUTOFF is left as is
+func (c *openstackCloud) StopServer(serverID string) error {
+	server, err := c.GetInstance(serverID)
+	if err != nil {
+		return fmt.Errorf("error getting server %s: %v", serverID, err)
+	}
+	if server.Status == InstanceStatusShutoff {
+		return nil
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := c.novaClient.Post(c.novaClient.ServiceURL("servers", serverID, "action"), map[string]interface{}{"os-stop": nil}, nil, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error stopping server %s: %v", serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.waitForServerStatus(serverID, InstanceStatusShutoff, serverPowerTimeout)
+	return err
+}
+
+// RebootServer reboots the server and waits until it is ACTIVE again. A soft reboot asks the operating system
+// to restart, a hard reboot power cycles the server.
+func (c *openstackCloud) RebootServer(serverID string, how servers.RebootMethod) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := servers.Reboot(c.novaClient, serverID, servers.RebootOpts{Type: how}).ExtractErr()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error rebooting server %s: %v", serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.waitForServerStatus(serverID, InstanceStatusActive, serverPowerTimeout)
+	return err
+}
+
+// reportPowerState marks a cloud group member whose server has been shut off as stopped. The servers are
+// only started again by the instance tasks of kops update cluster, when StartStoppedInstances is enabled.
+func reportPowerState(member *cloudinstances.CloudInstanceGroupMember, server *servers.Server) {
+	if server == nil {
+		glog.Warningf("server %s of the cloud group no longer exists", member.ID)
+		return
+	}
+	if server.Status != InstanceStatusShutoff {
+		return
+	}
+	glog.Warningf("server %s is %s but is expected to be running", member.ID, server.Status)
+	member.Stopped = true
+}
+
+// waitForServerStatus polls the server until it reaches the status. A server which goes into ERROR status is reported
+// as an error instead of waiting for the timeout.
+func (c *openstackCloud) waitForServerStatus(serverID, status string, timeout time.Duration) (*servers.Server, error) {
+	backoff := wait.Backoff{
+		Duration: serverStatusInterval,
+		Factor:   1,
+		Steps:    int(timeout/serverStatusInterval) + 1,
+	}
+	var server *servers.Server
+	done, err := c.retryWithBackoff(backoff, func() (bool, error) {
+		s, err := servers.Get(c.novaClient, serverID).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting server %s: %v", serverID, withRequestID(err))
+		}
+		server = s
+		if s.Status == status {
+			return true, nil
+		}
+		if s.Status == instanceStatusError {
+			return true, fmt.Errorf("server %s is in status %s while waiting for status %s", serverID, s.Status, status)
+		}
+		glog.V(4).Infof("waiting for server %s to reach status %s, status is %s", serverID, status, s.Status)
+		return false, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return server, fmt.Errorf("server %s did not reach status %s within %v: %v", serverID, status, timeout, err)
+	}
+	return server, err
+}
+
+// ResizeServer changes the flavor of the server. The resize is confirmed once nova reports it is done, a resize
+// which can not be confirmed is reverted so that the server keeps running with its previous flavor.
+func (c *openstackCloud) ResizeServer(serverID, flavorID string) error {
+	server, err := c.GetInstance(serverID)
+	if err != nil {
+		return fmt.Errorf("error getting server %s: %v", serverID, err)
+	}
+	if server.Flavor["id"] == flavorID && server.Status != instanceStatusVerifyResize {
+		glog.V(2).Infof("server %s already has flavor %s", serverID, flavorID)
+		return nil
+	}
+
+	// a resize interrupted while waiting for the confirmation only needs to be confirmed
+	if server.Status != instanceStatusVerifyResize {
+		glog.Infof("resizing server %s to flavor %s", serverID, flavorID)
+		done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+			err := servers.Resize(c.novaClient, serverID, servers.ResizeOpts{FlavorRef: flavorID}).ExtractErr()
+			if err != nil {
+				return !isRetryable(err), fmt.Errorf("error resizing server %s: %v", serverID, withRequestID(err))
+			}
+			return true, nil
+		})
+		if !done {
+			if err == nil {
+				err = wait.ErrWaitTimeout
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.waitForServerStatus(serverID, instanceStatusVerifyResize, serverResizeTimeout); err != nil {
+			return fmt.Errorf("error resizing server %s to flavor %s: %v", serverID, flavorID, err)
+		}
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := servers.ConfirmResize(c.novaClient, serverID).ExtractErr()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error confirming resize of server %s: %v", serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done && err == nil {
+		err = wait.ErrWaitTimeout
+	}
+	if err != nil {
+		glog.Warningf("reverting resize of server %s: %v", serverID, err)
+		if revertErr := c.revertResize(serverID); revertErr != nil {
+			return fmt.Errorf("%v, reverting the resize failed: %v", err, revertErr)
+		}
+		return err
+	}
+	_, err = c.waitForServerStatus(serverID, InstanceStatusActive, serverResizeTimeout)
+	return err
+}
+
+// revertResize reverts the resize of the server and waits until it runs with its previous flavor again
+func (c *openstackCloud) revertResize(serverID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := servers.RevertResize(c.novaClient, serverID).ExtractErr()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error reverting resize of server %s: %v", serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.waitForServerStatus(serverID, InstanceStatusActive, serverResizeTimeout)
+	return err
+}
@@ -0,0 +1,355 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// newTerminateTestServer serves a server with address 10.0.0.5 which is a member of pool-a, and records all
+// modifying requests in order
+func newTerminateTestServer(events *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			*events = append(*events, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		switch r.URL.Path {
+		case "/servers/server-1":
+			fmt.Fprint(w, `{"server": {"id": "server-1", "addresses": {"cluster": [{"addr": "10.0.0.5", "version": 4, "OS-EXT-IPS:type": "fixed"}]}}}`)
+		case "/lbaas/pools":
+			fmt.Fprint(w, `{"pools": [{"id": "pool-a"}, {"id": "pool-b"}]}`)
+		case "/lbaas/pools/pool-a/members":
+			fmt.Fprint(w, `{"members": [{"id": "member-1", "address": "10.0.0.5"}, {"id": "member-2", "address": "10.0.0.6"}]}`)
+		case "/lbaas/pools/pool-b/members":
+			fmt.Fprint(w, `{"members": [{"id": "member-3", "address": "10.0.0.6"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestTerminateInstance(t *testing.T) {
+	var events []string
+	server := newTerminateTestServer(&events)
+	defer server.Close()
+
+	var slept time.Duration
+	drainSleep = func(d time.Duration) {
+		slept = d
+		events = append(events, "drain")
+	}
+	defer func() { drainSleep = time.Sleep }()
+
+	c := &openstackCloud{
+		novaClient: newTestServiceClient(server),
+		lbClient:   newTestServiceClient(server),
+	}
+	if err := c.TerminateInstance("server-1", 30*time.Second); err != nil {
+		t.Fatalf("unexpected error terminating instance: %v", err)
+	}
+
+	expected := []string{
+		"DELETE /lbaas/pools/pool-a/members/member-1",
+		"drain",
+		"DELETE /servers/server-1",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected termination sequence, expected %v, got %v", expected, events)
+	}
+	if slept != 30*time.Second {
+		t.Errorf("expected to wait the drain timeout of 30s, waited %v", slept)
+	}
+}
+
+func TestTerminateInstanceWithoutDrainTimeout(t *testing.T) {
+	var events []string
+	server := newTerminateTestServer(&events)
+	defer server.Close()
+
+	drainSleep = func(d time.Duration) {
+		t.Errorf("unexpected wait of %v without drain timeout", d)
+	}
+	defer func() { drainSleep = time.Sleep }()
+
+	c := &openstackCloud{
+		novaClient: newTestServiceClient(server),
+		lbClient:   newTestServiceClient(server),
+	}
+	if err := c.TerminateInstance("server-1", 0); err != nil {
+		t.Fatalf("unexpected error terminating instance: %v", err)
+	}
+
+	expected := []string{
+		"DELETE /lbaas/pools/pool-a/members/member-1",
+		"DELETE /servers/server-1",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected termination sequence, expected %v, got %v", expected, events)
+	}
+}
+
+func TestListClusterInstances(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"servers": [
+			{"id": "server-1", "metadata": {"k8s": "my.k8s.local"}},
+			{"id": "server-2", "metadata": {"k8s": "other.k8s.local"}},
+			{"id": "server-3", "metadata": {}},
+			{"id": "server-4", "metadata": {"k8s": "my.k8s.local", "KopsInstanceGroup": "nodes"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	instances, err := c.ListClusterInstances("my.k8s.local")
+	if err != nil {
+		t.Fatalf("unexpected error listing instances: %v", err)
+	}
+
+	var ids []string
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+	expected := []string{"server-1", "server-4"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected servers %v, got %v", expected, ids)
+	}
+}
+
+// newResizeTestServer serves server-1 with flavor small, whose status follows the resize actions. The confirmation
+// of the resize fails with confirmStatus if it is set. All actions are recorded in order.
+func newResizeTestServer(actions *[]string, confirmStatus int) *httptest.Server {
+	status, flavor := "ACTIVE", "small"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/servers/server-1":
+			fmt.Fprintf(w, `{"server": {"id": "server-1", "status": %q, "flavor": {"id": %q}}}`, status, flavor)
+		case r.Method == http.MethodPost && r.URL.Path == "/servers/server-1/action":
+			b, _ := ioutil.ReadAll(r.Body)
+			body := string(b)
+			switch {
+			case strings.Contains(body, `"resize"`):
+				*actions = append(*actions, "resize")
+				status, flavor = "VERIFY_RESIZE", strings.Split(strings.Split(body, `"flavorRef":"`)[1], `"`)[0]
+			case strings.Contains(body, `"confirmResize"`):
+				*actions = append(*actions, "confirmResize")
+				if confirmStatus != 0 {
+					w.WriteHeader(confirmStatus)
+					return
+				}
+				status = "ACTIVE"
+			case strings.Contains(body, `"revertResize"`):
+				*actions = append(*actions, "revertResize")
+				status, flavor = "ACTIVE", "small"
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestResizeServer(t *testing.T) {
+	serverStatusInterval = time.Millisecond
+	defer func() { serverStatusInterval = 2 * time.Second }()
+
+	var actions []string
+	server := newResizeTestServer(&actions, 0)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	if err := c.ResizeServer("server-1", "large"); err != nil {
+		t.Fatalf("unexpected error resizing server: %v", err)
+	}
+	expected := []string{"resize", "confirmResize"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected actions %v, got %v", expected, actions)
+	}
+
+	// the server already has the flavor
+	actions = nil
+	if err := c.ResizeServer("server-1", "large"); err != nil {
+		t.Fatalf("unexpected error resizing server: %v", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("expected no actions for a server which already has the flavor, got %v", actions)
+	}
+}
+
+func TestResizeServerRevertsUnconfirmedResize(t *testing.T) {
+	serverStatusInterval = time.Millisecond
+	defer func() { serverStatusInterval = 2 * time.Second }()
+
+	var actions []string
+	server := newResizeTestServer(&actions, http.StatusBadRequest)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	if err := c.ResizeServer("server-1", "large"); err == nil {
+		t.Fatalf("expected an error when the resize can not be confirmed")
+	}
+	expected := []string{"resize", "confirmResize", "revertResize"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected actions %v, got %v", expected, actions)
+	}
+}
+
+// newPowerTestServer serves server-1 in the given status, whose status follows the power actions. All actions are
+// recorded in order.
+func newPowerTestServer(status string, actions *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/servers/server-1":
+			fmt.Fprintf(w, `{"server": {"id": "server-1", "status": %q}}`, status)
+		case r.Method == http.MethodPost && r.URL.Path == "/servers/server-1/action":
+			b, _ := ioutil.ReadAll(r.Body)
+			body := string(b)
+			switch {
+			case strings.Contains(body, `"os-start"`):
+				*actions = append(*actions, "os-start")
+				status = "ACTIVE"
+			case strings.Contains(body, `"os-stop"`):
+				*actions = append(*actions, "os-stop")
+				status = "SHUTOFF"
+			case strings.Contains(body, `"reboot"`):
+				*actions = append(*actions, body)
+				status = "ACTIVE"
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestServerPowerActions(t *testing.T) {
+	serverStatusInterval = time.Millisecond
+	defer func() { serverStatusInterval = 2 * time.Second }()
+
+	var actions []string
+	server := newPowerTestServer("ACTIVE", &actions)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	if err := c.StartServer("server-1"); err != nil {
+		t.Fatalf("unexpected error starting server: %v", err)
+	}
+	if err := c.StopServer("server-1"); err != nil {
+		t.Fatalf("unexpected error stopping server: %v", err)
+	}
+	if err := c.StopServer("server-1"); err != nil {
+		t.Fatalf("unexpected error stopping server: %v", err)
+	}
+	if err := c.StartServer("server-1"); err != nil {
+		t.Fatalf("unexpected error starting server: %v", err)
+	}
+	if err := c.RebootServer("server-1", servers.HardReboot); err != nil {
+		t.Fatalf("unexpected error rebooting server: %v", err)
+	}
+
+	expected := []string{"os-stop", "os-start", `{"reboot":{"type":"HARD"}}`}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected actions %v, got %v", expected, actions)
+	}
+}
+
+// newServersTestServer serves the servers server-0 to server-<count-1>, every request takes delay
+func newServersTestServer(count int, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/servers/server-broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/servers/server-%d", &i); err != nil || i >= count {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"server": {"id": "server-%d", "status": "ACTIVE"}}`, i)
+	}))
+}
+
+func TestGetServers(t *testing.T) {
+	server := newServersTestServer(100, 0)
+	defer server.Close()
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("server-%d", i))
+	}
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	result, err := c.GetServers(ids, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 100 {
+		t.Fatalf("expected 100 servers, got %d", len(result))
+	}
+	for _, id := range ids {
+		if result[id] == nil || result[id].ID != id {
+			t.Errorf("expected server %s, got %v", id, result[id])
+		}
+	}
+
+	result, err = c.GetServers(append(ids, "server-100"), 0)
+	if err != nil {
+		t.Fatalf("a deleted server should not fail the other servers: %v", err)
+	}
+	if _, ok := result["server-100"]; ok || len(result) != 100 {
+		t.Errorf("expected the deleted server to be left out, got %d servers", len(result))
+	}
+
+	if _, err := c.GetServers(append(ids, "server-broken"), 0); err == nil || !strings.Contains(err.Error(), "server-broken") {
+		t.Errorf("expected an error for the failing server, got %v", err)
+	}
+}
+
+func BenchmarkGetServers(b *testing.B) {
+	server := newServersTestServer(100, time.Millisecond)
+	defer server.Close()
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("server-%d", i))
+	}
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	for _, concurrency := range []int{1, defaultServerConcurrency} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetServers(ids, concurrency); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
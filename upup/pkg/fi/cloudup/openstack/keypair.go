@@ -21,18 +21,17 @@ import (
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) GetKeypair(name string) (*keypairs.KeyPair, error) {
 	var k *keypairs.KeyPair
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		rs, err := keypairs.Get(c.novaClient, name).Extract()
 		if err != nil {
 			if err.Error() == ErrNotFound {
 				return true, nil
 			}
-			return false, fmt.Errorf("error listing keypair: %v", err)
+			return false, fmt.Errorf("error listing keypair: %v", withRequestID(err))
 		}
 		k = rs
 		return true, nil
@@ -49,10 +48,10 @@ func (c *openstackCloud) GetKeypair(name string) (*keypairs.KeyPair, error) {
 func (c *openstackCloud) CreateKeypair(opt keypairs.CreateOptsBuilder) (*keypairs.KeyPair, error) {
 	var k *keypairs.KeyPair
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := keypairs.Create(c.novaClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating keypair: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating keypair: %v", withRequestID(err))
 		}
 		k = v
 		return true, nil
@@ -66,11 +65,12 @@ func (c *openstackCloud) CreateKeypair(opt keypairs.CreateOptsBuilder) (*keypair
 	}
 }
 
+// DeleteKeyPair deletes the Nova keypair, a missing keypair is ignored
 func (c *openstackCloud) DeleteKeyPair(name string) error {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := keypairs.Delete(c.novaClient, name).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting keypair: %v", err)
+			return false, fmt.Errorf("error deleting keypair: %v", withRequestID(err))
 		}
 
 		return true, nil
@@ -86,10 +86,10 @@ func (c *openstackCloud) DeleteKeyPair(name string) error {
 
 func (c *openstackCloud) ListKeypairs() ([]keypairs.KeyPair, error) {
 	var k []keypairs.KeyPair
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := keypairs.List(c.novaClient).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing keypairs: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing keypairs: %v", withRequestID(err))
 		}
 
 		ks, err := keypairs.ExtractKeyPairs(allPages)
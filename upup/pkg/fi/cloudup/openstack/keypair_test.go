@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteKeyPair(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		deleted = append(deleted, r.URL.Path)
+		if r.URL.Path == "/os-keypairs/kubernetes-missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		novaClient: newTestServiceClient(server),
+	}
+	for _, name := range []string{"kubernetes-cluster", "kubernetes-missing"} {
+		if err := c.DeleteKeyPair(name); err != nil {
+			t.Errorf("unexpected error deleting keypair %s: %v", name, err)
+		}
+	}
+	expected := []string{"/os-keypairs/kubernetes-cluster", "/os-keypairs/kubernetes-missing"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected requests %v, got %v", expected, deleted)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// LBFeature is a listener or pool feature whose support varies by loadbalancer provider
+type LBFeature string
+
+const (
+	LBFeatureTerminatedHTTPS LBFeature = "TERMINATED_HTTPS"
+	LBFeatureUDP             LBFeature = "UDP"
+	LBFeatureL7Policy        LBFeature = "L7_POLICY"
+	LBFeatureRoundRobin      LBFeature = "ROUND_ROBIN"
+	LBFeatureSourceIPPort    LBFeature = "SOURCE_IP_PORT"
+	// LBFeatureAvailabilityZone is the placement of the loadbalancer in an Octavia availability zone
+	LBFeatureAvailabilityZone LBFeature = "AVAILABILITY_ZONE"
+)
+
+// lbProtocolFeatures are the features Octavia does not report for a provider
+var lbProtocolFeatures = []LBFeature{LBFeatureTerminatedHTTPS, LBFeatureUDP, LBFeatureL7Policy, LBFeatureRoundRobin, LBFeatureSourceIPPort}
+
+// knownLBProviderFeatures lists the protocol features supported by the providers shipped with Octavia.
+// The capabilities API of Octavia only reports the settings of the flavors and availability zones of a
+// provider, not its protocols and algorithms, so this table is the fallback for them. The protocol
+// features of other providers are not validated.
+var knownLBProviderFeatures = map[string][]LBFeature{
+	"amphora": {LBFeatureTerminatedHTTPS, LBFeatureUDP, LBFeatureL7Policy, LBFeatureRoundRobin, LBFeatureSourceIPPort},
+	"octavia": {LBFeatureTerminatedHTTPS, LBFeatureUDP, LBFeatureL7Policy, LBFeatureRoundRobin, LBFeatureSourceIPPort},
+	"ovn":     {LBFeatureUDP, LBFeatureSourceIPPort},
+}
+
+// LBProviderCapabilities describes what an Octavia loadbalancer provider supports
+type LBProviderCapabilities struct {
+	Provider string
+	// FlavorCapabilities are the names of the flavor settings the provider reports, e.g. loadbalancer_topology
+	FlavorCapabilities []string
+	// AvailabilityZoneCapabilities are the names of the availability zone settings the provider reports,
+	// e.g. compute_zone. A provider without them can't place loadbalancers in an availability zone.
+	AvailabilityZoneCapabilities []string
+
+	// features holds the features whose support is known, other features are assumed to be supported
+	features map[LBFeature]bool
+}
+
+// NewLBProviderCapabilities builds the capabilities of the given provider from the protocol features known for it
+func NewLBProviderCapabilities(provider string) *LBProviderCapabilities {
+	p := &LBProviderCapabilities{
+		Provider: provider,
+		features: make(map[LBFeature]bool),
+	}
+	if known, ok := knownLBProviderFeatures[strings.ToLower(provider)]; ok {
+		for _, f := range lbProtocolFeatures {
+			p.features[f] = false
+		}
+		for _, f := range known {
+			p.features[f] = true
+		}
+	}
+	return p
+}
+
+// setAvailabilityZoneCapabilities records the availability zone settings reported by the provider
+func (p *LBProviderCapabilities) setAvailabilityZoneCapabilities(names []string) {
+	p.AvailabilityZoneCapabilities = names
+	p.features[LBFeatureAvailabilityZone] = len(names) > 0
+}
+
+// Supports returns true if the feature is supported by the provider, or if support of the feature is unknown
+func (p *LBProviderCapabilities) Supports(feature LBFeature) bool {
+	if p == nil {
+		return true
+	}
+	supported, known := p.features[feature]
+	return supported || !known
+}
+
+// Validate returns an error naming the first of the features which is not supported by the provider
+func (p *LBProviderCapabilities) Validate(features ...LBFeature) error {
+	for _, f := range features {
+		if !p.Supports(f) {
+			return fmt.Errorf("loadbalancer provider %q does not support %s", p.Provider, f)
+		}
+	}
+	return nil
+}
+
+// LBProviderCapabilities will return the capabilities of the given Octavia loadbalancer provider,
+// failing if the provider is not enabled
+func (c *openstackCloud) LBProviderCapabilities(provider string) (*LBProviderCapabilities, error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Providers []struct {
+				Name string `json:"name"`
+			} `json:"providers"`
+		}
+		_, err := client.Get(client.ServiceURL("lbaas", "providers"), &r, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing loadbalancer providers: %v", withRequestID(err))
+		}
+		for _, p := range r.Providers {
+			if p.Name == provider {
+				return true, nil
+			}
+		}
+		return true, fmt.Errorf("loadbalancer provider %q is not enabled", provider)
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := NewLBProviderCapabilities(provider)
+	flavorCapabilities, found, err := c.lbProviderCapabilityNames(client, provider, "flavor_capabilities")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		capabilities.FlavorCapabilities = flavorCapabilities
+	}
+	zoneCapabilities, found, err := c.lbProviderCapabilityNames(client, provider, "availability_zone_capabilities")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		capabilities.setAvailabilityZoneCapabilities(zoneCapabilities)
+	}
+	return capabilities, nil
+}
+
+// lbProviderCapabilityNames returns the names of the flavor_capabilities or availability_zone_capabilities of the
+// provider. Octavia releases without the API return 404, which is reported as not found.
+func (c *openstackCloud) lbProviderCapabilityNames(client *gophercloud.ServiceClient, provider string, kind string) ([]string, bool, error) {
+	var names []string
+	found := false
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r map[string][]struct {
+			Name string `json:"name"`
+		}
+		_, err := client.Get(client.ServiceURL("lbaas", "providers", provider, kind), &r, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if isNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting %s of loadbalancer provider %q: %v", kind, provider, withRequestID(err))
+		}
+		names = nil
+		for _, capability := range r[kind] {
+			names = append(names, capability.Name)
+		}
+		found = true
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return nil, false, err
+	}
+	return names, found, err
+}
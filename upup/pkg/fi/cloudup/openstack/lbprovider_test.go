@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLBProviderCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/lbaas/providers":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"providers": [{"name": "amphora", "description": "The Octavia Amphora driver."}, {"name": "ovn", "description": "The OVN driver."}, {"name": "vendor", "description": "A driver of an older Octavia."}]}`))
+		case "/lbaas/providers/amphora/flavor_capabilities":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"flavor_capabilities": [{"name": "loadbalancer_topology", "description": "The load balancer topology."}, {"name": "compute_flavor", "description": "The compute driver flavor ID."}]}`))
+		case "/lbaas/providers/amphora/availability_zone_capabilities":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"availability_zone_capabilities": [{"name": "compute_zone", "description": "The compute availability zone."}]}`))
+		case "/lbaas/providers/ovn/flavor_capabilities":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"flavor_capabilities": []}`))
+		case "/lbaas/providers/ovn/availability_zone_capabilities":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"availability_zone_capabilities": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		lbClient: newTestServiceClient(server),
+	}
+
+	capabilities, err := c.LBProviderCapabilities("amphora")
+	if err != nil {
+		t.Fatalf("unexpected error fetching provider capabilities: %v", err)
+	}
+	if !capabilities.Supports(LBFeatureTerminatedHTTPS) {
+		t.Errorf("expected amphora to support %s", LBFeatureTerminatedHTTPS)
+	}
+	if !capabilities.Supports(LBFeatureAvailabilityZone) {
+		t.Errorf("expected amphora to support %s", LBFeatureAvailabilityZone)
+	}
+	if !reflect.DeepEqual(capabilities.FlavorCapabilities, []string{"loadbalancer_topology", "compute_flavor"}) {
+		t.Errorf("unexpected flavor capabilities of amphora: %v", capabilities.FlavorCapabilities)
+	}
+
+	capabilities, err = c.LBProviderCapabilities("ovn")
+	if err != nil {
+		t.Fatalf("unexpected error fetching provider capabilities: %v", err)
+	}
+	if capabilities.Supports(LBFeatureAvailabilityZone) {
+		t.Errorf("expected ovn without availability zone capabilities not to support %s", LBFeatureAvailabilityZone)
+	}
+
+	// an Octavia without the capabilities API does not restrict the features
+	capabilities, err = c.LBProviderCapabilities("vendor")
+	if err != nil {
+		t.Fatalf("unexpected error fetching provider capabilities: %v", err)
+	}
+	if !capabilities.Supports(LBFeatureAvailabilityZone) || !capabilities.Supports(LBFeatureUDP) {
+		t.Errorf("expected the features of an unknown provider to be supported")
+	}
+
+	_, err = c.LBProviderCapabilities("unknown")
+	if err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("expected provider not enabled error, got %v", err)
+	}
+}
+
+func TestLBProviderCapabilitiesValidate(t *testing.T) {
+	grid := []struct {
+		provider string
+		features []LBFeature
+		valid    bool
+	}{
+		{
+			provider: "amphora",
+			features: []LBFeature{LBFeatureTerminatedHTTPS, LBFeatureL7Policy, LBFeatureRoundRobin},
+			valid:    true,
+		},
+		{
+			provider: "ovn",
+			features: []LBFeature{LBFeatureUDP, LBFeatureSourceIPPort},
+			valid:    true,
+		},
+		{
+			provider: "ovn",
+			features: []LBFeature{LBFeatureTerminatedHTTPS},
+			valid:    false,
+		},
+		{
+			provider: "ovn",
+			features: []LBFeature{LBFeatureRoundRobin},
+			valid:    false,
+		},
+		{
+			provider: "vendor-driver",
+			features: []LBFeature{LBFeatureTerminatedHTTPS, LBFeatureL7Policy},
+			valid:    true,
+		},
+	}
+	for _, g := range grid {
+		err := NewLBProviderCapabilities(g.provider).Validate(g.features...)
+		if g.valid && err != nil {
+			t.Errorf("unexpected error for provider %s with %v: %v", g.provider, g.features, err)
+		}
+		if !g.valid {
+			if err == nil {
+				t.Errorf("expected error for provider %s with %v", g.provider, g.features)
+			} else if !strings.Contains(err.Error(), string(g.features[0])) {
+				t.Errorf("expected error naming %s, got %v", g.features[0], err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// allowedCIDRsMicroversion is the Octavia API version which added allowed_cidrs to listeners
+const allowedCIDRsMicroversion = "2.12"
+
+// ListenerCreateOpts adds the allowed_cidrs attribute of Octavia to the options of a new listener
+type ListenerCreateOpts struct {
+	listeners.CreateOptsBuilder
+	// AllowedCIDRs restricts the sources the listener accepts connections from, all sources are allowed when empty
+	AllowedCIDRs []string
+}
+
+func (opts ListenerCreateOpts) ToListenerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToListenerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.AllowedCIDRs) > 0 {
+		base["listener"].(map[string]interface{})["allowed_cidrs"] = opts.AllowedCIDRs
+	}
+	return base, nil
+}
+
+// ListenerUpdateOpts adds the allowed_cidrs attribute of Octavia to the options of a listener update
+type ListenerUpdateOpts struct {
+	listeners.UpdateOptsBuilder
+	// AllowedCIDRs replaces the allowed sources of the listener when not nil, an empty list allows all sources
+	AllowedCIDRs *[]string
+}
+
+func (opts ListenerUpdateOpts) ToListenerUpdateMap() (map[string]interface{}, error) {
+	base, err := opts.UpdateOptsBuilder.ToListenerUpdateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.AllowedCIDRs != nil {
+		cidrs := *opts.AllowedCIDRs
+		if cidrs == nil {
+			cidrs = []string{}
+		}
+		base["listener"].(map[string]interface{})["allowed_cidrs"] = cidrs
+	}
+	return base, nil
+}
+
+// updateListener is listeners.Update accepting any options builder, so options unknown to gophercloud can be sent
+func updateListener(client *gophercloud.ServiceClient, listenerID string, opts listeners.UpdateOptsBuilder) (r listeners.UpdateResult) {
+	b, err := opts.ToListenerUpdateMap()
+	if err != nil {
+		r.Err = err
+		return
+	}
+	_, r.Err = client.Put(client.ServiceURL("lbaas", "listeners", listenerID), b, &r.Body, &gophercloud.RequestOpts{
+		OkCodes: []int{http.StatusOK, http.StatusAccepted},
+	})
+	return
+}
+
+// SupportsListenerAllowedCIDRs returns true if the loadbalancer service can restrict the sources of listeners,
+// which requires Octavia with API version 2.12 or later
+func (c *openstackCloud) SupportsListenerAllowedCIDRs() (bool, error) {
+	if !c.useOctavia {
+		return false, nil
+	}
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return false, err
+	}
+	return SupportsMicroversion(client, allowedCIDRsMicroversion)
+}
+
+// GetListenerAllowedCIDRs will return the sources the listener accepts connections from, empty if all are allowed
+func (c *openstackCloud) GetListenerAllowedCIDRs(listenerID string) (cidrs []string, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Listener struct {
+				AllowedCIDRs []string `json:"allowed_cidrs"`
+			} `json:"listener"`
+		}
+		_, err := client.Get(client.ServiceURL("lbaas", "listeners", listenerID), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting allowed CIDRs of listener %s: %v", listenerID, withRequestID(err))
+		}
+		cidrs = r.Listener.AllowedCIDRs
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return cidrs, err
+	}
+	return cidrs, err
+}
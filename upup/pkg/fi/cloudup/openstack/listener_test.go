@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+)
+
+func TestListenerAllowedCIDRs(t *testing.T) {
+	var requests []map[string]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.12", "status": "CURRENT"}]}`)
+		case r.Method == "PUT" && r.URL.Path == "/lbaas/listeners/listener-1":
+			body, _ := ioutil.ReadAll(r.Body)
+			var request map[string]map[string]interface{}
+			if err := json.Unmarshal(body, &request); err != nil {
+				t.Errorf("unexpected request body %s: %v", body, err)
+			}
+			requests = append(requests, request)
+			fmt.Fprint(w, `{"listener": {"id": "listener-1"}}`)
+		case r.Method == "GET" && r.URL.Path == "/lbaas/listeners/listener-1":
+			fmt.Fprint(w, `{"listener": {"id": "listener-1", "allowed_cidrs": ["192.0.2.0/24"]}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{lbClient: newTestServiceClient(server), useOctavia: true}
+	supported, err := c.SupportsListenerAllowedCIDRs()
+	if err != nil || !supported {
+		t.Fatalf("expected allowed CIDRs to be supported, got %v, %v", supported, err)
+	}
+
+	cidrs, err := c.GetListenerAllowedCIDRs("listener-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting allowed CIDRs: %v", err)
+	}
+	if !reflect.DeepEqual(cidrs, []string{"192.0.2.0/24"}) {
+		t.Errorf("unexpected allowed CIDRs %v", cidrs)
+	}
+
+	for _, allowed := range [][]string{{"198.51.100.0/24"}, nil} {
+		_, err := c.UpdateListener("listener-1", ListenerUpdateOpts{
+			UpdateOptsBuilder: listeners.UpdateOpts{},
+			AllowedCIDRs:      &allowed,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error updating listener: %v", err)
+		}
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected two updates, got %v", requests)
+	}
+	if actual := requests[0]["listener"]["allowed_cidrs"]; !reflect.DeepEqual(actual, []interface{}{"198.51.100.0/24"}) {
+		t.Errorf("unexpected allowed CIDRs sent: %v", actual)
+	}
+	if actual := requests[1]["listener"]["allowed_cidrs"]; !reflect.DeepEqual(actual, []interface{}{}) {
+		t.Errorf("expected an empty list to allow all sources, got %v", actual)
+	}
+}
+
+func TestListenerAllowedCIDRsWithoutOctavia(t *testing.T) {
+	c := &openstackCloud{}
+	supported, err := c.SupportsListenerAllowedCIDRs()
+	if err != nil || supported {
+		t.Errorf("expected allowed CIDRs to be unsupported without octavia, got %v, %v", supported, err)
+	}
+}
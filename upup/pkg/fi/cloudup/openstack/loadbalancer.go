@@ -18,20 +18,70 @@ package openstack
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/monitors"
 	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
+const (
+	lbProvisioningStatusActive  = "ACTIVE"
+	lbProvisioningStatusError   = "ERROR"
+	lbProvisioningStatusDeleted = "DELETED"
+)
+
+// LoadBalancerActiveTimeout is how long WaitForLoadBalancerActive waits for a loadbalancer
+// to reach the ACTIVE provisioning status
+var LoadBalancerActiveTimeout = 5 * time.Minute
+
+// loadBalancerActivePollInterval is the interval between two checks of the provisioning status
+var loadBalancerActivePollInterval = 2 * time.Second
+
+// WaitForLoadBalancerActive waits until the loadbalancer is ACTIVE. Loadbalancers are immutable while
+// a change is being provisioned, creating listeners, pools or members fails until then.
+func (c *openstackCloud) WaitForLoadBalancerActive(lbID string) error {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	var status string
+	err = wait.PollImmediate(loadBalancerActivePollInterval, LoadBalancerActiveTimeout, func() (bool, error) {
+		lb, err := loadbalancers.Get(client, lbID).Extract()
+		if err != nil {
+			return false, fmt.Errorf("error getting loadbalancer %s: %v", lbID, withRequestID(err))
+		}
+		status = lb.ProvisioningStatus
+		switch status {
+		case lbProvisioningStatusActive:
+			return true, nil
+		case lbProvisioningStatusError:
+			return false, fmt.Errorf("loadbalancer %s has gone into ERROR state", lbID)
+		default:
+			glog.Infof("Waiting for loadbalancer %s to be ACTIVE, currently %s", lbID, status)
+			return false, nil
+		}
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("loadbalancer %s failed to go into ACTIVE provisioning status within %v, last status was %s", lbID, LoadBalancerActiveTimeout, status)
+	}
+	return err
+}
+
 func (c *openstackCloud) DeletePool(poolID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		err := v2pools.Delete(c.LoadBalancerClient(), poolID).ExtractErr()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := v2pools.Delete(client, poolID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting pool: %v", err)
+			return false, fmt.Errorf("error deleting pool: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -45,10 +95,14 @@ func (c *openstackCloud) DeletePool(poolID string) error {
 }
 
 func (c *openstackCloud) DeleteListener(listenerID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		err := listeners.Delete(c.LoadBalancerClient(), listenerID).ExtractErr()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := listeners.Delete(client, listenerID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting listener: %v", err)
+			return false, fmt.Errorf("error deleting listener: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -61,30 +115,262 @@ func (c *openstackCloud) DeleteListener(listenerID string) error {
 	}
 }
 
+// DeleteLB deletes the loadbalancer and waits until it is gone. With Cascade the listeners, pools and members
+// are deleted together with the loadbalancer. Neutron-LBaaS does not support cascading deletes, so the
+// listeners and pools are deleted first.
 func (c *openstackCloud) DeleteLB(lbID string, opts loadbalancers.DeleteOpts) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		err := loadbalancers.Delete(c.LoadBalancerClient(), lbID, opts).ExtractErr()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	if opts.Cascade && !c.useOctavia {
+		if err := c.deleteLBChildren(lbID); err != nil {
+			return err
+		}
+		opts.Cascade = false
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := loadbalancers.Delete(client, lbID, opts).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting loadbalancer: %v", err)
+			return false, fmt.Errorf("error deleting loadbalancer: %v", withRequestID(err))
 		}
 		return true, nil
 	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
 	if err != nil {
 		return err
-	} else if done {
-		return nil
-	} else {
-		return wait.ErrWaitTimeout
 	}
+	return c.waitForLoadBalancerDeleted(lbID)
+}
+
+// deleteLBChildren deletes the listeners and pools of the loadbalancer, waiting for the loadbalancer
+// to be ACTIVE again after each deletion
+func (c *openstackCloud) deleteLBChildren(lbID string) error {
+	listenerList, err := c.ListListeners(listeners.ListOpts{LoadbalancerID: lbID})
+	if err != nil {
+		return err
+	}
+	for _, listener := range listenerList {
+		glog.V(2).Infof("Deleting listener %s of loadbalancer %s", listener.ID, lbID)
+		if err := c.DeleteListener(listener.ID); err != nil {
+			return err
+		}
+		if err := c.WaitForLoadBalancerActive(lbID); err != nil {
+			return err
+		}
+	}
+
+	poolList, err := c.ListPools(v2pools.ListOpts{LoadbalancerID: lbID})
+	if err != nil {
+		return err
+	}
+	for _, pool := range poolList {
+		glog.V(2).Infof("Deleting pool %s of loadbalancer %s", pool.ID, lbID)
+		if err := c.DeletePool(pool.ID); err != nil {
+			return err
+		}
+		if err := c.WaitForLoadBalancerActive(lbID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForLoadBalancerDeleted waits until the loadbalancer is gone or reports the DELETED status
+func (c *openstackCloud) waitForLoadBalancerDeleted(lbID string) error {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	err = wait.PollImmediate(loadBalancerActivePollInterval, LoadBalancerActiveTimeout, func() (bool, error) {
+		lb, err := loadbalancers.Get(client, lbID).Extract()
+		if isNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("error getting loadbalancer %s: %v", lbID, withRequestID(err))
+		}
+		switch lb.ProvisioningStatus {
+		case lbProvisioningStatusDeleted:
+			return true, nil
+		case lbProvisioningStatusError:
+			return false, fmt.Errorf("loadbalancer %s has gone into ERROR state while deleting", lbID)
+		default:
+			glog.V(2).Infof("Waiting for loadbalancer %s to be deleted, currently %s", lbID, lb.ProvisioningStatus)
+			return false, nil
+		}
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("loadbalancer %s was not deleted within %v", lbID, LoadBalancerActiveTimeout)
+	}
+	return err
+}
+
+// lbTagsMicroversion is the Octavia API version which added tags to loadbalancers
+const lbTagsMicroversion = "2.5"
+
+// SupportsLBTags returns true if the loadbalancer service can tag loadbalancers, which requires Octavia with
+// API version 2.5 or later
+func (c *openstackCloud) SupportsLBTags() (bool, error) {
+	if !c.useOctavia {
+		return false, nil
+	}
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return false, err
+	}
+	return SupportsMicroversion(client, lbTagsMicroversion)
+}
+
+// LBRoleAPI is the role of the loadbalancer of the kubernetes API
+const LBRoleAPI = "api"
+
+// LBTags returns the Octavia tags of a loadbalancer with the given role in the cluster
+func LBTags(clusterName string, role string) []string {
+	return []string{ClusterTag(clusterName), TagNameRolePrefix + role}
+}
+
+// LBName returns the conventional name of the loadbalancer with the given role in the cluster, which identifies
+// the loadbalancers of the cluster on Neutron-LBaaS and the loadbalancers created before kops tagged them
+func LBName(clusterName string, role string) string {
+	return role + "." + clusterName
+}
+
+// ListClusterLBs will list the loadbalancers of the cluster. With Octavia these are the loadbalancers tagged
+// with the cluster, and the untagged loadbalancers named by LBName. Without Octavia they are found by name only.
+func (c *openstackCloud) ListClusterLBs(clusterName string) ([]loadbalancers.LoadBalancer, error) {
+	named, err := c.ListLBs(loadbalancers.ListOpts{Name: LBName(clusterName, LBRoleAPI)})
+	if err != nil {
+		return nil, err
+	}
+	if !c.useOctavia {
+		return named, nil
+	}
+
+	lbs, err := c.ListLBs(loadbalancers.ListOpts{Tags: []string{ClusterTag(clusterName)}})
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, lb := range lbs {
+		found[lb.ID] = true
+	}
+	for _, lb := range named {
+		// a tagged loadbalancer of that name belongs to the cluster it is tagged with
+		if found[lb.ID] || len(lb.Tags) != 0 {
+			continue
+		}
+		lbs = append(lbs, lb)
+	}
+	return lbs, nil
+}
+
+// LBCreateOpts adds the availability_zone attribute of Octavia to the options of a new loadbalancer
+type LBCreateOpts struct {
+	loadbalancers.CreateOptsBuilder
+	// AvailabilityZone is the Octavia availability zone of the loadbalancer, the default zone of Octavia when empty
+	AvailabilityZone string
+}
+
+func (opts LBCreateOpts) ToLoadBalancerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToLoadBalancerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.AvailabilityZone != "" {
+		base["loadbalancer"].(map[string]interface{})["availability_zone"] = opts.AvailabilityZone
+	}
+	return base, nil
+}
+
+// LBAvailabilityZone is an availability zone of Octavia
+type LBAvailabilityZone struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// ListLoadBalancerAvailabilityZones will list the availability zones of Octavia, which are available
+// since Octavia API version 2.14
+func (c *openstackCloud) ListLoadBalancerAvailabilityZones() ([]LBAvailabilityZone, error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	var zones []LBAvailabilityZone
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			AvailabilityZones []LBAvailabilityZone `json:"availability_zones"`
+		}
+		_, err := client.Get(client.ServiceURL("lbaas", "availabilityzones"), &r, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if isNotFound(err) {
+			return true, fmt.Errorf("the loadbalancer service does not support availability zones")
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("failed to list loadbalancer availability zones: %v", withRequestID(err))
+		}
+		zones = r.AvailabilityZones
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return zones, err
+	}
+	return zones, err
+}
+
+// GetLBAvailabilityZone returns the Octavia availability zone of the loadbalancer, which gophercloud does not extract
+func (c *openstackCloud) GetLBAvailabilityZone(lbID string) (string, error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return "", err
+	}
+	var zone string
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			LoadBalancer struct {
+				AvailabilityZone string `json:"availability_zone"`
+			} `json:"loadbalancer"`
+		}
+		_, err := client.Get(client.ServiceURL("lbaas", "loadbalancers", lbID), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting loadbalancer %s: %v", lbID, withRequestID(err))
+		}
+		zone = r.LoadBalancer.AvailabilityZone
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return zone, err
+	}
+	return zone, err
 }
 
 func (c *openstackCloud) CreateLB(opt loadbalancers.CreateOptsBuilder) (*loadbalancers.LoadBalancer, error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
 	var i *loadbalancers.LoadBalancer
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		v, err := loadbalancers.Create(c.LoadBalancerClient(), opt).Extract()
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := loadbalancers.Create(client, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating loadbalancer: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating loadbalancer: %v", withRequestID(err))
 		}
 		i = v
 		return true, nil
@@ -98,10 +384,35 @@ func (c *openstackCloud) CreateLB(opt loadbalancers.CreateOptsBuilder) (*loadbal
 	}
 }
 
+func (c *openstackCloud) UpdateLB(lbID string, opts loadbalancers.UpdateOpts) (lb *loadbalancers.LoadBalancer, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		lb, err = loadbalancers.Update(client, lbID, opts).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error updating loadbalancer %s: %v", lbID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return lb, err
+	}
+	return lb, err
+}
+
 func (c *openstackCloud) GetLB(loadbalancerID string) (lb *loadbalancers.LoadBalancer, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		lb, err = loadbalancers.Get(c.LoadBalancerClient(), loadbalancerID).Extract()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		lb, err = loadbalancers.Get(client, loadbalancerID).Extract()
 		if err != nil {
 			return false, err
 		}
@@ -116,13 +427,21 @@ func (c *openstackCloud) GetLB(loadbalancerID string) (lb *loadbalancers.LoadBal
 	return lb, nil
 }
 
-// ListLBs will list load balancers
+// ListLBs will list load balancers. Neutron-LBaaS has no tags, so filtering by tags requires Octavia.
 func (c *openstackCloud) ListLBs(opt loadbalancers.ListOptsBuilder) (lbs []loadbalancers.LoadBalancer, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := opt.(loadbalancers.ListOpts); ok && !c.useOctavia &&
+		(len(o.Tags) != 0 || len(o.TagsAny) != 0 || len(o.TagsNot) != 0 || len(o.TagsNotAny) != 0) {
+		return nil, fmt.Errorf("filtering loadbalancers by tags requires Octavia")
+	}
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		allPages, err := loadbalancers.List(c.LoadBalancerClient(), opt).AllPages()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := loadbalancers.List(client, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("failed to list loadbalancers: %s", err)
+			return !isRetryable(err), fmt.Errorf("failed to list loadbalancers: %v", withRequestID(err))
 		}
 		lbs, err = loadbalancers.ExtractLoadBalancers(allPages)
 		if err != nil {
@@ -136,12 +455,16 @@ func (c *openstackCloud) ListLBs(opt loadbalancers.ListOptsBuilder) (lbs []loadb
 		}
 		return lbs, err
 	}
-	return lbs, nil
+	return lbs, err
 }
 
 func (c *openstackCloud) GetPool(poolID string, memberID string) (member *v2pools.Member, err error) {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		member, err = v2pools.GetMember(c.LoadBalancerClient(), poolID, memberID).Extract()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		member, err = v2pools.GetMember(client, poolID, memberID).Extract()
 		if err != nil {
 			return false, err
 		}
@@ -156,13 +479,86 @@ func (c *openstackCloud) GetPool(poolID string, memberID string) (member *v2pool
 	return member, nil
 }
 
+// ListPoolMembers will list the members of a loadbalancer pool
+func (c *openstackCloud) ListPoolMembers(poolID string, opts v2pools.ListMembersOpts) (memberList []v2pools.Member, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		memberPage, err := v2pools.ListMembers(client, poolID, opts).AllPages()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("Failed to list members of pool %s: %v", poolID, withRequestID(err))
+		}
+		memberList, err = v2pools.ExtractMembers(memberPage)
+		if err != nil {
+			return false, fmt.Errorf("Failed to extract pool members: %v", err)
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return memberList, err
+	}
+	return memberList, err
+}
+
+// UpdatePoolMember will update a member of a loadbalancer pool, e.g. its weight
+func (c *openstackCloud) UpdatePoolMember(poolID string, memberID string, opts v2pools.UpdateMemberOpts) (member *v2pools.Member, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		member, err = v2pools.UpdateMember(client, poolID, memberID, opts).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error updating member %s of pool %s: %v", memberID, poolID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return member, err
+	}
+	return member, err
+}
+
+func (c *openstackCloud) DeletePoolMember(poolID string, memberID string) error {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := v2pools.DeleteMember(client, poolID, memberID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("error deleting member %s of pool %s: %v", memberID, poolID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
+
 func (c *openstackCloud) AssociateToPool(server *servers.Server, poolID string, opts v2pools.CreateMemberOpts) (association *v2pools.Member, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		association, err = v2pools.GetMember(c.LoadBalancerClient(), poolID, server.ID).Extract()
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		association, err = v2pools.GetMember(client, poolID, server.ID).Extract()
 		if err != nil || association == nil {
 			// Pool association does not exist.  Create it
-			association, err = v2pools.CreateMember(c.LoadBalancerClient(), poolID, opts).Extract()
+			association, err = v2pools.CreateMember(client, poolID, opts).Extract()
 			if err != nil {
 				return false, fmt.Errorf("Failed to create pool association: %v", err)
 			}
@@ -177,14 +573,18 @@ func (c *openstackCloud) AssociateToPool(server *servers.Server, poolID string,
 		}
 		return association, err
 	}
-	return association, nil
+	return association, err
 }
 
 func (c *openstackCloud) CreatePool(opts v2pools.CreateOpts) (pool *v2pools.Pool, err error) {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		pool, err = v2pools.Create(c.LoadBalancerClient(), opts).Extract()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		pool, err = v2pools.Create(client, opts).Extract()
 		if err != nil {
-			return false, fmt.Errorf("Failed to create pool: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to create pool: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -194,14 +594,88 @@ func (c *openstackCloud) CreatePool(opts v2pools.CreateOpts) (pool *v2pools.Pool
 		}
 		return pool, err
 	}
-	return pool, nil
+	return pool, err
+}
+
+// CreateMonitor will create a health monitor for a loadbalancer pool
+func (c *openstackCloud) CreateMonitor(opts monitors.CreateOpts) (monitor *monitors.Monitor, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		monitor, err = monitors.Create(client, opts).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("Failed to create pool monitor: %v", withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return monitor, err
+	}
+	return monitor, err
+}
+
+// ListMonitors will list the health monitors matching the options
+func (c *openstackCloud) ListMonitors(opts monitors.ListOpts) (monitorList []monitors.Monitor, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		monitorPage, err := monitors.List(client, opts).AllPages()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("Failed to list pool monitors: %v", withRequestID(err))
+		}
+		monitorList, err = monitors.ExtractMonitors(monitorPage)
+		if err != nil {
+			return false, fmt.Errorf("Failed to extract pool monitors: %v", err)
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return monitorList, err
+	}
+	return monitorList, err
+}
+
+// UpdatePoolMonitor will update the timings of a health monitor
+func (c *openstackCloud) UpdatePoolMonitor(monitorID string, opts monitors.UpdateOpts) (monitor *monitors.Monitor, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		monitor, err = monitors.Update(client, monitorID, opts).Extract()
+		if err != nil {
+			return false, fmt.Errorf("Failed to update pool monitor %s: %v", monitorID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return monitor, err
+	}
+	return monitor, err
 }
 
 func (c *openstackCloud) ListPools(opts v2pools.ListOpts) (poolList []v2pools.Pool, err error) {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		poolPage, err := v2pools.List(c.LoadBalancerClient(), opts).AllPages()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		poolPage, err := v2pools.List(client, opts).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("Failed to list pools: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to list pools: %v", withRequestID(err))
 		}
 		poolList, err = v2pools.ExtractPools(poolPage)
 		if err != nil {
@@ -215,14 +689,39 @@ func (c *openstackCloud) ListPools(opts v2pools.ListOpts) (poolList []v2pools.Po
 		}
 		return poolList, err
 	}
-	return poolList, nil
+	return poolList, err
+}
+
+func (c *openstackCloud) GetLBPool(poolID string) (pool *v2pools.Pool, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		pool, err = v2pools.Get(client, poolID).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting pool %s: %v", poolID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return pool, err
+	}
+	return pool, err
 }
 
 func (c *openstackCloud) ListListeners(opts listeners.ListOpts) (listenerList []listeners.Listener, err error) {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		listenerPage, err := listeners.List(c.LoadBalancerClient(), opts).AllPages()
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		listenerPage, err := listeners.List(client, opts).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("Failed to list listeners: %v", err)
+			return !isRetryable(err), fmt.Errorf("Failed to list listeners: %v", withRequestID(err))
 		}
 		listenerList, err = listeners.ExtractListeners(listenerPage)
 		if err != nil {
@@ -236,14 +735,39 @@ func (c *openstackCloud) ListListeners(opts listeners.ListOpts) (listenerList []
 		}
 		return listenerList, err
 	}
-	return listenerList, nil
+	return listenerList, err
 }
 
-func (c *openstackCloud) CreateListener(opts listeners.CreateOpts) (listener *listeners.Listener, err error) {
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		listener, err = listeners.Create(c.LoadBalancerClient(), opts).Extract()
+func (c *openstackCloud) CreateListener(opts listeners.CreateOptsBuilder) (listener *listeners.Listener, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		listener, err = listeners.Create(client, opts).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("Unabled to create listener: %v", withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return listener, err
+	}
+	return listener, err
+}
+
+func (c *openstackCloud) UpdateListener(listenerID string, opts listeners.UpdateOptsBuilder) (listener *listeners.Listener, err error) {
+	client, err := c.LoadBalancerClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		listener, err = updateListener(client, listenerID, opts).Extract()
 		if err != nil {
-			return false, fmt.Errorf("Unabled to create listener: %v", err)
+			return false, fmt.Errorf("Unable to update listener %s: %v", listenerID, withRequestID(err))
 		}
 		return true, nil
 	})
@@ -253,5 +777,5 @@ func (c *openstackCloud) CreateListener(opts listeners.CreateOpts) (listener *li
 		}
 		return listener, err
 	}
-	return listener, nil
+	return listener, err
 }
@@ -0,0 +1,247 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+)
+
+func TestWaitForLoadBalancerActive(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		loadBalancerActivePollInterval = interval
+		LoadBalancerActiveTimeout = timeout
+	}(loadBalancerActivePollInterval, LoadBalancerActiveTimeout)
+	loadBalancerActivePollInterval = time.Millisecond
+	LoadBalancerActiveTimeout = 100 * time.Millisecond
+
+	grid := []struct {
+		statuses    []string
+		expectError string
+	}{
+		{statuses: []string{"ACTIVE"}},
+		{statuses: []string{"PENDING_CREATE", "PENDING_CREATE", "ACTIVE"}},
+		{statuses: []string{"PENDING_CREATE", "ERROR"}, expectError: "ERROR state"},
+		{statuses: []string{"PENDING_UPDATE"}, expectError: "within"},
+	}
+	for _, g := range grid {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/lbaas/loadbalancers/lb-1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			status := g.statuses[len(g.statuses)-1]
+			if requests < len(g.statuses) {
+				status = g.statuses[requests]
+			}
+			requests++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"loadbalancer": {"id": "lb-1", "provisioning_status": %q}}`, status)
+		}))
+
+		c := &openstackCloud{lbClient: newTestServiceClient(server)}
+		err := c.WaitForLoadBalancerActive("lb-1")
+		server.Close()
+
+		if g.expectError == "" {
+			if err != nil {
+				t.Errorf("%v: unexpected error %v", g.statuses, err)
+			}
+			if requests != len(g.statuses) {
+				t.Errorf("%v: expected %d status requests, got %d", g.statuses, len(g.statuses), requests)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), g.expectError) {
+			t.Errorf("%v: expected error containing %q, got %v", g.statuses, g.expectError, err)
+		}
+	}
+}
+
+// newDeleteLBTestServer serves a loadbalancer with a listener and a pool, recording the delete requests
+func newDeleteLBTestServer(t *testing.T, deletes *[]string) *httptest.Server {
+	deleted := make(map[string]bool)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "DELETE" {
+			request := r.URL.Path
+			if r.URL.RawQuery != "" {
+				request += "?" + r.URL.RawQuery
+			}
+			*deletes = append(*deletes, request)
+			deleted[r.URL.Path] = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		switch r.URL.Path {
+		case "/lbaas/loadbalancers/lb-1":
+			if deleted[r.URL.Path] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"loadbalancer": {"id": "lb-1", "provisioning_status": "ACTIVE"}}`)
+		case "/lbaas/listeners":
+			if r.URL.Query().Get("loadbalancer_id") != "lb-1" {
+				t.Errorf("expected listeners to be filtered by loadbalancer, got %q", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"listeners": [{"id": "listener-1"}]}`)
+		case "/lbaas/pools":
+			if r.URL.Query().Get("loadbalancer_id") != "lb-1" {
+				t.Errorf("expected pools to be filtered by loadbalancer, got %q", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"pools": [{"id": "pool-1"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestDeleteLBCascade(t *testing.T) {
+	defer func(interval time.Duration) {
+		loadBalancerActivePollInterval = interval
+	}(loadBalancerActivePollInterval)
+	loadBalancerActivePollInterval = time.Millisecond
+
+	grid := []struct {
+		useOctavia bool
+		expected   []string
+	}{
+		{
+			useOctavia: true,
+			expected:   []string{"/lbaas/loadbalancers/lb-1?cascade=true"},
+		},
+		{
+			useOctavia: false,
+			expected: []string{
+				"/lbaas/listeners/listener-1",
+				"/lbaas/pools/pool-1",
+				"/lbaas/loadbalancers/lb-1",
+			},
+		},
+	}
+	for _, g := range grid {
+		var deletes []string
+		server := newDeleteLBTestServer(t, &deletes)
+
+		c := &openstackCloud{lbClient: newTestServiceClient(server), useOctavia: g.useOctavia}
+		err := c.DeleteLB("lb-1", loadbalancers.DeleteOpts{Cascade: true})
+		server.Close()
+
+		if err != nil {
+			t.Errorf("octavia=%v: unexpected error %v", g.useOctavia, err)
+		}
+		if !reflect.DeepEqual(deletes, g.expected) {
+			t.Errorf("octavia=%v: expected deletes %v, got %v", g.useOctavia, g.expected, deletes)
+		}
+	}
+}
+
+func TestCreateLBWithAvailabilityZone(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/lbaas/availabilityzones":
+			fmt.Fprint(w, `{"availability_zones": [{"name": "az-1", "enabled": true}, {"name": "az-2", "enabled": false}]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/lbaas/loadbalancers":
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"loadbalancer": {"id": "lb-1", "name": "api"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{lbClient: newTestServiceClient(server)}
+	zones, err := c.ListLoadBalancerAvailabilityZones()
+	if err != nil {
+		t.Fatalf("unexpected error listing availability zones: %v", err)
+	}
+	expected := []LBAvailabilityZone{{Name: "az-1", Enabled: true}, {Name: "az-2"}}
+	if !reflect.DeepEqual(zones, expected) {
+		t.Errorf("unexpected availability zones, expected %v, got %v", expected, zones)
+	}
+
+	_, err = c.CreateLB(LBCreateOpts{
+		CreateOptsBuilder: loadbalancers.CreateOpts{Name: "api", VipSubnetID: "subnet-1"},
+		AvailabilityZone:  "az-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating loadbalancer: %v", err)
+	}
+	if !strings.Contains(body, `"availability_zone":"az-1"`) {
+		t.Errorf("expected the availability zone in the request, got %s", body)
+	}
+}
+
+func TestListClusterLBs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lbaas/loadbalancers" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Query().Get("tags") == "KubernetesCluster:my-k8s-local":
+			fmt.Fprint(w, `{"loadbalancers": [{"id": "lb-tagged", "name": "api.example.com", "tags": ["KubernetesCluster:my-k8s-local"]}]}`)
+		case r.URL.Query().Get("name") == "api.my.k8s.local":
+			fmt.Fprint(w, `{"loadbalancers": [
+				{"id": "lb-legacy", "name": "api.my.k8s.local"},
+				{"id": "lb-other", "name": "api.my.k8s.local", "tags": ["KubernetesCluster:other"]}
+			]}`)
+		default:
+			fmt.Fprint(w, `{"loadbalancers": []}`)
+		}
+	}))
+	defer server.Close()
+
+	grid := []struct {
+		octavia  bool
+		expected []string
+	}{
+		{octavia: true, expected: []string{"lb-tagged", "lb-legacy"}},
+		{octavia: false, expected: []string{"lb-legacy", "lb-other"}},
+	}
+	for _, g := range grid {
+		c := &openstackCloud{lbClient: newTestServiceClient(server), useOctavia: g.octavia}
+		lbs, err := c.ListClusterLBs("my.k8s.local")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var ids []string
+		for _, lb := range lbs {
+			ids = append(ids, lb.ID)
+		}
+		if !reflect.DeepEqual(ids, g.expected) {
+			t.Errorf("unexpected loadbalancers with octavia=%v, expected %v, got %v", g.octavia, g.expected, ids)
+		}
+	}
+
+	c := &openstackCloud{lbClient: newTestServiceClient(server)}
+	if _, err := c.ListLBs(loadbalancers.ListOpts{Tags: []string{"KubernetesCluster:my-k8s-local"}}); err == nil {
+		t.Errorf("expected filtering by tags to fail without Octavia")
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+)
+
+const (
+	// MetadataServiceIP is the well-known address of the metadata service
+	MetadataServiceIP = "169.254.169.254"
+	// MetadataServiceCIDR is the destination of a host route to the metadata service
+	MetadataServiceCIDR = MetadataServiceIP + "/32"
+)
+
+// MetadataHostRoute returns a host route to the metadata service via the gateway of the subnet.
+// When the gateway is not known, the first address of the CIDR is used, as neutron does by default.
+func MetadataHostRoute(cidr string, gatewayIP string) (subnets.HostRoute, error) {
+	nextHop := gatewayIP
+	if nextHop == "" {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return subnets.HostRoute{}, fmt.Errorf("error parsing CIDR %q: %v", cidr, err)
+		}
+		ip = ip.Mask(ipNet.Mask).To4()
+		if ip == nil {
+			return subnets.HostRoute{}, fmt.Errorf("metadata route is only supported for IPv4 subnets, got %q", cidr)
+		}
+		ip[3]++
+		nextHop = ip.String()
+	}
+	return subnets.HostRoute{
+		DestinationCIDR: MetadataServiceCIDR,
+		NextHop:         nextHop,
+	}, nil
+}
+
+// HasMetadataRoute returns true if the subnet has a host route to the metadata service
+func HasMetadataRoute(subnet *subnets.Subnet) bool {
+	for _, route := range subnet.HostRoutes {
+		if route.DestinationCIDR == MetadataServiceCIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataServiceWarning returns a description of why instances on the subnet may not reach the metadata service,
+// or an empty string if they can reach it through a host route or the router behind the gateway.
+func MetadataServiceWarning(subnet *subnets.Subnet) string {
+	if HasMetadataRoute(subnet) || subnet.GatewayIP != "" {
+		return ""
+	}
+	return fmt.Sprintf("instances on subnet %s (%s) may not reach the metadata service at %s: the subnet has no gateway "+
+		"and no host route to it, enable the config drive or inject a metadata route", subnet.Name, subnet.ID, MetadataServiceIP)
+}
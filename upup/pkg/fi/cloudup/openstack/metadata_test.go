@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+)
+
+func TestMetadataHostRoute(t *testing.T) {
+	grid := []struct {
+		cidr      string
+		gatewayIP string
+		nextHop   string
+	}{
+		{cidr: "10.0.32.0/19", nextHop: "10.0.32.1"},
+		{cidr: "10.0.32.17/19", nextHop: "10.0.32.1"},
+		{cidr: "10.0.32.0/19", gatewayIP: "10.0.32.254", nextHop: "10.0.32.254"},
+	}
+	for _, g := range grid {
+		route, err := MetadataHostRoute(g.cidr, g.gatewayIP)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", g.cidr, err)
+			continue
+		}
+		if route.DestinationCIDR != MetadataServiceCIDR || route.NextHop != g.nextHop {
+			t.Errorf("unexpected route for %s: %+v", g.cidr, route)
+		}
+	}
+
+	if _, err := MetadataHostRoute("fd00::/64", ""); err == nil {
+		t.Errorf("expected error for IPv6 subnet")
+	}
+}
+
+func TestMetadataServiceWarning(t *testing.T) {
+	isolated := &subnets.Subnet{ID: "subnet-1", Name: "isolated"}
+	grid := []struct {
+		subnet *subnets.Subnet
+		warn   bool
+	}{
+		{subnet: isolated, warn: true},
+		{subnet: &subnets.Subnet{GatewayIP: "10.0.0.1"}},
+		{subnet: &subnets.Subnet{HostRoutes: []subnets.HostRoute{{DestinationCIDR: MetadataServiceCIDR, NextHop: "10.0.0.2"}}}},
+	}
+	for _, g := range grid {
+		warning := MetadataServiceWarning(g.subnet)
+		if g.warn != (warning != "") {
+			t.Errorf("unexpected warning %q for %+v", warning, g.subnet)
+		}
+	}
+	if !strings.Contains(MetadataServiceWarning(isolated), MetadataServiceIP) {
+		t.Errorf("expected warning to mention the metadata service address")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequestsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kops_openstack_api_requests_total",
+			Help: "The number of requests sent to the OpenStack APIs, broken down by service, method and response code",
+		},
+		[]string{"service", "method", "code"},
+	)
+	apiRequestLatencyMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "kops_openstack_api_request_duration_seconds",
+			Help: "A histogram of the latency of requests sent to the OpenStack APIs in seconds",
+		},
+		[]string{"service", "method"},
+	)
+)
+
+// metrics holds whether the API metrics are recorded, and the endpoints used to tell the service of a request
+var metrics = struct {
+	sync.RWMutex
+	enabled   bool
+	endpoints map[string]string
+}{
+	endpoints: make(map[string]string),
+}
+
+// EnableMetrics registers the OpenStack API metrics with the registerer and starts recording them,
+// they are not recorded by default
+func EnableMetrics(registerer prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{apiRequestsMetric, apiRequestLatencyMetric} {
+		if err := registerer.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				return err
+			}
+		}
+	}
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.enabled = true
+	return nil
+}
+
+// registerServiceEndpoint records the service of an endpoint, so requests to it are labelled with the service
+func registerServiceEndpoint(endpoint, service string) {
+	if endpoint == "" {
+		return
+	}
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.endpoints[endpoint] = service
+}
+
+// serviceOf returns the service of the endpoint which is the longest prefix of the url
+func serviceOf(url string) string {
+	service, longest := "unknown", 0
+	for endpoint, name := range metrics.endpoints {
+		if len(endpoint) > longest && strings.HasPrefix(url, endpoint) {
+			service, longest = name, len(endpoint)
+		}
+	}
+	return service
+}
+
+// metricsTransport records the count, latency and response code of every request sent to the OpenStack APIs.
+// It sits below the retries, so every attempt is recorded.
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	metrics.RLock()
+	enabled := metrics.enabled
+	metrics.RUnlock()
+	if !enabled {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.RLock()
+	service := serviceOf(req.URL.String())
+	metrics.RUnlock()
+	apiRequestsMetric.WithLabelValues(service, req.Method, code).Inc()
+	apiRequestLatencyMetric.WithLabelValues(service, req.Method).Observe(elapsed.Seconds())
+	return resp, err
+}
+
+// withMetricsTransport returns the http client with its transport wrapped to record the API metrics
+func withMetricsTransport(client http.Client) http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &metricsTransport{base: base}
+	return client
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServiceOf(t *testing.T) {
+	defer func(endpoints map[string]string) { metrics.endpoints = endpoints }(metrics.endpoints)
+	metrics.endpoints = map[string]string{
+		"https://cloud.example.com:9696/":          "neutron",
+		"https://cloud.example.com:9696/lbaas/v2/": "octavia",
+		"https://cloud.example.com:8774/v2.1/":     "nova",
+	}
+
+	grid := map[string]string{
+		"https://cloud.example.com:9696/v2.0/ports":             "neutron",
+		"https://cloud.example.com:9696/lbaas/v2/loadbalancers": "octavia",
+		"https://cloud.example.com:8774/v2.1/servers/detail":    "nova",
+		"https://cloud.example.com:5000/v3/auth/tokens":         "unknown",
+	}
+	for url, expected := range grid {
+		if actual := serviceOf(url); actual != expected {
+			t.Errorf("unexpected service of %s: expected %s, got %s", url, expected, actual)
+		}
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defer func(enabled bool) { metrics.enabled = enabled }(metrics.enabled)
+	registerServiceEndpoint(server.URL+"/", "cinder")
+	defer delete(metrics.endpoints, server.URL+"/")
+
+	client := withMetricsTransport(http.Client{})
+	get := func(path string) {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	before := countRequests(t, "cinder", "200")
+	get("/volumes")
+	if requests := countRequests(t, "cinder", "200") - before; requests != 0 {
+		t.Errorf("expected no requests to be recorded while metrics are disabled, got %v", requests)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := EnableMetrics(registry); err != nil {
+		t.Fatalf("unexpected error enabling metrics: %v", err)
+	}
+	succeeded, failed := countRequests(t, "cinder", "200"), countRequests(t, "cinder", "404")
+	get("/volumes")
+	get("/volumes")
+	get("/missing")
+	if requests := countRequests(t, "cinder", "200") - succeeded; requests != 2 {
+		t.Errorf("expected 2 successful requests, got %v", requests)
+	}
+	if requests := countRequests(t, "cinder", "404") - failed; requests != 1 {
+		t.Errorf("expected 1 failed request, got %v", requests)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	if len(families) != 2 {
+		t.Errorf("expected 2 registered metrics, got %d", len(families))
+	}
+}
+
+// countRequests returns the value of the request counter of the service and response code
+func countRequests(t *testing.T, service, code string) float64 {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(apiRequestsMetric)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %v", err)
+	}
+	var count float64
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["service"] == service && labels["code"] == code {
+				count += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	os "github.com/gophercloud/gophercloud/openstack"
+)
+
+// apiVersion is a version of an OpenStack API as listed by its version document,
+// Version is the maximum microversion, it is empty for APIs without microversions.
+// APIs without microversions may list every minor version instead, their ID is used then.
+type apiVersion struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Version    string `json:"version"`
+	MinVersion string `json:"min_version"`
+}
+
+// maxMicroversions caches the maximum microversion of the services by endpoint
+var maxMicroversions = struct {
+	sync.Mutex
+	entries map[string]string
+}{
+	entries: make(map[string]string),
+}
+
+// SupportsMicroversion returns true if the service of the client supports the microversion,
+// so features requiring it can be skipped on older clouds
+func SupportsMicroversion(client *gophercloud.ServiceClient, version string) (bool, error) {
+	if client == nil {
+		return false, nil
+	}
+	max, err := maxMicroversion(client)
+	if err != nil {
+		return false, err
+	}
+	return CompareMicroversion(max, version) >= 0, nil
+}
+
+// maxMicroversion returns the maximum microversion of the service of the client,
+// which is empty when the service has no microversions
+func maxMicroversion(client *gophercloud.ServiceClient) (string, error) {
+	endpoint := versionEndpoint(client.Endpoint)
+
+	maxMicroversions.Lock()
+	defer maxMicroversions.Unlock()
+	if max, found := maxMicroversions.entries[endpoint]; found {
+		return max, nil
+	}
+
+	var body struct {
+		Version  *apiVersion  `json:"version"`
+		Versions []apiVersion `json:"versions"`
+	}
+	_, err := client.Get(endpoint, &body, &gophercloud.RequestOpts{
+		OkCodes: []int{http.StatusOK, http.StatusMultipleChoices},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting the versions of %s: %v", endpoint, withRequestID(err))
+	}
+
+	versions := body.Versions
+	if body.Version != nil {
+		versions = append(versions, *body.Version)
+	}
+	max := ""
+	for _, v := range versions {
+		if v.Status != "" && !strings.EqualFold(v.Status, "CURRENT") && !strings.EqualFold(v.Status, "SUPPORTED") {
+			continue
+		}
+		version := v.Version
+		if version == "" && versionSegment.MatchString(v.ID) {
+			// octavia has no microversions but lists each of its API versions by id, e.g. v2.12
+			version = strings.TrimPrefix(v.ID, "v")
+		}
+		if CompareMicroversion(version, max) > 0 {
+			max = version
+		}
+	}
+	glog.V(4).Infof("maximum microversion of %s is %q", endpoint, max)
+	maxMicroversions.entries[endpoint] = max
+	return max, nil
+}
+
+// versionSegment matches the version in the path of an endpoint, e.g. v2.1 or v3
+var versionSegment = regexp.MustCompile(`^v[0-9]+(\.[0-9]+)?$`)
+
+// versionEndpoint returns the versioned root of an endpoint, endpoints may end in the project id
+// which the version document is not served under
+func versionEndpoint(endpoint string) string {
+	trimmed := strings.TrimSuffix(endpoint, "/")
+	i := strings.LastIndex(trimmed, "/")
+	if i < 0 || versionSegment.MatchString(trimmed[i+1:]) {
+		return trimmed + "/"
+	}
+	if j := strings.LastIndex(trimmed[:i], "/"); j >= 0 && versionSegment.MatchString(trimmed[j+1:i]) {
+		return trimmed[:i+1]
+	}
+	return trimmed + "/"
+}
+
+// cinderClientName returns the name the cinder client is cached by, which depends on the API version
+func cinderClientName(microversion string) string {
+	if microversion != "" {
+		return "cinder-v3"
+	}
+	return "cinder"
+}
+
+// newCinderClient returns the client of cinder. Cinder only supports microversions on its v3 API, which is used
+// when a microversion is requested. The v3 API accepts the same volume requests as the v2 API.
+func newCinderClient(provider *gophercloud.ProviderClient, region string, microversion string) (*gophercloud.ServiceClient, error) {
+	if microversion != "" {
+		return os.NewBlockStorageV3(provider, gophercloud.EndpointOpts{
+			Type:   "volumev3",
+			Region: region,
+		})
+	}
+	return os.NewBlockStorageV2(provider, gophercloud.EndpointOpts{
+		Type:   "volumev2",
+		Region: region,
+	})
+}
+
+// selectMicroversion returns a copy of the client requesting the microversion. The client is returned
+// as is when the service does not support the microversion, requests then use the default microversion.
+func selectMicroversion(client *gophercloud.ServiceClient, version string) *gophercloud.ServiceClient {
+	if client == nil || version == "" {
+		return client
+	}
+	supported, err := SupportsMicroversion(client, version)
+	if err != nil {
+		glog.Warningf("unable to check the microversions of %s, using the default microversion: %v", client.Endpoint, err)
+		return client
+	}
+	if !supported {
+		glog.Warningf("%s does not support microversion %s, using the default microversion", client.Endpoint, version)
+		return client
+	}
+	// the service clients are shared between clouds, so the microversion is only set on a copy
+	selected := *client
+	selected.Microversion = version
+	if strings.HasPrefix(selected.Type, "volume") {
+		// gophercloud only sends the microversion headers cinder understands for the volume service type
+		selected.Type = "volume"
+	}
+	return &selected
+}
+
+// CompareMicroversion compares two microversions of the form "major.minor",
+// an empty or malformed microversion is considered older than any valid one
+func CompareMicroversion(a, b string) int {
+	aMajor, aMinor, aOK := parseMicroversion(a)
+	bMajor, bMinor, bOK := parseMicroversion(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	case aMajor != bMajor:
+		return aMajor - bMajor
+	default:
+		return aMinor - bMinor
+	}
+}
+
+func parseMicroversion(v string) (int, int, bool) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestCompareMicroversion(t *testing.T) {
+	grid := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "2.19", b: "2.19", expected: 0},
+		{a: "2.60", b: "2.19", expected: 1},
+		{a: "2.2", b: "2.19", expected: -1},
+		{a: "3.0", b: "2.19", expected: 1},
+		{a: "", b: "2.19", expected: -1},
+		{a: "latest", b: "2.19", expected: -1},
+	}
+	for _, g := range grid {
+		actual := CompareMicroversion(g.a, g.b)
+		if (actual > 0) != (g.expected > 0) || (actual < 0) != (g.expected < 0) {
+			t.Errorf("CompareMicroversion(%q, %q): expected %d, got %d", g.a, g.b, g.expected, actual)
+		}
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	grid := map[string]string{
+		"https://nova.example.com/v2.1/":            "https://nova.example.com/v2.1/",
+		"https://nova.example.com/v2.1/0123abcd/":   "https://nova.example.com/v2.1/",
+		"https://cinder.example.com:8776/v3/abcd":   "https://cinder.example.com:8776/v3/",
+		"https://compute.example.com/":              "https://compute.example.com/",
+		"https://compute.example.com/compute/v2.1/": "https://compute.example.com/compute/v2.1/",
+	}
+	for endpoint, expected := range grid {
+		if actual := versionEndpoint(endpoint); actual != expected {
+			t.Errorf("versionEndpoint(%q): expected %q, got %q", endpoint, expected, actual)
+		}
+	}
+}
+
+func TestSupportsMicroversion(t *testing.T) {
+	grid := []struct {
+		document string
+		version  string
+		expected bool
+	}{
+		{
+			document: `{"version": {"id": "v2.1", "status": "CURRENT", "version": "2.65", "min_version": "2.1"}}`,
+			version:  "2.15",
+			expected: true,
+		},
+		{
+			document: `{"version": {"id": "v2.1", "status": "CURRENT", "version": "2.12", "min_version": "2.1"}}`,
+			version:  "2.15",
+		},
+		{
+			document: `{"versions": [
+				{"id": "v2.0", "status": "DEPRECATED", "version": "", "min_version": ""},
+				{"id": "v3.0", "status": "CURRENT", "version": "3.59", "min_version": "3.0"}
+			]}`,
+			version:  "3.50",
+			expected: true,
+		},
+		{
+			// cinder v2 has no microversions
+			document: `{"versions": [{"id": "v2.0", "status": "SUPPORTED", "version": "", "min_version": ""}]}`,
+			version:  "3.50",
+		},
+		{
+			// octavia lists its API versions by id
+			document: `{"versions": [
+				{"id": "v2.0", "status": "SUPPORTED"},
+				{"id": "v2.12", "status": "SUPPORTED"},
+				{"id": "v2.13", "status": "CURRENT"}
+			]}`,
+			version:  "2.12",
+			expected: true,
+		},
+		{
+			document: `{"versions": [{"id": "v2.0", "status": "SUPPORTED"}, {"id": "v2.11", "status": "CURRENT"}]}`,
+			version:  "2.12",
+		},
+	}
+	for i, g := range grid {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.URL.Path != "/v2.1/" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, g.document)
+		}))
+
+		client := &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + fmt.Sprintf("/v2.1/project-%d/", i),
+		}
+		for j := 0; j < 2; j++ {
+			supported, err := SupportsMicroversion(client, g.version)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if supported != g.expected {
+				t.Errorf("%d: expected support of %s to be %v, got %v", i, g.version, g.expected, supported)
+			}
+		}
+		server.Close()
+		if requests != 1 {
+			t.Errorf("%d: expected the version document to be fetched once, got %d requests", i, requests)
+		}
+	}
+}
+
+func TestConfigureMicroversions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/compute/v2.1/":
+			fmt.Fprint(w, `{"version": {"id": "v2.1", "status": "CURRENT", "version": "2.60", "min_version": "2.1"}}`)
+		case "/volume/v3/":
+			fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.59", "min_version": "3.0"}]}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	nova := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: server.URL + "/compute/v2.1/", Type: "compute"}
+	c := &openstackCloud{novaClient: nova}
+	spec := &kops.ClusterSpec{
+		CloudConfig: &kops.CloudConfiguration{
+			Openstack: &kops.OpenstackConfiguration{
+				ComputeMicroversion:      fi.String("2.15"),
+				BlockStorageMicroversion: fi.String("3.50"),
+			},
+		},
+	}
+	if err := c.configureFromSpec(spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.novaClient.Microversion != "2.15" {
+		t.Errorf("expected compute microversion 2.15, got %q", c.novaClient.Microversion)
+	}
+	if nova.Microversion != "" {
+		t.Errorf("the shared compute client was modified")
+	}
+	if c.blockStorageMicroversion != "3.50" {
+		t.Errorf("expected block storage microversion 3.50 to be requested, got %q", c.blockStorageMicroversion)
+	}
+	// the lazily built cinder client uses the v3 API, which supports the microversion
+	provider := &gophercloud.ProviderClient{
+		EndpointLocator: func(eo gophercloud.EndpointOpts) (string, error) {
+			if eo.Type != "volumev3" {
+				t.Errorf("expected the volumev3 endpoint to be looked up, got %s", eo.Type)
+			}
+			return server.URL + "/volume/v3/project/", nil
+		},
+	}
+	cinder, err := newCinderClient(provider, "", c.blockStorageMicroversion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v := selectMicroversion(cinder, c.blockStorageMicroversion).Microversion; v != "3.50" {
+		t.Errorf("expected block storage microversion 3.50, got %q", v)
+	}
+	spec.CloudConfig.Openstack.ComputeMicroversion = fi.String("latest")
+	if err := c.configureFromSpec(spec); err == nil {
+		t.Errorf("expected error for an invalid microversion")
+	}
+}
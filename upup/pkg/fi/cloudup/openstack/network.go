@@ -18,21 +18,21 @@ package openstack
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	"github.com/gophercloud/gophercloud/pagination"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/upup/pkg/fi"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) GetNetwork(id string) (*networks.Network, error) {
 	var network *networks.Network
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		r, err := networks.Get(c.neutronClient, id).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error retrieving network with id %s: %v", id, err)
+			return false, fmt.Errorf("error retrieving network with id %s: %v", id, withRequestID(err))
 		}
 		network = r
 		return true, nil
@@ -49,10 +49,10 @@ func (c *openstackCloud) GetNetwork(id string) (*networks.Network, error) {
 func (c *openstackCloud) ListNetworks(opt networks.ListOptsBuilder) ([]networks.Network, error) {
 	var ns []networks.Network
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := networks.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing networks: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing networks: %v", withRequestID(err))
 		}
 
 		r, err := networks.ExtractNetworks(allPages)
@@ -71,50 +71,77 @@ func (c *openstackCloud) ListNetworks(opt networks.ListOptsBuilder) ([]networks.
 	}
 }
 
-func (c *openstackCloud) GetExternalNetwork() (net *networks.Network, err error) {
-	type NetworkWithExternalExt struct {
-		networks.Network
-		external.NetworkExternalExt
-	}
-
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-
-		err = networks.List(c.NetworkingClient(), networks.ListOpts{}).EachPage(func(page pagination.Page) (bool, error) {
-			var externalNetwork []NetworkWithExternalExt
-			err := networks.ExtractNetworksInto(page, &externalNetwork)
-			if err != nil {
+// EachNetwork calls fn for the networks which match the options page by page, without holding all networks in memory.
+// An error returned by fn stops the iteration and is returned.
+func (c *openstackCloud) EachNetwork(opt networks.ListOptsBuilder, fn func(networks.Network) error) error {
+	return c.eachPage("networks", func() pagination.Pager {
+		return networks.List(c.neutronClient, opt)
+	}, func(page pagination.Page) (bool, error) {
+		ns, err := networks.ExtractNetworks(page)
+		if err != nil {
+			return false, fmt.Errorf("error extracting networks from page: %v", err)
+		}
+		for _, network := range ns {
+			if err := fn(network); err != nil {
 				return false, err
 			}
-			for _, externalNet := range externalNetwork {
-				if externalNet.External && externalNet.Name == fi.StringValue(c.extNetworkName) {
-					net = &externalNet.Network
-					return true, nil
-				}
-			}
-			return true, nil
-		})
-		if err != nil {
-			return false, nil
 		}
-		return net != nil, nil
+		return true, nil
 	})
+}
 
+// GetExternalNetwork returns the external network selected by name or ID in the cluster spec, the router external network
+// taking precedence over the loadbalancer floating network. Without a selection the only external network is returned.
+func (c *openstackCloud) GetExternalNetwork() (*networks.Network, error) {
+	externals, err := c.ListNetworks(external.ListOptsExt{
+		ListOptsBuilder: networks.ListOpts{},
+		External:        fi.Bool(true),
+	})
 	if err != nil {
-		return net, err
-	} else if done {
-		return net, nil
-	} else {
-		return net, wait.ErrWaitTimeout
+		return nil, err
+	}
+	return selectExternalNetwork(externals, c.externalNetworkSelector())
+}
+
+// externalNetworkSelector returns the name or ID of the external network configured in the cluster spec, if any
+func (c *openstackCloud) externalNetworkSelector() string {
+	for _, selector := range []*string{c.extNetworkName, c.floatingNetworkID, c.floatingNetwork} {
+		if fi.StringValue(selector) != "" {
+			return fi.StringValue(selector)
+		}
+	}
+	return ""
+}
+
+// selectExternalNetwork returns the external network with the name or ID of the selector, or the only external
+// network when the selector is empty
+func selectExternalNetwork(externals []networks.Network, selector string) (*networks.Network, error) {
+	var available []string
+	for i := range externals {
+		if selector != "" && (externals[i].ID == selector || externals[i].Name == selector) {
+			return &externals[i], nil
+		}
+		available = append(available, fmt.Sprintf("%s (%s)", externals[i].Name, externals[i].ID))
+	}
+	if len(externals) == 0 {
+		return nil, fmt.Errorf("no external network found")
+	}
+	if selector != "" {
+		return nil, fmt.Errorf("external network %q not found, available external networks: %s", selector, strings.Join(available, ", "))
+	}
+	if len(externals) > 1 {
+		return nil, fmt.Errorf("found multiple external networks, select one with floatingNetwork of the loadbalancer config: %s", strings.Join(available, ", "))
 	}
+	return &externals[0], nil
 }
 
 func (c *openstackCloud) CreateNetwork(opt networks.CreateOptsBuilder) (*networks.Network, error) {
 	var n *networks.Network
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		r, err := networks.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating network: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating network: %v", withRequestID(err))
 		}
 		n = r
 		return true, nil
@@ -128,11 +155,13 @@ func (c *openstackCloud) CreateNetwork(opt networks.CreateOptsBuilder) (*network
 	}
 }
 
+// DeleteNetwork deletes the network, a missing network is ignored.
+// The subnets of the network have to be deleted with DeleteSubnet first.
 func (c *openstackCloud) DeleteNetwork(networkID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := networks.Delete(c.neutronClient, networkID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting network: %v", err)
+			return false, fmt.Errorf("error deleting network: %v", withRequestID(err))
 		}
 		return true, nil
 	})
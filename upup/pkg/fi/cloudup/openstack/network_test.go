@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+)
+
+func TestSelectExternalNetwork(t *testing.T) {
+	public := networks.Network{ID: "net-1", Name: "public"}
+	provider := networks.Network{ID: "net-2", Name: "provider"}
+
+	grid := []struct {
+		externals []networks.Network
+		selector  string
+		expected  string
+		err       string
+	}{
+		{externals: []networks.Network{public}, expected: "net-1"},
+		{externals: []networks.Network{public, provider}, selector: "provider", expected: "net-2"},
+		{externals: []networks.Network{public, provider}, selector: "net-1", expected: "net-1"},
+		{externals: []networks.Network{public, provider}, err: "found multiple external networks, select one with floatingNetwork of the loadbalancer config: public (net-1), provider (net-2)"},
+		{externals: []networks.Network{public}, selector: "private", err: `external network "private" not found, available external networks: public (net-1)`},
+		{err: "no external network found"},
+	}
+	for _, g := range grid {
+		network, err := selectExternalNetwork(g.externals, g.selector)
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("selecting %q: expected error %q, got %v", g.selector, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selecting %q: unexpected error: %v", g.selector, err)
+			continue
+		}
+		if network.ID != g.expected {
+			t.Errorf("selecting %q: expected %s, got %s", g.selector, g.expected, network.ID)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/pagination"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// eachPage calls handler for the pages of a list request until it returns false or an error. The request is
+// retried as long as no page was handled, afterwards a retry would hand out the first pages again.
+// An error of the handler stops the iteration and is returned as is.
+func (c *openstackCloud) eachPage(what string, pager func() pagination.Pager, handler func(pagination.Page) (bool, error)) error {
+	handled := false
+	var handlerErr error
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		err := pager().EachPage(func(page pagination.Page) (bool, error) {
+			handled = true
+			more, err := handler(page)
+			if err != nil {
+				handlerErr = err
+				return false, nil
+			}
+			return more, nil
+		})
+		if handlerErr != nil {
+			return true, handlerErr
+		}
+		if err != nil {
+			return handled || !isRetryable(err), fmt.Errorf("error listing %s: %v", what, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
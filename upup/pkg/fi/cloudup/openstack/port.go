@@ -21,16 +21,15 @@ import (
 
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) CreatePort(opt ports.CreateOptsBuilder) (*ports.Port, error) {
 	var p *ports.Port
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := ports.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating port: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating port: %v", withRequestID(err))
 		}
 		p = v
 		return true, nil
@@ -44,13 +43,38 @@ func (c *openstackCloud) CreatePort(opt ports.CreateOptsBuilder) (*ports.Port, e
 	}
 }
 
+// UpdatePort updates the port, e.g. to add allowed address pairs
+func (c *openstackCloud) UpdatePort(id string, opt ports.UpdateOptsBuilder) (*ports.Port, error) {
+	var p *ports.Port
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := ports.Update(c.neutronClient, id, opt).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error updating port %s: %v", id, withRequestID(err))
+		}
+		p = v
+		return true, nil
+	})
+	if err != nil {
+		return p, err
+	} else if done {
+		return p, nil
+	} else {
+		return p, wait.ErrWaitTimeout
+	}
+}
+
+// GetPort returns the port with the given id, or nil if it does not exist
 func (c *openstackCloud) GetPort(id string) (*ports.Port, error) {
 	var p *ports.Port
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		port, err := ports.Get(c.neutronClient, id).Extract()
+		if isNotFound(err) {
+			return true, nil
+		}
 		if err != nil {
-			return false, err
+			return false, fmt.Errorf("error getting port %s: %v", id, withRequestID(err))
 		}
 		p = port
 		return true, nil
@@ -67,10 +91,10 @@ func (c *openstackCloud) GetPort(id string) (*ports.Port, error) {
 func (c *openstackCloud) ListPorts(opt ports.ListOptsBuilder) ([]ports.Port, error) {
 	var p []ports.Port
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := ports.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing ports: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing ports: %v", withRequestID(err))
 		}
 
 		r, err := ports.ExtractPorts(allPages)
@@ -89,11 +113,12 @@ func (c *openstackCloud) ListPorts(opt ports.ListOptsBuilder) ([]ports.Port, err
 	}
 }
 
+// DeletePort deletes the port, a missing port is ignored
 func (c *openstackCloud) DeletePort(portID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := ports.Delete(c.neutronClient, portID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting port: %v", err)
+			return false, fmt.Errorf("error deleting port: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -105,3 +130,62 @@ func (c *openstackCloud) DeletePort(portID string) error {
 		return wait.ErrWaitTimeout
 	}
 }
+
+// PortSecurityCreateOpts adds the port_security_enabled attribute of the port-security extension to the options of a new port
+type PortSecurityCreateOpts struct {
+	ports.CreateOptsBuilder
+	PortSecurityEnabled *bool
+}
+
+func (opts PortSecurityCreateOpts) ToPortCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.PortSecurityEnabled != nil {
+		base["port"].(map[string]interface{})["port_security_enabled"] = *opts.PortSecurityEnabled
+	}
+	return base, nil
+}
+
+// PortSecurityUpdateOpts adds the port_security_enabled attribute of the port-security extension to the options of a port update
+type PortSecurityUpdateOpts struct {
+	ports.UpdateOptsBuilder
+	PortSecurityEnabled *bool
+}
+
+func (opts PortSecurityUpdateOpts) ToPortUpdateMap() (map[string]interface{}, error) {
+	base, err := opts.UpdateOptsBuilder.ToPortUpdateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.PortSecurityEnabled != nil {
+		base["port"].(map[string]interface{})["port_security_enabled"] = *opts.PortSecurityEnabled
+	}
+	return base, nil
+}
+
+// GetPortSecurityEnabled returns whether port security is enabled on the port, or nil when the cloud
+// does not have the port-security extension
+func (c *openstackCloud) GetPortSecurityEnabled(id string) (*bool, error) {
+	var enabled *bool
+
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var port struct {
+			PortSecurityEnabled *bool `json:"port_security_enabled"`
+		}
+		err := ports.Get(c.neutronClient, id).ExtractInto(&port)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting port %s: %v", id, withRequestID(err))
+		}
+		enabled = port.PortSecurityEnabled
+		return true, nil
+	})
+	if err != nil {
+		return enabled, err
+	} else if done {
+		return enabled, nil
+	} else {
+		return enabled, wait.ErrWaitTimeout
+	}
+}
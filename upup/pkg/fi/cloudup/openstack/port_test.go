@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestGetPortNotFound(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v2.0/ports/port-1" {
+			w.Write([]byte(`{"port": {"id": "port-1", "name": "port-master-1-cluster", "device_owner": "compute:nova"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{
+		neutronClient: networking,
+	}
+
+	port, err := c.GetPort("port-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if port == nil || port.DeviceOwner != "compute:nova" {
+		t.Errorf("expected port-1, got %+v", port)
+	}
+
+	requests = 0
+	port, err = c.GetPort("port-2")
+	if err != nil {
+		t.Fatalf("unexpected error for missing port: %v", err)
+	}
+	if port != nil {
+		t.Errorf("expected no port, got %+v", port)
+	}
+	if requests != 1 {
+		t.Errorf("expected missing port not to be retried, got %d requests", requests)
+	}
+}
+
+func TestUpdatePortAllowedAddressPairs(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/v2.0/ports/port-1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"port": {"id": "port-1", "allowed_address_pairs": [{"ip_address": "10.0.0.100", "mac_address": "fa:16:3e:00:00:01"}]}}`))
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{neutronClient: networking}
+
+	pairs := []ports.AddressPair{{IPAddress: "10.0.0.100"}}
+	port, err := c.UpdatePort("port-1", ports.UpdateOpts{AllowedAddressPairs: &pairs})
+	if err != nil {
+		t.Fatalf("unexpected error updating port: %v", err)
+	}
+	if !strings.Contains(body, `"allowed_address_pairs":[{"ip_address":"10.0.0.100"}]`) {
+		t.Errorf("expected the address pairs to be sent, got %s", body)
+	}
+	if len(port.AllowedAddressPairs) != 1 || port.AllowedAddressPairs[0].MACAddress != "fa:16:3e:00:00:01" {
+		t.Errorf("unexpected updated port %+v", port)
+	}
+}
+
+func TestUpdatePortSecurityEnabled(t *testing.T) {
+	var body string
+	enabled := "true"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			enabled = "false"
+		}
+		fmt.Fprintf(w, `{"port": {"id": "port-1", "security_groups": [], "port_security_enabled": %s}}`, enabled)
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{neutronClient: networking}
+
+	sgs := []string{}
+	opt := PortSecurityUpdateOpts{
+		UpdateOptsBuilder:   ports.UpdateOpts{SecurityGroups: &sgs},
+		PortSecurityEnabled: fi.Bool(false),
+	}
+	if _, err := c.UpdatePort("port-1", opt); err != nil {
+		t.Fatalf("unexpected error updating port: %v", err)
+	}
+	if !strings.Contains(body, `"port_security_enabled":false`) || !strings.Contains(body, `"security_groups":[]`) {
+		t.Errorf("expected port security and security groups to be disabled, got %s", body)
+	}
+
+	actual, err := c.GetPortSecurityEnabled("port-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting port: %v", err)
+	}
+	if actual == nil || *actual {
+		t.Errorf("expected port security to be disabled, got %v", actual)
+	}
+}
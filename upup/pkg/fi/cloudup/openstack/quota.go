@@ -0,0 +1,277 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Quota is the limit of a resource of the project and how much of it is in use, a negative limit is unlimited
+type Quota struct {
+	Limit    int
+	InUse    int
+	Reserved int
+}
+
+// Unlimited returns true if the project may use any amount of the resource
+func (q Quota) Unlimited() bool {
+	return q.Limit < 0
+}
+
+// Available returns how much of the resource the project may still use
+func (q Quota) Available() int {
+	available := q.Limit - q.InUse - q.Reserved
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// ComputeQuota holds the Nova quotas of the project
+type ComputeQuota struct {
+	Instances Quota
+	Cores     Quota
+	// RAM is in MB
+	RAM Quota
+}
+
+// NetworkQuota holds the Neutron quotas of the project
+type NetworkQuota struct {
+	FloatingIPs Quota
+	Ports       Quota
+}
+
+// VolumeQuota holds the Cinder quotas of the project
+type VolumeQuota struct {
+	Volumes   Quota
+	Gigabytes Quota
+}
+
+// absoluteLimits are the absolute limits reported by the limits API of Nova and Cinder
+type absoluteLimits struct {
+	MaxTotalInstances       int `json:"maxTotalInstances"`
+	TotalInstancesUsed      int `json:"totalInstancesUsed"`
+	MaxTotalCores           int `json:"maxTotalCores"`
+	TotalCoresUsed          int `json:"totalCoresUsed"`
+	MaxTotalRAMSize         int `json:"maxTotalRAMSize"`
+	TotalRAMUsed            int `json:"totalRAMUsed"`
+	MaxTotalVolumes         int `json:"maxTotalVolumes"`
+	TotalVolumesUsed        int `json:"totalVolumesUsed"`
+	MaxTotalVolumeGigabytes int `json:"maxTotalVolumeGigabytes"`
+	TotalGigabytesUsed      int `json:"totalGigabytesUsed"`
+}
+
+// getAbsoluteLimits reads the limits of the project, which Nova and Cinder report together with the usage
+func (c *openstackCloud) getAbsoluteLimits(client *gophercloud.ServiceClient, service string) (*absoluteLimits, error) {
+	var limits *absoluteLimits
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Limits struct {
+				Absolute absoluteLimits `json:"absolute"`
+			} `json:"limits"`
+		}
+		_, err := client.Get(client.ServiceURL("limits"), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting %s limits: %v", service, withRequestID(err))
+		}
+		limits = &r.Limits.Absolute
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return limits, err
+	}
+	return limits, err
+}
+
+// GetComputeQuota returns the instance, core and RAM quotas of the project
+func (c *openstackCloud) GetComputeQuota() (*ComputeQuota, error) {
+	limits, err := c.getAbsoluteLimits(c.novaClient, "compute")
+	if err != nil {
+		return nil, err
+	}
+	return &ComputeQuota{
+		Instances: Quota{Limit: limits.MaxTotalInstances, InUse: limits.TotalInstancesUsed},
+		Cores:     Quota{Limit: limits.MaxTotalCores, InUse: limits.TotalCoresUsed},
+		RAM:       Quota{Limit: limits.MaxTotalRAMSize, InUse: limits.TotalRAMUsed},
+	}, nil
+}
+
+// GetVolumeQuota returns the volume and gigabyte quotas of the project
+func (c *openstackCloud) GetVolumeQuota() (*VolumeQuota, error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := c.getAbsoluteLimits(client, "volume")
+	if err != nil {
+		return nil, err
+	}
+	return &VolumeQuota{
+		Volumes:   Quota{Limit: limits.MaxTotalVolumes, InUse: limits.TotalVolumesUsed},
+		Gigabytes: Quota{Limit: limits.MaxTotalVolumeGigabytes, InUse: limits.TotalGigabytesUsed},
+	}, nil
+}
+
+// neutronQuota is a quota of the quota details extension of Neutron
+type neutronQuota struct {
+	Limit    int `json:"limit"`
+	Used     int `json:"used"`
+	Reserved int `json:"reserved"`
+}
+
+func (q neutronQuota) quota() Quota {
+	return Quota{Limit: q.Limit, InUse: q.Used, Reserved: q.Reserved}
+}
+
+// GetNetworkQuota returns the floating IP and port quotas of the project, it requires the quota details extension
+func (c *openstackCloud) GetNetworkQuota() (*NetworkQuota, error) {
+	if c.projectID == "" {
+		return nil, fmt.Errorf("the project of the token is unknown")
+	}
+	var quota *NetworkQuota
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Quota struct {
+				FloatingIP neutronQuota `json:"floatingip"`
+				Port       neutronQuota `json:"port"`
+			} `json:"quota"`
+		}
+		_, err := c.neutronClient.Get(c.neutronClient.ServiceURL("quotas", c.projectID, "details"), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting network quota: %v", withRequestID(err))
+		}
+		quota = &NetworkQuota{
+			FloatingIPs: r.Quota.FloatingIP.quota(),
+			Ports:       r.Quota.Port.quota(),
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return quota, err
+	}
+	return quota, err
+}
+
+// authProjectID returns the ID of the project the token of the provider client is scoped to
+func authProjectID(pc *gophercloud.ProviderClient) (string, error) {
+	switch r := pc.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		project, err := r.ExtractProject()
+		if err != nil {
+			return "", err
+		}
+		if project == nil {
+			return "", nil
+		}
+		return project.ID, nil
+	case tokens2.CreateResult:
+		token, err := r.ExtractToken()
+		if err != nil {
+			return "", err
+		}
+		return token.Tenant.ID, nil
+	default:
+		return "", fmt.Errorf("no project for authentication result %T", r)
+	}
+}
+
+// ResourceRequest is an amount of the resources which are limited by quotas
+type ResourceRequest struct {
+	Instances int
+	Cores     int
+	// RAM is in MB
+	RAM             int
+	Volumes         int
+	VolumeGigabytes int
+	FloatingIPs     int
+}
+
+// Subtract returns the resources of r which are not covered by used
+func (r *ResourceRequest) Subtract(used *ResourceRequest) *ResourceRequest {
+	sub := func(a, b int) int {
+		if a < b {
+			return 0
+		}
+		return a - b
+	}
+	return &ResourceRequest{
+		Instances:       sub(r.Instances, used.Instances),
+		Cores:           sub(r.Cores, used.Cores),
+		RAM:             sub(r.RAM, used.RAM),
+		Volumes:         sub(r.Volumes, used.Volumes),
+		VolumeGigabytes: sub(r.VolumeGigabytes, used.VolumeGigabytes),
+		FloatingIPs:     sub(r.FloatingIPs, used.FloatingIPs),
+	}
+}
+
+// CheckQuota returns an error listing the resources whose quota does not leave room for the request.
+// A quota which can not be read is skipped with a warning, the check must not stand in the way of clouds
+// which do not report it.
+func CheckQuota(cloud OpenstackCloud, need *ResourceRequest) error {
+	var shortages []string
+	check := func(resource string, need int, q Quota) {
+		if need <= 0 || q.Unlimited() {
+			return
+		}
+		if available := q.Available(); need > available {
+			shortages = append(shortages, fmt.Sprintf("need %d more %s, have %d", need, resource, available))
+		}
+	}
+
+	if need.Instances > 0 || need.Cores > 0 || need.RAM > 0 {
+		if q, err := cloud.GetComputeQuota(); err != nil {
+			glog.Warningf("Skipping the compute quota check: %v", err)
+		} else {
+			check("instances", need.Instances, q.Instances)
+			check("cores", need.Cores, q.Cores)
+			check("MB of RAM", need.RAM, q.RAM)
+		}
+	}
+	if need.Volumes > 0 || need.VolumeGigabytes > 0 {
+		if q, err := cloud.GetVolumeQuota(); err != nil {
+			glog.Warningf("Skipping the volume quota check: %v", err)
+		} else {
+			check("volumes", need.Volumes, q.Volumes)
+			check("GB of volumes", need.VolumeGigabytes, q.Gigabytes)
+		}
+	}
+	if need.FloatingIPs > 0 {
+		if q, err := cloud.GetNetworkQuota(); err != nil {
+			glog.Warningf("Skipping the floating IP quota check: %v", err)
+		} else {
+			check("floating IPs", need.FloatingIPs, q.FloatingIPs)
+		}
+	}
+
+	if len(shortages) > 0 {
+		return fmt.Errorf("the quota of the project is too low for the cluster: %s", strings.Join(shortages, ", "))
+	}
+	return nil
+}
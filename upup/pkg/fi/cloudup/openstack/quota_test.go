@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newQuotaTestCloud(server *httptest.Server) *openstackCloud {
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	return &openstackCloud{
+		novaClient:    newTestServiceClient(server),
+		cinderClient:  newTestServiceClient(server),
+		neutronClient: networking,
+		projectID:     "project-1",
+	}
+}
+
+func newQuotaTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/limits":
+			fmt.Fprint(w, `{"limits": {"absolute": {
+				"maxTotalInstances": 10, "totalInstancesUsed": 4,
+				"maxTotalCores": 20, "totalCoresUsed": 18,
+				"maxTotalRAMSize": -1, "totalRAMUsed": 40960,
+				"maxTotalVolumes": 10, "totalVolumesUsed": 2,
+				"maxTotalVolumeGigabytes": 1000, "totalGigabytesUsed": 100
+			}}}`)
+		case "/v2.0/quotas/project-1/details":
+			fmt.Fprint(w, `{"quota": {
+				"floatingip": {"limit": 5, "used": 3, "reserved": 1},
+				"port": {"limit": -1, "used": 12, "reserved": 0}
+			}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGetQuotas(t *testing.T) {
+	server := newQuotaTestServer()
+	defer server.Close()
+	c := newQuotaTestCloud(server)
+
+	compute, err := c.GetComputeQuota()
+	if err != nil {
+		t.Fatalf("unexpected error getting compute quota: %v", err)
+	}
+	if compute.Cores.Available() != 2 || compute.Instances.Available() != 6 || !compute.RAM.Unlimited() {
+		t.Errorf("unexpected compute quota %+v", compute)
+	}
+
+	volume, err := c.GetVolumeQuota()
+	if err != nil {
+		t.Fatalf("unexpected error getting volume quota: %v", err)
+	}
+	if volume.Volumes.Available() != 8 || volume.Gigabytes.Available() != 900 {
+		t.Errorf("unexpected volume quota %+v", volume)
+	}
+
+	network, err := c.GetNetworkQuota()
+	if err != nil {
+		t.Fatalf("unexpected error getting network quota: %v", err)
+	}
+	if network.FloatingIPs.Available() != 1 || !network.Ports.Unlimited() {
+		t.Errorf("unexpected network quota %+v", network)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	server := newQuotaTestServer()
+	defer server.Close()
+	c := newQuotaTestCloud(server)
+
+	grid := []struct {
+		need     ResourceRequest
+		expected string
+	}{
+		{
+			need: ResourceRequest{Instances: 2, Cores: 2, RAM: 1 << 20, Volumes: 3, VolumeGigabytes: 60, FloatingIPs: 1},
+		},
+		{
+			need:     ResourceRequest{Instances: 3, Cores: 6, RAM: 4096},
+			expected: "the quota of the project is too low for the cluster: need 6 more cores, have 2",
+		},
+		{
+			need:     ResourceRequest{Instances: 7, Volumes: 3, FloatingIPs: 2},
+			expected: "the quota of the project is too low for the cluster: need 7 more instances, have 6, need 2 more floating IPs, have 1",
+		},
+	}
+	for _, g := range grid {
+		err := CheckQuota(c, &g.need)
+		if g.expected == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %v", g.need, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != g.expected {
+			t.Errorf("%+v: expected error %q, got %v", g.need, g.expected, err)
+		}
+	}
+}
+
+func TestCheckQuotaSkipsUnknownQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	c := newQuotaTestCloud(server)
+
+	if err := CheckQuota(c, &ResourceRequest{Instances: 100, FloatingIPs: 100}); err != nil {
+		t.Errorf("expected quotas which can not be read to be skipped, got %v", err)
+	}
+}
+
+func TestResourceRequestSubtract(t *testing.T) {
+	planned := &ResourceRequest{Instances: 5, Cores: 10, RAM: 8192, Volumes: 3, VolumeGigabytes: 60, FloatingIPs: 1}
+	used := &ResourceRequest{Instances: 3, Cores: 12, RAM: 4096, Volumes: 3, VolumeGigabytes: 60, FloatingIPs: 0}
+	expected := ResourceRequest{Instances: 2, RAM: 4096, FloatingIPs: 1}
+	if need := planned.Subtract(used); *need != expected {
+		t.Errorf("expected %+v, got %+v", expected, *need)
+	}
+}
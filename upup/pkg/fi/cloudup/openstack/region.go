@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// openstackServices are the services whose region can be overridden, named like in OS_<SERVICE>_REGION_NAME
+var openstackServices = []string{"compute", "network", "volume", "image", "key-manager", "dns", "load-balancer"}
+
+// catalogRegions returns the regions of the endpoints in the service catalog of the token of the provider client
+func catalogRegions(pc *gophercloud.ProviderClient) ([]string, error) {
+	found := make(map[string]bool)
+	switch r := pc.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		catalog, err := r.ExtractServiceCatalog()
+		if err != nil {
+			return nil, fmt.Errorf("error reading service catalog: %v", err)
+		}
+		for _, entry := range catalog.Entries {
+			for _, endpoint := range entry.Endpoints {
+				if endpoint.Region != "" {
+					found[endpoint.Region] = true
+				} else if endpoint.RegionID != "" {
+					found[endpoint.RegionID] = true
+				}
+			}
+		}
+	case tokens2.CreateResult:
+		catalog, err := r.ExtractServiceCatalog()
+		if err != nil {
+			return nil, fmt.Errorf("error reading service catalog: %v", err)
+		}
+		for _, entry := range catalog.Entries {
+			for _, endpoint := range entry.Endpoints {
+				if endpoint.Region != "" {
+					found[endpoint.Region] = true
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("no service catalog for authentication result %T", r)
+	}
+
+	var regions []string
+	for region := range found {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// validateRegion checks that the region has endpoints in the service catalog. Catalogs without
+// any region, as kept by some single region clouds, accept every region.
+func validateRegion(region string, regions []string) error {
+	if len(regions) == 0 {
+		return nil
+	}
+	for _, r := range regions {
+		if r == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("region %q not found in the service catalog, available regions: %s", region, strings.Join(regions, ", "))
+}
+
+// resolveServiceRegions returns the region of each service, which is the region of the cloud unless the config
+// overrides it, e.g. for clouds running Designate or Octavia in another region than compute
+func resolveServiceRegions(config vfs.OpenstackConfig, region string, catalog []string) (map[string]string, error) {
+	regions := make(map[string]string)
+	for _, service := range openstackServices {
+		r := config.GetServiceRegion(service)
+		if r == "" {
+			r = region
+		} else {
+			if err := validateRegion(r, catalog); err != nil {
+				return nil, fmt.Errorf("invalid region of the %s service: %v", service, err)
+			}
+			glog.V(2).Infof("using region %q for the %s service", r, service)
+		}
+		regions[service] = r
+	}
+	return regions, nil
+}
+
+// ServiceRegions returns the region used for each service
+func (c *openstackCloud) ServiceRegions() map[string]string {
+	regions := make(map[string]string)
+	for service, region := range c.serviceRegions {
+		regions[service] = region
+	}
+	return regions
+}
+
+// ListRegions returns the regions of the service catalog
+func (c *openstackCloud) ListRegions() ([]string, error) {
+	return append([]string(nil), c.regions...), nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+func TestCatalogRegions(t *testing.T) {
+	pc := &gophercloud.ProviderClient{}
+	result := tokens3.CreateResult{}
+	result.Body = map[string]interface{}{
+		"token": map[string]interface{}{
+			"catalog": []interface{}{
+				map[string]interface{}{
+					"type": "compute",
+					"endpoints": []interface{}{
+						map[string]interface{}{"interface": "public", "region": "RegionTwo", "url": "https://nova.two"},
+						map[string]interface{}{"interface": "public", "region": "RegionOne", "url": "https://nova.one"},
+					},
+				},
+				map[string]interface{}{
+					"type": "network",
+					"endpoints": []interface{}{
+						map[string]interface{}{"interface": "public", "region_id": "RegionOne", "url": "https://neutron.one"},
+					},
+				},
+			},
+		},
+	}
+	if err := pc.SetTokenAndAuthResult(result); err != nil {
+		t.Fatalf("unexpected error setting token: %v", err)
+	}
+
+	regions, err := catalogRegions(pc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(regions) != "[RegionOne RegionTwo]" {
+		t.Errorf("unexpected regions %v", regions)
+	}
+}
+
+func TestValidateRegion(t *testing.T) {
+	if err := validateRegion("RegionOne", []string{"RegionOne", "RegionTwo"}); err != nil {
+		t.Errorf("unexpected error for known region: %v", err)
+	}
+	if err := validateRegion("RegionOne", nil); err != nil {
+		t.Errorf("unexpected error for catalog without regions: %v", err)
+	}
+	err := validateRegion("regionone", []string{"RegionOne", "RegionTwo"})
+	if err == nil || !strings.Contains(err.Error(), "available regions: RegionOne, RegionTwo") {
+		t.Errorf("expected the available regions to be listed, got %v", err)
+	}
+}
+
+func TestResolveServiceRegions(t *testing.T) {
+	for name, value := range map[string]string{
+		"OPENSTACK_CREDENTIAL_FILE":    filepath.Join(os.TempDir(), "kops-missing-openstack-config"),
+		"OS_DNS_REGION_NAME":           "RegionTwo",
+		"OS_LOAD_BALANCER_REGION_NAME": "",
+	} {
+		previous, found := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if found {
+			defer os.Setenv(name, previous)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	regions, err := resolveServiceRegions(vfs.OpenstackConfig{}, "RegionOne", []string{"RegionOne", "RegionTwo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if regions["dns"] != "RegionTwo" || regions["compute"] != "RegionOne" || regions["load-balancer"] != "RegionOne" {
+		t.Errorf("unexpected service regions %v", regions)
+	}
+
+	if _, err := resolveServiceRegions(vfs.OpenstackConfig{}, "RegionOne", []string{"RegionOne"}); err == nil {
+		t.Errorf("expected the region of the dns service to be validated")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// requestIDHeaders are the headers in which the OpenStack services return the id of a request,
+// nova returns the id in its own header
+var requestIDHeaders = []string{"X-Openstack-Request-Id", "X-Compute-Request-Id"}
+
+// maxFailedRequests is the number of failed requests whose request id is remembered
+const maxFailedRequests = 256
+
+// failedRequests holds the request ids of the latest failed requests, keyed by method, url and response code.
+// gophercloud does not keep the response headers in its errors, so the ids are captured by the transport
+// and looked up again when the error is wrapped.
+var failedRequests = struct {
+	sync.Mutex
+	ids   map[string]string
+	order []string
+}{
+	ids: make(map[string]string),
+}
+
+func failedRequestKey(method, url string, code int) string {
+	return method + " " + url + " " + strconv.Itoa(code)
+}
+
+// recordRequestID remembers the request id of a failed request
+func recordRequestID(req *http.Request, resp *http.Response) {
+	if resp.StatusCode < 400 {
+		return
+	}
+	id := ""
+	for _, header := range requestIDHeaders {
+		if id = resp.Header.Get(header); id != "" {
+			break
+		}
+	}
+	if id == "" {
+		return
+	}
+
+	key := failedRequestKey(req.Method, req.URL.String(), resp.StatusCode)
+	failedRequests.Lock()
+	defer failedRequests.Unlock()
+	if _, found := failedRequests.ids[key]; !found {
+		failedRequests.order = append(failedRequests.order, key)
+		if len(failedRequests.order) > maxFailedRequests {
+			delete(failedRequests.ids, failedRequests.order[0])
+			failedRequests.order = failedRequests.order[1:]
+		}
+	}
+	failedRequests.ids[key] = id
+}
+
+// requestID returns the request id of the failed request which caused a gophercloud error
+func requestID(err error) (string, bool) {
+	e, ok := unexpectedResponse(err)
+	if !ok {
+		return "", false
+	}
+	failedRequests.Lock()
+	defer failedRequests.Unlock()
+	id, found := failedRequests.ids[failedRequestKey(e.Method, e.URL, e.Actual)]
+	return id, found
+}
+
+// requestIDError is an error of an OpenStack API together with the id of the request which failed
+type requestIDError struct {
+	err       error
+	requestID string
+}
+
+func (e *requestIDError) Error() string {
+	return fmt.Sprintf("%v, req-id: %s", e.err, e.requestID)
+}
+
+// withRequestID adds the request id to the message of a gophercloud error, so a failure can be correlated
+// with the logs of the OpenStack service. Other errors are returned unchanged.
+func withRequestID(err error) error {
+	if id, found := requestID(err); found {
+		return &requestIDError{err: err, requestID: id}
+	}
+	return err
+}
+
+// requestIDTransport captures the request ids of failed requests
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		recordRequestID(req, resp)
+	}
+	return resp, err
+}
+
+// withRequestIDTransport returns the http client with its transport wrapped to capture request ids
+func withRequestIDTransport(client http.Client) http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &requestIDTransport{base: base}
+	return client
+}
+
+// unexpectedResponse returns the response details of a gophercloud error
+func unexpectedResponse(err error) (gophercloud.ErrUnexpectedResponseCode, bool) {
+	switch e := err.(type) {
+	case gophercloud.ErrUnexpectedResponseCode:
+		return e, true
+	case gophercloud.ErrDefault400:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault401:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault403:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault404:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault405:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault408:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault429:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault500:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault503:
+		return e.ErrUnexpectedResponseCode, true
+	}
+	return gophercloud.ErrUnexpectedResponseCode{}, false
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+)
+
+func TestErrorIncludesRequestID(t *testing.T) {
+	grid := []struct {
+		header   string
+		id       string
+		expected string
+	}{
+		{header: "X-Openstack-Request-Id", id: "req-abc123", expected: "req-id: req-abc123"},
+		{header: "X-Compute-Request-Id", id: "req-def456", expected: "req-id: req-def456"},
+		{header: "X-Unrelated", id: "req-ghi789"},
+	}
+	for _, g := range grid {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(g.header, g.id)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"badRequest": {"message": "Invalid volume size", "code": 400}}`))
+		}))
+
+		client := newTestServiceClient(server)
+		client.ProviderClient.HTTPClient = withRequestIDTransport(http.Client{})
+		c := &openstackCloud{cinderClient: client}
+
+		_, err := c.CreateVolume(cinder.CreateOpts{Size: 1})
+		server.Close()
+		if err == nil {
+			t.Fatalf("expected error creating volume")
+		}
+		if g.expected != "" && !strings.Contains(err.Error(), g.expected) {
+			t.Errorf("expected error to contain %q, got %v", g.expected, err)
+		}
+		if g.expected == "" && strings.Contains(err.Error(), "req-id") {
+			t.Errorf("expected error without request id, got %v", err)
+		}
+	}
+}
+
+func TestRecordRequestIDIsBounded(t *testing.T) {
+	defer func(ids map[string]string, order []string) {
+		failedRequests.ids, failedRequests.order = ids, order
+	}(failedRequests.ids, failedRequests.order)
+	failedRequests.ids, failedRequests.order = make(map[string]string), nil
+
+	for i := 0; i < maxFailedRequests+10; i++ {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://cloud.example.com/volumes/vol-%d", i), nil)
+		resp := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{"X-Openstack-Request-Id": []string{"req-1"}}}
+		recordRequestID(req, resp)
+	}
+	if len(failedRequests.ids) != maxFailedRequests || len(failedRequests.order) != maxFailedRequests {
+		t.Errorf("expected %d remembered request ids, got %d", maxFailedRequests, len(failedRequests.ids))
+	}
+}
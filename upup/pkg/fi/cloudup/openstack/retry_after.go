@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// maxRetryAfter caps the wait requested by a Retry-After header, so a misbehaving cloud cannot stall kops
+	maxRetryAfter = 2 * time.Minute
+	// maxRetryAfterAttempts is how often a rate limited request is resent before the error is returned
+	maxRetryAfterAttempts = 5
+)
+
+// retryAfterTransport resends requests rejected with 429 or 503 once the delay of their Retry-After header has passed.
+// gophercloud does not keep the response headers in its errors, so the header has to be honoured here
+// rather than in the backoff of the cloud methods, which only see the error.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || attempt >= maxRetryAfterAttempts {
+			return resp, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+		next := req.WithContext(req.Context())
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			next.Body = body
+		}
+		resp.Body.Close()
+
+		glog.V(2).Infof("%s %s was rate limited with status %d, retrying after %v", req.Method, req.URL, resp.StatusCode, delay)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		req = next
+	}
+}
+
+// withRetryAfterTransport returns the http client with its transport wrapped to honour Retry-After headers
+func withRetryAfterTransport(client http.Client) http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &retryAfterTransport{base: base}
+	return client
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+	} else {
+		return 0, false
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay, true
+}
+
+// responseCode returns the HTTP status code of a gophercloud error
+func responseCode(err error) (int, bool) {
+	e, ok := unexpectedResponse(err)
+	return e.Actual, ok
+}
+
+// isRetryable returns false for client errors which will fail the same way when the request is retried,
+// e.g. a bad request or an exceeded quota, so the backoff can give up at once.
+// Not found and conflicts are retried, the resource may not be visible yet or still be in a transient state.
+func isRetryable(err error) bool {
+	code, ok := responseCode(err)
+	if !ok || code < 400 || code >= 500 {
+		return true
+	}
+	switch code {
+	case http.StatusNotFound, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
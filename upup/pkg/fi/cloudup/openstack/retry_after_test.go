@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	grid := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "5", expected: 5 * time.Second, ok: true},
+		{value: "-1", ok: false},
+		{value: "3600", expected: maxRetryAfter, ok: true},
+		{value: "Wed, 01 May 2019 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Wed, 01 May 2019 11:00:00 GMT", expected: 0, ok: true},
+		{value: "later", ok: false},
+	}
+	for _, g := range grid {
+		actual, ok := parseRetryAfter(g.value, now)
+		if ok != g.ok || actual != g.expected {
+			t.Errorf("unexpected result for %q: expected %v/%v, got %v/%v", g.value, g.expected, g.ok, actual, ok)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	grid := []struct {
+		code     int
+		expected bool
+	}{
+		{code: http.StatusBadRequest, expected: false},
+		{code: http.StatusForbidden, expected: false},
+		{code: http.StatusRequestEntityTooLarge, expected: false},
+		{code: http.StatusNotFound, expected: true},
+		{code: http.StatusConflict, expected: true},
+		{code: http.StatusTooManyRequests, expected: true},
+		{code: http.StatusInternalServerError, expected: true},
+		{code: http.StatusServiceUnavailable, expected: true},
+	}
+	for _, g := range grid {
+		err := gophercloud.ErrUnexpectedResponseCode{Actual: g.code}
+		if actual := isRetryable(err); actual != g.expected {
+			t.Errorf("unexpected result for %d: expected %v, got %v", g.code, g.expected, actual)
+		}
+	}
+}
+
+func newRetryAfterTestCloud(server *httptest.Server) *openstackCloud {
+	client := newTestServiceClient(server)
+	client.ProviderClient.HTTPClient = withRetryAfterTransport(client.ProviderClient.HTTPClient)
+	return &openstackCloud{
+		cinderClient: client,
+		readBackoff:  wait.Backoff{Duration: time.Minute, Factor: 1, Steps: 3},
+		writeBackoff: wait.Backoff{Duration: time.Minute, Factor: 1, Steps: 3},
+	}
+}
+
+func TestRetryAfterReplacesBackoff(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"volumes": [{"id": "vol-1"}]}`))
+	}))
+	defer server.Close()
+
+	c := newRetryAfterTestCloud(server)
+	start := time.Now()
+	volumes, err := c.ListVolumes(cinder.ListOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(volumes) != 1 {
+		t.Errorf("expected 1 volume, got %d", len(volumes))
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the Retry-After to be used instead of the backoff, took %v", elapsed)
+	}
+}
+
+func TestRetryAfterResendsBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"volume": {"id": "vol-1"}}`))
+	}))
+	defer server.Close()
+
+	c := newRetryAfterTestCloud(server)
+	volume, err := c.CreateVolume(cinder.CreateOpts{Size: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if volume.ID != "vol-1" {
+		t.Errorf("expected volume vol-1, got %q", volume.ID)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] == "" {
+		t.Errorf("expected the request body to be resent, got %q", bodies)
+	}
+}
+
+func TestClientErrorIsNotRetried(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"badRequest": {"message": "Invalid volume size", "code": 400}}`))
+	}))
+	defer server.Close()
+
+	c := newRetryAfterTestCloud(server)
+	if _, err := c.CreateVolume(cinder.CreateOpts{Size: 1}); err == nil {
+		t.Fatalf("expected error creating volume")
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+}
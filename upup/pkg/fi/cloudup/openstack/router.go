@@ -21,16 +21,15 @@ import (
 
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) ListRouters(opt routers.ListOpts) ([]routers.Router, error) {
 	var rs []routers.Router
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := routers.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing routers: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing routers: %v", withRequestID(err))
 		}
 
 		r, err := routers.ExtractRouters(allPages)
@@ -52,10 +51,10 @@ func (c *openstackCloud) ListRouters(opt routers.ListOpts) ([]routers.Router, er
 func (c *openstackCloud) CreateRouter(opt routers.CreateOptsBuilder) (*routers.Router, error) {
 	var r *routers.Router
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := routers.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating router: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating router: %v", withRequestID(err))
 		}
 		r = v
 		return true, nil
@@ -72,10 +71,10 @@ func (c *openstackCloud) CreateRouter(opt routers.CreateOptsBuilder) (*routers.R
 func (c *openstackCloud) CreateRouterInterface(routerID string, opt routers.AddInterfaceOptsBuilder) (*routers.InterfaceInfo, error) {
 	var i *routers.InterfaceInfo
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := routers.AddInterface(c.neutronClient, routerID, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating router interface: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating router interface: %v", withRequestID(err))
 		}
 		i = v
 		return true, nil
@@ -89,11 +88,13 @@ func (c *openstackCloud) CreateRouterInterface(routerID string, opt routers.AddI
 	}
 }
 
+// DeleteRouterInterface removes the router interface from the subnet, a missing interface is ignored.
+// The interface has to be removed before the router or the subnet can be deleted.
 func (c *openstackCloud) DeleteRouterInterface(routerID string, opt routers.RemoveInterfaceOptsBuilder) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		_, err := routers.RemoveInterface(c.neutronClient, routerID, opt).Extract()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting router interface: %v", err)
+			return false, fmt.Errorf("error deleting router interface: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -106,11 +107,13 @@ func (c *openstackCloud) DeleteRouterInterface(routerID string, opt routers.Remo
 	}
 }
 
+// DeleteRouter deletes the router, a missing router is ignored.
+// All interfaces of the router have to be removed with DeleteRouterInterface first.
 func (c *openstackCloud) DeleteRouter(routerID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := routers.Delete(c.neutronClient, routerID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting router: %v", err)
+			return false, fmt.Errorf("error deleting router: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -19,19 +19,19 @@ package openstack
 import (
 	"fmt"
 
+	"github.com/golang/glog"
 	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
 	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) ListSecurityGroups(opt sg.ListOpts) ([]sg.SecGroup, error) {
 	var groups []sg.SecGroup
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := sg.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing security groups %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error listing security groups %v: %v", opt, withRequestID(err))
 		}
 
 		gs, err := sg.ExtractGroups(allPages)
@@ -53,10 +53,10 @@ func (c *openstackCloud) ListSecurityGroups(opt sg.ListOpts) ([]sg.SecGroup, err
 func (c *openstackCloud) CreateSecurityGroup(opt sg.CreateOptsBuilder) (*sg.SecGroup, error) {
 	var group *sg.SecGroup
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		g, err := sg.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating security group %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error creating security group %v: %v", opt, withRequestID(err))
 		}
 		group = g
 		return true, nil
@@ -73,10 +73,10 @@ func (c *openstackCloud) CreateSecurityGroup(opt sg.CreateOptsBuilder) (*sg.SecG
 func (c *openstackCloud) ListSecurityGroupRules(opt sgr.ListOpts) ([]sgr.SecGroupRule, error) {
 	var rules []sgr.SecGroupRule
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := sgr.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing security group rules %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error listing security group rules %v: %v", opt, withRequestID(err))
 		}
 
 		rs, err := sgr.ExtractRules(allPages)
@@ -98,10 +98,10 @@ func (c *openstackCloud) ListSecurityGroupRules(opt sgr.ListOpts) ([]sgr.SecGrou
 func (c *openstackCloud) CreateSecurityGroupRule(opt sgr.CreateOptsBuilder) (*sgr.SecGroupRule, error) {
 	var rule *sgr.SecGroupRule
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		r, err := sgr.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating security group rule %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error creating security group rule %v: %v", opt, withRequestID(err))
 		}
 		rule = r
 		return true, nil
@@ -115,11 +115,75 @@ func (c *openstackCloud) CreateSecurityGroupRule(opt sgr.CreateOptsBuilder) (*sg
 	}
 }
 
+// EnsureSecurityGroupRule creates the rule unless the security group already has a rule with the same
+// direction, ethertype, protocol, port range and remote, in which case that rule is returned.
+// This keeps repeated reconciles from adding duplicate rules.
+func (c *openstackCloud) EnsureSecurityGroupRule(opt sgr.CreateOpts) (*sgr.SecGroupRule, error) {
+	rules, err := c.ListSecurityGroupRules(sgr.ListOpts{
+		SecGroupID: opt.SecGroupID,
+		Direction:  string(opt.Direction),
+		EtherType:  string(opt.EtherType),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if securityGroupRuleMatches(opt, rules[i]) {
+			glog.V(4).Infof("security group rule %s already exists in security group %s", rules[i].ID, opt.SecGroupID)
+			return &rules[i], nil
+		}
+	}
+	return c.CreateSecurityGroupRule(opt)
+}
+
+// securityGroupRuleMatches returns true if the existing rule has the same fingerprint as the rule to create
+func securityGroupRuleMatches(opt sgr.CreateOpts, rule sgr.SecGroupRule) bool {
+	return string(opt.Direction) == rule.Direction &&
+		string(opt.EtherType) == rule.EtherType &&
+		string(opt.Protocol) == rule.Protocol &&
+		NormalizeRulePort(opt.PortRangeMin) == NormalizeRulePort(rule.PortRangeMin) &&
+		NormalizeRulePort(opt.PortRangeMax) == NormalizeRulePort(rule.PortRangeMax) &&
+		opt.RemoteGroupID == rule.RemoteGroupID &&
+		opt.RemoteIPPrefix == rule.RemoteIPPrefix
+}
+
+// NormalizeRulePort maps the -1 used for "any" ICMP type and code to the unset value Neutron returns
+func NormalizeRulePort(port int) int {
+	if port < 0 {
+		return 0
+	}
+	return port
+}
+
+// DeleteSecurityGroup deletes the security group, a security group which no longer exists is not an error.
+// Neutron refuses to delete a security group still in use by ports, that conflict is returned as is
+// so the caller can retry once the ports are gone.
 func (c *openstackCloud) DeleteSecurityGroup(sgID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := sg.Delete(c.neutronClient, sgID).ExtractErr()
+		if isConflict(err) {
+			return true, err
+		}
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("error deleting security group: %v", withRequestID(err))
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	} else if done {
+		return nil
+	} else {
+		return wait.ErrWaitTimeout
+	}
+}
+
+// DeleteSecurityGroupRule deletes the security group rule, a rule which no longer exists is not an error
+func (c *openstackCloud) DeleteSecurityGroupRule(ruleID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := sgr.Delete(c.neutronClient, ruleID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting network: %v", err)
+			return false, fmt.Errorf("error deleting security group rule: %v", withRequestID(err))
 		}
 		return true, nil
 	})
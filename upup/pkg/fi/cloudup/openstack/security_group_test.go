@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+)
+
+func TestDeleteSecurityGroup(t *testing.T) {
+	grid := []struct {
+		status      int
+		body        string
+		expectError bool
+	}{
+		{status: http.StatusNoContent},
+		{status: http.StatusNotFound, body: `{"NeutronError": {"type": "SecurityGroupNotFound"}}`},
+		{
+			status:      http.StatusConflict,
+			body:        `{"NeutronError": {"type": "SecurityGroupInUse", "message": "Security Group sg-1 in use."}}`,
+			expectError: true,
+		},
+	}
+	for _, g := range grid {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Method != "DELETE" || r.URL.Path != "/v2.0/security-groups/sg-1" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(g.status)
+			w.Write([]byte(g.body))
+		}))
+
+		c := &openstackCloud{neutronClient: newTestServiceClient(server)}
+		c.neutronClient.ResourceBase = server.URL + "/v2.0/"
+		err := c.DeleteSecurityGroup("sg-1")
+		server.Close()
+
+		if g.expectError {
+			if !isConflict(err) {
+				t.Errorf("status %d: expected the conflict error to be returned, got %v", g.status, err)
+			}
+		} else if err != nil {
+			t.Errorf("status %d: unexpected error %v", g.status, err)
+		}
+		if requests != 1 {
+			t.Errorf("status %d: expected a single request, got %d", g.status, requests)
+		}
+	}
+}
+
+func TestDeleteSecurityGroupRuleNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/v2.0/security-group-rules/rule-1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{neutronClient: newTestServiceClient(server)}
+	c.neutronClient.ResourceBase = server.URL + "/v2.0/"
+	if err := c.DeleteSecurityGroupRule("rule-1"); err != nil {
+		t.Errorf("expected a missing rule to be ignored, got %v", err)
+	}
+}
+
+func TestEnsureSecurityGroupRule(t *testing.T) {
+	existing := `{"security_group_rules": [
+		{"id": "rule-ssh", "direction": "ingress", "ethertype": "IPv4", "security_group_id": "sg-1",
+		 "protocol": "tcp", "port_range_min": 22, "port_range_max": 22, "remote_ip_prefix": "0.0.0.0/0"},
+		{"id": "rule-icmp", "direction": "ingress", "ethertype": "IPv4", "security_group_id": "sg-1",
+		 "protocol": "icmp", "remote_group_id": "sg-2"}
+	]}`
+	grid := []struct {
+		name     string
+		opt      sgr.CreateOpts
+		expectID string
+		created  bool
+	}{
+		{
+			name:     "same rule",
+			opt:      sgr.CreateOpts{Direction: sgr.DirIngress, EtherType: sgr.EtherType4, SecGroupID: "sg-1", Protocol: sgr.ProtocolTCP, PortRangeMin: 22, PortRangeMax: 22, RemoteIPPrefix: "0.0.0.0/0"},
+			expectID: "rule-ssh",
+		},
+		{
+			name:     "any icmp type",
+			opt:      sgr.CreateOpts{Direction: sgr.DirIngress, EtherType: sgr.EtherType4, SecGroupID: "sg-1", Protocol: sgr.ProtocolICMP, PortRangeMin: -1, PortRangeMax: -1, RemoteGroupID: "sg-2"},
+			expectID: "rule-icmp",
+		},
+		{
+			name:     "different remote",
+			opt:      sgr.CreateOpts{Direction: sgr.DirIngress, EtherType: sgr.EtherType4, SecGroupID: "sg-1", Protocol: sgr.ProtocolTCP, PortRangeMin: 22, PortRangeMax: 22, RemoteGroupID: "sg-2"},
+			expectID: "rule-new",
+			created:  true,
+		},
+		{
+			name:     "different port",
+			opt:      sgr.CreateOpts{Direction: sgr.DirIngress, EtherType: sgr.EtherType4, SecGroupID: "sg-1", Protocol: sgr.ProtocolTCP, PortRangeMin: 443, PortRangeMax: 443, RemoteIPPrefix: "0.0.0.0/0"},
+			expectID: "rule-new",
+			created:  true,
+		},
+	}
+	for _, g := range grid {
+		created := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/v2.0/security-group-rules":
+				if r.URL.Query().Get("security_group_id") != "sg-1" {
+					t.Errorf("%s: expected rules to be listed by security group, got %s", g.name, r.URL.RawQuery)
+				}
+				fmt.Fprint(w, existing)
+			case r.Method == "POST" && r.URL.Path == "/v2.0/security-group-rules":
+				created = true
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"security_group_rule": {"id": "rule-new"}}`)
+			default:
+				t.Errorf("%s: unexpected request %s %s", g.name, r.Method, r.URL.Path)
+			}
+		}))
+
+		c := &openstackCloud{neutronClient: newTestServiceClient(server)}
+		c.neutronClient.ResourceBase = server.URL + "/v2.0/"
+		rule, err := c.EnsureSecurityGroupRule(g.opt)
+		server.Close()
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", g.name, err)
+			continue
+		}
+		if rule.ID != g.expectID {
+			t.Errorf("%s: expected rule %s, got %s", g.name, g.expectID, rule.ID)
+		}
+		if created != g.created {
+			t.Errorf("%s: expected created=%v, got %v", g.name, g.created, created)
+		}
+	}
+}
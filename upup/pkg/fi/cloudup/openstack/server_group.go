@@ -17,25 +17,36 @@ limitations under the License.
 package openstack
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/cloudinstances"
 	"k8s.io/kops/upup/pkg/fi"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
+// SoftServerGroupPolicyMicroversion is the first compute microversion which supports soft server group policies
+const SoftServerGroupPolicyMicroversion = "2.15"
+
 func (c *openstackCloud) CreateServerGroup(opt servergroups.CreateOptsBuilder) (*servergroups.ServerGroup, error) {
 	var i *servergroups.ServerGroup
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		v, err := servergroups.Create(c.novaClient, opt).Extract()
+	// nova only accepts soft policies from requests for the microversion which introduced them
+	client := c.novaClient
+	if CompareMicroversion(client.Microversion, SoftServerGroupPolicyMicroversion) < 0 {
+		client = selectMicroversion(client, SoftServerGroupPolicyMicroversion)
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := servergroups.Create(client, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating server group: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating server group: %v", withRequestID(err))
 		}
 		i = v
 		return true, nil
@@ -52,10 +63,10 @@ func (c *openstackCloud) CreateServerGroup(opt servergroups.CreateOptsBuilder) (
 func (c *openstackCloud) ListServerGroups() ([]servergroups.ServerGroup, error) {
 	var sgs []servergroups.ServerGroup
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := servergroups.List(c.novaClient).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing server groups: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing server groups: %v", withRequestID(err))
 		}
 
 		r, err := servergroups.ExtractServerGroups(allPages)
@@ -74,6 +85,37 @@ func (c *openstackCloud) ListServerGroups() ([]servergroups.ServerGroup, error)
 	}
 }
 
+// ErrServerGroupNotFound is returned by GetServerGroupByName when no server group has the name
+var ErrServerGroupNotFound = errors.New("server group not found")
+
+// GetServerGroupByName returns the server group with the given name, or ErrServerGroupNotFound.
+// Nova does not enforce unique names, several server groups with the name are an error.
+func (c *openstackCloud) GetServerGroupByName(name string) (*servergroups.ServerGroup, error) {
+	groups, err := c.ListServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	return FindServerGroupByName(groups, name)
+}
+
+// FindServerGroupByName returns the server group of the list with the given name, or ErrServerGroupNotFound
+func FindServerGroupByName(groups []servergroups.ServerGroup, name string) (*servergroups.ServerGroup, error) {
+	var found *servergroups.ServerGroup
+	for i := range groups {
+		if groups[i].Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("found multiple server groups with name %s: %s and %s", name, found.ID, groups[i].ID)
+		}
+		found = &groups[i]
+	}
+	if found == nil {
+		return nil, ErrServerGroupNotFound
+	}
+	return found, nil
+}
+
 // matchInstanceGroup filters a list of instancegroups for recognized cloud groups
 func matchInstanceGroup(name string, clusterName string, instancegroups []*kops.InstanceGroup) (*kops.InstanceGroup, error) {
 	var instancegroup *kops.InstanceGroup
@@ -120,14 +162,37 @@ func (c *openstackCloud) osBuildCloudInstanceGroup(ig *kops.InstanceGroup, g *se
 			return nil, fmt.Errorf("error creating cloud instance group member: %v", err)
 		}
 	}
+	members := append(cg.Ready, cg.NeedUpdate...)
+	if len(members) == 0 {
+		return cg, nil
+	}
+	var ids []string
+	for _, member := range members {
+		ids = append(ids, member.ID)
+	}
+	// fetching the servers one by one is slow on large clusters, the concurrency can be lowered in the cluster spec
+	// for clouds which rate limit the compute API
+	instances, err := c.GetServers(ids, c.serverConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		reportPowerState(member, instances[member.ID])
+	}
 	return cg, nil
 }
 
+// DeleteServerGroup deletes the server group, a server group which no longer exists is not an error.
+// A conflict because the group still has members is returned as is, so the caller can retry once
+// the servers are removed.
 func (c *openstackCloud) DeleteServerGroup(groupID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := servergroups.Delete(c.novaClient, groupID).ExtractErr()
+		if isConflict(err) {
+			return true, err
+		}
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting server group: %v", err)
+			return false, fmt.Errorf("error deleting server group: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -139,3 +204,98 @@ func (c *openstackCloud) DeleteServerGroup(groupID string) error {
 		return wait.ErrWaitTimeout
 	}
 }
+
+// addTaggedInstances adds the servers of the cluster which are tagged with an instance group,
+// but are not members of its server group, to the cloud groups. This happens when a server
+// was created without its scheduler hint, or was removed from the server group by an operator.
+// The missing instance group and role metadata of the servers of the cluster is repaired.
+func (c *openstackCloud) addTaggedInstances(cluster *kops.Cluster, instancegroups []*kops.InstanceGroup, groups map[string]*cloudinstances.CloudInstanceGroup, warnUnmatched bool, nodeMap map[string]*v1.Node) error {
+	instances, err := c.ListClusterInstances(cluster.ObjectMeta.Name)
+	if err != nil {
+		return fmt.Errorf("unable to list instances: %v", err)
+	}
+
+	// known holds the instance groups of the servers which are members of a server group
+	known := make(map[string]*kops.InstanceGroup)
+	for _, cg := range groups {
+		for _, member := range append(cg.Ready, cg.NeedUpdate...) {
+			known[member.ID] = cg.InstanceGroup
+		}
+	}
+
+	for i := range instances {
+		instance := &instances[i]
+		if ig := known[instance.ID]; ig != nil {
+			if err := c.repairInstanceMetadata(instance, ig); err != nil {
+				return err
+			}
+			continue
+		}
+		igName := instance.Metadata[TagKopsInstanceGroup]
+		if igName == "" {
+			continue
+		}
+
+		var instancegroup *kops.InstanceGroup
+		for _, ig := range instancegroups {
+			if ig.ObjectMeta.Name == igName {
+				instancegroup = ig
+			}
+		}
+		if instancegroup == nil {
+			if warnUnmatched {
+				glog.Warningf("Found instance %q with no corresponding instance group %q", instance.Name, igName)
+			}
+			continue
+		}
+		if err := c.repairInstanceMetadata(instance, instancegroup); err != nil {
+			return err
+		}
+
+		cg := groups[igName]
+		if cg == nil {
+			if warnUnmatched {
+				glog.Warningf("Found instance %q of instance group %q which has no server group", instance.Name, igName)
+			}
+			continue
+		}
+		grp := cg.Raw.(*servergroups.ServerGroup)
+		err := cg.NewCloudInstanceGroupMember(instance.ID, grp.Name, grp.Name+"-updatealways", nodeMap)
+		if err != nil {
+			return fmt.Errorf("error creating cloud instance group member: %v", err)
+		}
+		known[instance.ID] = instancegroup
+
+		reportPowerState(cg.NeedUpdate[len(cg.NeedUpdate)-1], instance)
+	}
+	return nil
+}
+
+// repairInstanceMetadata adds the instance group and role metadata the model sets on the servers of the instance
+// group to a server which is missing them, e.g. a server which was imported or created by an older release
+func (c *openstackCloud) repairInstanceMetadata(instance *servers.Server, ig *kops.InstanceGroup) error {
+	md := make(map[string]string)
+	if instance.Metadata[TagKopsInstanceGroup] == "" {
+		md[TagKopsInstanceGroup] = ig.ObjectMeta.Name
+	}
+	if ig.Spec.Role != "" {
+		roleTag := TagNameRolePrefix + strings.ToLower(string(ig.Spec.Role))
+		if instance.Metadata[roleTag] == "" {
+			md[roleTag] = "1"
+		}
+	}
+	if len(md) == 0 {
+		return nil
+	}
+	glog.Infof("Adding missing metadata %v to instance %q of instance group %q", md, instance.Name, ig.ObjectMeta.Name)
+	if err := c.SetServerMetadata(instance.ID, md); err != nil {
+		return fmt.Errorf("error repairing metadata of instance %q: %v", instance.Name, err)
+	}
+	if instance.Metadata == nil {
+		instance.Metadata = make(map[string]string)
+	}
+	for k, v := range md {
+		instance.Metadata[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/cloudinstances"
+	"k8s.io/kops/pkg/featureflag"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// newPowerStateTestServer serves a single server in the given status and records start actions
+func newPowerStateTestServer(status string, started *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/servers/srv-1":
+			fmt.Fprintf(w, `{"server": {"id": "srv-1", "status": %q}}`, status)
+		case r.Method == "POST" && r.URL.Path == "/servers/srv-1/action":
+			*started = append(*started, "srv-1")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func buildPowerStateTestGroup(t *testing.T, c *openstackCloud) *cloudinstances.CloudInstanceGroup {
+	ig := &kops.InstanceGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "master-1"},
+		Spec: kops.InstanceGroupSpec{
+			Role:    kops.InstanceGroupRoleMaster,
+			MinSize: fi.Int32(1),
+			MaxSize: fi.Int32(1),
+		},
+	}
+	grp := &servergroups.ServerGroup{
+		Name:    "cluster-master-1",
+		Members: []string{"srv-1"},
+	}
+	cg, err := c.osBuildCloudInstanceGroup(ig, grp, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building cloud group: %v", err)
+	}
+	if len(cg.NeedUpdate) != 1 {
+		t.Fatalf("expected one member, got %d", len(cg.NeedUpdate))
+	}
+	return cg
+}
+
+func TestReportPowerStateDoesNotStartShutoffInstance(t *testing.T) {
+	featureflag.ParseFlags("+OpenstackStartStoppedInstances")
+	defer featureflag.ParseFlags("-OpenstackStartStoppedInstances")
+
+	var started []string
+	server := newPowerStateTestServer(InstanceStatusShutoff, &started)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	cg := buildPowerStateTestGroup(t, c)
+
+	if len(started) != 0 {
+		t.Errorf("listing the cloud groups should not start servers, got %v", started)
+	}
+	if !cg.NeedUpdate[0].Stopped {
+		t.Errorf("expected member to be reported as stopped")
+	}
+}
+
+func TestReportPowerStateReportsShutoffInstance(t *testing.T) {
+	var started []string
+	server := newPowerStateTestServer(InstanceStatusShutoff, &started)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	cg := buildPowerStateTestGroup(t, c)
+
+	if len(started) != 0 {
+		t.Errorf("no server should be started without the feature flag, got %v", started)
+	}
+	if !cg.NeedUpdate[0].Stopped {
+		t.Errorf("expected member to be reported as stopped")
+	}
+}
+
+func TestReportPowerStateIgnoresActiveInstance(t *testing.T) {
+	var started []string
+	server := newPowerStateTestServer("ACTIVE", &started)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	cg := buildPowerStateTestGroup(t, c)
+
+	if len(started) != 0 {
+		t.Errorf("active server should not be started, got %v", started)
+	}
+	if cg.NeedUpdate[0].Stopped {
+		t.Errorf("active member should not be reported as stopped")
+	}
+}
+
+func TestReportPowerStateIgnoresDeletedInstance(t *testing.T) {
+	var started []string
+	server := newPowerStateTestServer("ACTIVE", &started)
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	ig := &kops.InstanceGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+		Spec: kops.InstanceGroupSpec{
+			Role:    kops.InstanceGroupRoleNode,
+			MinSize: fi.Int32(2),
+			MaxSize: fi.Int32(2),
+		},
+	}
+	grp := &servergroups.ServerGroup{
+		Name:    "cluster-nodes",
+		Members: []string{"srv-1", "srv-gone"},
+	}
+	cg, err := c.osBuildCloudInstanceGroup(ig, grp, nil)
+	if err != nil {
+		t.Fatalf("a deleted member should not fail the cloud group: %v", err)
+	}
+	if len(cg.NeedUpdate) != 2 {
+		t.Fatalf("expected two members, got %d", len(cg.NeedUpdate))
+	}
+	for _, m := range cg.NeedUpdate {
+		if m.Stopped {
+			t.Errorf("member %s should not be reported as stopped", m.ID)
+		}
+	}
+}
+
+func TestGetCloudGroupsAddsTaggedInstances(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/os-server-groups":
+			fmt.Fprint(w, `{"server_groups": [{"id": "sg-1", "name": "cluster-nodes", "members": ["srv-1"]}]}`)
+		case r.URL.Path == "/servers/detail":
+			fmt.Fprint(w, `{"servers": [
+				{"id": "srv-1", "name": "nodes-1", "metadata": {"k8s": "cluster", "KopsInstanceGroup": "nodes", "k8s.io/role/node": "1"}},
+				{"id": "srv-2", "name": "nodes-2", "metadata": {"k8s": "cluster", "KopsInstanceGroup": "nodes", "k8s.io/role/node": "1"}},
+				{"id": "srv-3", "name": "other-1", "metadata": {"k8s": "other", "KopsInstanceGroup": "nodes"}},
+				{"id": "srv-4", "name": "gone-1", "metadata": {"k8s": "cluster", "KopsInstanceGroup": "gone"}}
+			]}`)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/servers/"):
+			fmt.Fprintf(w, `{"server": {"id": %q, "status": "ACTIVE"}}`, strings.TrimPrefix(r.URL.Path, "/servers/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	cluster := &kops.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+	igs := []*kops.InstanceGroup{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+			Spec: kops.InstanceGroupSpec{
+				Role:    kops.InstanceGroupRoleNode,
+				MinSize: fi.Int32(2),
+				MaxSize: fi.Int32(2),
+			},
+		},
+	}
+
+	groups, err := c.GetCloudGroups(cluster, igs, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected a single group, got %d", len(groups))
+	}
+	cg := groups["nodes"]
+	var ids []string
+	for _, m := range append(cg.Ready, cg.NeedUpdate...) {
+		ids = append(ids, m.ID)
+	}
+	if len(ids) != 2 || ids[0] != "srv-1" || ids[1] != "srv-2" {
+		t.Errorf("expected members [srv-1 srv-2], got %v", ids)
+	}
+	grp := cg.Raw.(*servergroups.ServerGroup)
+	if len(grp.Members) != 1 {
+		t.Errorf("listing the cloud groups should not change the server group members, got %v", grp.Members)
+	}
+}
+
+func TestGetCloudGroupsRepairsInstanceMetadata(t *testing.T) {
+	updated := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/os-server-groups":
+			fmt.Fprint(w, `{"server_groups": [{"id": "sg-1", "name": "cluster-nodes", "members": ["srv-1", "srv-2"]}]}`)
+		case r.URL.Path == "/servers/detail":
+			fmt.Fprint(w, `{"servers": [
+				{"id": "srv-1", "name": "nodes-1", "metadata": {"k8s": "cluster", "KopsInstanceGroup": "nodes", "k8s.io/role/node": "1"}},
+				{"id": "srv-2", "name": "nodes-2", "metadata": {"k8s": "cluster"}}
+			]}`)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/metadata"):
+			b, _ := ioutil.ReadAll(r.Body)
+			updated[r.URL.Path] = string(b)
+			fmt.Fprint(w, `{"metadata": {}}`)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/servers/"):
+			fmt.Fprintf(w, `{"server": {"id": %q, "status": "ACTIVE"}}`, strings.TrimPrefix(r.URL.Path, "/servers/"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{novaClient: newTestServiceClient(server)}
+	cluster := &kops.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+	igs := []*kops.InstanceGroup{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+			Spec:       kops.InstanceGroupSpec{Role: kops.InstanceGroupRoleNode},
+		},
+	}
+
+	if _, err := c.GetCloudGroups(cluster, igs, true, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 1 {
+		t.Fatalf("expected the metadata of a single server to be repaired, got %v", updated)
+	}
+	body := updated["/servers/srv-2/metadata"]
+	if !strings.Contains(body, `"KopsInstanceGroup":"nodes"`) || !strings.Contains(body, `"k8s.io/role/node":"1"`) {
+		t.Errorf("expected instance group and role metadata to be added to srv-2, got %q", body)
+	}
+}
+
+func TestDeleteServerGroup(t *testing.T) {
+	grid := []struct {
+		status      int
+		body        string
+		expectError bool
+	}{
+		{status: http.StatusNoContent},
+		{status: http.StatusNotFound, body: `{"itemNotFound": {"code": 404, "message": "Server group sg-1 could not be found."}}`},
+		{
+			status:      http.StatusConflict,
+			body:        `{"conflictingRequest": {"code": 409, "message": "Server group sg-1 still has members."}}`,
+			expectError: true,
+		},
+	}
+	for _, g := range grid {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Method != "DELETE" || r.URL.Path != "/os-server-groups/sg-1" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(g.status)
+			w.Write([]byte(g.body))
+		}))
+
+		c := &openstackCloud{novaClient: newTestServiceClient(server)}
+		err := c.DeleteServerGroup("sg-1")
+		server.Close()
+
+		if g.expectError {
+			if !isConflict(err) {
+				t.Errorf("status %d: expected the conflict error to be returned, got %v", g.status, err)
+			}
+		} else if err != nil {
+			t.Errorf("status %d: unexpected error %v", g.status, err)
+		}
+		if requests != 1 {
+			t.Errorf("status %d: expected a single request, got %d", g.status, requests)
+		}
+	}
+}
+
+func TestCreateServerGroupRequestsSoftPolicyMicroversion(t *testing.T) {
+	var microversion string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"version": {"id": "v2.1", "status": "CURRENT", "version": "2.60", "min_version": "2.1"}}`)
+		case r.Method == "POST" && r.URL.Path == "/os-server-groups":
+			microversion = r.Header.Get("X-OpenStack-Nova-API-Version")
+			fmt.Fprint(w, `{"server_group": {"id": "sg-1", "name": "cluster-nodes", "policies": ["soft-anti-affinity"]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestServiceClient(server)
+	client.Type = "compute"
+	c := &openstackCloud{novaClient: client}
+	_, err := c.CreateServerGroup(servergroups.CreateOpts{Name: "cluster-nodes", Policies: []string{"soft-anti-affinity"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if microversion != SoftServerGroupPolicyMicroversion {
+		t.Errorf("expected the server group to be created with microversion %s, got %q", SoftServerGroupPolicyMicroversion, microversion)
+	}
+	if client.Microversion != "" {
+		t.Errorf("the shared compute client should keep its microversion, got %q", client.Microversion)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	snapshotStatusAvailable = "available"
+	snapshotStatusError     = "error"
+)
+
+// VolumeSnapshot is a Cinder snapshot of a volume
+type VolumeSnapshot struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	VolumeID    string            `json:"volume_id"`
+	Status      string            `json:"status"`
+	Size        int               `json:"size"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// SnapshotCreateOpts are the options to create a snapshot of a volume
+type SnapshotCreateOpts struct {
+	VolumeID    string `json:"volume_id" required:"true"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Force allows the snapshot of a volume which is attached to a server
+	Force    bool              `json:"force,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SnapshotListOpts filters the listed snapshots
+type SnapshotListOpts struct {
+	Name     string `q:"name"`
+	Status   string `q:"status"`
+	VolumeID string `q:"volume_id"`
+}
+
+// snapshotAvailableBackoff is the backoff strategy for waiting until a new snapshot is available
+var snapshotAvailableBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    12,
+}
+
+// CreateSnapshot creates a snapshot of the volume, and waits until it is available if requested
+func (c *openstackCloud) CreateSnapshot(opts SnapshotCreateOpts, waitAvailable bool) (snapshot *VolumeSnapshot, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	body, err := gophercloud.BuildRequestBody(opts, "snapshot")
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		var r struct {
+			Snapshot *VolumeSnapshot `json:"snapshot"`
+		}
+		_, err := client.Post(client.ServiceURL("snapshots"), body, &r, &gophercloud.RequestOpts{
+			OkCodes: []int{202},
+		})
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error creating snapshot of volume %s: %v", opts.VolumeID, withRequestID(err))
+		}
+		snapshot = r.Snapshot
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return snapshot, err
+	}
+	if err != nil || !waitAvailable {
+		return snapshot, err
+	}
+	return c.waitForSnapshotAvailable(snapshot.ID)
+}
+
+// waitForSnapshotAvailable waits until the snapshot reaches the available status
+func (c *openstackCloud) waitForSnapshotAvailable(snapshotID string) (snapshot *VolumeSnapshot, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(snapshotAvailableBackoff, func() (bool, error) {
+		var r struct {
+			Snapshot *VolumeSnapshot `json:"snapshot"`
+		}
+		_, err := client.Get(client.ServiceURL("snapshots", snapshotID), &r, nil)
+		if err != nil {
+			return false, fmt.Errorf("error getting snapshot %s: %v", snapshotID, withRequestID(err))
+		}
+		snapshot = r.Snapshot
+		switch snapshot.Status {
+		case snapshotStatusAvailable:
+			return true, nil
+		case snapshotStatusError:
+			return true, fmt.Errorf("snapshot %s of volume %s is in error status", snapshotID, snapshot.VolumeID)
+		}
+		glog.V(4).Infof("waiting for snapshot %s to become available, status is %s", snapshotID, snapshot.Status)
+		return false, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return snapshot, err
+	}
+	return snapshot, err
+}
+
+// ListSnapshots returns the snapshots which match the options
+func (c *openstackCloud) ListSnapshots(opts SnapshotListOpts) (snapshots []VolumeSnapshot, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	query, err := gophercloud.BuildQueryString(opts)
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Snapshots []VolumeSnapshot `json:"snapshots"`
+		}
+		_, err := client.Get(client.ServiceURL("snapshots")+query.String(), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing snapshots: %v", withRequestID(err))
+		}
+		snapshots = r.Snapshots
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return snapshots, err
+	}
+	return snapshots, err
+}
+
+// DeleteSnapshot deletes the snapshot, a snapshot which no longer exists is ignored
+func (c *openstackCloud) DeleteSnapshot(snapshotID string) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := client.Delete(client.ServiceURL("snapshots", snapshotID), nil)
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("error deleting snapshot %s: %v", snapshotID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done && err == nil {
+		err = wait.ErrWaitTimeout
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateSnapshotWaitsUntilAvailable(t *testing.T) {
+	polls := 0
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/snapshots":
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"snapshot": {"id": "snap-1", "volume_id": "vol-1", "status": "creating"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/snapshots/snap-1":
+			polls++
+			status := "creating"
+			if polls > 1 {
+				status = "available"
+			}
+			fmt.Fprintf(w, `{"snapshot": {"id": "snap-1", "volume_id": "vol-1", "status": %q}}`, status)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+	snapshot, err := c.CreateSnapshot(SnapshotCreateOpts{VolumeID: "vol-1", Name: "etcd-main", Force: true}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Status != snapshotStatusAvailable {
+		t.Errorf("expected snapshot to be available, got %q", snapshot.Status)
+	}
+	if polls != 2 {
+		t.Errorf("expected 2 status polls, got %d", polls)
+	}
+	if !strings.Contains(body, `"volume_id":"vol-1"`) || !strings.Contains(body, `"force":true`) {
+		t.Errorf("unexpected request body %s", body)
+	}
+}
+
+func TestListAndDeleteSnapshots(t *testing.T) {
+	var query string
+	deletes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/snapshots":
+			query = r.URL.RawQuery
+			fmt.Fprint(w, `{"snapshots": [{"id": "snap-1", "volume_id": "vol-1", "status": "available"}]}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/snapshots/snap-1":
+			deletes++
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+	snapshots, err := c.ListSnapshots(SnapshotListOpts{VolumeID: "vol-1"})
+	if err != nil {
+		t.Fatalf("unexpected error listing snapshots: %v", err)
+	}
+	if query != "volume_id=vol-1" {
+		t.Errorf("expected volume filter, got %q", query)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != "snap-1" {
+		t.Errorf("unexpected snapshots %+v", snapshots)
+	}
+	if err := c.DeleteSnapshot("snap-1"); err != nil {
+		t.Errorf("expected missing snapshot to be ignored, got %v", err)
+	}
+	if deletes != 1 {
+		t.Errorf("expected a single delete request, got %d", deletes)
+	}
+}
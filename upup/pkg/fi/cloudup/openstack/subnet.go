@@ -22,16 +22,15 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/upup/pkg/fi"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) ListSubnets(opt subnets.ListOptsBuilder) ([]subnets.Subnet, error) {
 	var s []subnets.Subnet
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
 		allPages, err := subnets.List(c.neutronClient, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing subnets: %v", err)
+			return !isRetryable(err), fmt.Errorf("error listing subnets: %v", withRequestID(err))
 		}
 
 		r, err := subnets.ExtractSubnets(allPages)
@@ -53,10 +52,10 @@ func (c *openstackCloud) ListSubnets(opt subnets.ListOptsBuilder) ([]subnets.Sub
 func (c *openstackCloud) CreateSubnet(opt subnets.CreateOptsBuilder) (*subnets.Subnet, error) {
 	var s *subnets.Subnet
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		v, err := subnets.Create(c.neutronClient, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating subnet: %v", err)
+			return !isRetryable(err), fmt.Errorf("error creating subnet: %v", withRequestID(err))
 		}
 		s = v
 		return true, nil
@@ -70,11 +69,14 @@ func (c *openstackCloud) CreateSubnet(opt subnets.CreateOptsBuilder) (*subnets.S
 	}
 }
 
+// DeleteSubnet deletes the subnet, a missing subnet is ignored.
+// Router interfaces on the subnet have to be removed with DeleteRouterInterface first,
+// and the subnet has to be deleted before its network.
 func (c *openstackCloud) DeleteSubnet(subnetID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		err := subnets.Delete(c.neutronClient, subnetID).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting subnet: %v", err)
+			return false, fmt.Errorf("error deleting subnet: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The Neutron resources kops tags, named like the collections of the networking API
+const (
+	ResourceTypeNetwork       = "networks"
+	ResourceTypeSubnet        = "subnets"
+	ResourceTypeRouter        = "routers"
+	ResourceTypePort          = "ports"
+	ResourceTypeSecurityGroup = "security-groups"
+	ResourceTypeFloatingIP    = "floatingips"
+)
+
+// ClusterTag returns the tag of the resources of the cluster. Neutron tags are plain strings
+// without commas, so the cluster name is joined to the tag name like for the tags of instances.
+func ClusterTag(clusterName string) string {
+	return TagClusterName + ":" + strings.Replace(clusterName, ".", "-", -1)
+}
+
+// TagFilter returns the tags filter of a Neutron list request, which matches the resources having all the tags
+func TagFilter(tags []string) string {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// replaceAllTags replaces the tags of a Neutron resource through the standard-attr-tag extension,
+// like attributestags.ReplaceAll of newer gophercloud releases
+func replaceAllTags(client *gophercloud.ServiceClient, resourceType string, resourceID string, tags []string) (r gophercloud.Result) {
+	if tags == nil {
+		tags = []string{}
+	}
+	_, r.Err = client.Put(client.ServiceURL(resourceType, resourceID, "tags"), map[string]interface{}{"tags": tags}, &r.Body, &gophercloud.RequestOpts{
+		OkCodes: []int{http.StatusOK},
+	})
+	return
+}
+
+// SetResourceTags will replace the tags of the Neutron resource
+func (c *openstackCloud) SetResourceTags(resourceType string, resourceID string, tags []string) error {
+	glog.V(4).Infof("setting tags of %s %s: %v", resourceType, resourceID, tags)
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := replaceAllTags(c.NetworkingClient(), resourceType, resourceID, tags).Err
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error setting tags of %s %s: %v", resourceType, resourceID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
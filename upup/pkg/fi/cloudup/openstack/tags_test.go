@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetResourceTags(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"tags": ["KubernetesCluster:my-cluster-example-com"]}`))
+	}))
+	defer server.Close()
+
+	networking := newTestServiceClient(server)
+	networking.ResourceBase = server.URL + "/v2.0/"
+	c := &openstackCloud{neutronClient: networking}
+
+	tag := ClusterTag("my-cluster.example.com")
+	if err := c.SetResourceTags(ResourceTypeSecurityGroup, "sg-1", []string{tag}); err != nil {
+		t.Fatalf("unexpected error setting tags: %v", err)
+	}
+	if method != "PUT" || path != "/v2.0/security-groups/sg-1/tags" {
+		t.Errorf("unexpected request %s %s", method, path)
+	}
+	if body != `{"tags":["KubernetesCluster:my-cluster-example-com"]}` {
+		t.Errorf("unexpected request body %s", body)
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	grid := []struct {
+		tags     []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"b", "a"}, "a,b"},
+	}
+	for _, g := range grid {
+		if actual := TagFilter(g.tags); actual != g.expected {
+			t.Errorf("TagFilter(%v) = %q, expected %q", g.tags, actual, g.expected)
+		}
+	}
+}
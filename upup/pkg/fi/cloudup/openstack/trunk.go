@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// SegmentationTypeVLAN carries the network of a subport as a VLAN on the trunk
+const SegmentationTypeVLAN = "vlan"
+
+// Trunk is a Neutron trunk, carrying the networks of its subports over its parent port
+type Trunk struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	PortID      string    `json:"port_id"`
+	Status      string    `json:"status"`
+	SubPorts    []SubPort `json:"sub_ports"`
+	Tags        []string  `json:"tags"`
+}
+
+// SubPort is a port whose network is carried by a trunk
+type SubPort struct {
+	PortID           string `json:"port_id"`
+	SegmentationType string `json:"segmentation_type"`
+	SegmentationID   int    `json:"segmentation_id"`
+}
+
+// TrunkCreateOpts are the options of a new trunk
+type TrunkCreateOpts struct {
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	PortID      string    `json:"port_id"`
+	SubPorts    []SubPort `json:"sub_ports,omitempty"`
+}
+
+// TrunkListOpts filters the listed trunks, empty fields match every trunk
+type TrunkListOpts struct {
+	Name   string
+	PortID string
+}
+
+func (opts TrunkListOpts) query() string {
+	q := url.Values{}
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	if opts.PortID != "" {
+		q.Set("port_id", opts.PortID)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// CreateTrunk creates a trunk on the parent port of the options
+func (c *openstackCloud) CreateTrunk(opts TrunkCreateOpts) (*Trunk, error) {
+	var trunk *Trunk
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		var r struct {
+			Trunk *Trunk `json:"trunk"`
+		}
+		_, err := c.neutronClient.Post(c.neutronClient.ServiceURL("trunks"), map[string]interface{}{"trunk": opts}, &r, &gophercloud.RequestOpts{
+			OkCodes: []int{http.StatusCreated},
+		})
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error creating trunk: %v", withRequestID(err))
+		}
+		trunk = r.Trunk
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return trunk, err
+	}
+	return trunk, err
+}
+
+// ListTrunks returns the trunks which match the options
+func (c *openstackCloud) ListTrunks(opts TrunkListOpts) ([]Trunk, error) {
+	var trunks []Trunk
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			Trunks []Trunk `json:"trunks"`
+		}
+		_, err := c.neutronClient.Get(c.neutronClient.ServiceURL("trunks")+opts.query(), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing trunks: %v", withRequestID(err))
+		}
+		trunks = r.Trunks
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return trunks, err
+	}
+	return trunks, err
+}
+
+// AddTrunkSubPorts adds the subports to the trunk, returning the updated trunk
+func (c *openstackCloud) AddTrunkSubPorts(trunkID string, subPorts []SubPort) (*Trunk, error) {
+	var trunk *Trunk
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		var r Trunk
+		_, err := c.neutronClient.Put(c.neutronClient.ServiceURL("trunks", trunkID, "add_subports"), map[string]interface{}{"sub_ports": subPorts}, &r, &gophercloud.RequestOpts{
+			OkCodes: []int{http.StatusOK},
+		})
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error adding subports to trunk %s: %v", trunkID, withRequestID(err))
+		}
+		trunk = &r
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return trunk, err
+	}
+	return trunk, err
+}
+
+// DeleteTrunk deletes the trunk, a missing trunk is ignored. The subports of the trunk are not deleted,
+// and the conflict error is returned as is while the parent port is still bound to an instance.
+func (c *openstackCloud) DeleteTrunk(trunkID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := c.neutronClient.Delete(c.neutronClient.ServiceURL("trunks", trunkID), nil)
+		if isConflict(err) {
+			return true, err
+		}
+		if err != nil && !isNotFound(err) {
+			return !isRetryable(err), fmt.Errorf("error deleting trunk %s: %v", trunkID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
+
+// deleteTrunksOfPorts deletes the trunks on the parent ports, waiting until their instances released them,
+// and returns the ports of their subports
+func (c *openstackCloud) deleteTrunksOfPorts(portIDs sets.String) ([]string, error) {
+	if portIDs.Len() == 0 {
+		return nil, nil
+	}
+	supported, err := c.HasExtension(ServiceNetwork, ExtensionTrunk)
+	if err != nil || !supported {
+		return nil, err
+	}
+	trunks, err := c.ListTrunks(TrunkListOpts{})
+	if err != nil {
+		return nil, err
+	}
+	var subPortIDs []string
+	for _, trunk := range trunks {
+		if !portIDs.Has(trunk.PortID) {
+			continue
+		}
+		// neutron refuses to delete the trunk while the deleted instance is still bound to its port
+		done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+			err := c.DeleteTrunk(trunk.ID)
+			if isConflict(err) {
+				return false, nil
+			}
+			return true, err
+		})
+		if err == nil && !done {
+			err = wait.ErrWaitTimeout
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not delete trunk %q: %v", trunk.ID, err)
+		}
+		for _, sp := range trunk.SubPorts {
+			subPortIDs = append(subPortIDs, sp.PortID)
+		}
+	}
+	return subPortIDs, nil
+}
@@ -26,9 +26,10 @@ import (
 )
 
 const (
-	openstackExternalIPType = "OS-EXT-IPS:type"
-	openstackAddressFixed   = "fixed"
-	openstackAddress        = "addr"
+	openstackExternalIPType  = "OS-EXT-IPS:type"
+	openstackAddressFixed    = "fixed"
+	openstackAddressFloating = "floating"
+	openstackAddress         = "addr"
 )
 
 type flavorList []flavors.Flavor
@@ -41,65 +42,67 @@ func (s flavorList) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// Less orders the flavors by vCPUs, RAM and disk, the name breaks ties so the order is deterministic
 func (s flavorList) Less(i, j int) bool {
-	if s[i].VCPUs < s[j].VCPUs {
-		return true
-	} else {
-		if s[i].VCPUs > s[j].VCPUs {
-			return false
-		}
+	if s[i].VCPUs != s[j].VCPUs {
+		return s[i].VCPUs < s[j].VCPUs
+	}
+	if s[i].RAM != s[j].RAM {
+		return s[i].RAM < s[j].RAM
 	}
-	return s[i].RAM < s[j].RAM
+	if s[i].Disk != s[j].Disk {
+		return s[i].Disk < s[j].Disk
+	}
+	return s[i].Name < s[j].Name
+}
+
+// flavorRequirement is the minimum size of the flavor of an instance group role
+type flavorRequirement struct {
+	// ram is the minimum RAM in MB
+	ram   int
+	vcpus int
 }
 
+// flavorRequirements are the minimum flavor sizes by role, based on awsCloudImplementation.DefaultInstanceType
+var flavorRequirements = map[kops.InstanceGroupRole]flavorRequirement{
+	kops.InstanceGroupRoleMaster:  {ram: 4096, vcpus: 1},
+	kops.InstanceGroupRoleNode:    {ram: 4096, vcpus: 2},
+	kops.InstanceGroupRoleBastion: {ram: 1024, vcpus: 1},
+}
+
+// DefaultInstanceType returns the machine type of the instance group when it is set, otherwise the
+// smallest flavor which meets the requirements of the role of the instance group
 func (c *openstackCloud) DefaultInstanceType(cluster *kops.Cluster, ig *kops.InstanceGroup) (string, error) {
-	type flavorInfo struct {
-		memory int
-		cpu    int
+	if ig.Spec.MachineType != "" {
+		return ig.Spec.MachineType, nil
 	}
-	flavorPage, err := flavors.ListDetail(c.ComputeClient(), flavors.ListOpts{
-		MinRAM: 1024,
-	}).AllPages()
-	if err != nil {
-		return "", fmt.Errorf("Could not list flavors: %v", err)
+	requirement, found := flavorRequirements[ig.Spec.Role]
+	if !found {
+		return "", fmt.Errorf("unhandled role %q", ig.Spec.Role)
 	}
-	var fList flavorList
-	fList, err = flavors.ExtractFlavors(flavorPage)
+
+	fList, err := c.ListFlavors(flavors.ListOpts{
+		MinRAM: requirement.ram,
+	})
 	if err != nil {
-		return "", fmt.Errorf("Could not extract flavors: %v", err)
+		return "", fmt.Errorf("Could not list flavors: %v", err)
 	}
-	sort.Sort(&fList)
+	return smallestFlavor(fList, requirement, ig.Spec.Role)
+}
 
+// smallestFlavor returns the name of the smallest flavor which meets the requirement
+func smallestFlavor(fList flavorList, requirement flavorRequirement, role kops.InstanceGroupRole) (string, error) {
 	var candidates flavorList
-	switch ig.Spec.Role {
-	case kops.InstanceGroupRoleMaster:
-		// Requirements based on awsCloudImplementation.DefaultInstanceType
-		for _, flavor := range fList {
-			if flavor.RAM >= 4096 && flavor.VCPUs >= 1 {
-				candidates = append(candidates, flavor)
-			}
-		}
-
-	case kops.InstanceGroupRoleNode:
-		for _, flavor := range fList {
-			if flavor.RAM >= 4096 && flavor.VCPUs >= 2 {
-				candidates = append(candidates, flavor)
-			}
+	for _, flavor := range fList {
+		if flavor.RAM >= requirement.ram && flavor.VCPUs >= requirement.vcpus {
+			candidates = append(candidates, flavor)
 		}
-
-	case kops.InstanceGroupRoleBastion:
-		for _, flavor := range fList {
-			if flavor.RAM >= 1024 {
-				candidates = append(candidates, flavor)
-			}
-		}
-
-	default:
-		return "", fmt.Errorf("unhandled role %q", ig.Spec.Role)
 	}
 	if len(candidates) == 0 {
-		return "", fmt.Errorf("No suitable flavor for role %q", ig.Spec.Role)
+		return "", fmt.Errorf("No suitable flavor for role %q, a flavor with at least %d vCPUs and %d MB RAM is required: "+
+			"set the machineType of the instance group", role, requirement.vcpus, requirement.ram)
 	}
+	sort.Sort(candidates)
 	return candidates[0].Name, nil
 }
 
@@ -18,21 +18,29 @@ package openstack
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
 	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/pagination"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/kops/util/pkg/vfs"
 )
 
 func (c *openstackCloud) ListVolumes(opt cinder.ListOptsBuilder) ([]cinder.Volume, error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
 	var volumes []cinder.Volume
 
-	done, err := vfs.RetryWithBackoff(readBackoff, func() (bool, error) {
-		allPages, err := cinder.List(c.cinderClient, opt).AllPages()
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		allPages, err := cinder.List(client, opt).AllPages()
 		if err != nil {
-			return false, fmt.Errorf("error listing volumes %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error listing volumes %v: %v", opt, withRequestID(err))
 		}
 
 		vs, err := cinder.ExtractVolumes(allPages)
@@ -51,13 +59,90 @@ func (c *openstackCloud) ListVolumes(opt cinder.ListOptsBuilder) ([]cinder.Volum
 	}
 }
 
+// EachVolume calls fn for the volumes which match the options page by page, without holding all volumes in memory.
+// An error returned by fn stops the iteration and is returned.
+func (c *openstackCloud) EachVolume(opt cinder.ListOptsBuilder, fn func(cinder.Volume) error) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	return c.eachPage("volumes", func() pagination.Pager {
+		return cinder.List(client, opt)
+	}, func(page pagination.Page) (bool, error) {
+		volumes, err := cinder.ExtractVolumes(page)
+		if err != nil {
+			return false, fmt.Errorf("error extracting volumes from page: %v", err)
+		}
+		for _, volume := range volumes {
+			if err := fn(volume); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// MultiattachCreateOpts creates a volume which can be attached to several servers at once,
+// which requires a volume type with the multiattach extra spec
+type MultiattachCreateOpts struct {
+	cinder.CreateOptsBuilder
+	Multiattach bool
+}
+
+func (opts MultiattachCreateOpts) ToVolumeCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToVolumeCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Multiattach {
+		base["volume"].(map[string]interface{})["multiattach"] = true
+	}
+	return base, nil
+}
+
+// validateMultiattach fails if the volume type of a multiattach volume does not support multiattach
+func (c *openstackCloud) validateMultiattach(opts MultiattachCreateOpts) error {
+	body, err := opts.CreateOptsBuilder.ToVolumeCreateMap()
+	if err != nil {
+		return err
+	}
+	volumeType, _ := body["volume"].(map[string]interface{})["volume_type"].(string)
+	if volumeType == "" {
+		return fmt.Errorf("multiattach volumes require a volume type with the multiattach extra spec")
+	}
+	volumeTypes, err := c.ListVolumeTypes()
+	if err != nil {
+		return err
+	}
+	for _, t := range volumeTypes {
+		if t.Name != volumeType && t.ID != volumeType {
+			continue
+		}
+		if !t.SupportsMultiattach() {
+			return fmt.Errorf("volume type %q does not support multiattach, its extra spec multiattach must be \"<is> True\"", volumeType)
+		}
+		return nil
+	}
+	return fmt.Errorf("volume type %q not found", volumeType)
+}
+
 func (c *openstackCloud) CreateVolume(opt cinder.CreateOptsBuilder) (*cinder.Volume, error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
 	var volume *cinder.Volume
 
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		v, err := cinder.Create(c.cinderClient, opt).Extract()
+	if mo, ok := opt.(MultiattachCreateOpts); ok && mo.Multiattach {
+		if err := c.validateMultiattach(mo); err != nil {
+			return nil, err
+		}
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		v, err := cinder.Create(client, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error creating volume %v: %v", opt, err)
+			return !isRetryable(err), fmt.Errorf("error creating volume %v: %v", opt, withRequestID(err))
 		}
 		volume = v
 		return true, nil
@@ -71,11 +156,34 @@ func (c *openstackCloud) CreateVolume(opt cinder.CreateOptsBuilder) (*cinder.Vol
 	}
 }
 
+// multiattachMicroversion is the first compute microversion which attaches a volume to a second server
+const multiattachMicroversion = "2.60"
+
 func (c *openstackCloud) AttachVolume(serverID string, opts volumeattach.CreateOpts) (attachment *volumeattach.VolumeAttachment, err error) {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
+	volume, err := c.GetVolume(opts.VolumeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range volume.Attachments {
+		if a.ServerID == serverID {
+			glog.V(2).Infof("volume %s is already attached to server %s as %s", opts.VolumeID, serverID, a.Device)
+			return &volumeattach.VolumeAttachment{ID: a.ID, Device: a.Device, ServerID: a.ServerID, VolumeID: opts.VolumeID}, nil
+		}
+	}
+	if len(volume.Attachments) > 0 {
+		if !volume.Multiattach {
+			return nil, fmt.Errorf("volume %s is already attached to server %s and is not a multiattach volume", opts.VolumeID, volume.Attachments[0].ServerID)
+		}
+		if CompareMicroversion(c.ComputeClient().Microversion, multiattachMicroversion) < 0 {
+			return nil, fmt.Errorf("attaching multiattach volume %s to a second server requires compute microversion %s, set computeMicroversion in the openstack cloudConfig",
+				opts.VolumeID, multiattachMicroversion)
+		}
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
 		volumeAttachment, err := volumeattach.Create(c.ComputeClient(), serverID, opts).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error attaching volume %s to server %s: %v", opts.VolumeID, serverID, err)
+			return false, fmt.Errorf("error attaching volume %s to server %s: %v", opts.VolumeID, serverID, withRequestID(err))
 		}
 		attachment = volumeAttachment
 		return true, nil
@@ -86,10 +194,34 @@ func (c *openstackCloud) AttachVolume(serverID string, opts volumeattach.CreateO
 		}
 		return attachment, err
 	}
-	return attachment, err
+	if err != nil {
+		return attachment, err
+	}
+	if warning := attachedDeviceWarning(opts, attachment); warning != "" {
+		glog.Warning(warning)
+	}
+	// the attachment is returned before cinder has attached the volume
+	if err := c.WaitForVolumeStatus(opts.VolumeID, "in-use", volumeAttachedTimeout); err != nil {
+		return attachment, err
+	}
+	return attachment, nil
+}
+
+// attachedDeviceWarning describes a mismatch between the requested device and the one nova attached the volume as.
+// Some hypervisors ignore the requested device name.
+func attachedDeviceWarning(opts volumeattach.CreateOpts, attachment *volumeattach.VolumeAttachment) string {
+	if opts.Device == "" || attachment == nil || attachment.Device == opts.Device {
+		return ""
+	}
+	return fmt.Sprintf("volume %s was attached as %s instead of the requested device %s, the hypervisor may not honour requested device names",
+		opts.VolumeID, attachment.Device, opts.Device)
 }
 
 func (c *openstackCloud) SetVolumeTags(id string, tags map[string]string) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
 	if len(tags) == 0 {
 		return nil
 	}
@@ -99,10 +231,10 @@ func (c *openstackCloud) SetVolumeTags(id string, tags map[string]string) error
 	glog.V(4).Infof("setting tags to cinder volume %q: %v", id, tags)
 
 	opt := cinder.UpdateOpts{Metadata: tags}
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		_, err := cinder.Update(c.cinderClient, id, opt).Extract()
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := cinder.Update(client, id, opt).Extract()
 		if err != nil {
-			return false, fmt.Errorf("error setting tags to cinder volume %q: %v", id, err)
+			return false, fmt.Errorf("error setting tags to cinder volume %q: %v", id, withRequestID(err))
 		}
 		return true, nil
 	})
@@ -115,11 +247,77 @@ func (c *openstackCloud) SetVolumeTags(id string, tags map[string]string) error
 	}
 }
 
-func (c *openstackCloud) DeleteVolume(volumeID string) error {
-	done, err := vfs.RetryWithBackoff(writeBackoff, func() (bool, error) {
-		err := cinder.Delete(c.cinderClient, volumeID, cinder.DeleteOpts{}).ExtractErr()
+// volumeDeletedBackoff is the backoff strategy for waiting until a deleted volume is gone
+var volumeDeletedBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    10,
+}
+
+const (
+	// volumeAvailableTimeout is how long to wait for a new volume to be available,
+	// volumes created from an image take a while to be populated
+	volumeAvailableTimeout = 10 * time.Minute
+	// volumeAttachedTimeout is how long to wait for an attached volume to be in use
+	volumeAttachedTimeout = 2 * time.Minute
+	// volumeDetachedTimeout is how long to wait for a detached volume to be available
+	volumeDetachedTimeout = 2 * time.Minute
+)
+
+// volumeStatusInterval is the interval at which the status of a volume is polled
+var volumeStatusInterval = 2 * time.Second
+
+// volumeResizedBackoff is the backoff strategy for waiting until an extended volume is usable again
+var volumeResizedBackoff = wait.Backoff{
+	Duration: 2 * time.Second,
+	Factor:   1.5,
+	Jitter:   0.1,
+	Steps:    10,
+}
+
+// DeleteVolume deletes the volume. When detach is set the volume is detached from its servers first,
+// cinder refuses to delete a volume which is still attached.
+func (c *openstackCloud) DeleteVolume(volumeID string, detach bool) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	if detach {
+		var attachments []cinder.Attachment
+		done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+			volume, err := cinder.Get(client, volumeID).Extract()
+			if isNotFound(err) {
+				return true, nil
+			}
+			if err != nil {
+				return !isRetryable(err), fmt.Errorf("error getting volume %s: %v", volumeID, withRequestID(err))
+			}
+			attachments = volume.Attachments
+			return true, nil
+		})
+		if err != nil {
+			return err
+		} else if !done {
+			return wait.ErrWaitTimeout
+		}
+		if len(attachments) > 0 {
+			for _, attachment := range attachments {
+				glog.V(2).Infof("detaching volume %s from server %s", volumeID, attachment.ServerID)
+				if err := c.DetachVolume(attachment.ServerID, volumeID); err != nil {
+					return err
+				}
+			}
+			if err := c.WaitForVolumeStatus(volumeID, "available", volumeDetachedTimeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := cinder.Delete(client, volumeID, cinder.DeleteOpts{}).ExtractErr()
 		if err != nil && !isNotFound(err) {
-			return false, fmt.Errorf("error deleting volume: %v", err)
+			return false, fmt.Errorf("error deleting volume: %v", withRequestID(err))
 		}
 		return true, nil
 	})
@@ -131,3 +329,316 @@ func (c *openstackCloud) DeleteVolume(volumeID string) error {
 		return wait.ErrWaitTimeout
 	}
 }
+
+// DetachVolume detaches the volume from the server, a volume which is no longer attached is ignored
+func (c *openstackCloud) DetachVolume(serverID, volumeID string) error {
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		err := volumeattach.Delete(c.ComputeClient(), serverID, volumeID).ExtractErr()
+		if err != nil && !isNotFound(err) {
+			return false, fmt.Errorf("error detaching volume %s from server %s: %v", volumeID, serverID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	} else if done {
+		return nil
+	} else {
+		return wait.ErrWaitTimeout
+	}
+}
+
+// ListOrphanedVolumes returns the volumes tagged for the cluster which are not attached to any existing server
+func (c *openstackCloud) ListOrphanedVolumes(clusterName string) ([]cinder.Volume, error) {
+	if clusterName == "" {
+		return nil, fmt.Errorf("cluster name is required to list orphaned volumes")
+	}
+
+	var volumes []cinder.Volume
+	err := c.EachVolume(cinder.ListOpts{
+		Metadata: map[string]string{TagClusterName: clusterName},
+	}, func(volume cinder.Volume) error {
+		// the metadata filter is not honoured by every cinder release
+		if volume.Metadata[TagClusterName] == clusterName {
+			volumes = append(volumes, volume)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	err = c.EachInstance(servers.ListOpts{}, func(instance servers.Server) error {
+		existing[instance.ID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned []cinder.Volume
+	for _, volume := range volumes {
+		attached := false
+		for _, attachment := range volume.Attachments {
+			if existing[attachment.ServerID] {
+				attached = true
+				break
+			}
+		}
+		if !attached {
+			glog.V(2).Infof("found orphaned volume %s (%s) of cluster %s", volume.Name, volume.ID, clusterName)
+			orphaned = append(orphaned, volume)
+		}
+	}
+	return orphaned, nil
+}
+
+// WaitForVolumeDeleted waits until the volume is no longer known to cinder
+func (c *openstackCloud) WaitForVolumeDeleted(volumeID string) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	done, err := c.retryWithBackoff(volumeDeletedBackoff, func() (bool, error) {
+		v, err := cinder.Get(client, volumeID).Extract()
+		if isNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("error getting volume %s: %v", volumeID, withRequestID(err))
+		}
+		glog.V(4).Infof("waiting for volume %s to be deleted, status is %s", volumeID, v.Status)
+		return false, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
+
+// WaitForVolumeStatus polls the volume until it reaches the status. A volume which reaches an error status,
+// e.g. error or error_extending, is reported as an error instead of waiting for the timeout.
+func (c *openstackCloud) WaitForVolumeStatus(volumeID, status string, timeout time.Duration) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	backoff := wait.Backoff{
+		Duration: volumeStatusInterval,
+		Factor:   1,
+		Steps:    int(timeout/volumeStatusInterval) + 1,
+	}
+	done, err := c.retryWithBackoff(backoff, func() (bool, error) {
+		v, err := cinder.Get(client, volumeID).Extract()
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting volume %s: %v", volumeID, withRequestID(err))
+		}
+		if v.Status == status {
+			return true, nil
+		}
+		if strings.HasPrefix(v.Status, "error") {
+			return true, fmt.Errorf("volume %s is in status %s while waiting for status %s", volumeID, v.Status, status)
+		}
+		glog.V(4).Infof("waiting for volume %s to reach status %s, status is %s", volumeID, status, v.Status)
+		return false, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return fmt.Errorf("volume %s did not reach status %s within %v: %v", volumeID, status, timeout, err)
+	}
+	return err
+}
+
+// WaitForVolumeAvailable waits until the volume is available, a volume which failed to be created is reported as an error
+func (c *openstackCloud) WaitForVolumeAvailable(volumeID string) error {
+	return c.WaitForVolumeStatus(volumeID, "available", volumeAvailableTimeout)
+}
+
+// VolumeType is a Cinder volume type
+type VolumeType struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IsPublic bool   `json:"os-volume-type-access:is_public"`
+	// ExtraSpecs are the extra specs of the volume type which are visible to the project
+	ExtraSpecs map[string]string `json:"extra_specs"`
+}
+
+// SupportsMultiattach returns true if volumes of the type can be attached to several servers at once
+func (t *VolumeType) SupportsMultiattach() bool {
+	return strings.EqualFold(strings.TrimSpace(t.ExtraSpecs["multiattach"]), "<is> True")
+}
+
+// ListVolumeTypes returns the volume types available to the project
+func (c *openstackCloud) ListVolumeTypes() (volumeTypes []VolumeType, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			VolumeTypes []VolumeType `json:"volume_types"`
+		}
+		_, err := client.Get(client.ServiceURL("types"), &r, nil)
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error listing volume types: %v", withRequestID(err))
+		}
+		volumeTypes = r.VolumeTypes
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return volumeTypes, err
+	}
+	return volumeTypes, err
+}
+
+// EncryptionTypeHiddenError is returned by VolumeTypeEncrypted when the policy of the cloud does not let the project
+// read the encryption type of the volume type
+type EncryptionTypeHiddenError struct {
+	TypeID string
+	err    error
+}
+
+func (e *EncryptionTypeHiddenError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("volume type %s: the policy of the cloud hides the encryption type", e.TypeID)
+	}
+	return fmt.Sprintf("volume type %s: the policy of the cloud hides the encryption type (%v)", e.TypeID, e.err)
+}
+
+// IsEncryptionTypeHidden returns true if the error reports that the policy of the cloud hides the encryption type
+func IsEncryptionTypeHidden(err error) bool {
+	_, ok := err.(*EncryptionTypeHiddenError)
+	return ok
+}
+
+// VolumeTypeEncrypted returns true if the volume type has an encryption type, e.g. LUKS, so its volumes are encrypted
+func (c *openstackCloud) VolumeTypeEncrypted(typeID string) (encrypted bool, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return false, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		var r struct {
+			EncryptionID string `json:"encryption_id"`
+			Provider     string `json:"provider"`
+		}
+		_, err := client.Get(client.ServiceURL("types", typeID, "encryption"), &r, nil)
+		if isNotFound(err) {
+			return true, nil
+		}
+		if isForbidden(err) {
+			return true, &EncryptionTypeHiddenError{TypeID: typeID, err: withRequestID(err)}
+		}
+		if err != nil {
+			return !isRetryable(err), fmt.Errorf("error getting the encryption type of volume type %s: %v", typeID, withRequestID(err))
+		}
+		// volume types without an encryption type return an empty object
+		encrypted = r.EncryptionID != "" || r.Provider != ""
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return encrypted, err
+	}
+	return encrypted, err
+}
+
+// GetVolume returns the Cinder volume with the given id
+func (c *openstackCloud) GetVolume(volumeID string) (volume *cinder.Volume, err error) {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return nil, err
+	}
+	done, err := c.retryWithBackoff(c.readBackoff, func() (bool, error) {
+		volume, err = cinder.Get(client, volumeID).Extract()
+		if err != nil {
+			return false, fmt.Errorf("error getting volume %s: %v", volumeID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return volume, err
+	}
+	return volume, err
+}
+
+// ResizeVolume extends the volume to the new size and waits until it is usable again.
+// Volumes can only grow, a smaller size is rejected.
+func (c *openstackCloud) ResizeVolume(volumeID string, newSizeGB int) error {
+	client, err := c.BlockStorageClient()
+	if err != nil {
+		return err
+	}
+	volume, err := c.GetVolume(volumeID)
+	if err != nil {
+		return err
+	}
+	if newSizeGB < volume.Size {
+		return fmt.Errorf("cannot shrink volume %s from %dGB to %dGB, cinder volumes can only be extended", volumeID, volume.Size, newSizeGB)
+	}
+	if newSizeGB == volume.Size {
+		glog.V(2).Infof("volume %s already has size %dGB", volumeID, newSizeGB)
+		return nil
+	}
+
+	glog.V(2).Infof("extending volume %s from %dGB to %dGB", volumeID, volume.Size, newSizeGB)
+	body := map[string]interface{}{
+		"os-extend": map[string]interface{}{
+			"new_size": newSizeGB,
+		},
+	}
+	done, err := c.retryWithBackoff(c.writeBackoff, func() (bool, error) {
+		_, err := client.Post(client.ServiceURL("volumes", volumeID, "action"), body, nil, &gophercloud.RequestOpts{
+			OkCodes: []int{202},
+		})
+		if err != nil {
+			return false, fmt.Errorf("error extending volume %s: %v", volumeID, withRequestID(err))
+		}
+		return true, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	done, err = c.retryWithBackoff(volumeResizedBackoff, func() (bool, error) {
+		v, err := cinder.Get(client, volumeID).Extract()
+		if err != nil {
+			return false, fmt.Errorf("error getting volume %s: %v", volumeID, withRequestID(err))
+		}
+		switch v.Status {
+		case "available", "in-use":
+			return true, nil
+		case "error_extending":
+			return true, fmt.Errorf("error extending volume %s to %dGB", volumeID, newSizeGB)
+		}
+		glog.V(4).Infof("waiting for volume %s to be extended, status is %s", volumeID, v.Status)
+		return false, nil
+	})
+	if !done {
+		if err == nil {
+			err = wait.ErrWaitTimeout
+		}
+		return err
+	}
+	return err
+}
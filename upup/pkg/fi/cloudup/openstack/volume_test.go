@@ -0,0 +1,532 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestListOrphanedVolumes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/volumes/detail":
+			fmt.Fprint(w, `{"volumes": [
+				{"id": "detached", "metadata": {"KubernetesCluster": "my.k8s"}, "attachments": []},
+				{"id": "attached", "metadata": {"KubernetesCluster": "my.k8s"}, "attachments": [{"server_id": "server-1"}]},
+				{"id": "stale-attachment", "metadata": {"KubernetesCluster": "my.k8s"}, "attachments": [{"server_id": "deleted-server"}]},
+				{"id": "other-cluster", "metadata": {"KubernetesCluster": "other.k8s"}, "attachments": []}
+			]}`)
+		case "/servers/detail":
+			fmt.Fprint(w, `{"servers": [{"id": "server-1"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+		novaClient:   newTestServiceClient(server),
+	}
+	volumes, err := c.ListOrphanedVolumes("my.k8s")
+	if err != nil {
+		t.Fatalf("unexpected error listing orphaned volumes: %v", err)
+	}
+
+	var ids []string
+	for _, v := range volumes {
+		ids = append(ids, v.ID)
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[detached stale-attachment]" {
+		t.Errorf("unexpected orphaned volumes %v", ids)
+	}
+}
+
+func TestListOrphanedVolumesRequiresClusterName(t *testing.T) {
+	c := &openstackCloud{}
+	if _, err := c.ListOrphanedVolumes(""); err == nil {
+		t.Errorf("expected error without cluster name")
+	}
+}
+
+func TestDeleteVolumeNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/volumes/vol-1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+	if err := c.DeleteVolume("vol-1", false); err != nil {
+		t.Errorf("expected deleting a missing volume to succeed, got %v", err)
+	}
+}
+
+func TestWaitForVolumeDeleted(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		if polls > 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"volume": {"id": "vol-1", "status": "deleting"}}`)
+	}))
+	defer server.Close()
+
+	defer func(b wait.Backoff) { volumeDeletedBackoff = b }(volumeDeletedBackoff)
+	volumeDeletedBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+	if err := c.WaitForVolumeDeleted("vol-1"); err != nil {
+		t.Fatalf("unexpected error waiting for volume deletion: %v", err)
+	}
+	if polls != 2 {
+		t.Errorf("expected 2 polls, got %d", polls)
+	}
+}
+
+func TestWaitForVolumeAvailable(t *testing.T) {
+	grid := []struct {
+		statuses []string
+		err      bool
+	}{
+		{statuses: []string{"creating", "downloading", "available"}},
+		{statuses: []string{"creating", "error"}, err: true},
+		{statuses: []string{"extending", "error_extending"}, err: true},
+	}
+	defer func(d time.Duration) { volumeStatusInterval = d }(volumeStatusInterval)
+	volumeStatusInterval = time.Millisecond
+
+	for _, g := range grid {
+		polls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"volume": {"id": "vol-1", "status": %q}}`, g.statuses[polls])
+			polls++
+		}))
+
+		c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+		err := c.WaitForVolumeAvailable("vol-1")
+		server.Close()
+		if g.err && err == nil {
+			t.Errorf("expected error waiting for volume with statuses %v", g.statuses)
+		}
+		if !g.err && err != nil {
+			t.Errorf("unexpected error waiting for volume with statuses %v: %v", g.statuses, err)
+		}
+		if polls != len(g.statuses) {
+			t.Errorf("expected %d polls, got %d", len(g.statuses), polls)
+		}
+	}
+}
+
+func TestWaitForVolumeStatusTimeout(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"volume": {"id": "vol-1", "status": "attaching"}}`)
+	}))
+	defer server.Close()
+
+	defer func(d time.Duration) { volumeStatusInterval = d }(volumeStatusInterval)
+	volumeStatusInterval = time.Millisecond
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+	err := c.WaitForVolumeStatus("vol-1", "in-use", 3*time.Millisecond)
+	if err == nil {
+		t.Fatalf("expected error waiting for volume which stays attaching")
+	}
+	if !strings.Contains(err.Error(), "did not reach status in-use") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if polls != 4 {
+		t.Errorf("expected 4 polls, got %d", polls)
+	}
+}
+
+func TestResizeVolume(t *testing.T) {
+	grid := []struct {
+		name        string
+		size        int
+		newSize     int
+		statuses    []string
+		expectError bool
+		expectPost  bool
+	}{
+		{name: "grow available volume", size: 10, newSize: 20, statuses: []string{"extending", "available"}, expectPost: true},
+		{name: "grow attached volume", size: 10, newSize: 20, statuses: []string{"in-use"}, expectPost: true},
+		{name: "same size", size: 10, newSize: 10},
+		{name: "shrink", size: 20, newSize: 10, expectError: true},
+		{name: "extend fails", size: 10, newSize: 20, statuses: []string{"error_extending"}, expectError: true, expectPost: true},
+	}
+
+	defer func(b wait.Backoff) { volumeResizedBackoff = b }(volumeResizedBackoff)
+	volumeResizedBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 5}
+
+	for _, g := range grid {
+		var posted []string
+		polls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodPost {
+				body, _ := ioutil.ReadAll(r.Body)
+				posted = append(posted, r.URL.Path+" "+string(body))
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			status := "available"
+			if len(posted) > 0 && len(g.statuses) > 0 {
+				status = g.statuses[polls]
+				if polls < len(g.statuses)-1 {
+					polls++
+				}
+			}
+			fmt.Fprintf(w, `{"volume": {"id": "vol-1", "size": %d, "status": %q}}`, g.size, status)
+		}))
+
+		c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+		err := c.ResizeVolume("vol-1", g.newSize)
+		server.Close()
+
+		if g.expectError != (err != nil) {
+			t.Errorf("%s: unexpected error result: %v", g.name, err)
+		}
+		if !g.expectPost {
+			if len(posted) != 0 {
+				t.Errorf("%s: expected no extend request, got %v", g.name, posted)
+			}
+			continue
+		}
+		expected := fmt.Sprintf(`/volumes/vol-1/action {"os-extend":{"new_size":%d}}`, g.newSize)
+		if len(posted) != 1 || posted[0] != expected {
+			t.Errorf("%s: expected extend request %q, got %v", g.name, expected, posted)
+		}
+	}
+}
+
+func TestAttachVolumeRequestedDevice(t *testing.T) {
+	grid := []struct {
+		requested   string
+		assigned    string
+		expectWarn  bool
+		expectInReq bool
+	}{
+		{requested: "/dev/vdb", assigned: "/dev/vdb", expectInReq: true},
+		{requested: "/dev/vdb", assigned: "/dev/sdb", expectWarn: true, expectInReq: true},
+		{requested: "", assigned: "/dev/vdc"},
+	}
+	for _, g := range grid {
+		var requestBody string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/volumes/vol-1" {
+				fmt.Fprint(w, `{"volume": {"id": "vol-1", "status": "in-use"}}`)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			requestBody = string(body)
+			fmt.Fprintf(w, `{"volumeAttachment": {"id": "att-1", "volumeId": "vol-1", "serverId": "server-1", "device": %q}}`, g.assigned)
+		}))
+
+		c := &openstackCloud{
+			novaClient:   newTestServiceClient(server),
+			cinderClient: newTestServiceClient(server),
+		}
+		opts := volumeattach.CreateOpts{VolumeID: "vol-1", Device: g.requested}
+		attachment, err := c.AttachVolume("server-1", opts)
+		server.Close()
+		if err != nil {
+			t.Fatalf("unexpected error attaching volume: %v", err)
+		}
+
+		if g.expectInReq != strings.Contains(requestBody, `"device":"/dev/vdb"`) {
+			t.Errorf("requested device %q not passed through correctly: %s", g.requested, requestBody)
+		}
+		warning := attachedDeviceWarning(opts, attachment)
+		if g.expectWarn != (warning != "") {
+			t.Errorf("unexpected warning %q for requested %q and assigned %q", warning, g.requested, g.assigned)
+		}
+	}
+}
+
+func TestDeleteVolumeDetachesFirst(t *testing.T) {
+	var requests []string
+	detached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/volumes/vol-1":
+			if detached {
+				fmt.Fprint(w, `{"volume": {"id": "vol-1", "status": "available", "attachments": []}}`)
+				return
+			}
+			fmt.Fprint(w, `{"volume": {"id": "vol-1", "status": "in-use", "attachments": [{"server_id": "server-1", "volume_id": "vol-1"}]}}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/servers/server-1/os-volume_attachments/vol-1":
+			detached = true
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete && r.URL.Path == "/volumes/vol-1":
+			if !detached {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"badRequest": {"message": "Volume status must be available or error"}}`)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defer func(d time.Duration) { volumeStatusInterval = d }(volumeStatusInterval)
+	volumeStatusInterval = time.Millisecond
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+		novaClient:   newTestServiceClient(server),
+		readBackoff:  wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+		writeBackoff: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+	}
+	if err := c.DeleteVolume("vol-1", true); err != nil {
+		t.Fatalf("unexpected error deleting attached volume: %v", err)
+	}
+	expected := []string{
+		"GET /volumes/vol-1",
+		"DELETE /servers/server-1/os-volume_attachments/vol-1",
+		"GET /volumes/vol-1",
+		"DELETE /volumes/vol-1",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %v, got %v", expected, requests)
+	}
+}
+
+func TestCreateMultiattachVolume(t *testing.T) {
+	grid := []struct {
+		volumeType string
+		err        string
+	}{
+		{volumeType: "multiattach"},
+		{volumeType: "standard", err: `volume type "standard" does not support multiattach`},
+		{volumeType: "", err: "require a volume type"},
+		{volumeType: "missing", err: `volume type "missing" not found`},
+	}
+	for _, g := range grid {
+		var body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/types":
+				fmt.Fprint(w, `{"volume_types": [
+					{"id": "type-1", "name": "standard", "extra_specs": {}},
+					{"id": "type-2", "name": "multiattach", "extra_specs": {"multiattach": "<is> True"}}
+				]}`)
+			case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/encryption"):
+				fmt.Fprint(w, `{}`)
+			case r.Method == http.MethodPost && r.URL.Path == "/volumes":
+				b, _ := ioutil.ReadAll(r.Body)
+				body = string(b)
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprint(w, `{"volume": {"id": "vol-1", "multiattach": true}}`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		c := &openstackCloud{
+			cinderClient: newTestServiceClient(server),
+			readBackoff:  wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+			writeBackoff: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+		}
+		_, err := c.CreateVolume(MultiattachCreateOpts{
+			CreateOptsBuilder: cinder.CreateOpts{Size: 1, VolumeType: g.volumeType},
+			Multiattach:       true,
+		})
+		server.Close()
+
+		if g.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", g.volumeType, err)
+			}
+			if !strings.Contains(body, `"multiattach":true`) {
+				t.Errorf("%q: expected a multiattach volume to be requested, got %s", g.volumeType, body)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), g.err) {
+			t.Errorf("%q: expected error %q, got %v", g.volumeType, g.err, err)
+		}
+		if body != "" {
+			t.Errorf("%q: expected no volume to be created, got %s", g.volumeType, body)
+		}
+	}
+}
+
+func TestVolumeTypeEncrypted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/types/type-1/encryption":
+			fmt.Fprint(w, `{}`)
+		case "/types/type-2/encryption":
+			fmt.Fprint(w, `{"volume_type_id": "type-2", "encryption_id": "enc-1", "provider": "luks", "control_location": "front-end"}`)
+		case "/types/type-3/encryption":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{
+		cinderClient: newTestServiceClient(server),
+		readBackoff:  wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+	}
+	for typeID, expected := range map[string]bool{"type-1": false, "type-2": true, "type-4": false} {
+		encrypted, err := c.VolumeTypeEncrypted(typeID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", typeID, err)
+		}
+		if encrypted != expected {
+			t.Errorf("%s: expected encrypted %v, got %v", typeID, expected, encrypted)
+		}
+	}
+	if _, err := c.VolumeTypeEncrypted("type-3"); !IsEncryptionTypeHidden(err) {
+		t.Errorf("expected the hidden encryption type to be reported, got %v", err)
+	}
+}
+
+func TestAttachVolumeToSecondServer(t *testing.T) {
+	grid := []struct {
+		serverID     string
+		multiattach  bool
+		microversion string
+		err          string
+		expectPost   bool
+	}{
+		{serverID: "server-2", multiattach: true, microversion: "2.60", expectPost: true},
+		{serverID: "server-2", multiattach: true, err: "requires compute microversion 2.60"},
+		{serverID: "server-2", microversion: "2.60", err: "not a multiattach volume"},
+		{serverID: "server-1", microversion: "2.60"},
+	}
+	for _, g := range grid {
+		posted := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/volumes/vol-1" {
+				fmt.Fprintf(w, `{"volume": {"id": "vol-1", "status": "in-use", "multiattach": %v,
+					"attachments": [{"id": "vol-1", "server_id": "server-1", "device": "/dev/vdb"}]}}`, g.multiattach)
+				return
+			}
+			posted = true
+			fmt.Fprintf(w, `{"volumeAttachment": {"id": "vol-1", "volumeId": "vol-1", "serverId": %q, "device": "/dev/vdc"}}`, g.serverID)
+		}))
+
+		nova := newTestServiceClient(server)
+		nova.Microversion = g.microversion
+		c := &openstackCloud{
+			novaClient:   nova,
+			cinderClient: newTestServiceClient(server),
+			readBackoff:  wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+			writeBackoff: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+		}
+		attachment, err := c.AttachVolume(g.serverID, volumeattach.CreateOpts{VolumeID: "vol-1"})
+		server.Close()
+
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("expected error %q, got %v", g.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("unexpected error attaching volume to %s: %v", g.serverID, err)
+		} else if attachment.ServerID != g.serverID {
+			t.Errorf("expected attachment to %s, got %+v", g.serverID, attachment)
+		}
+		if posted != g.expectPost {
+			t.Errorf("%s: expected attach request %v, got %v", g.serverID, g.expectPost, posted)
+		}
+	}
+}
+
+func TestEachVolumeStopsEarly(t *testing.T) {
+	var requests []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("marker") == "" {
+			fmt.Fprintf(w, `{"volumes": [{"id": "vol-1"}, {"id": "vol-2"}], "volumes_links": [{"rel": "next", "href": "%s/volumes/detail?marker=vol-2"}]}`, server.URL)
+			return
+		}
+		fmt.Fprint(w, `{"volumes": [{"id": "vol-3"}, {"id": "vol-4"}]}`)
+	}))
+	defer server.Close()
+
+	c := &openstackCloud{cinderClient: newTestServiceClient(server)}
+
+	var seen []string
+	err := c.EachVolume(cinder.ListOpts{}, func(volume cinder.Volume) error {
+		seen = append(seen, volume.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"vol-1", "vol-2", "vol-3", "vol-4"}) {
+		t.Errorf("expected the volumes of both pages, got %v", seen)
+	}
+
+	requests, seen = nil, nil
+	stop := fmt.Errorf("stop")
+	err = c.EachVolume(cinder.ListOpts{}, func(volume cinder.Volume) error {
+		seen = append(seen, volume.ID)
+		if volume.ID == "vol-1" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("expected the error of the callback, got %v", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"vol-1"}) {
+		t.Errorf("expected the iteration to stop after vol-1, got %v", seen)
+	}
+	if len(requests) != 1 {
+		t.Errorf("expected the second page not to be requested, got requests %v", requests)
+	}
+}
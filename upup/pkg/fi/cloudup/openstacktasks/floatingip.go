@@ -221,22 +221,37 @@ func (f *FloatingIP) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, chan
 
 		if e.LB != nil {
 			//Layer 3
-
-			opts := l3floatingip.CreateOpts{
-				FloatingNetworkID: external.ID,
-				PortID:            fi.StringValue(e.LB.PortID),
+			// the VIP of the loadbalancer is a port, not a server, so the floating IP is associated to the port
+			portID := fi.StringValue(e.LB.PortID)
+			if portID == "" {
+				return fmt.Errorf("Failed to associate floating IP %s: loadbalancer %s has no VIP port", fi.StringValue(e.Name), fi.StringValue(e.LB.Name))
 			}
+
 			lbSubnet, err := cloud.GetLBFloatingSubnet()
 			if err != nil {
 				return fmt.Errorf("Failed to find floatingip subnet: %v", err)
 			}
 			if lbSubnet != nil {
-				opts.SubnetID = lbSubnet.ID
+				// a floating IP of a specific subnet can not be reused, it is allocated on the port
+				fip, err := cloud.CreateL3FloatingIP(l3floatingip.CreateOpts{
+					FloatingNetworkID: external.ID,
+					SubnetID:          lbSubnet.ID,
+					PortID:            portID,
+				})
+				if err != nil {
+					return fmt.Errorf("Failed to create floating IP: %v", err)
+				}
+				e.ID = fi.String(fip.ID)
+				return nil
 			}
-			fip, err := cloud.CreateL3FloatingIP(opts)
+
+			fip, err := cloud.EnsureFloatingIP(external.ID)
 			if err != nil {
 				return fmt.Errorf("Failed to create floating IP: %v", err)
 			}
+			if err := cloud.AssociateL3FloatingIPToPort(fip.ID, portID); err != nil {
+				return fmt.Errorf("Failed to associate floating IP to loadbalancer %s: %v", fi.StringValue(e.LB.Name), err)
+			}
 
 			e.ID = fi.String(fip.ID)
 
@@ -260,14 +275,12 @@ func (f *FloatingIP) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, chan
 				}
 			}
 
-			fip, err := cloud.CreateFloatingIP(floatingips.CreateOpts{
-				Pool: external.Name,
-			})
+			fip, err := cloud.EnsureFloatingIP(external.ID)
 			if err != nil {
 				return fmt.Errorf("Failed to create floating IP: %v", err)
 			}
 			err = cloud.AssociateFloatingIPToInstance(fi.StringValue(e.Server.ID), floatingips.AssociateOpts{
-				FloatingIP: fip.IP,
+				FloatingIP: fip.FloatingIP,
 			})
 			if err != nil {
 				return fmt.Errorf("Failed to associated floating IP to instance %s: %v", *e.Name, err)
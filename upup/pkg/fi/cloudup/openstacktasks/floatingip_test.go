@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"testing"
+
+	l3floatingip "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestFloatingIPAssociatesLBVipPort(t *testing.T) {
+	cloud := &mockCloud{
+		externalNetwork: &networks.Network{ID: "ext-net", Name: "public"},
+		floatingIPs: []l3floatingip.FloatingIP{
+			{ID: "fip-1", FloatingNetworkID: "ext-net", PortID: "port-1"},
+			{ID: "fip-2", FloatingNetworkID: "ext-net"},
+		},
+	}
+	e := &FloatingIP{
+		Name: fi.String("fip-api"),
+		LB:   &LB{Name: fi.String("api"), ID: fi.String("lb-1"), PortID: fi.String("vip-port")},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fi.StringValue(e.ID) != "fip-2" {
+		t.Errorf("expected the unassociated floating ip to be reused, got %q", fi.StringValue(e.ID))
+	}
+	if cloud.floatingIPs[1].PortID != "vip-port" {
+		t.Errorf("expected floating ip to be associated to the VIP port, got %q", cloud.floatingIPs[1].PortID)
+	}
+	if len(cloud.floatingIPs) != 2 {
+		t.Errorf("expected no floating ip to be allocated, got %d floating ips", len(cloud.floatingIPs))
+	}
+}
+
+func TestFloatingIPRequiresLBVipPort(t *testing.T) {
+	cloud := &mockCloud{
+		externalNetwork: &networks.Network{ID: "ext-net", Name: "public"},
+	}
+	e := &FloatingIP{
+		Name: fi.String("fip-api"),
+		LB:   &LB{Name: fi.String("api"), ID: fi.String("lb-1")},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err == nil {
+		t.Errorf("expected an error without a VIP port")
+	}
+	if len(cloud.floatingIPs) != 0 {
+		t.Errorf("expected no floating ip to be allocated, got %d floating ips", len(cloud.floatingIPs))
+	}
+}
@@ -17,12 +17,20 @@ limitations under the License.
 package openstacktasks
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/schedulerhints"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
@@ -42,6 +50,26 @@ type Instance struct {
 	UserData         *string
 	Metadata         map[string]string
 	AvailabilityZone *string
+	ConfigDrive      *bool
+	// Description is the human-readable description of the server, only set when the
+	// compute API microversion supports it
+	Description *string
+	// BootVolumeSize boots the server from a Cinder volume of the given size in GB created from the image,
+	// the server boots from the image directly when not set
+	BootVolumeSize *int
+	// BootVolumeType is the volume type of the boot volume
+	BootVolumeType *string
+	// BootVolumeDeleteOnTermination deletes the boot volume together with the server
+	BootVolumeDeleteOnTermination *bool
+	// AdditionalSecurityGroups are the names or IDs of existing security groups which are attached to the server
+	// in addition to the security groups managed by kops
+	AdditionalSecurityGroups []string
+	// SchedulerHints are passed to the scheduler together with the server group, hints unknown to kops
+	// are passed through unchanged for the custom filters of the cloud
+	SchedulerHints map[string]string
+	// Status is the nova status of the server, a server which has been shut off is started again
+	// when StartStoppedInstances is enabled
+	Status *string
 
 	Lifecycle *fi.Lifecycle
 }
@@ -56,6 +84,10 @@ func (e *Instance) GetDependencies(tasks map[string]fi.Task) []fi.Task {
 		if _, ok := task.(*Port); ok {
 			deps = append(deps, task)
 		}
+		// the trunk is created on the port before the instance is bound to it
+		if _, ok := task.(*Trunk); ok {
+			deps = append(deps, task)
+		}
 	}
 	return deps
 }
@@ -98,6 +130,14 @@ func (e *Instance) Find(c *fi.Context) (*Instance, error) {
 		SSHKey:           fi.String(server.KeyName),
 		Lifecycle:        e.Lifecycle,
 		AvailabilityZone: e.AvailabilityZone,
+		ConfigDrive:      e.ConfigDrive,
+
+		BootVolumeSize:                e.BootVolumeSize,
+		BootVolumeType:                e.BootVolumeType,
+		BootVolumeDeleteOnTermination: e.BootVolumeDeleteOnTermination,
+		AdditionalSecurityGroups:      e.AdditionalSecurityGroups,
+		SchedulerHints:                e.SchedulerHints,
+		Status:                        actualStatus(server.Status, e.Status),
 	}
 	e.ID = actual.ID
 
@@ -113,6 +153,9 @@ func (_ *Instance) CheckChanges(a, e, changes *Instance) error {
 		if e.Name == nil {
 			return fi.RequiredField("Name")
 		}
+		if _, err := buildSchedulerHints("", e.SchedulerHints); err != nil {
+			return fmt.Errorf("invalid scheduler hints of instance %q: %v", fi.StringValue(e.Name), err)
+		}
 	} else {
 		if changes.ID != nil {
 			return fi.CannotChangeField("ID")
@@ -124,25 +167,57 @@ func (_ *Instance) CheckChanges(a, e, changes *Instance) error {
 	return nil
 }
 
+// ShouldCreate creates missing instances and starts stopped ones, other changes of existing instances are ignored
 func (_ *Instance) ShouldCreate(a, e, changes *Instance) (bool, error) {
-	return a == nil, nil
+	return a == nil || changes.Status != nil, nil
+}
+
+// actualStatus returns the status of the existing server as compared with the expected status. Only a server
+// which has been shut off differs, and only when StartStoppedInstances is enabled, other states such as a
+// rebuild in progress are left alone.
+func actualStatus(status string, expected *string) *string {
+	if status == openstack.InstanceStatusShutoff && openstack.StartStoppedInstances.Enabled() {
+		return fi.String(status)
+	}
+	return expected
 }
 
 func (_ *Instance) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *Instance) error {
 	if a == nil {
 		glog.V(2).Infof("Creating Instance with name: %q", fi.StringValue(e.Name))
 
+		// an unknown flavor or image is reported before anything is created for the instance
+		flavor, err := t.Cloud.GetFlavor(fi.StringValue(e.Flavor))
+		if err != nil {
+			return fmt.Errorf("invalid machine type of instance %q: %v", fi.StringValue(e.Name), err)
+		}
+		image, err := t.Cloud.GetImage(fi.StringValue(e.Image))
+		if err != nil {
+			return fmt.Errorf("invalid image of instance %q: %v", fi.StringValue(e.Name), err)
+		}
+		additionalSGs, err := resolveSecurityGroups(t.Cloud, e.AdditionalSecurityGroups)
+		if err != nil {
+			return fmt.Errorf("invalid additional security groups of instance %q: %v", fi.StringValue(e.Name), err)
+		}
+		if len(additionalSGs) > 0 {
+			if err := e.addPortSecurityGroups(t.Cloud, additionalSGs); err != nil {
+				return err
+			}
+		}
+
 		opt := servers.CreateOpts{
-			Name:       fi.StringValue(e.Name),
-			ImageName:  fi.StringValue(e.Image),
-			FlavorName: fi.StringValue(e.Flavor),
+			Name:      fi.StringValue(e.Name),
+			ImageRef:  image.ID,
+			FlavorRef: flavor.ID,
 			Networks: []servers.Network{
 				{
 					Port: fi.StringValue(e.Port.ID),
 				},
 			},
-			Metadata:      e.Metadata,
-			ServiceClient: t.Cloud.ComputeClient(),
+			Metadata:       e.Metadata,
+			ConfigDrive:    e.ConfigDrive,
+			SecurityGroups: additionalSGs,
+			ServiceClient:  t.Cloud.ComputeClient(),
 		}
 		if e.UserData != nil {
 			opt.UserData = []byte(*e.UserData)
@@ -150,16 +225,47 @@ func (_ *Instance) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, change
 		if e.AvailabilityZone != nil {
 			opt.AvailabilityZone = fi.StringValue(e.AvailabilityZone)
 		}
+		var bootVolume *cinder.Volume
+		if e.BootVolumeSize != nil {
+			v, err := e.createBootVolume(t, image.ID)
+			if err != nil {
+				return err
+			}
+			bootVolume = v
+			opt.ImageRef = ""
+		}
 		keyext := keypairs.CreateOptsExt{
 			CreateOptsBuilder: opt,
 			KeyName:           openstackKeyPairName(fi.StringValue(e.SSHKey)),
 		}
 
+		var createOpts servers.CreateOptsBuilder = keyext
+		if e.Description != nil {
+			if supportsServerDescription(t.Cloud.ComputeClient()) {
+				createOpts = descriptionCreateOptsExt{
+					CreateOptsBuilder: keyext,
+					Description:       fi.StringValue(e.Description),
+				}
+			} else {
+				glog.V(4).Infof("Compute API microversion does not support server descriptions, not setting description of %q", fi.StringValue(e.Name))
+			}
+		}
+
+		if bootVolume != nil {
+			createOpts = bootVolumeCreateOptsExt{
+				CreateOptsBuilder:   createOpts,
+				VolumeID:            bootVolume.ID,
+				DeleteOnTermination: fi.BoolValue(e.BootVolumeDeleteOnTermination),
+			}
+		}
+
+		hints, err := buildSchedulerHints(fi.StringValue(e.ServerGroup.ID), e.SchedulerHints)
+		if err != nil {
+			return fmt.Errorf("invalid scheduler hints of instance %q: %v", fi.StringValue(e.Name), err)
+		}
 		sgext := schedulerhints.CreateOptsExt{
-			CreateOptsBuilder: keyext,
-			SchedulerHints: &schedulerhints.SchedulerHints{
-				Group: *e.ServerGroup.ID,
-			},
+			CreateOptsBuilder: createOpts,
+			SchedulerHints:    hints,
 		}
 		v, err := t.Cloud.CreateInstance(sgext)
 		if err != nil {
@@ -173,6 +279,252 @@ func (_ *Instance) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, change
 		return nil
 	}
 
+	if changes.Status != nil {
+		glog.Infof("Starting server %s which was found in %s state", fi.StringValue(a.ID), fi.StringValue(a.Status))
+		if err := t.Cloud.StartInstance(fi.StringValue(a.ID)); err != nil {
+			return fmt.Errorf("error starting instance %q: %v", fi.StringValue(e.Name), err)
+		}
+		return nil
+	}
+
 	glog.V(2).Infof("Openstack task Instance::RenderOpenstack did nothing")
 	return nil
 }
+
+// The scheduler hints known to Nova, other hints are only understood by custom filters of the cloud
+const (
+	schedulerHintGroup           = "group"
+	schedulerHintDifferentHost   = "different_host"
+	schedulerHintSameHost        = "same_host"
+	schedulerHintQuery           = "query"
+	schedulerHintTargetCell      = "target_cell"
+	schedulerHintBuildNearHostIP = "build_near_host_ip"
+	schedulerHintCIDR            = "cidr"
+)
+
+// buildSchedulerHints returns the scheduler hints of the server group merged with the additional hints.
+// The known hints are validated like gophercloud does when creating the server, the hints unknown to kops
+// are passed through unchanged.
+func buildSchedulerHints(group string, hints map[string]string) (*schedulerhints.SchedulerHints, error) {
+	r := &schedulerhints.SchedulerHints{Group: group}
+	for k, v := range hints {
+		switch k {
+		case schedulerHintGroup:
+			return nil, fmt.Errorf("the %s hint is set from the server group of the instance group", k)
+		case schedulerHintDifferentHost, schedulerHintSameHost:
+			var ids []string
+			for _, id := range strings.Split(v, ",") {
+				ids = append(ids, strings.TrimSpace(id))
+			}
+			if k == schedulerHintDifferentHost {
+				r.DifferentHost = ids
+			} else {
+				r.SameHost = ids
+			}
+		case schedulerHintQuery:
+			var query []interface{}
+			if err := json.Unmarshal([]byte(v), &query); err != nil {
+				return nil, fmt.Errorf("the %s hint must be a JSON condition like [\">=\", \"$free_ram_mb\", 1024], got %q", k, v)
+			}
+			r.Query = query
+		case schedulerHintTargetCell:
+			if v == "" {
+				return nil, fmt.Errorf("the %s hint must not be empty", k)
+			}
+			r.TargetCell = v
+		case schedulerHintBuildNearHostIP:
+			r.BuildNearHostIP = v
+		case schedulerHintCIDR:
+			return nil, fmt.Errorf("the %s hint is set from the subnet of the %s hint", k, schedulerHintBuildNearHostIP)
+		default:
+			if r.AdditionalProperties == nil {
+				r.AdditionalProperties = make(map[string]interface{})
+			}
+			r.AdditionalProperties[k] = v
+		}
+	}
+	if _, err := r.ToServerSchedulerHintsCreateMap(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// resolveSecurityGroups returns the IDs of the security groups given by name or ID, failing with the
+// valid security groups if one does not exist
+func resolveSecurityGroups(cloud openstack.OpenstackCloud, namesOrIDs []string) ([]string, error) {
+	if len(namesOrIDs) == 0 {
+		return nil, nil
+	}
+	groups, err := cloud.ListSecurityGroups(sg.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing security groups: %v", err)
+	}
+	var ids []string
+	for _, nameOrID := range namesOrIDs {
+		var found []string
+		for _, group := range groups {
+			if group.ID == nameOrID {
+				found = []string{group.ID}
+				break
+			}
+			if group.Name == nameOrID {
+				found = append(found, group.ID)
+			}
+		}
+		switch len(found) {
+		case 0:
+			var names []string
+			for _, group := range groups {
+				names = append(names, group.Name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("security group %q not found, valid security groups are: %s", nameOrID, strings.Join(names, ", "))
+		case 1:
+			ids = append(ids, found[0])
+		default:
+			return nil, fmt.Errorf("found multiple security groups with name %q, use the ID of the security group instead", nameOrID)
+		}
+	}
+	return ids, nil
+}
+
+// addPortSecurityGroups adds the security groups to the port of the instance, Nova only applies the security
+// groups of the server to the ports it creates itself. The Port task ignores the additional security groups.
+func (e *Instance) addPortSecurityGroups(cloud openstack.OpenstackCloud, sgIDs []string) error {
+	portID := fi.StringValue(e.Port.ID)
+	port, err := cloud.GetPort(portID)
+	if err != nil {
+		return fmt.Errorf("error getting port of instance %q: %v", fi.StringValue(e.Name), err)
+	}
+	if port == nil {
+		return fmt.Errorf("port %s of instance %q not found", portID, fi.StringValue(e.Name))
+	}
+	groups := sets.NewString(port.SecurityGroups...)
+	if groups.HasAll(sgIDs...) {
+		return nil
+	}
+	merged := append([]string{}, port.SecurityGroups...)
+	for _, id := range sgIDs {
+		if !groups.Has(id) {
+			groups.Insert(id)
+			merged = append(merged, id)
+		}
+	}
+	glog.V(2).Infof("Adding security groups %v to port %s of instance %q", sgIDs, portID, fi.StringValue(e.Name))
+	if _, err := cloud.UpdatePort(portID, ports.UpdateOpts{SecurityGroups: &merged}); err != nil {
+		return fmt.Errorf("error adding security groups to port %s: %v", portID, err)
+	}
+	return nil
+}
+
+// bootVolumeName returns the name of the boot volume of the server
+func bootVolumeName(serverName string) string {
+	return serverName + "-root"
+}
+
+// createBootVolume creates the volume the server boots from, populated from the image of the server, and
+// waits until it is available. A boot volume left behind by an earlier failed attempt is reused.
+func (e *Instance) createBootVolume(t *openstack.OpenstackAPITarget, imageID string) (*cinder.Volume, error) {
+	name := bootVolumeName(fi.StringValue(e.Name))
+	volumes, err := t.Cloud.ListVolumes(cinder.ListOpts{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("error listing boot volumes: %v", err)
+	}
+	for i := range volumes {
+		if volumes[i].Name == name && len(volumes[i].Attachments) == 0 {
+			glog.V(2).Infof("Reusing boot volume %s of instance %q", volumes[i].ID, fi.StringValue(e.Name))
+			return &volumes[i], t.Cloud.WaitForVolumeAvailable(volumes[i].ID)
+		}
+	}
+
+	if e.BootVolumeType != nil {
+		if err := validateVolumeType(t.Cloud, fi.StringValue(e.BootVolumeType)); err != nil {
+			return nil, err
+		}
+	}
+	opt := cinder.CreateOpts{
+		Name:       name,
+		Size:       fi.IntValue(e.BootVolumeSize),
+		VolumeType: fi.StringValue(e.BootVolumeType),
+		ImageID:    imageID,
+	}
+	if clusterName := e.Metadata[openstack.TagServerClusterName]; clusterName != "" {
+		opt.Metadata = map[string]string{openstack.TagClusterName: clusterName}
+	}
+	zone, err := storageZone(t.Cloud, e.AvailabilityZone)
+	if err != nil {
+		return nil, err
+	}
+	opt.AvailabilityZone = zone
+
+	glog.V(2).Infof("Creating boot volume %q of instance %q", name, fi.StringValue(e.Name))
+	v, err := t.Cloud.CreateVolume(opt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating boot volume: %v", err)
+	}
+	if err := t.Cloud.WaitForVolumeAvailable(v.ID); err != nil {
+		return nil, fmt.Errorf("error waiting for boot volume %s: %v", v.ID, err)
+	}
+	return v, nil
+}
+
+// bootVolumeCreateOptsExt boots the server from a volume
+type bootVolumeCreateOptsExt struct {
+	servers.CreateOptsBuilder
+	VolumeID            string
+	DeleteOnTermination bool
+}
+
+// ToServerCreateMap adds the block device mapping of the boot volume to the base server creation options
+func (opts bootVolumeCreateOptsExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	// the image is copied to the volume, the server itself has no image
+	delete(serverMap, "imageRef")
+	serverMap["block_device_mapping_v2"] = []map[string]interface{}{
+		{
+			"uuid":                  opts.VolumeID,
+			"source_type":           "volume",
+			"destination_type":      "volume",
+			"boot_index":            0,
+			"delete_on_termination": opts.DeleteOnTermination,
+		},
+	}
+
+	return base, nil
+}
+
+// serverDescriptionMicroversion is the first compute API microversion accepting a server description
+const serverDescriptionMicroversion = "2.19"
+
+// supportsServerDescription returns true if the compute client requests a microversion
+// which accepts a server description
+func supportsServerDescription(client *gophercloud.ServiceClient) bool {
+	if client == nil {
+		return false
+	}
+	return openstack.CompareMicroversion(client.Microversion, serverDescriptionMicroversion) >= 0
+}
+
+// descriptionCreateOptsExt adds a description to the server create request
+type descriptionCreateOptsExt struct {
+	servers.CreateOptsBuilder
+	Description string
+}
+
+// ToServerCreateMap adds the description to the base server creation options
+func (opts descriptionCreateOptsExt) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	serverMap := base["server"].(map[string]interface{})
+	serverMap["description"] = opts.Description
+
+	return base, nil
+}
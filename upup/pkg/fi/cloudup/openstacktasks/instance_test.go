@@ -0,0 +1,325 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/pkg/featureflag"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func renderDescribedInstance(t *testing.T, microversion string) map[string]interface{} {
+	cloud := &mockCloud{
+		computeClient: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Microversion:   microversion,
+		},
+	}
+	e := &Instance{
+		Name:        fi.String("nodes-1"),
+		Flavor:      fi.String("m1.small"),
+		Image:       fi.String("ubuntu"),
+		Port:        &Port{ID: fi.String("port-1")},
+		ServerGroup: &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:      fi.String("key"),
+		Description: fi.String("kops node instance"),
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error rendering instance: %v", err)
+	}
+	if len(cloud.serverRequests) != 1 {
+		t.Fatalf("expected one server to be created, got %d", len(cloud.serverRequests))
+	}
+	return cloud.serverRequests[0]["server"].(map[string]interface{})
+}
+
+func TestInstanceDescriptionSupported(t *testing.T) {
+	body := renderDescribedInstance(t, "2.19")
+	if body["description"] != "kops node instance" {
+		t.Errorf("expected description to be set, got %v", body["description"])
+	}
+}
+
+func TestInstanceDescriptionUnsupported(t *testing.T) {
+	body := renderDescribedInstance(t, "")
+	if _, found := body["description"]; found {
+		t.Errorf("expected description to be omitted, got %v", body["description"])
+	}
+}
+
+func TestInstanceBootFromVolume(t *testing.T) {
+	cloud := &mockCloud{}
+	e := &Instance{
+		Name:                          fi.String("nodes-1"),
+		Flavor:                        fi.String("m1.small"),
+		Image:                         fi.String("ubuntu"),
+		Port:                          &Port{ID: fi.String("port-1")},
+		ServerGroup:                   &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:                        fi.String("key"),
+		AvailabilityZone:              fi.String("zone-1"),
+		Metadata:                      map[string]string{openstack.TagServerClusterName: "my.k8s.local"},
+		BootVolumeSize:                fi.Int(20),
+		BootVolumeType:                fi.String("fast-ssd"),
+		BootVolumeDeleteOnTermination: fi.Bool(true),
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error rendering instance: %v", err)
+	}
+
+	if len(cloud.volumes) != 1 {
+		t.Fatalf("expected one boot volume to be created, got %d", len(cloud.volumes))
+	}
+	volume := cloud.volumes[0]
+	if volume.Name != "nodes-1-root" || volume.Size != 20 || volume.VolumeType != "fast-ssd" || volume.AvailabilityZone != "zone-1" {
+		t.Errorf("unexpected boot volume %+v", volume)
+	}
+	if volume.Metadata[openstack.TagClusterName] != "my.k8s.local" {
+		t.Errorf("expected boot volume to be tagged with the cluster, got %v", volume.Metadata)
+	}
+
+	body := cloud.serverRequests[0]["server"].(map[string]interface{})
+	if _, found := body["imageRef"]; found {
+		t.Errorf("expected no image reference when booting from volume, got %v", body["imageRef"])
+	}
+	mappings := body["block_device_mapping_v2"].([]map[string]interface{})
+	if len(mappings) != 1 || mappings[0]["uuid"] != volume.ID || mappings[0]["boot_index"] != 0 || mappings[0]["delete_on_termination"] != true {
+		t.Errorf("unexpected block device mapping %v", mappings)
+	}
+}
+
+func TestInstanceBootVolumeZone(t *testing.T) {
+	grid := []struct {
+		computeZone  *string
+		storageZones []string
+		expected     string
+		valid        bool
+	}{
+		{computeZone: fi.String("zone-2"), storageZones: []string{"zone-1", "zone-2"}, expected: "zone-2", valid: true},
+		// a single cinder zone serves all compute zones
+		{computeZone: fi.String("zone-2"), storageZones: []string{"nova"}, expected: "nova", valid: true},
+		// without a compute zone cinder picks its default zone
+		{computeZone: nil, storageZones: []string{"zone-1", "zone-2"}, expected: "", valid: true},
+		{computeZone: fi.String("zone-3"), storageZones: []string{"zone-1", "zone-2"}},
+	}
+	for _, g := range grid {
+		cloud := &mockCloud{storageZones: g.storageZones}
+		e := &Instance{
+			Name:             fi.String("nodes-1"),
+			Flavor:           fi.String("m1.small"),
+			Image:            fi.String("ubuntu"),
+			Port:             &Port{ID: fi.String("port-1")},
+			ServerGroup:      &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+			SSHKey:           fi.String("key"),
+			AvailabilityZone: g.computeZone,
+			BootVolumeSize:   fi.Int(20),
+		}
+		err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+		if !g.valid {
+			if err == nil {
+				t.Errorf("expected error for compute zone %s with storage zones %v", fi.StringValue(g.computeZone), g.storageZones)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error rendering instance: %v", err)
+		}
+		if len(cloud.volumes) != 1 || cloud.volumes[0].AvailabilityZone != g.expected {
+			t.Errorf("expected boot volume in zone %q for compute zone %s, got %+v", g.expected, fi.StringValue(g.computeZone), cloud.volumes)
+		}
+	}
+}
+
+func TestInstanceUnknownFlavor(t *testing.T) {
+	cloud := &mockCloud{}
+	e := &Instance{
+		Name:           fi.String("nodes-1"),
+		Flavor:         fi.String("m1.smal"),
+		Image:          fi.String("ubuntu"),
+		Port:           &Port{ID: fi.String("port-1")},
+		ServerGroup:    &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:         fi.String("key"),
+		BootVolumeSize: fi.Int(20),
+	}
+	err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+	if err == nil || !strings.Contains(err.Error(), `flavor "m1.smal" not found`) {
+		t.Fatalf("expected unknown flavor error, got %v", err)
+	}
+	if len(cloud.volumes) != 0 || len(cloud.serverRequests) != 0 {
+		t.Errorf("expected nothing to be created for an unknown flavor")
+	}
+}
+
+func TestInstanceStartsStoppedServer(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		if enabled {
+			featureflag.ParseFlags("+OpenstackStartStoppedInstances")
+		}
+		cloud := &mockCloud{}
+		e := &Instance{Name: fi.String("nodes-1"), Flavor: fi.String("m1.medium"), Status: fi.String(openstack.InstanceStatusActive)}
+		// Find does not fill in the flavor, a drift which has to be ignored
+		a := &Instance{ID: fi.String("server-1"), Name: fi.String("nodes-1"), Status: actualStatus(openstack.InstanceStatusShutoff, e.Status)}
+
+		changes := &Instance{}
+		fi.BuildChanges(a, e, changes)
+		create, err := e.ShouldCreate(a, e, changes)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if create != enabled {
+			t.Errorf("expected ShouldCreate %v with the feature flag enabled=%v, got %v", enabled, enabled, create)
+		}
+		if !create {
+			continue
+		}
+		if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+			t.Fatalf("unexpected error rendering instance: %v", err)
+		}
+		if !reflect.DeepEqual(cloud.startedServers, []string{"server-1"}) {
+			t.Errorf("expected server-1 to be started, got %v", cloud.startedServers)
+		}
+		if len(cloud.serverRequests) != 0 {
+			t.Errorf("expected no server to be created for an existing instance")
+		}
+	}
+	featureflag.ParseFlags("-OpenstackStartStoppedInstances")
+}
+
+func TestInstanceAdditionalSecurityGroups(t *testing.T) {
+	cloud := &mockCloud{
+		ports: []ports.Port{{ID: "port-1", SecurityGroups: []string{"sg-nodes"}}},
+		securityGroups: []sg.SecGroup{
+			{ID: "sg-nodes", Name: "nodes.my.k8s.local"},
+			{ID: "sg-audit", Name: "org-audit"},
+			{ID: "sg-backup", Name: "org-backup"},
+		},
+	}
+	e := &Instance{
+		Name:                     fi.String("nodes-1"),
+		Flavor:                   fi.String("m1.small"),
+		Image:                    fi.String("ubuntu"),
+		Port:                     &Port{ID: fi.String("port-1")},
+		ServerGroup:              &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:                   fi.String("key"),
+		AdditionalSecurityGroups: []string{"org-audit", "sg-backup"},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error rendering instance: %v", err)
+	}
+
+	expected := []string{"sg-nodes", "sg-audit", "sg-backup"}
+	if !reflect.DeepEqual(cloud.ports[0].SecurityGroups, expected) {
+		t.Errorf("expected port security groups %v, got %v", expected, cloud.ports[0].SecurityGroups)
+	}
+	body := cloud.serverRequests[0]["server"].(map[string]interface{})
+	groups := body["security_groups"].([]map[string]interface{})
+	if len(groups) != 2 || groups[0]["name"] != "sg-audit" || groups[1]["name"] != "sg-backup" {
+		t.Errorf("unexpected server security groups %v", groups)
+	}
+}
+
+func TestInstanceUnknownSecurityGroup(t *testing.T) {
+	cloud := &mockCloud{
+		ports: []ports.Port{{ID: "port-1"}},
+		securityGroups: []sg.SecGroup{
+			{ID: "sg-nodes", Name: "nodes.my.k8s.local"},
+			{ID: "sg-audit", Name: "org-audit"},
+		},
+	}
+	e := &Instance{
+		Name:                     fi.String("nodes-1"),
+		Flavor:                   fi.String("m1.small"),
+		Image:                    fi.String("ubuntu"),
+		Port:                     &Port{ID: fi.String("port-1")},
+		ServerGroup:              &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:                   fi.String("key"),
+		AdditionalSecurityGroups: []string{"org-audi"},
+	}
+	err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+	if err == nil || !strings.Contains(err.Error(), `security group "org-audi" not found, valid security groups are: nodes.my.k8s.local, org-audit`) {
+		t.Fatalf("expected unknown security group error, got %v", err)
+	}
+	if len(cloud.serverRequests) != 0 {
+		t.Errorf("expected no server to be created for an unknown security group")
+	}
+}
+
+func TestInstanceSchedulerHints(t *testing.T) {
+	cloud := &mockCloud{}
+	e := &Instance{
+		Name:        fi.String("master-1"),
+		Flavor:      fi.String("m1.small"),
+		Image:       fi.String("ubuntu"),
+		Port:        &Port{ID: fi.String("port-1")},
+		ServerGroup: &ServerGroup{ID: fi.String("2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1")},
+		SSHKey:      fi.String("key"),
+		SchedulerHints: map[string]string{
+			"different_host": "9c1a3e9e-5bb1-4d0a-9f2a-6b5c7e1d2f30",
+			"aggregate":      "etcd-ssd",
+		},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error rendering instance: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"group":          "2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1",
+		"different_host": []string{"9c1a3e9e-5bb1-4d0a-9f2a-6b5c7e1d2f30"},
+		"aggregate":      "etcd-ssd",
+	}
+	if actual := cloud.serverRequests[0]["os:scheduler_hints"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected scheduler hints %v, got %v", expected, actual)
+	}
+}
+
+func TestBuildSchedulerHints(t *testing.T) {
+	grid := []struct {
+		hints map[string]string
+		err   string
+	}{
+		{hints: map[string]string{"query": `[">=", "$free_ram_mb", 1024]`, "target_cell": "cell1", "build_near_host_ip": "192.168.1.1/24"}},
+		{hints: map[string]string{"custom_filter": "anything goes"}},
+		{hints: map[string]string{"group": "2ae5ac2e-1b02-4d62-8f0a-8e1d5bd0a4b1"}, err: "server group of the instance group"},
+		{hints: map[string]string{"same_host": "master-1"}, err: "UUID format"},
+		{hints: map[string]string{"query": `["$free_ram_mb"]`}, err: "conditional statement"},
+		{hints: map[string]string{"query": `>= $free_ram_mb`}, err: "JSON condition"},
+		{hints: map[string]string{"build_near_host_ip": "192.168.1.1"}, err: "valid subnet"},
+		{hints: map[string]string{"cidr": "/24"}, err: "build_near_host_ip"},
+	}
+	for _, g := range grid {
+		hints, err := buildSchedulerHints("", g.hints)
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("%v: expected error %q, got %v", g.hints, g.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", g.hints, err)
+			continue
+		}
+		if hints == nil {
+			t.Errorf("%v: expected scheduler hints", g.hints)
+		}
+	}
+}
@@ -18,14 +18,13 @@ package openstacktasks
 
 import (
 	"fmt"
-	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/golang/glog"
-	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
@@ -39,50 +38,14 @@ type LB struct {
 	Lifecycle     *fi.Lifecycle
 	PortID        *string
 	SecurityGroup *SecurityGroup
-}
-
-const (
-	// loadbalancerActive* is configuration of exponential backoff for
-	// going into ACTIVE loadbalancer provisioning status. Starting with 1
-	// seconds, multiplying by 1.2 with each step and taking 22 steps at maximum
-	// it will time out after 326s, which roughly corresponds to about 5 minutes
-	loadbalancerActiveInitDelay = 1 * time.Second
-	loadbalancerActiveFactor    = 1.2
-	loadbalancerActiveSteps     = 22
-
-	activeStatus = "ACTIVE"
-	errorStatus  = "ERROR"
-)
-
-func waitLoadbalancerActiveProvisioningStatus(client *gophercloud.ServiceClient, loadbalancerID string) (string, error) {
-	backoff := wait.Backoff{
-		Duration: loadbalancerActiveInitDelay,
-		Factor:   loadbalancerActiveFactor,
-		Steps:    loadbalancerActiveSteps,
-	}
-
-	var provisioningStatus string
-	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		loadbalancer, err := loadbalancers.Get(client, loadbalancerID).Extract()
-		if err != nil {
-			return false, err
-		}
-		provisioningStatus = loadbalancer.ProvisioningStatus
-		if loadbalancer.ProvisioningStatus == activeStatus {
-			return true, nil
-		} else if loadbalancer.ProvisioningStatus == errorStatus {
-			return true, fmt.Errorf("loadbalancer has gone into ERROR state")
-		} else {
-			glog.Infof("Waiting for Loadbalancer to be ACTIVE...")
-			return false, nil
-		}
-
-	})
-
-	if err == wait.ErrWaitTimeout {
-		err = fmt.Errorf("loadbalancer failed to go into ACTIVE provisioning status within allotted time")
-	}
-	return provisioningStatus, err
+	// Provider is the Octavia provider used for the loadbalancer, e.g. amphora or ovn
+	Provider *string
+	// AdminStateUp disables the loadbalancer when false, defaults to true
+	AdminStateUp *bool
+	// AvailabilityZone is the Octavia availability zone of the loadbalancer
+	AvailabilityZone *string
+	// Tags are the Octavia tags identifying the cluster and role of the loadbalancer, tags added by others are kept
+	Tags []string
 }
 
 // GetDependencies returns the dependencies of the Instance task
@@ -119,12 +82,16 @@ func NewLBTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecycle,
 	}
 
 	actual := &LB{
-		ID:        fi.String(lb.ID),
-		Name:      fi.String(lb.Name),
-		Lifecycle: lifecycle,
-		PortID:    fi.String(lb.VipPortID),
-		Subnet:    fi.String(sub.Name),
-		VipSubnet: fi.String(lb.VipSubnetID),
+		ID:           fi.String(lb.ID),
+		Name:         fi.String(lb.Name),
+		Lifecycle:    lifecycle,
+		PortID:       fi.String(lb.VipPortID),
+		Subnet:       fi.String(sub.Name),
+		VipSubnet:    fi.String(lb.VipSubnetID),
+		AdminStateUp: fi.Bool(lb.AdminStateUp),
+	}
+	if lb.Provider != "" {
+		actual.Provider = fi.String(lb.Provider)
 	}
 
 	if find != nil {
@@ -141,16 +108,15 @@ func (s *LB) Find(context *fi.Context) (*LB, error) {
 	}
 
 	cloud := context.Cloud.(openstack.OpenstackCloud)
-	lbPage, err := loadbalancers.List(cloud.LoadBalancerClient(), loadbalancers.ListOpts{
+	if err := dropUnsupportedLBTags(cloud, &s.Tags); err != nil {
+		return nil, err
+	}
+	lbs, err := cloud.ListLBs(loadbalancers.ListOpts{
 		Name: fi.StringValue(s.Name),
-	}).AllPages()
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to retrieve loadbalancers for name %s: %v", fi.StringValue(s.Name), err)
 	}
-	lbs, err := loadbalancers.ExtractLoadBalancers(lbPage)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to extract loadbalancers : %v", err)
-	}
 	if len(lbs) == 0 {
 		return nil, nil
 	}
@@ -158,7 +124,23 @@ func (s *LB) Find(context *fi.Context) (*LB, error) {
 		return nil, fmt.Errorf("Multiple load balancers for name %s", fi.StringValue(s.Name))
 	}
 
-	return NewLBTaskFromCloud(cloud, s.Lifecycle, &lbs[0], s)
+	actual, err := NewLBTaskFromCloud(cloud, s.Lifecycle, &lbs[0], s)
+	if err != nil {
+		return nil, err
+	}
+	if s.AvailabilityZone != nil {
+		zone, err := cloud.GetLBAvailabilityZone(lbs[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		if zone != "" {
+			actual.AvailabilityZone = fi.String(zone)
+		}
+	}
+	if len(s.Tags) != 0 {
+		actual.Tags = actualTags(lbs[0].Tags, s.Tags)
+	}
+	return actual, nil
 }
 
 func (s *LB) Run(context *fi.Context) error {
@@ -177,10 +159,44 @@ func (_ *LB) CheckChanges(a, e, changes *LB) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
+		if changes.AvailabilityZone != nil {
+			return fi.CannotChangeField("AvailabilityZone")
+		}
 	}
 	return nil
 }
 
+// validateLBAvailabilityZone returns an error if the availability zone is not an enabled availability zone of Octavia
+func validateLBAvailabilityZone(cloud openstack.OpenstackCloud, name string) error {
+	if !cloud.UseOctavia() {
+		return fmt.Errorf("loadbalancer availability zone %q requires Octavia", name)
+	}
+	zones, err := cloud.ListLoadBalancerAvailabilityZones()
+	if err != nil {
+		return fmt.Errorf("error listing loadbalancer availability zones: %v", err)
+	}
+	var valid []string
+	for _, zone := range zones {
+		if !zone.Enabled {
+			continue
+		}
+		if zone.Name == name {
+			return nil
+		}
+		valid = append(valid, zone.Name)
+	}
+	sort.Strings(valid)
+	return fmt.Errorf("loadbalancer availability zone %q not found, valid availability zones are: %s", name, strings.Join(valid, ", "))
+}
+
+// lbProviderCapabilities returns the capabilities of the Octavia provider of the loadbalancer, or nil when they can't be determined
+func lbProviderCapabilities(cloud openstack.OpenstackCloud, lb *LB) (*openstack.LBProviderCapabilities, error) {
+	if lb == nil || lb.Provider == nil || !cloud.UseOctavia() {
+		return nil, nil
+	}
+	return cloud.LBProviderCapabilities(fi.StringValue(lb.Provider))
+}
+
 func (_ *LB) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LB) error {
 	if a == nil {
 		glog.V(2).Infof("Creating LB with Name: %q", fi.StringValue(e.Name))
@@ -195,9 +211,28 @@ func (_ *LB) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LB)
 			return fmt.Errorf("Unexpected desired subnets for `%s`.  Expected 1, got %d", fi.StringValue(e.Subnet), len(subnets))
 		}
 
-		lbopts := loadbalancers.CreateOpts{
-			Name:        fi.StringValue(e.Name),
-			VipSubnetID: subnets[0].ID,
+		if e.AvailabilityZone != nil {
+			if err := validateLBAvailabilityZone(t.Cloud, fi.StringValue(e.AvailabilityZone)); err != nil {
+				return err
+			}
+			capabilities, err := lbProviderCapabilities(t.Cloud, e)
+			if err != nil {
+				return err
+			}
+			if err := capabilities.Validate(openstack.LBFeatureAvailabilityZone); err != nil {
+				return err
+			}
+		}
+
+		lbopts := openstack.LBCreateOpts{
+			CreateOptsBuilder: loadbalancers.CreateOpts{
+				Name:         fi.StringValue(e.Name),
+				VipSubnetID:  subnets[0].ID,
+				Provider:     fi.StringValue(e.Provider),
+				AdminStateUp: e.AdminStateUp,
+				Tags:         e.Tags,
+			},
+			AvailabilityZone: fi.StringValue(e.AvailabilityZone),
 		}
 		lb, err := t.Cloud.CreateLB(lbopts)
 		if err != nil {
@@ -207,6 +242,11 @@ func (_ *LB) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LB)
 		e.PortID = fi.String(lb.VipPortID)
 		e.VipSubnet = fi.String(lb.VipSubnetID)
 
+		// listeners and pools can only be created once the loadbalancer is provisioned
+		if err := t.Cloud.WaitForLoadBalancerActive(lb.ID); err != nil {
+			return err
+		}
+
 		opts := ports.UpdateOpts{
 			SecurityGroups: &[]string{fi.StringValue(e.SecurityGroup.ID)},
 		}
@@ -216,11 +256,41 @@ func (_ *LB) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LB)
 		}
 		return nil
 	}
+	if changes.Tags != nil {
+		// Find has dropped the tags if the loadbalancer service does not support them
+		tags := mergeTags(a.Tags, e.Tags)
+		glog.V(2).Infof("Updating tags of LB %q to %v", fi.StringValue(a.ID), tags)
+		_, err := t.Cloud.UpdateLB(fi.StringValue(a.ID), loadbalancers.UpdateOpts{
+			Tags: &tags,
+		})
+		if err != nil {
+			return fmt.Errorf("error updating LB: %v", err)
+		}
+		if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(a.ID)); err != nil {
+			return err
+		}
+	}
+	if changes.AdminStateUp != nil {
+		glog.V(2).Infof("Updating admin state of LB %q to %v", fi.StringValue(a.ID), fi.BoolValue(e.AdminStateUp))
+		_, err := t.Cloud.UpdateLB(fi.StringValue(a.ID), loadbalancers.UpdateOpts{
+			AdminStateUp: e.AdminStateUp,
+		})
+		if err != nil {
+			return fmt.Errorf("error updating LB: %v", err)
+		}
+		if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(a.ID)); err != nil {
+			return err
+		}
+	}
+
 	// We may have failed to update the security groups on the load balancer
 	port, err := t.Cloud.GetPort(fi.StringValue(a.PortID))
 	if err != nil {
 		return fmt.Errorf("Failed to get port with id %s: %v", fi.StringValue(a.PortID), err)
 	}
+	if port == nil {
+		return fmt.Errorf("Port with id %s of loadbalancer %s not found", fi.StringValue(a.PortID), fi.StringValue(a.Name))
+	}
 	// Ensure the loadbalancer port has one security group and it is the one specified,
 	if e.SecurityGroup != nil &&
 		(len(port.SecurityGroups) < 1 || port.SecurityGroups[0] != fi.StringValue(e.SecurityGroup.ID)) {
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestLBUpdatesAdminState(t *testing.T) {
+	cloud := &mockCloud{
+		lbs:   []loadbalancers.LoadBalancer{{ID: "lb-1", Name: "api", VipPortID: "port-1", AdminStateUp: true}},
+		ports: []ports.Port{{ID: "port-1", SecurityGroups: []string{"sg-1"}}},
+	}
+	a := &LB{
+		ID:           fi.String("lb-1"),
+		Name:         fi.String("api"),
+		PortID:       fi.String("port-1"),
+		AdminStateUp: fi.Bool(true),
+	}
+	e := &LB{
+		Name:          fi.String("api"),
+		SecurityGroup: &SecurityGroup{ID: fi.String("sg-1")},
+		AdminStateUp:  fi.Bool(false),
+	}
+	changes := &LB{AdminStateUp: fi.Bool(false)}
+
+	if err := e.CheckChanges(a, e, changes); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+		t.Fatalf("unexpected error updating LB: %v", err)
+	}
+	if cloud.lbs[0].AdminStateUp {
+		t.Errorf("expected the loadbalancer to be disabled")
+	}
+	if !reflect.DeepEqual(cloud.lbWaits, []string{"lb-1"}) {
+		t.Errorf("expected to wait until the loadbalancer is ACTIVE, got %v", cloud.lbWaits)
+	}
+}
+
+func TestValidateLBAvailabilityZone(t *testing.T) {
+	zones := []openstack.LBAvailabilityZone{
+		{Name: "az-2", Enabled: true},
+		{Name: "az-1", Enabled: true},
+		{Name: "az-3", Enabled: false},
+	}
+	grid := []struct {
+		zone     string
+		octavia  bool
+		expected string
+	}{
+		{
+			zone:    "az-1",
+			octavia: true,
+		},
+		{
+			zone:     "az-3",
+			octavia:  true,
+			expected: `loadbalancer availability zone "az-3" not found, valid availability zones are: az-1, az-2`,
+		},
+		{
+			zone:     "az-1",
+			expected: `loadbalancer availability zone "az-1" requires Octavia`,
+		},
+	}
+	for _, g := range grid {
+		cloud := &mockCloud{lbAvailabilityZones: zones}
+		if g.octavia {
+			cloud.lbProviders = map[string]*openstack.LBProviderCapabilities{}
+		}
+		err := validateLBAvailabilityZone(cloud, g.zone)
+		if g.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %s: %v", g.zone, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != g.expected {
+			t.Errorf("expected error %q for %s, got %v", g.expected, g.zone, err)
+		}
+	}
+}
+
+func TestLBAddsMissingTags(t *testing.T) {
+	cloud := &mockCloud{
+		lbs:   []loadbalancers.LoadBalancer{{ID: "lb-1", Name: "api", VipPortID: "port-1", AdminStateUp: true, Tags: []string{"owner:team-a"}}},
+		ports: []ports.Port{{ID: "port-1", SecurityGroups: []string{"sg-1"}}},
+	}
+	a := &LB{
+		ID:     fi.String("lb-1"),
+		Name:   fi.String("api"),
+		PortID: fi.String("port-1"),
+		Tags:   []string{"owner:team-a"},
+	}
+	e := &LB{
+		Name:          fi.String("api"),
+		SecurityGroup: &SecurityGroup{ID: fi.String("sg-1")},
+		Tags:          openstack.LBTags("my.k8s.local", openstack.LBRoleAPI),
+	}
+	changes := &LB{Tags: e.Tags}
+
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+		t.Fatalf("unexpected error updating LB: %v", err)
+	}
+	expected := []string{"owner:team-a", "KubernetesCluster:my-k8s-local", "k8s.io/role/api"}
+	if !reflect.DeepEqual(cloud.lbs[0].Tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, cloud.lbs[0].Tags)
+	}
+}
+
+func TestDropUnsupportedLBTags(t *testing.T) {
+	for _, unsupported := range []bool{false, true} {
+		cloud := &mockCloud{lbTagsUnsupported: unsupported}
+		tags := openstack.LBTags("my.k8s.local", openstack.LBRoleAPI)
+		if err := dropUnsupportedLBTags(cloud, &tags); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if unsupported != (tags == nil) {
+			t.Errorf("expected the tags to be dropped only without tag support, got %v", tags)
+		}
+	}
+}
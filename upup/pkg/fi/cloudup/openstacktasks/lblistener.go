@@ -18,10 +18,15 @@ package openstacktasks
 
 import (
 	"fmt"
+	"net"
+	"strings"
 
 	"github.com/golang/glog"
 	// "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/kops/pkg/featureflag"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
@@ -32,8 +37,36 @@ type LBListener struct {
 	Name      *string
 	Pool      *LBPool
 	Lifecycle *fi.Lifecycle
+	// Protocol is the protocol of the listener, defaults to TCP, or to TERMINATED_HTTPS when a TLS container is set
+	Protocol *string
+	// Port is the port the listener accepts connections on, defaults to 443
+	Port *int
+	// DefaultTLSContainerRef is the Barbican container used to terminate TLS for clients without SNI
+	DefaultTLSContainerRef *string
+	// SniContainerRefs are the additional Barbican containers served based on the SNI hostname
+	SniContainerRefs []string
+	// AdminStateUp disables the listener when false, defaults to true
+	AdminStateUp *bool
+	// AllowedCIDRs restricts the sources the listener accepts connections from, requires Octavia API 2.12 or later
+	AllowedCIDRs []string
+
+	// capabilities of the loadbalancer provider, used to validate the requested features
+	capabilities *openstack.LBProviderCapabilities
+	// allowedCIDRsSupported is true if the loadbalancer service supports AllowedCIDRs
+	allowedCIDRsSupported bool
 }
 
+const (
+	// protocolTerminatedHTTPS is the listener protocol used when TLS is terminated on the loadbalancer
+	protocolTerminatedHTTPS listeners.Protocol = "TERMINATED_HTTPS"
+
+	defaultListenerPort = 443
+)
+
+// CleanupStaleListeners if set will delete listeners left on the port of a new listener by a previous run.
+// When not set, such listeners are only reported.
+var CleanupStaleListeners = featureflag.New("OpenstackCleanupStaleListeners", featureflag.Bool(false))
+
 // GetDependencies returns the dependencies of the Instance task
 func (e *LBListener) GetDependencies(tasks map[string]fi.Task) []fi.Task {
 	var deps []fi.Task
@@ -57,9 +90,33 @@ func (s *LBListener) CompareWithID() *string {
 func NewLBListenerTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecycle, lb *listeners.Listener, find *LBListener) (*LBListener, error) {
 
 	listenerTask := &LBListener{
-		ID:        fi.String(lb.ID),
-		Name:      fi.String(lb.Name),
-		Lifecycle: lifecycle,
+		ID:           fi.String(lb.ID),
+		Name:         fi.String(lb.Name),
+		Lifecycle:    lifecycle,
+		Port:         fi.Int(lb.ProtocolPort),
+		AdminStateUp: fi.Bool(lb.AdminStateUp),
+	}
+	if lb.Protocol != string(protocolTerminatedHTTPS) || (find != nil && find.protocol() == protocolTerminatedHTTPS) {
+		listenerTask.Protocol = fi.String(lb.Protocol)
+	}
+	if lb.DefaultTlsContainerRef != "" {
+		listenerTask.DefaultTLSContainerRef = fi.String(lb.DefaultTlsContainerRef)
+	}
+	if len(lb.SniContainerRefs) > 0 {
+		listenerTask.SniContainerRefs = lb.SniContainerRefs
+	}
+
+	if find != nil && len(find.AllowedCIDRs) > 0 {
+		if find.allowedCIDRsSupported {
+			cidrs, err := cloud.GetListenerAllowedCIDRs(lb.ID)
+			if err != nil {
+				return nil, fmt.Errorf("NewLBListenerTaskFromCloud: Failed to get allowed CIDRs of listener %s: %v", lb.Name, err)
+			}
+			listenerTask.AllowedCIDRs = cidrs
+		} else {
+			// the sources can't be restricted, which was reported when finding the listener
+			listenerTask.AllowedCIDRs = find.AllowedCIDRs
+		}
 	}
 
 	for _, pool := range lb.Pools {
@@ -86,6 +143,17 @@ func (s *LBListener) Find(context *fi.Context) (*LBListener, error) {
 	}
 
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if s.Pool != nil {
+		capabilities, err := lbProviderCapabilities(cloud, s.Pool.Loadbalancer)
+		if err != nil {
+			return nil, err
+		}
+		s.capabilities = capabilities
+	}
+	if len(s.AllowedCIDRs) > 0 {
+		s.allowedCIDRsSupported = s.checkAllowedCIDRsSupport(cloud)
+	}
+
 	listenerList, err := cloud.ListListeners(listeners.ListOpts{
 		ID:   fi.StringValue(s.ID),
 		Name: fi.StringValue(s.Name),
@@ -94,6 +162,9 @@ func (s *LBListener) Find(context *fi.Context) (*LBListener, error) {
 		return nil, fmt.Errorf("Failed to list loadbalancer listeners for name %s: %v", fi.StringValue(s.Name), err)
 	}
 	if len(listenerList) == 0 {
+		if err := s.checkStaleListeners(cloud); err != nil {
+			return nil, err
+		}
 		return nil, nil
 	}
 	if len(listenerList) > 1 {
@@ -108,6 +179,31 @@ func (s *LBListener) Run(context *fi.Context) error {
 }
 
 func (_ *LBListener) CheckChanges(a, e, changes *LBListener) error {
+	if len(e.SniContainerRefs) > 0 && e.DefaultTLSContainerRef == nil {
+		return fi.RequiredField("DefaultTLSContainerRef")
+	}
+	if e.protocol() == protocolTerminatedHTTPS && e.DefaultTLSContainerRef == nil {
+		return fmt.Errorf("LB listener %s: %s listeners require a DefaultTLSContainerRef", fi.StringValue(e.Name), protocolTerminatedHTTPS)
+	}
+	if err := e.capabilities.Validate(e.requiredLBFeatures()...); err != nil {
+		return fmt.Errorf("LB listener %s: %v", fi.StringValue(e.Name), err)
+	}
+	if e.protocol() == listeners.ProtocolUDP {
+		if e.DefaultTLSContainerRef != nil {
+			return fmt.Errorf("LB listener %s: TLS termination is not supported on UDP listeners", fi.StringValue(e.Name))
+		}
+		if e.Pool != nil && e.Pool.protocol() != v2pools.ProtocolUDP {
+			return fmt.Errorf("LB listener %s: UDP listeners require a UDP pool", fi.StringValue(e.Name))
+		}
+	}
+	for _, cidr := range e.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("LB listener %s: invalid allowed CIDR %q: %v", fi.StringValue(e.Name), cidr, err)
+		}
+	}
+	if e.Pool != nil && e.Pool.cookiePersistence() && e.protocol() != listeners.ProtocolHTTP && e.DefaultTLSContainerRef == nil {
+		return fmt.Errorf("LB listener %s: cookie based session persistence requires an HTTP listener", fi.StringValue(e.Name))
+	}
 	if a == nil {
 		if e.Name == nil {
 			return fi.RequiredField("Name")
@@ -119,28 +215,213 @@ func (_ *LBListener) CheckChanges(a, e, changes *LBListener) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
+		if changes.Protocol != nil {
+			return fi.CannotChangeField("Protocol")
+		}
+		if changes.Port != nil {
+			return fi.CannotChangeField("Port")
+		}
 	}
 	return nil
 }
 
 func (_ *LBListener) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LBListener) error {
+	if err := e.validateTLSContainers(t.Cloud); err != nil {
+		return err
+	}
+
 	if a == nil {
 		glog.V(2).Infof("Creating LB with Name: %q", fi.StringValue(e.Name))
 		listeneropts := listeners.CreateOpts{
 			Name:           fi.StringValue(e.Name),
 			DefaultPoolID:  *e.Pool.ID,
 			LoadbalancerID: *e.Pool.Loadbalancer.ID,
-			Protocol:       listeners.ProtocolTCP,
-			ProtocolPort:   443,
+			Protocol:       e.protocol(),
+			ProtocolPort:   defaultListenerPort,
+			AdminStateUp:   e.AdminStateUp,
+		}
+		if e.Port != nil {
+			listeneropts.ProtocolPort = fi.IntValue(e.Port)
+		}
+		if e.DefaultTLSContainerRef != nil {
+			listeneropts.Protocol = protocolTerminatedHTTPS
+			listeneropts.DefaultTlsContainerRef = fi.StringValue(e.DefaultTLSContainerRef)
+			listeneropts.SniContainerRefs = e.SniContainerRefs
 		}
-		listener, err := t.Cloud.CreateListener(listeneropts)
+		var createOpts listeners.CreateOptsBuilder = listeneropts
+		if e.allowedCIDRsSupported && len(e.AllowedCIDRs) > 0 {
+			createOpts = openstack.ListenerCreateOpts{
+				CreateOptsBuilder: listeneropts,
+				AllowedCIDRs:      e.AllowedCIDRs,
+			}
+		}
+		listener, err := t.Cloud.CreateListener(createOpts)
 		if err != nil {
 			return fmt.Errorf("error creating LB listener: %v", err)
 		}
 		e.ID = fi.String(listener.ID)
+
+		if t.Cloud.UseOctavia() {
+			// Octavia refuses changes to the loadbalancer until the listener is provisioned
+			if err := t.Cloud.WaitForLoadBalancerActive(listeneropts.LoadbalancerID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	updateOpts := listeners.UpdateOpts{}
+	changed := false
+	if changes.DefaultTLSContainerRef != nil || changes.SniContainerRefs != nil {
+		glog.V(2).Infof("Updating TLS containers of LB listener %q", fi.StringValue(a.ID))
+		updateOpts.DefaultTlsContainerRef = fi.StringValue(e.DefaultTLSContainerRef)
+		updateOpts.SniContainerRefs = e.SniContainerRefs
+		changed = true
+	}
+	if changes.AdminStateUp != nil {
+		glog.V(2).Infof("Updating admin state of LB listener %q to %v", fi.StringValue(a.ID), fi.BoolValue(e.AdminStateUp))
+		updateOpts.AdminStateUp = e.AdminStateUp
+		changed = true
+	}
+	var opts listeners.UpdateOptsBuilder = updateOpts
+	if changes.AllowedCIDRs != nil && e.allowedCIDRsSupported {
+		glog.V(2).Infof("Updating allowed CIDRs of LB listener %q to %v", fi.StringValue(a.ID), e.AllowedCIDRs)
+		opts = openstack.ListenerUpdateOpts{
+			UpdateOptsBuilder: updateOpts,
+			AllowedCIDRs:      &e.AllowedCIDRs,
+		}
+		changed = true
+	}
+	if changed {
+		_, err := t.Cloud.UpdateListener(fi.StringValue(a.ID), opts)
+		if err != nil {
+			return fmt.Errorf("error updating LB listener: %v", err)
+		}
+		// the loadbalancer is immutable until the update of the listener is provisioned
+		if e.Pool != nil && e.Pool.Loadbalancer != nil && e.Pool.Loadbalancer.ID != nil {
+			if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(e.Pool.Loadbalancer.ID)); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
 	glog.V(2).Infof("Openstack task LB::RenderOpenstack did nothing")
 	return nil
 }
+
+// checkStaleListeners looks for listeners of a previous run which occupy the port of the listener on the
+// loadbalancers of the cluster, which would make creating the listener fail with a port conflict
+func (e *LBListener) checkStaleListeners(cloud openstack.OpenstackCloud) error {
+	if e.Pool == nil || e.Pool.Loadbalancer == nil {
+		return nil
+	}
+	lb := e.Pool.Loadbalancer
+
+	lbIDs := make(map[string]bool)
+	if lb.ID != nil {
+		lbIDs[fi.StringValue(lb.ID)] = true
+	}
+	if lb.Name != nil {
+		lbs, err := cloud.ListLBs(loadbalancers.ListOpts{Name: fi.StringValue(lb.Name)})
+		if err != nil {
+			return fmt.Errorf("Failed to list loadbalancers for name %s: %v", fi.StringValue(lb.Name), err)
+		}
+		for _, l := range lbs {
+			lbIDs[l.ID] = true
+		}
+	}
+
+	port := defaultListenerPort
+	if e.Port != nil {
+		port = fi.IntValue(e.Port)
+	}
+	var stale []listeners.Listener
+	for lbID := range lbIDs {
+		ls, err := cloud.ListListeners(listeners.ListOpts{
+			LoadbalancerID: lbID,
+			ProtocolPort:   port,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to list listeners of loadbalancer %s: %v", lbID, err)
+		}
+		for _, l := range ls {
+			// UDP and TCP based listeners can share a port
+			if l.ProtocolPort != port || (l.Protocol == string(listeners.ProtocolUDP)) != (e.protocol() == listeners.ProtocolUDP) {
+				continue
+			}
+			stale = append(stale, l)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	var conflicts []string
+	for _, l := range stale {
+		var lbs []string
+		for _, lb := range l.Loadbalancers {
+			lbs = append(lbs, lb.ID)
+		}
+		conflicts = append(conflicts, fmt.Sprintf("listener %s (%s) on loadbalancer %s", l.ID, l.Name, strings.Join(lbs, ",")))
+	}
+	if !CleanupStaleListeners.Enabled() {
+		return fmt.Errorf("LB listener %s: port %d is used by %s, delete the listeners or enable the feature flag %s",
+			fi.StringValue(e.Name), port, strings.Join(conflicts, ", "), CleanupStaleListeners.Key)
+	}
+	for i, l := range stale {
+		glog.Warningf("Deleting stale %s", conflicts[i])
+		if err := cloud.DeleteListener(l.ID); err != nil {
+			return fmt.Errorf("Failed to delete stale listener %s: %v", l.ID, err)
+		}
+	}
+	return nil
+}
+
+// protocol returns the requested protocol of the listener
+func (e *LBListener) protocol() listeners.Protocol {
+	if e.Protocol == nil {
+		return listeners.ProtocolTCP
+	}
+	return listeners.Protocol(fi.StringValue(e.Protocol))
+}
+
+// requiredLBFeatures returns the loadbalancer provider features used by the listener
+func (e *LBListener) requiredLBFeatures() []openstack.LBFeature {
+	var features []openstack.LBFeature
+	if e.DefaultTLSContainerRef != nil {
+		features = append(features, openstack.LBFeatureTerminatedHTTPS)
+	}
+	if e.protocol() == listeners.ProtocolUDP {
+		features = append(features, openstack.LBFeatureUDP)
+	}
+	return features
+}
+
+// checkAllowedCIDRsSupport returns true if the loadbalancer service can restrict the sources of the listener.
+// Older clouds can't, the listener is then left open to all sources with a warning instead of failing.
+func (e *LBListener) checkAllowedCIDRsSupport(cloud openstack.OpenstackCloud) bool {
+	supported, err := cloud.SupportsListenerAllowedCIDRs()
+	if err != nil {
+		glog.Warningf("Unable to check whether the loadbalancer service supports allowed CIDRs, access to LB listener %s is not restricted: %v", fi.StringValue(e.Name), err)
+		return false
+	}
+	if !supported {
+		glog.Warningf("The loadbalancer service does not support allowed CIDRs (requires Octavia API 2.12), access to LB listener %s is not restricted", fi.StringValue(e.Name))
+	}
+	return supported
+}
+
+// validateTLSContainers ensures that all referenced Barbican containers exist and hold certificates
+func (e *LBListener) validateTLSContainers(cloud openstack.OpenstackCloud) error {
+	if e.DefaultTLSContainerRef == nil {
+		return nil
+	}
+	refs := append([]string{fi.StringValue(e.DefaultTLSContainerRef)}, e.SniContainerRefs...)
+	for _, ref := range refs {
+		if err := openstack.ValidateTLSContainer(cloud, ref); err != nil {
+			return fmt.Errorf("invalid TLS container for LB listener %s: %v", fi.StringValue(e.Name), err)
+		}
+	}
+	return nil
+}
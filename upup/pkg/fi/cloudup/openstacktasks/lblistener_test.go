@@ -0,0 +1,311 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"k8s.io/kops/pkg/featureflag"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func newListenerTestCloud() *mockCloud {
+	return &mockCloud{
+		tlsContainers: map[string]*openstack.TLSContainer{
+			"https://barbican/v1/containers/default": {Type: openstack.TLSContainerTypeCertificate},
+			"https://barbican/v1/containers/sni-a":   {Type: openstack.TLSContainerTypeCertificate},
+			"https://barbican/v1/containers/sni-b":   {Type: openstack.TLSContainerTypeCertificate},
+			"https://barbican/v1/containers/generic": {Type: "generic"},
+		},
+	}
+}
+
+func newListenerTask() *LBListener {
+	return &LBListener{
+		Name: fi.String("api"),
+		Pool: &LBPool{
+			ID:           fi.String("pool-1"),
+			Loadbalancer: &LB{ID: fi.String("lb-1")},
+		},
+	}
+}
+
+func TestLBListenerSniContainers(t *testing.T) {
+	cloud := newListenerTestCloud()
+	e := newListenerTask()
+	e.DefaultTLSContainerRef = fi.String("https://barbican/v1/containers/default")
+	e.SniContainerRefs = []string{"https://barbican/v1/containers/sni-a", "https://barbican/v1/containers/sni-b"}
+
+	if err := e.CheckChanges(nil, e, e); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+
+	if len(cloud.listeners) != 1 {
+		t.Fatalf("expected one listener, got %d", len(cloud.listeners))
+	}
+	l := cloud.listeners[0]
+	if l.Protocol != string(protocolTerminatedHTTPS) {
+		t.Errorf("expected protocol %s, got %s", protocolTerminatedHTTPS, l.Protocol)
+	}
+	if l.DefaultTlsContainerRef != "https://barbican/v1/containers/default" {
+		t.Errorf("unexpected default container %q", l.DefaultTlsContainerRef)
+	}
+	if !reflect.DeepEqual(l.SniContainerRefs, e.SniContainerRefs) {
+		t.Errorf("expected SNI containers %v, got %v", e.SniContainerRefs, l.SniContainerRefs)
+	}
+}
+
+func TestLBListenerSniRequiresDefaultContainer(t *testing.T) {
+	e := newListenerTask()
+	e.SniContainerRefs = []string{"https://barbican/v1/containers/sni-a"}
+
+	if err := e.CheckChanges(nil, e, e); err == nil {
+		t.Fatalf("expected error when SNI containers are set without a default container")
+	}
+}
+
+func TestTerminatedHTTPSListener(t *testing.T) {
+	e := newListenerTask()
+	e.Protocol = fi.String("TERMINATED_HTTPS")
+	if err := e.CheckChanges(nil, e, e); err == nil {
+		t.Fatalf("expected error when a TERMINATED_HTTPS listener has no default container")
+	}
+
+	cloud := newListenerTestCloud()
+	e.DefaultTLSContainerRef = fi.String("https://barbican/v1/containers/default")
+	if err := e.CheckChanges(nil, e, e); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+	if len(cloud.listeners) != 1 || cloud.listeners[0].Protocol != string(protocolTerminatedHTTPS) {
+		t.Fatalf("expected a single %s listener, got %+v", protocolTerminatedHTTPS, cloud.listeners)
+	}
+
+	find := &LBListener{Name: e.Name, Protocol: e.Protocol}
+	actual, err := NewLBListenerTaskFromCloud(cloud, nil, &cloud.listeners[0], find)
+	if err != nil {
+		t.Fatalf("unexpected error reading listener: %v", err)
+	}
+	if fi.StringValue(actual.Protocol) != "TERMINATED_HTTPS" {
+		t.Errorf("expected the protocol to be read back as TERMINATED_HTTPS, got %v", fi.StringValue(actual.Protocol))
+	}
+}
+
+func TestLBListenerRejectsInvalidContainer(t *testing.T) {
+	cloud := newListenerTestCloud()
+	e := newListenerTask()
+	e.DefaultTLSContainerRef = fi.String("https://barbican/v1/containers/default")
+	e.SniContainerRefs = []string{"https://barbican/v1/containers/generic"}
+
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err == nil {
+		t.Fatalf("expected error for non-certificate container")
+	}
+	if len(cloud.listeners) != 0 {
+		t.Errorf("listener should not be created with an invalid container")
+	}
+}
+
+func TestLBListenerUpdatesAdminState(t *testing.T) {
+	cloud := &mockCloud{
+		listeners: []listeners.Listener{
+			{ID: "listener-1", Name: "api", Protocol: "TCP", ProtocolPort: 443, AdminStateUp: true},
+		},
+	}
+	a := newListenerTask()
+	a.ID = fi.String("listener-1")
+	a.AdminStateUp = fi.Bool(true)
+	e := newListenerTask()
+	e.AdminStateUp = fi.Bool(false)
+	changes := &LBListener{AdminStateUp: fi.Bool(false)}
+
+	if err := e.CheckChanges(a, e, changes); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+		t.Fatalf("unexpected error updating listener: %v", err)
+	}
+	if cloud.listeners[0].AdminStateUp {
+		t.Errorf("expected the listener to be disabled")
+	}
+	if !reflect.DeepEqual(cloud.lbWaits, []string{"lb-1"}) {
+		t.Errorf("expected to wait until the loadbalancer is ACTIVE, got %v", cloud.lbWaits)
+	}
+}
+
+func TestLBListenerAllowedCIDRs(t *testing.T) {
+	cloud := &mockCloud{allowedCIDRs: map[string][]string{}}
+	context := &fi.Context{Cloud: cloud}
+	target := openstack.NewOpenstackAPITarget(cloud)
+
+	e := newListenerTask()
+	e.AllowedCIDRs = []string{"192.0.2.0/24"}
+	if a, err := e.Find(context); err != nil || a != nil {
+		t.Fatalf("unexpected result finding listener: %v, %v", a, err)
+	}
+	if err := e.CheckChanges(nil, e, e); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := e.RenderOpenstack(target, nil, e, e); err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+	if !reflect.DeepEqual(cloud.allowedCIDRs["listener-1"], e.AllowedCIDRs) {
+		t.Fatalf("expected allowed CIDRs %v, got %v", e.AllowedCIDRs, cloud.allowedCIDRs["listener-1"])
+	}
+
+	e = newListenerTask()
+	e.AllowedCIDRs = []string{"192.0.2.0/24", "198.51.100.0/24"}
+	a, err := e.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error finding listener: %v", err)
+	}
+	if !reflect.DeepEqual(a.AllowedCIDRs, []string{"192.0.2.0/24"}) {
+		t.Fatalf("expected the allowed CIDRs to be read back, got %v", a.AllowedCIDRs)
+	}
+	changes := &LBListener{AllowedCIDRs: e.AllowedCIDRs}
+	if err := e.RenderOpenstack(target, a, e, changes); err != nil {
+		t.Fatalf("unexpected error updating listener: %v", err)
+	}
+	if !reflect.DeepEqual(cloud.allowedCIDRs["listener-1"], e.AllowedCIDRs) {
+		t.Errorf("expected allowed CIDRs %v, got %v", e.AllowedCIDRs, cloud.allowedCIDRs["listener-1"])
+	}
+}
+
+func TestLBListenerAllowedCIDRsUnsupported(t *testing.T) {
+	cloud := &mockCloud{}
+	e := newListenerTask()
+	e.AllowedCIDRs = []string{"192.0.2.0/24"}
+	if _, err := e.Find(&fi.Context{Cloud: cloud}); err != nil {
+		t.Fatalf("unexpected error finding listener: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+	if len(cloud.listeners) != 1 {
+		t.Fatalf("expected the listener to be created without allowed CIDRs, got %+v", cloud.listeners)
+	}
+
+	e = newListenerTask()
+	e.AllowedCIDRs = []string{"192.0.2.0/24"}
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding listener: %v", err)
+	}
+	if !reflect.DeepEqual(a.AllowedCIDRs, e.AllowedCIDRs) {
+		t.Errorf("expected no change to be detected when allowed CIDRs are unsupported, got %v", a.AllowedCIDRs)
+	}
+}
+
+func TestLBListenerInvalidAllowedCIDR(t *testing.T) {
+	e := newListenerTask()
+	e.AllowedCIDRs = []string{"192.0.2.0"}
+	if err := e.CheckChanges(nil, e, e); err == nil {
+		t.Errorf("expected error for an allowed CIDR without prefix length")
+	}
+}
+
+func newStaleListenerTestCloud() *mockCloud {
+	return &mockCloud{
+		lbs: []loadbalancers.LoadBalancer{
+			{ID: "lb-current", Name: "api.cluster"},
+			{ID: "lb-orphaned", Name: "api.cluster"},
+		},
+		listeners: []listeners.Listener{
+			{ID: "stale", Name: "api-old", ProtocolPort: 443, Protocol: "TCP", Loadbalancers: []listeners.LoadBalancerID{{ID: "lb-orphaned"}}},
+			{ID: "dns", Name: "dns", ProtocolPort: 443, Protocol: "UDP", Loadbalancers: []listeners.LoadBalancerID{{ID: "lb-current"}}},
+			{ID: "other-port", Name: "metrics", ProtocolPort: 8443, Protocol: "TCP", Loadbalancers: []listeners.LoadBalancerID{{ID: "lb-current"}}},
+		},
+	}
+}
+
+func newStaleListenerTask() *LBListener {
+	return &LBListener{
+		Name: fi.String("api"),
+		Pool: &LBPool{
+			Name:         fi.String("api"),
+			Loadbalancer: &LB{ID: fi.String("lb-current"), Name: fi.String("api.cluster")},
+		},
+	}
+}
+
+func TestLBListenerReportsStaleListener(t *testing.T) {
+	cloud := newStaleListenerTestCloud()
+	e := newStaleListenerTask()
+
+	_, err := e.Find(&fi.Context{Cloud: cloud})
+	if err == nil {
+		t.Fatalf("expected error for stale listener on the port")
+	}
+	for _, id := range []string{"stale", "lb-orphaned", CleanupStaleListeners.Key} {
+		if !strings.Contains(err.Error(), id) {
+			t.Errorf("expected error to mention %s, got %v", id, err)
+		}
+	}
+	if strings.Contains(err.Error(), "dns") || strings.Contains(err.Error(), "other-port") {
+		t.Errorf("listeners without a port conflict should not be reported: %v", err)
+	}
+	if len(cloud.listeners) != 3 {
+		t.Errorf("listeners should not be deleted without the feature flag")
+	}
+}
+
+func TestLBListenerCleansUpStaleListener(t *testing.T) {
+	featureflag.ParseFlags("+" + CleanupStaleListeners.Key)
+	defer featureflag.ParseFlags("-" + CleanupStaleListeners.Key)
+
+	cloud := newStaleListenerTestCloud()
+	e := newStaleListenerTask()
+
+	actual, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual != nil {
+		t.Errorf("expected listener to be created, found %v", actual)
+	}
+
+	var remaining []string
+	for _, l := range cloud.listeners {
+		remaining = append(remaining, l.ID)
+	}
+	if !reflect.DeepEqual(remaining, []string{"dns", "other-port"}) {
+		t.Errorf("expected only the stale listener to be deleted, remaining %v", remaining)
+	}
+}
+
+func TestOctaviaListenerWaitsForLoadbalancer(t *testing.T) {
+	cloud := newLBProviderTestCloud()
+	e := &LBListener{
+		Name: fi.String("api"),
+		Pool: &LBPool{ID: fi.String("pool-1"), Loadbalancer: &LB{ID: fi.String("lb-1")}},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cloud.lbWaits, []string{"lb-1"}) {
+		t.Errorf("expected to wait until the loadbalancer is ACTIVE, got %v", cloud.lbWaits)
+	}
+}
@@ -25,12 +25,27 @@ import (
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
 
+const (
+	persistenceSourceIP   = "SOURCE_IP"
+	persistenceHTTPCookie = "HTTP_COOKIE"
+	persistenceAppCookie  = "APP_COOKIE"
+)
+
 //go:generate fitask -type=LBPool
 type LBPool struct {
 	ID           *string
 	Name         *string
 	Lifecycle    *fi.Lifecycle
 	Loadbalancer *LB
+	// LBMethod is the balancing algorithm of the pool, defaults to ROUND_ROBIN
+	LBMethod *string
+	// Protocol is the protocol used to reach the members, defaults to TCP
+	Protocol *string
+	// SessionPersistence binds the sessions of a client to a single member, cookie based persistence requires an HTTP pool
+	SessionPersistence *v2pools.SessionPersistence
+
+	// capabilities of the loadbalancer provider, used to validate the requested features
+	capabilities *openstack.LBProviderCapabilities
 }
 
 // GetDependencies returns the dependencies of the Instance task
@@ -59,8 +74,16 @@ func NewLBPoolTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecy
 	a := &LBPool{
 		ID:        fi.String(pool.ID),
 		Name:      fi.String(pool.Name),
+		LBMethod:  fi.String(pool.LBMethod),
+		Protocol:  fi.String(pool.Protocol),
 		Lifecycle: lifecycle,
 	}
+	if pool.Persistence.Type != "" {
+		a.SessionPersistence = &v2pools.SessionPersistence{
+			Type:       pool.Persistence.Type,
+			CookieName: pool.Persistence.CookieName,
+		}
+	}
 	if len(pool.Loadbalancers) == 1 {
 		lbID := pool.Loadbalancers[0]
 		lb, err := cloud.GetLB(lbID.ID)
@@ -87,6 +110,12 @@ func (p *LBPool) Find(context *fi.Context) (*LBPool, error) {
 	}
 
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	capabilities, err := lbProviderCapabilities(cloud, p.Loadbalancer)
+	if err != nil {
+		return nil, err
+	}
+	p.capabilities = capabilities
+
 	poolList, err := cloud.ListPools(v2pools.ListOpts{
 		ID:   fi.StringValue(p.ID),
 		Name: fi.StringValue(p.Name),
@@ -109,6 +138,12 @@ func (s *LBPool) Run(context *fi.Context) error {
 }
 
 func (_ *LBPool) CheckChanges(a, e, changes *LBPool) error {
+	if err := e.capabilities.Validate(e.requiredLBFeatures()...); err != nil {
+		return fmt.Errorf("LB pool %s: %v", fi.StringValue(e.Name), err)
+	}
+	if err := e.validateSessionPersistence(); err != nil {
+		return fmt.Errorf("LB pool %s: %v", fi.StringValue(e.Name), err)
+	}
 	if a == nil {
 		if e.Name == nil {
 			return fi.RequiredField("Name")
@@ -120,24 +155,90 @@ func (_ *LBPool) CheckChanges(a, e, changes *LBPool) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
+		if changes.LBMethod != nil {
+			return fi.CannotChangeField("LBMethod")
+		}
+		if changes.Protocol != nil {
+			return fi.CannotChangeField("Protocol")
+		}
+		if changes.SessionPersistence != nil {
+			return fi.CannotChangeField("SessionPersistence")
+		}
+	}
+	return nil
+}
+
+// lbMethod returns the requested balancing algorithm of the pool
+func (p *LBPool) lbMethod() v2pools.LBMethod {
+	if p.LBMethod == nil {
+		return v2pools.LBMethodRoundRobin
+	}
+	return v2pools.LBMethod(fi.StringValue(p.LBMethod))
+}
+
+// protocol returns the requested protocol of the pool
+func (p *LBPool) protocol() v2pools.Protocol {
+	if p.Protocol == nil {
+		return v2pools.ProtocolTCP
+	}
+	return v2pools.Protocol(fi.StringValue(p.Protocol))
+}
+
+// cookiePersistence returns true if the pool binds sessions with a cookie
+func (p *LBPool) cookiePersistence() bool {
+	if p.SessionPersistence == nil {
+		return false
+	}
+	return p.SessionPersistence.Type == persistenceHTTPCookie || p.SessionPersistence.Type == persistenceAppCookie
+}
+
+// validateSessionPersistence checks the requested session persistence against the protocol of the pool
+func (p *LBPool) validateSessionPersistence() error {
+	sp := p.SessionPersistence
+	if sp == nil {
+		return nil
+	}
+	switch sp.Type {
+	case persistenceSourceIP, persistenceHTTPCookie:
+		if sp.CookieName != "" {
+			return fmt.Errorf("a cookie name is only supported with %s session persistence", persistenceAppCookie)
+		}
+	case persistenceAppCookie:
+		if sp.CookieName == "" {
+			return fmt.Errorf("%s session persistence requires a cookie name", persistenceAppCookie)
+		}
+	default:
+		return fmt.Errorf("unknown session persistence type %q, expected one of %s, %s, %s", sp.Type, persistenceSourceIP, persistenceHTTPCookie, persistenceAppCookie)
+	}
+	if p.cookiePersistence() && p.protocol() != v2pools.ProtocolHTTP {
+		return fmt.Errorf("%s session persistence is only supported on HTTP pools", sp.Type)
 	}
 	return nil
 }
 
+// requiredLBFeatures returns the loadbalancer provider features used by the pool
+func (p *LBPool) requiredLBFeatures() []openstack.LBFeature {
+	features := []openstack.LBFeature{openstack.LBFeature(p.lbMethod())}
+	if p.protocol() == v2pools.ProtocolUDP {
+		features = append(features, openstack.LBFeatureUDP)
+	}
+	return features
+}
+
 func (_ *LBPool) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *LBPool) error {
 	if a == nil {
 
 		// wait that lb is in ACTIVE state
-		provisioningStatus, err := waitLoadbalancerActiveProvisioningStatus(t.Cloud.LoadBalancerClient(), fi.StringValue(e.Loadbalancer.ID))
-		if err != nil {
-			return fmt.Errorf("failed to loadbalancer ACTIVE provisioning status %v: %v", provisioningStatus, err)
+		if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(e.Loadbalancer.ID)); err != nil {
+			return err
 		}
 
 		poolopts := v2pools.CreateOpts{
 			Name:           fi.StringValue(e.Name),
-			LBMethod:       v2pools.LBMethodRoundRobin,
-			Protocol:       v2pools.ProtocolTCP,
+			LBMethod:       e.lbMethod(),
+			Protocol:       e.protocol(),
 			LoadbalancerID: fi.StringValue(e.Loadbalancer.ID),
+			Persistence:    e.SessionPersistence,
 		}
 		pool, err := t.Cloud.CreatePool(poolopts)
 		if err != nil {
@@ -0,0 +1,259 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// newLBTestServer serves servers with a fixed ip on the cluster network
+func newLBTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/servers/"):
+			id := strings.TrimPrefix(r.URL.Path, "/servers/")
+			fmt.Fprintf(w, `{"server": {"id": %q, "addresses": {"cluster": [{"addr": "10.0.0.5", "version": 4, "OS-EXT-IPS:type": "fixed"}]}}}`, id)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestServiceClient(server *httptest.Server) *gophercloud.ServiceClient {
+	return &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       server.URL + "/",
+	}
+}
+
+func TestUDPListenerPoolAndMember(t *testing.T) {
+	server := newLBTestServer()
+	defer server.Close()
+
+	cloud := newLBProviderTestCloud()
+	cloud.computeClient = newTestServiceClient(server)
+	target := openstack.NewOpenstackAPITarget(cloud)
+
+	lb := &LB{ID: fi.String("lb-1"), Provider: fi.String("ovn"), VipSubnet: fi.String("subnet-1")}
+	pool := &LBPool{
+		Name:         fi.String("dns-udp"),
+		LBMethod:     fi.String("SOURCE_IP_PORT"),
+		Protocol:     fi.String("UDP"),
+		Loadbalancer: lb,
+	}
+	monitor := &PoolMonitor{
+		Name:       fi.String("dns-udp"),
+		Pool:       pool,
+		Type:       fi.String("UDP-CONNECT"),
+		Delay:      fi.Int(10),
+		Timeout:    fi.Int(5),
+		MaxRetries: fi.Int(3),
+	}
+	listener := &LBListener{
+		Name:     fi.String("dns-udp"),
+		Protocol: fi.String("UDP"),
+		Port:     fi.Int(53),
+		Pool:     pool,
+	}
+	member := &PoolAssociation{
+		Name:          fi.String("master"),
+		Pool:          pool,
+		ServerGroup:   &ServerGroup{Members: []string{"server-1"}},
+		InterfaceName: fi.String("cluster"),
+		ProtocolPort:  fi.Int(53),
+	}
+
+	context := &fi.Context{Cloud: cloud}
+	if _, err := pool.Find(context); err != nil {
+		t.Fatalf("unexpected error finding pool: %v", err)
+	}
+	if err := pool.CheckChanges(nil, pool, pool); err != nil {
+		t.Fatalf("unexpected pool validation error: %v", err)
+	}
+	if err := pool.RenderOpenstack(target, nil, pool, pool); err != nil {
+		t.Fatalf("unexpected error creating pool: %v", err)
+	}
+	if err := monitor.CheckChanges(nil, monitor, monitor); err != nil {
+		t.Fatalf("unexpected monitor validation error: %v", err)
+	}
+	if err := monitor.RenderOpenstack(target, nil, monitor, monitor); err != nil {
+		t.Fatalf("unexpected error creating monitor: %v", err)
+	}
+	if _, err := listener.Find(context); err != nil {
+		t.Fatalf("unexpected error finding listener: %v", err)
+	}
+	if err := listener.CheckChanges(nil, listener, listener); err != nil {
+		t.Fatalf("unexpected listener validation error: %v", err)
+	}
+	if err := listener.RenderOpenstack(target, nil, listener, listener); err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+	if err := member.RenderOpenstack(target, nil, member, member); err != nil {
+		t.Fatalf("unexpected error creating member: %v", err)
+	}
+
+	if len(cloud.pools) != 1 || cloud.pools[0].Protocol != "UDP" {
+		t.Errorf("expected a single UDP pool, got %+v", cloud.pools)
+	}
+	if len(cloud.monitors) != 1 || cloud.monitors[0].Type != "UDP-CONNECT" {
+		t.Errorf("expected a UDP-CONNECT health monitor, got %+v", cloud.monitors)
+	}
+	if len(cloud.listeners) != 1 || cloud.listeners[0].Protocol != "UDP" || cloud.listeners[0].ProtocolPort != 53 {
+		t.Errorf("expected a UDP listener on port 53, got %+v", cloud.listeners)
+	}
+	if cloud.listeners[0].DefaultPoolID != cloud.pools[0].ID {
+		t.Errorf("expected listener to use pool %s, got %s", cloud.pools[0].ID, cloud.listeners[0].DefaultPoolID)
+	}
+	members := cloud.members[cloud.pools[0].ID]
+	if len(members) != 1 || members[0].Address != "10.0.0.5" || members[0].ProtocolPort != 53 {
+		t.Errorf("expected a member for 10.0.0.5:53, got %+v", members)
+	}
+}
+
+func TestPoolSessionPersistence(t *testing.T) {
+	grid := []struct {
+		protocol    *string
+		persistence *v2pools.SessionPersistence
+		valid       bool
+	}{
+		{protocol: nil, persistence: nil, valid: true},
+		{protocol: nil, persistence: &v2pools.SessionPersistence{Type: "SOURCE_IP"}, valid: true},
+		{protocol: fi.String("HTTP"), persistence: &v2pools.SessionPersistence{Type: "HTTP_COOKIE"}, valid: true},
+		{protocol: fi.String("HTTP"), persistence: &v2pools.SessionPersistence{Type: "APP_COOKIE", CookieName: "session"}, valid: true},
+		{protocol: nil, persistence: &v2pools.SessionPersistence{Type: "HTTP_COOKIE"}, valid: false},
+		{protocol: fi.String("PROXY"), persistence: &v2pools.SessionPersistence{Type: "APP_COOKIE", CookieName: "session"}, valid: false},
+		{protocol: fi.String("HTTP"), persistence: &v2pools.SessionPersistence{Type: "APP_COOKIE"}, valid: false},
+		{protocol: fi.String("HTTP"), persistence: &v2pools.SessionPersistence{Type: "HTTP_COOKIE", CookieName: "session"}, valid: false},
+		{protocol: nil, persistence: &v2pools.SessionPersistence{Type: "STICKY"}, valid: false},
+	}
+	for _, g := range grid {
+		pool := &LBPool{
+			Name:               fi.String("api"),
+			Protocol:           g.protocol,
+			SessionPersistence: g.persistence,
+			Loadbalancer:       &LB{ID: fi.String("lb-1")},
+		}
+		err := pool.CheckChanges(nil, pool, pool)
+		if g.valid && err != nil {
+			t.Errorf("unexpected error for %v pool with persistence %+v: %v", fi.StringValue(g.protocol), g.persistence, err)
+		}
+		if !g.valid && err == nil {
+			t.Errorf("expected error for %v pool with persistence %+v", fi.StringValue(g.protocol), g.persistence)
+		}
+	}
+}
+
+func TestCookiePersistenceRequiresHTTPListener(t *testing.T) {
+	pool := &LBPool{
+		Name:               fi.String("api"),
+		Protocol:           fi.String("HTTP"),
+		SessionPersistence: &v2pools.SessionPersistence{Type: "HTTP_COOKIE"},
+		Loadbalancer:       &LB{ID: fi.String("lb-1")},
+	}
+	grid := []struct {
+		listener *LBListener
+		valid    bool
+	}{
+		{listener: &LBListener{Name: fi.String("api"), Pool: pool}, valid: false},
+		{listener: &LBListener{Name: fi.String("api"), Protocol: fi.String("HTTP"), Pool: pool}, valid: true},
+		{listener: &LBListener{Name: fi.String("api"), DefaultTLSContainerRef: fi.String("container-1"), Pool: pool}, valid: true},
+	}
+	for _, g := range grid {
+		err := g.listener.CheckChanges(nil, g.listener, g.listener)
+		if g.valid && err != nil {
+			t.Errorf("unexpected error for %v listener: %v", fi.StringValue(g.listener.Protocol), err)
+		}
+		if !g.valid && err == nil {
+			t.Errorf("expected error for %v listener", fi.StringValue(g.listener.Protocol))
+		}
+	}
+}
+
+func TestCreatePoolWithSessionPersistence(t *testing.T) {
+	cloud := newLBProviderTestCloud()
+	pool := &LBPool{
+		Name:               fi.String("api"),
+		Protocol:           fi.String("HTTP"),
+		SessionPersistence: &v2pools.SessionPersistence{Type: "APP_COOKIE", CookieName: "session"},
+		Loadbalancer:       &LB{ID: fi.String("lb-1")},
+	}
+	if err := pool.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, pool, pool); err != nil {
+		t.Fatalf("unexpected error creating pool: %v", err)
+	}
+	if len(cloud.pools) != 1 {
+		t.Fatalf("expected a single pool, got %+v", cloud.pools)
+	}
+	expected := v2pools.SessionPersistence{Type: "APP_COOKIE", CookieName: "session"}
+	if cloud.pools[0].Persistence != expected {
+		t.Errorf("expected persistence %+v, got %+v", expected, cloud.pools[0].Persistence)
+	}
+
+	actual, err := NewLBPoolTaskFromCloud(cloud, nil, &cloud.pools[0], nil)
+	if err != nil {
+		t.Fatalf("unexpected error reading pool: %v", err)
+	}
+	if actual.SessionPersistence == nil || *actual.SessionPersistence != expected {
+		t.Errorf("expected persistence %+v to be read back, got %+v", expected, actual.SessionPersistence)
+	}
+}
+
+func TestUDPListenerRequiresUDPPool(t *testing.T) {
+	listener := &LBListener{
+		Name:     fi.String("dns-udp"),
+		Protocol: fi.String("UDP"),
+		Port:     fi.Int(53),
+		Pool: &LBPool{
+			Name:         fi.String("api-https"),
+			Loadbalancer: &LB{ID: fi.String("lb-1")},
+		},
+	}
+	if err := listener.CheckChanges(nil, listener, listener); err == nil {
+		t.Errorf("expected error for UDP listener with a TCP pool")
+	}
+}
+
+func TestUDPRequiresProviderSupport(t *testing.T) {
+	pool := &LBPool{
+		LBMethod: fi.String("SOURCE_IP_PORT"),
+		Protocol: fi.String("UDP"),
+	}
+	listener := &LBListener{
+		Protocol: fi.String("UDP"),
+		Pool:     pool,
+	}
+	for _, features := range [][]openstack.LBFeature{pool.requiredLBFeatures(), listener.requiredLBFeatures()} {
+		found := false
+		for _, f := range features {
+			if f == openstack.LBFeatureUDP {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s to be required, got %v", openstack.LBFeatureUDP, features)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"testing"
+
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func newLBProviderTestCloud() *mockCloud {
+	cloud := newListenerTestCloud()
+	cloud.lbProviders = map[string]*openstack.LBProviderCapabilities{
+		"amphora": openstack.NewLBProviderCapabilities("amphora"),
+		"ovn":     openstack.NewLBProviderCapabilities("ovn"),
+	}
+	return cloud
+}
+
+func TestLBListenerProviderCapabilities(t *testing.T) {
+	grid := []struct {
+		provider string
+		tls      bool
+		valid    bool
+	}{
+		{provider: "amphora", tls: true, valid: true},
+		{provider: "amphora", tls: false, valid: true},
+		{provider: "ovn", tls: false, valid: true},
+		{provider: "ovn", tls: true, valid: false},
+	}
+	for _, g := range grid {
+		cloud := newLBProviderTestCloud()
+		e := newListenerTask()
+		e.Pool.Loadbalancer.Provider = fi.String(g.provider)
+		if g.tls {
+			e.DefaultTLSContainerRef = fi.String("https://barbican/v1/containers/default")
+		}
+
+		a, err := e.Find(&fi.Context{Cloud: cloud})
+		if err != nil {
+			t.Fatalf("unexpected error finding listener: %v", err)
+		}
+		err = e.CheckChanges(a, e, e)
+		if g.valid && err != nil {
+			t.Errorf("unexpected validation error for provider %s with tls=%v: %v", g.provider, g.tls, err)
+		}
+		if !g.valid && err == nil {
+			t.Errorf("expected validation error for provider %s with tls=%v", g.provider, g.tls)
+		}
+	}
+}
+
+func TestLBPoolProviderCapabilities(t *testing.T) {
+	grid := []struct {
+		provider string
+		lbMethod *string
+		valid    bool
+	}{
+		{provider: "amphora", lbMethod: nil, valid: true},
+		{provider: "ovn", lbMethod: fi.String("SOURCE_IP_PORT"), valid: true},
+		{provider: "ovn", lbMethod: nil, valid: false},
+		{provider: "ovn", lbMethod: fi.String("ROUND_ROBIN"), valid: false},
+	}
+	for _, g := range grid {
+		cloud := newLBProviderTestCloud()
+		e := &LBPool{
+			Name:         fi.String("api-https"),
+			LBMethod:     g.lbMethod,
+			Loadbalancer: &LB{ID: fi.String("lb-1"), Provider: fi.String(g.provider)},
+		}
+
+		a, err := e.Find(&fi.Context{Cloud: cloud})
+		if err != nil {
+			t.Fatalf("unexpected error finding pool: %v", err)
+		}
+		err = e.CheckChanges(a, e, e)
+		if g.valid && err != nil {
+			t.Errorf("unexpected validation error for provider %s with method %v: %v", g.provider, fi.StringValue(g.lbMethod), err)
+		}
+		if !g.valid && err == nil {
+			t.Errorf("expected validation error for provider %s with method %v", g.provider, fi.StringValue(g.lbMethod))
+		}
+	}
+}
+
+func TestLBProviderCapabilitiesSkippedWithoutOctavia(t *testing.T) {
+	cloud := newListenerTestCloud()
+	e := newListenerTask()
+	e.Pool.Loadbalancer.Provider = fi.String("ovn")
+	e.DefaultTLSContainerRef = fi.String("https://barbican/v1/containers/default")
+
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding listener: %v", err)
+	}
+	if err := e.CheckChanges(a, e, e); err != nil {
+		t.Errorf("unexpected validation error without octavia: %v", err)
+	}
+}
@@ -0,0 +1,854 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	az "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/monitors"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	l3floatingip "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// mockCloud is an in-memory OpenstackCloud; only the methods exercised by the tests are implemented
+type mockCloud struct {
+	openstack.OpenstackCloud
+
+	networks  []networks.Network
+	subnets   []subnets.Subnet
+	listeners []listeners.Listener
+	// allowedCIDRs holds the allowed sources of the listeners by listener id, nil if unsupported by the cloud
+	allowedCIDRs map[string][]string
+	lbs          []loadbalancers.LoadBalancer
+	// lbTagsUnsupported is set for a loadbalancer service which cannot tag loadbalancers
+	lbTagsUnsupported bool
+	tlsContainers     map[string]*openstack.TLSContainer
+	lbProviders       map[string]*openstack.LBProviderCapabilities
+	// lbAvailabilityZones are the availability zones of Octavia
+	lbAvailabilityZones []openstack.LBAvailabilityZone
+	// lbZones are the availability zones of the loadbalancers by ID
+	lbZones  map[string]string
+	pools    []v2pools.Pool
+	monitors []monitors.Monitor
+	members  map[string][]v2pools.Member
+	volumes  []cinder.Volume
+	// storageZones are the availability zones of cinder, the same as the compute zones if unset
+	storageZones []string
+	// volumeTypes are the available volume types, standard and fast-ssd if unset
+	volumeTypes []openstack.VolumeType
+	// encryptedVolumeTypes and hiddenVolumeTypes are the IDs of the encrypted volume types and of the volume
+	// types whose encryption type the policy of the cloud hides
+	encryptedVolumeTypes []string
+	hiddenVolumeTypes    []string
+	// encryptionRequests counts the encryption types read
+	encryptionRequests int
+	// flavors are the available flavors, m1.small if unset
+	flavors []flavors.Flavor
+	// images are the available images, an active ubuntu image if unset
+	images []openstack.Image
+	rules  []sgr.SecGroupRule
+	// securityGroups are the existing security groups
+	securityGroups []sg.SecGroup
+	// lbWaits holds the loadbalancers which were waited on to become ACTIVE
+	lbWaits []string
+	// serverRequests holds the request bodies of the created servers
+	serverRequests []map[string]interface{}
+	// startedServers holds the ids of the started servers
+	startedServers []string
+	// portRequests holds the options of the created ports
+	portRequests []ports.CreateOpts
+	ports        []ports.Port
+	// portSecurity holds the port_security_enabled attribute of the ports by port id
+	portSecurity map[string]*bool
+	// externalNetwork is the external network of the floating IPs
+	externalNetwork *networks.Network
+	floatingIPs     []l3floatingip.FloatingIP
+	// missingExtensions are the aliases of the Neutron extensions the cloud does not have
+	missingExtensions []string
+	trunks            []openstack.Trunk
+	serverGroups      []servergroups.ServerGroup
+	// serverGroupLists counts the listings of the server groups
+	serverGroupLists int
+
+	// computeClient and lbClient are used by tasks which call gophercloud directly
+	computeClient *gophercloud.ServiceClient
+	lbClient      *gophercloud.ServiceClient
+}
+
+func (c *mockCloud) GetNetwork(id string) (*networks.Network, error) {
+	for i := range c.networks {
+		if c.networks[i].ID == id {
+			return &c.networks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("network %s not found", id)
+}
+
+func (c *mockCloud) ListNetworks(opt networks.ListOptsBuilder) ([]networks.Network, error) {
+	o := opt.(networks.ListOpts)
+	var rs []networks.Network
+	for _, n := range c.networks {
+		if o.ID != "" && o.ID != n.ID {
+			continue
+		}
+		if o.Name != "" && o.Name != n.Name {
+			continue
+		}
+		if o.Tags != "" && !hasTags(n.Tags, strings.Split(o.Tags, ",")) {
+			continue
+		}
+		rs = append(rs, n)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) CreateNetwork(opt networks.CreateOptsBuilder) (*networks.Network, error) {
+	o := opt.(networks.CreateOpts)
+	n := networks.Network{
+		ID:   fmt.Sprintf("network-%d", len(c.networks)+1),
+		Name: o.Name,
+	}
+	c.networks = append(c.networks, n)
+	return &n, nil
+}
+
+func (c *mockCloud) SetResourceTags(resourceType string, resourceID string, tags []string) error {
+	switch resourceType {
+	case openstack.ResourceTypeNetwork:
+		for i := range c.networks {
+			if c.networks[i].ID == resourceID {
+				c.networks[i].Tags = tags
+				return nil
+			}
+		}
+	case openstack.ResourceTypeSubnet:
+		for i := range c.subnets {
+			if c.subnets[i].ID == resourceID {
+				c.subnets[i].Tags = tags
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s %s not found", resourceType, resourceID)
+}
+
+func (c *mockCloud) ListSubnets(opt subnets.ListOptsBuilder) ([]subnets.Subnet, error) {
+	o := opt.(subnets.ListOpts)
+	var rs []subnets.Subnet
+	for _, s := range c.subnets {
+		if o.ID != "" && o.ID != s.ID {
+			continue
+		}
+		if o.Name != "" && o.Name != s.Name {
+			continue
+		}
+		if o.NetworkID != "" && o.NetworkID != s.NetworkID {
+			continue
+		}
+		if o.CIDR != "" && o.CIDR != s.CIDR {
+			continue
+		}
+		if o.Tags != "" && !hasTags(s.Tags, strings.Split(o.Tags, ",")) {
+			continue
+		}
+		// subnets without an ip version are IPv4
+		if o.IPVersion != 0 && o.IPVersion != s.IPVersion && !(o.IPVersion == 4 && s.IPVersion == 0) {
+			continue
+		}
+		rs = append(rs, s)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) CreateSubnet(opt subnets.CreateOptsBuilder) (*subnets.Subnet, error) {
+	o := opt.(subnets.CreateOpts)
+	s := subnets.Subnet{
+		ID:              fmt.Sprintf("subnet-%d", len(c.subnets)+1),
+		Name:            o.Name,
+		NetworkID:       o.NetworkID,
+		CIDR:            o.CIDR,
+		DNSNameservers:  o.DNSNameservers,
+		HostRoutes:      o.HostRoutes,
+		IPVersion:       int(o.IPVersion),
+		IPv6AddressMode: o.IPv6AddressMode,
+		IPv6RAMode:      o.IPv6RAMode,
+	}
+	c.subnets = append(c.subnets, s)
+	return &s, nil
+}
+
+func (c *mockCloud) CreateListener(opt listeners.CreateOptsBuilder) (*listeners.Listener, error) {
+	var allowedCIDRs []string
+	if lo, ok := opt.(openstack.ListenerCreateOpts); ok {
+		opt = lo.CreateOptsBuilder
+		allowedCIDRs = lo.AllowedCIDRs
+	}
+	opts := opt.(listeners.CreateOpts)
+	l := listeners.Listener{
+		ID:                     fmt.Sprintf("listener-%d", len(c.listeners)+1),
+		Name:                   opts.Name,
+		Protocol:               string(opts.Protocol),
+		ProtocolPort:           opts.ProtocolPort,
+		DefaultPoolID:          opts.DefaultPoolID,
+		DefaultTlsContainerRef: opts.DefaultTlsContainerRef,
+		SniContainerRefs:       opts.SniContainerRefs,
+		Loadbalancers:          []listeners.LoadBalancerID{{ID: opts.LoadbalancerID}},
+	}
+	c.listeners = append(c.listeners, l)
+	if allowedCIDRs != nil {
+		c.allowedCIDRs[l.ID] = allowedCIDRs
+	}
+	return &l, nil
+}
+
+func (c *mockCloud) UpdateListener(listenerID string, opt listeners.UpdateOptsBuilder) (*listeners.Listener, error) {
+	if lo, ok := opt.(openstack.ListenerUpdateOpts); ok {
+		opt = lo.UpdateOptsBuilder
+		if lo.AllowedCIDRs != nil {
+			c.allowedCIDRs[listenerID] = *lo.AllowedCIDRs
+		}
+	}
+	opts := opt.(listeners.UpdateOpts)
+	for i := range c.listeners {
+		l := &c.listeners[i]
+		if l.ID != listenerID {
+			continue
+		}
+		if opts.DefaultTlsContainerRef != "" {
+			l.DefaultTlsContainerRef = opts.DefaultTlsContainerRef
+		}
+		if opts.SniContainerRefs != nil {
+			l.SniContainerRefs = opts.SniContainerRefs
+		}
+		if opts.AdminStateUp != nil {
+			l.AdminStateUp = *opts.AdminStateUp
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("listener %s not found", listenerID)
+}
+
+func (c *mockCloud) SupportsLBTags() (bool, error) {
+	return !c.lbTagsUnsupported, nil
+}
+
+func (c *mockCloud) SupportsListenerAllowedCIDRs() (bool, error) {
+	return c.allowedCIDRs != nil, nil
+}
+
+func (c *mockCloud) GetListenerAllowedCIDRs(listenerID string) ([]string, error) {
+	return c.allowedCIDRs[listenerID], nil
+}
+
+func (c *mockCloud) GetTLSContainer(ref string) (*openstack.TLSContainer, error) {
+	container, ok := c.tlsContainers[ref]
+	if !ok {
+		return nil, fmt.Errorf("TLS container %s not found", ref)
+	}
+	return container, nil
+}
+
+func (c *mockCloud) ListListeners(opts listeners.ListOpts) ([]listeners.Listener, error) {
+	var rs []listeners.Listener
+	for _, l := range c.listeners {
+		if opts.ID != "" && opts.ID != l.ID {
+			continue
+		}
+		if opts.Name != "" && opts.Name != l.Name {
+			continue
+		}
+		if opts.ProtocolPort != 0 && opts.ProtocolPort != l.ProtocolPort {
+			continue
+		}
+		if opts.LoadbalancerID != "" && (len(l.Loadbalancers) == 0 || l.Loadbalancers[0].ID != opts.LoadbalancerID) {
+			continue
+		}
+		rs = append(rs, l)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) DeleteListener(listenerID string) error {
+	for i, l := range c.listeners {
+		if l.ID == listenerID {
+			c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("listener %s not found", listenerID)
+}
+
+func (c *mockCloud) ListServerGroups() ([]servergroups.ServerGroup, error) {
+	c.serverGroupLists++
+	return c.serverGroups, nil
+}
+
+func (c *mockCloud) GetServerGroupByName(name string) (*servergroups.ServerGroup, error) {
+	return openstack.FindServerGroupByName(c.serverGroups, name)
+}
+
+func (c *mockCloud) CreateServerGroup(opt servergroups.CreateOptsBuilder) (*servergroups.ServerGroup, error) {
+	o := opt.(servergroups.CreateOpts)
+	g := servergroups.ServerGroup{
+		ID:       fmt.Sprintf("sg-%d", len(c.serverGroups)+1),
+		Name:     o.Name,
+		Policies: o.Policies,
+	}
+	c.serverGroups = append(c.serverGroups, g)
+	return &g, nil
+}
+
+func (c *mockCloud) ListLBs(opt loadbalancers.ListOptsBuilder) ([]loadbalancers.LoadBalancer, error) {
+	o := opt.(loadbalancers.ListOpts)
+	var rs []loadbalancers.LoadBalancer
+	for _, lb := range c.lbs {
+		if o.Name != "" && o.Name != lb.Name {
+			continue
+		}
+		rs = append(rs, lb)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) ListPools(opts v2pools.ListOpts) ([]v2pools.Pool, error) {
+	var rs []v2pools.Pool
+	for _, p := range c.pools {
+		if opts.ID != "" && opts.ID != p.ID {
+			continue
+		}
+		if opts.Name != "" && opts.Name != p.Name {
+			continue
+		}
+		rs = append(rs, p)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) UseOctavia() bool {
+	return c.lbProviders != nil
+}
+
+func (c *mockCloud) UpdateLB(lbID string, opts loadbalancers.UpdateOpts) (*loadbalancers.LoadBalancer, error) {
+	for i := range c.lbs {
+		lb := &c.lbs[i]
+		if lb.ID != lbID {
+			continue
+		}
+		if opts.AdminStateUp != nil {
+			lb.AdminStateUp = *opts.AdminStateUp
+		}
+		if opts.Tags != nil {
+			lb.Tags = *opts.Tags
+		}
+		return lb, nil
+	}
+	return nil, fmt.Errorf("loadbalancer %s not found", lbID)
+}
+
+func (c *mockCloud) ListLoadBalancerAvailabilityZones() ([]openstack.LBAvailabilityZone, error) {
+	return c.lbAvailabilityZones, nil
+}
+
+func (c *mockCloud) GetLBAvailabilityZone(lbID string) (string, error) {
+	return c.lbZones[lbID], nil
+}
+
+func (c *mockCloud) LBProviderCapabilities(provider string) (*openstack.LBProviderCapabilities, error) {
+	capabilities, ok := c.lbProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("loadbalancer provider %q is not enabled", provider)
+	}
+	return capabilities, nil
+}
+
+func (c *mockCloud) ComputeClient() *gophercloud.ServiceClient {
+	return c.computeClient
+}
+
+func (c *mockCloud) LoadBalancerClient() (*gophercloud.ServiceClient, error) {
+	return c.lbClient, nil
+}
+
+func (c *mockCloud) CreatePool(opts v2pools.CreateOpts) (*v2pools.Pool, error) {
+	p := v2pools.Pool{
+		ID:       fmt.Sprintf("pool-%d", len(c.pools)+1),
+		Name:     opts.Name,
+		LBMethod: string(opts.LBMethod),
+		Protocol: string(opts.Protocol),
+	}
+	if opts.Persistence != nil {
+		p.Persistence = *opts.Persistence
+	}
+	c.pools = append(c.pools, p)
+	return &p, nil
+}
+
+func (c *mockCloud) CreateMonitor(opts monitors.CreateOpts) (*monitors.Monitor, error) {
+	m := monitors.Monitor{
+		ID:         fmt.Sprintf("monitor-%d", len(c.monitors)+1),
+		Name:       opts.Name,
+		Type:       opts.Type,
+		Delay:      opts.Delay,
+		Timeout:    opts.Timeout,
+		MaxRetries: opts.MaxRetries,
+		Pools:      []monitors.PoolID{{ID: opts.PoolID}},
+	}
+	c.monitors = append(c.monitors, m)
+	return &m, nil
+}
+
+func (c *mockCloud) ListMonitors(opts monitors.ListOpts) ([]monitors.Monitor, error) {
+	var result []monitors.Monitor
+	for _, m := range c.monitors {
+		if opts.Name != "" && m.Name != opts.Name {
+			continue
+		}
+		if opts.PoolID != "" && (len(m.Pools) == 0 || m.Pools[0].ID != opts.PoolID) {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func (c *mockCloud) UpdatePoolMonitor(monitorID string, opts monitors.UpdateOpts) (*monitors.Monitor, error) {
+	for i := range c.monitors {
+		if c.monitors[i].ID == monitorID {
+			c.monitors[i].Delay = opts.Delay
+			c.monitors[i].Timeout = opts.Timeout
+			c.monitors[i].MaxRetries = opts.MaxRetries
+			return &c.monitors[i], nil
+		}
+	}
+	return nil, fmt.Errorf("monitor %s not found", monitorID)
+}
+
+func (c *mockCloud) AssociateToPool(server *servers.Server, poolID string, opts v2pools.CreateMemberOpts) (*v2pools.Member, error) {
+	if c.members == nil {
+		c.members = make(map[string][]v2pools.Member)
+	}
+	m := v2pools.Member{
+		ID:           fmt.Sprintf("member-%d", len(c.members[poolID])+1),
+		Name:         opts.Name,
+		Address:      opts.Address,
+		ProtocolPort: opts.ProtocolPort,
+		PoolID:       poolID,
+		Weight:       1,
+	}
+	if opts.Weight != nil {
+		m.Weight = *opts.Weight
+	}
+	c.members[poolID] = append(c.members[poolID], m)
+	return &m, nil
+}
+
+func (c *mockCloud) ListPoolMembers(poolID string, opts v2pools.ListMembersOpts) ([]v2pools.Member, error) {
+	var rs []v2pools.Member
+	for _, m := range c.members[poolID] {
+		if opts.Name != "" && opts.Name != m.Name {
+			continue
+		}
+		rs = append(rs, m)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) UpdatePoolMember(poolID string, memberID string, opts v2pools.UpdateMemberOpts) (*v2pools.Member, error) {
+	for i := range c.members[poolID] {
+		m := &c.members[poolID][i]
+		if m.ID != memberID {
+			continue
+		}
+		if opts.Weight != nil {
+			m.Weight = *opts.Weight
+		}
+		updated := *m
+		return &updated, nil
+	}
+	return nil, fmt.Errorf("member %s not found", memberID)
+}
+
+func (c *mockCloud) DeletePoolMember(poolID string, memberID string) error {
+	for i, m := range c.members[poolID] {
+		if m.ID == memberID {
+			c.members[poolID] = append(c.members[poolID][:i], c.members[poolID][i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *mockCloud) GetLBPool(poolID string) (*v2pools.Pool, error) {
+	for i := range c.pools {
+		if c.pools[i].ID == poolID {
+			return &c.pools[i], nil
+		}
+	}
+	return nil, fmt.Errorf("pool %s not found", poolID)
+}
+
+func (c *mockCloud) GetCloudTags() map[string]string {
+	return map[string]string{}
+}
+
+func (c *mockCloud) GetStorageAZFromCompute(azName string) (*az.AvailabilityZone, error) {
+	if c.storageZones == nil {
+		return &az.AvailabilityZone{ZoneName: azName}, nil
+	}
+	for _, zone := range c.storageZones {
+		if zone == azName {
+			return &az.AvailabilityZone{ZoneName: zone}, nil
+		}
+	}
+	if len(c.storageZones) == 1 {
+		return &az.AvailabilityZone{ZoneName: c.storageZones[0]}, nil
+	}
+	return nil, fmt.Errorf("no storage availability zone for compute availability zone %s", azName)
+}
+
+func (c *mockCloud) ListVolumes(opt cinder.ListOptsBuilder) ([]cinder.Volume, error) {
+	o := opt.(cinder.ListOpts)
+	var rs []cinder.Volume
+	for _, v := range c.volumes {
+		if o.Name != "" && o.Name != v.Name {
+			continue
+		}
+		// like the API, every listing returns its own metadata
+		metadata := make(map[string]string)
+		for k, val := range v.Metadata {
+			metadata[k] = val
+		}
+		v.Metadata = metadata
+		rs = append(rs, v)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) SetVolumeTags(id string, tags map[string]string) error {
+	for i := range c.volumes {
+		if c.volumes[i].ID == id {
+			c.volumes[i].Metadata = tags
+			return nil
+		}
+	}
+	return fmt.Errorf("volume %s not found", id)
+}
+
+func (c *mockCloud) ListVolumeTypes() ([]openstack.VolumeType, error) {
+	if c.volumeTypes == nil {
+		return []openstack.VolumeType{{ID: "type-1", Name: "standard"}, {ID: "type-2", Name: "fast-ssd"}}, nil
+	}
+	return c.volumeTypes, nil
+}
+
+func (c *mockCloud) VolumeTypeEncrypted(typeID string) (bool, error) {
+	c.encryptionRequests++
+	if sets.NewString(c.hiddenVolumeTypes...).Has(typeID) {
+		return false, &openstack.EncryptionTypeHiddenError{TypeID: typeID}
+	}
+	return sets.NewString(c.encryptedVolumeTypes...).Has(typeID), nil
+}
+
+func (c *mockCloud) GetFlavor(name string) (*flavors.Flavor, error) {
+	fs := c.flavors
+	if fs == nil {
+		fs = []flavors.Flavor{{ID: "flavor-1", Name: "m1.small"}}
+	}
+	for i := range fs {
+		if fs[i].ID == name || fs[i].Name == name {
+			return &fs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("flavor %q not found", name)
+}
+
+func (c *mockCloud) GetImage(nameOrID string) (*openstack.Image, error) {
+	images := c.images
+	if images == nil {
+		images = []openstack.Image{{ID: "image-1", Name: "ubuntu", Status: "active"}}
+	}
+	for i := range images {
+		if images[i].ID == nameOrID || images[i].Name == nameOrID {
+			return &images[i], nil
+		}
+	}
+	return nil, fmt.Errorf("image %q not found", nameOrID)
+}
+
+func (c *mockCloud) CreateVolume(opt cinder.CreateOptsBuilder) (*cinder.Volume, error) {
+	multiattach := false
+	if mo, ok := opt.(openstack.MultiattachCreateOpts); ok {
+		opt, multiattach = mo.CreateOptsBuilder, mo.Multiattach
+	}
+	o := opt.(cinder.CreateOpts)
+	encrypted := false
+	for _, t := range c.volumeTypes {
+		if t.Name == o.VolumeType {
+			encrypted = sets.NewString(c.encryptedVolumeTypes...).Has(t.ID)
+		}
+	}
+	v := cinder.Volume{
+		Multiattach:      multiattach,
+		Encrypted:        encrypted,
+		ID:               fmt.Sprintf("volume-%d", len(c.volumes)+1),
+		Name:             o.Name,
+		Size:             o.Size,
+		VolumeType:       o.VolumeType,
+		AvailabilityZone: o.AvailabilityZone,
+		Metadata:         o.Metadata,
+	}
+	c.volumes = append(c.volumes, v)
+	return &v, nil
+}
+
+func (c *mockCloud) WaitForVolumeAvailable(volumeID string) error {
+	for _, v := range c.volumes {
+		if v.ID == volumeID {
+			return nil
+		}
+	}
+	return fmt.Errorf("volume %s not found", volumeID)
+}
+
+func (c *mockCloud) CreateInstance(opt servers.CreateOptsBuilder) (*servers.Server, error) {
+	body, err := opt.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	c.serverRequests = append(c.serverRequests, body)
+	return &servers.Server{ID: fmt.Sprintf("server-%d", len(c.serverRequests))}, nil
+}
+
+func (c *mockCloud) StartInstance(instanceID string) error {
+	c.startedServers = append(c.startedServers, instanceID)
+	return nil
+}
+
+func (c *mockCloud) CreatePort(opt ports.CreateOptsBuilder) (*ports.Port, error) {
+	var enabled *bool
+	if ps, ok := opt.(openstack.PortSecurityCreateOpts); ok {
+		opt, enabled = ps.CreateOptsBuilder, ps.PortSecurityEnabled
+	}
+	o := opt.(ports.CreateOpts)
+	c.portRequests = append(c.portRequests, o)
+	port := ports.Port{ID: fmt.Sprintf("port-%d", len(c.portRequests)), Name: o.Name, NetworkID: o.NetworkID, AllowedAddressPairs: o.AllowedAddressPairs}
+	if o.SecurityGroups != nil {
+		port.SecurityGroups = *o.SecurityGroups
+	}
+	c.ports = append(c.ports, port)
+	c.setPortSecurity(port.ID, enabled)
+	return &port, nil
+}
+
+func (c *mockCloud) setPortSecurity(id string, enabled *bool) {
+	if enabled == nil {
+		return
+	}
+	if c.portSecurity == nil {
+		c.portSecurity = make(map[string]*bool)
+	}
+	c.portSecurity[id] = enabled
+}
+
+func (c *mockCloud) GetPortSecurityEnabled(id string) (*bool, error) {
+	return c.portSecurity[id], nil
+}
+
+func (c *mockCloud) ListPorts(opt ports.ListOptsBuilder) ([]ports.Port, error) {
+	o := opt.(ports.ListOpts)
+	var rs []ports.Port
+	for _, p := range c.ports {
+		if o.Name != "" && o.Name != p.Name {
+			continue
+		}
+		rs = append(rs, p)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) GetPort(id string) (*ports.Port, error) {
+	for i := range c.ports {
+		if c.ports[i].ID == id {
+			return &c.ports[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *mockCloud) UpdatePort(id string, opt ports.UpdateOptsBuilder) (*ports.Port, error) {
+	port, _ := c.GetPort(id)
+	if port == nil {
+		return nil, fmt.Errorf("port %s not found", id)
+	}
+	if ps, ok := opt.(openstack.PortSecurityUpdateOpts); ok {
+		opt = ps.UpdateOptsBuilder
+		c.setPortSecurity(id, ps.PortSecurityEnabled)
+	}
+	o := opt.(ports.UpdateOpts)
+	if o.AllowedAddressPairs != nil {
+		port.AllowedAddressPairs = *o.AllowedAddressPairs
+	}
+	if o.SecurityGroups != nil {
+		port.SecurityGroups = *o.SecurityGroups
+	}
+	return port, nil
+}
+
+func (c *mockCloud) ListSecurityGroups(opt sg.ListOpts) ([]sg.SecGroup, error) {
+	var rs []sg.SecGroup
+	for _, g := range c.securityGroups {
+		if opt.Name != "" && opt.Name != g.Name {
+			continue
+		}
+		rs = append(rs, g)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) ListSecurityGroupRules(opt sgr.ListOpts) ([]sgr.SecGroupRule, error) {
+	var rules []sgr.SecGroupRule
+	for _, r := range c.rules {
+		if opt.SecGroupID != "" && opt.SecGroupID != r.SecGroupID {
+			continue
+		}
+		if opt.Direction != "" && opt.Direction != r.Direction {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (c *mockCloud) EnsureSecurityGroupRule(opt sgr.CreateOpts) (*sgr.SecGroupRule, error) {
+	rule := sgr.SecGroupRule{
+		ID:             fmt.Sprintf("rule-%d", len(c.rules)+1),
+		Direction:      string(opt.Direction),
+		EtherType:      string(opt.EtherType),
+		SecGroupID:     opt.SecGroupID,
+		PortRangeMin:   opt.PortRangeMin,
+		PortRangeMax:   opt.PortRangeMax,
+		Protocol:       string(opt.Protocol),
+		RemoteGroupID:  opt.RemoteGroupID,
+		RemoteIPPrefix: opt.RemoteIPPrefix,
+	}
+	c.rules = append(c.rules, rule)
+	return &rule, nil
+}
+
+func (c *mockCloud) DeleteSecurityGroupRule(ruleID string) error {
+	for i := range c.rules {
+		if c.rules[i].ID == ruleID {
+			c.rules = append(c.rules[:i], c.rules[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *mockCloud) WaitForLoadBalancerActive(lbID string) error {
+	c.lbWaits = append(c.lbWaits, lbID)
+	return nil
+}
+
+func (c *mockCloud) GetExternalNetwork() (*networks.Network, error) {
+	if c.externalNetwork == nil {
+		return nil, fmt.Errorf("no external network found")
+	}
+	return c.externalNetwork, nil
+}
+
+func (c *mockCloud) GetLBFloatingSubnet() (*subnets.Subnet, error) {
+	return nil, nil
+}
+
+func (c *mockCloud) EnsureFloatingIP(networkID string) (*l3floatingip.FloatingIP, error) {
+	for i := range c.floatingIPs {
+		if c.floatingIPs[i].FloatingNetworkID == networkID && c.floatingIPs[i].PortID == "" {
+			return &c.floatingIPs[i], nil
+		}
+	}
+	c.floatingIPs = append(c.floatingIPs, l3floatingip.FloatingIP{
+		ID:                fmt.Sprintf("fip-%d", len(c.floatingIPs)+1),
+		FloatingNetworkID: networkID,
+	})
+	return &c.floatingIPs[len(c.floatingIPs)-1], nil
+}
+
+func (c *mockCloud) AssociateL3FloatingIPToPort(fipID string, portID string) error {
+	for i := range c.floatingIPs {
+		if c.floatingIPs[i].ID == fipID {
+			c.floatingIPs[i].PortID = portID
+			return nil
+		}
+	}
+	return fmt.Errorf("floating ip %s not found", fipID)
+}
+
+func (c *mockCloud) HasExtension(service string, alias string) (bool, error) {
+	for _, missing := range c.missingExtensions {
+		if missing == alias {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *mockCloud) ListTrunks(opts openstack.TrunkListOpts) ([]openstack.Trunk, error) {
+	var rs []openstack.Trunk
+	for _, t := range c.trunks {
+		if opts.Name != "" && opts.Name != t.Name {
+			continue
+		}
+		if opts.PortID != "" && opts.PortID != t.PortID {
+			continue
+		}
+		rs = append(rs, t)
+	}
+	return rs, nil
+}
+
+func (c *mockCloud) CreateTrunk(opts openstack.TrunkCreateOpts) (*openstack.Trunk, error) {
+	trunk := openstack.Trunk{ID: fmt.Sprintf("trunk-%d", len(c.trunks)+1), Name: opts.Name, PortID: opts.PortID, SubPorts: opts.SubPorts}
+	c.trunks = append(c.trunks, trunk)
+	return &trunk, nil
+}
+
+func (c *mockCloud) AddTrunkSubPorts(trunkID string, subPorts []openstack.SubPort) (*openstack.Trunk, error) {
+	for i := range c.trunks {
+		if c.trunks[i].ID == trunkID {
+			c.trunks[i].SubPorts = append(c.trunks[i].SubPorts, subPorts...)
+			return &c.trunks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("trunk %s not found", trunkID)
+}
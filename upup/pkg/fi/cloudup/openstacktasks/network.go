@@ -27,8 +27,10 @@ import (
 
 //go:generate fitask -type=Network
 type Network struct {
-	ID        *string
-	Name      *string
+	ID   *string
+	Name *string
+	// Tags are the Neutron tags of the network, which is found by its name and tags
+	Tags      []string
 	Lifecycle *fi.Lifecycle
 }
 
@@ -53,14 +55,33 @@ func (n *Network) Find(context *fi.Context) (*Network, error) {
 	}
 
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if err := dropUnsupportedTags(cloud, &n.Tags); err != nil {
+		return nil, err
+	}
 	opt := networks.ListOpts{
 		ID:   fi.StringValue(n.ID),
 		Name: fi.StringValue(n.Name),
 	}
+	if n.ID == nil {
+		opt.Tags = openstack.TagFilter(n.Tags)
+	}
 	ns, err := cloud.ListNetworks(opt)
 	if err != nil {
 		return nil, err
 	}
+	if ns == nil && n.ID == nil {
+		var all []networks.Network
+		untagged, err := findUntagged(n.Tags, func() (int, error) {
+			all, err = cloud.ListNetworks(networks.ListOpts{Name: fi.StringValue(n.Name)})
+			return len(all), err
+		}, func(i int) []string { return all[i].Tags })
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range untagged {
+			ns = append(ns, all[i])
+		}
+	}
 	if ns == nil {
 		return nil, nil
 	} else if len(ns) != 1 {
@@ -71,6 +92,7 @@ func (n *Network) Find(context *fi.Context) (*Network, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create new Network object: %v", err)
 	}
+	actual.Tags = actualTags(v.Tags, n.Tags)
 	n.ID = actual.ID
 	return actual, nil
 }
@@ -96,7 +118,7 @@ func (_ *Network) CheckChanges(a, e, changes *Network) error {
 }
 
 func (_ *Network) ShouldCreate(a, e, changes *Network) (bool, error) {
-	return a == nil, nil
+	return a == nil || changes.Tags != nil, nil
 }
 
 func (_ *Network) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *Network) error {
@@ -115,8 +137,14 @@ func (_ *Network) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes
 
 		e.ID = fi.String(v.ID)
 		glog.V(2).Infof("Creating a new Openstack network, id=%s", v.ID)
+		if len(e.Tags) > 0 {
+			return renderTags(t.Cloud, openstack.ResourceTypeNetwork, v.ID, nil, e.Tags)
+		}
 		return nil
 	}
+	if changes.Tags != nil {
+		return renderTags(t.Cloud, openstack.ResourceTypeNetwork, fi.StringValue(a.ID), a.Tags, e.Tags)
+	}
 
 	glog.V(2).Infof("Openstack task Network::RenderOpenstack did nothing")
 	return nil
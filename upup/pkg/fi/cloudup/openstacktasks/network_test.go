@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func runNetworkTask(t *testing.T, cloud *mockCloud, e *Network) {
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding network: %v", err)
+	}
+	changes := e
+	if a != nil {
+		changes = &Network{}
+		if !fi.BuildChanges(a, e, changes) {
+			return
+		}
+	}
+	if err := e.CheckChanges(a, e, changes); err != nil {
+		t.Fatalf("unexpected error checking changes: %v", err)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+		t.Fatalf("unexpected error rendering network: %v", err)
+	}
+}
+
+func TestNetworkFindsByTags(t *testing.T) {
+	tag := openstack.ClusterTag("a.example.com")
+	cloud := &mockCloud{
+		networks: []networks.Network{
+			{ID: "network-1", Name: "cluster", Tags: []string{openstack.ClusterTag("b.example.com")}},
+			{ID: "network-2", Name: "cluster", Tags: []string{"foo", tag}},
+		},
+	}
+	e := &Network{Name: fi.String("cluster"), Tags: []string{tag}}
+	runNetworkTask(t, cloud, e)
+
+	if fi.StringValue(e.ID) != "network-2" {
+		t.Errorf("expected the network tagged for the cluster, got %q", fi.StringValue(e.ID))
+	}
+	if len(cloud.networks) != 2 {
+		t.Errorf("expected no network to be created, got %v", cloud.networks)
+	}
+	if fmt.Sprint(cloud.networks[1].Tags) != fmt.Sprintf("[foo %s]", tag) {
+		t.Errorf("expected the tags of the network to be kept, got %v", cloud.networks[1].Tags)
+	}
+}
+
+func TestNetworkAdoptsUntaggedNetwork(t *testing.T) {
+	tag := openstack.ClusterTag("a.example.com")
+	cloud := &mockCloud{
+		networks: []networks.Network{
+			{ID: "network-1", Name: "cluster", Tags: []string{openstack.ClusterTag("b.example.com")}},
+			{ID: "network-2", Name: "cluster", Tags: []string{"owner=ops"}},
+		},
+	}
+	e := &Network{Name: fi.String("cluster"), Tags: []string{tag}}
+	runNetworkTask(t, cloud, e)
+
+	if fi.StringValue(e.ID) != "network-2" {
+		t.Errorf("expected the network without a cluster tag to be adopted, got %q", fi.StringValue(e.ID))
+	}
+	if fmt.Sprint(cloud.networks[1].Tags) != fmt.Sprintf("[owner=ops %s]", tag) {
+		t.Errorf("expected the adopted network to be tagged, got %v", cloud.networks[1].Tags)
+	}
+	if len(cloud.networks[0].Tags) != 1 || cloud.networks[0].Tags[0] == tag {
+		t.Errorf("expected the network of the other cluster to be untouched, got %v", cloud.networks[0].Tags)
+	}
+}
+
+func TestNetworkCreatesTaggedNetwork(t *testing.T) {
+	tag := openstack.ClusterTag("a.example.com")
+	cloud := &mockCloud{
+		networks: []networks.Network{
+			{ID: "network-1", Name: "cluster", Tags: []string{openstack.ClusterTag("b.example.com")}},
+		},
+	}
+	e := &Network{Name: fi.String("cluster"), Tags: []string{tag}}
+	runNetworkTask(t, cloud, e)
+
+	if fi.StringValue(e.ID) != "network-2" {
+		t.Fatalf("expected a network to be created, got %q", fi.StringValue(e.ID))
+	}
+	if fmt.Sprint(cloud.networks[1].Tags) != fmt.Sprintf("[%s]", tag) {
+		t.Errorf("expected the new network to be tagged, got %v", cloud.networks[1].Tags)
+	}
+}
+
+func TestNetworkWithoutTagExtension(t *testing.T) {
+	cloud := &mockCloud{
+		networks: []networks.Network{
+			{ID: "network-1", Name: "cluster"},
+		},
+		missingExtensions: []string{openstack.ExtensionTags},
+	}
+	e := &Network{Name: fi.String("cluster"), Tags: []string{openstack.ClusterTag("a.example.com")}}
+	runNetworkTask(t, cloud, e)
+
+	if fi.StringValue(e.ID) != "network-1" {
+		t.Errorf("expected the network to be found by name, got %q", fi.StringValue(e.ID))
+	}
+	if len(cloud.networks) != 1 || len(cloud.networks[0].Tags) != 0 {
+		t.Errorf("expected the network to be left untagged, got %+v", cloud.networks)
+	}
+}
@@ -36,6 +36,9 @@ type PoolAssociation struct {
 	ServerGroup   *ServerGroup
 	InterfaceName *string
 	ProtocolPort  *int
+	// Weight is the relative share of requests sent to the members, a weight of 0 drains
+	// the members without removing them from the pool
+	Weight *int
 }
 
 // GetDependencies returns the dependencies of the Instance task
@@ -64,37 +67,47 @@ func (s *PoolAssociation) CompareWithID() *string {
 func (p *PoolAssociation) Find(context *fi.Context) (*PoolAssociation, error) {
 	cloud := context.Cloud.(openstack.OpenstackCloud)
 
-	opt := v2pools.ListOpts{
-		Name: fi.StringValue(p.Pool.Name),
-		ID:   fi.StringValue(p.Pool.ID),
-	}
-
-	rs, err := cloud.ListPools(opt)
-	if err != nil {
-		return nil, err
-	}
-	if rs == nil {
-		return nil, nil
-	} else if len(rs) != 1 {
-		return nil, fmt.Errorf("found multiple pools with name: %s", fi.StringValue(p.Pool.Name))
-	}
-
-	a := rs[0]
-	// check is member already created
-	found := false
-	for _, member := range a.Members {
-		poolMember, err := cloud.GetPool(a.ID, member.ID)
+	var a v2pools.Pool
+	if p.Pool.ID != nil {
+		pool, err := cloud.GetLBPool(fi.StringValue(p.Pool.ID))
+		if err != nil {
+			return nil, err
+		}
+		a = *pool
+	} else {
+		rs, err := cloud.ListPools(v2pools.ListOpts{
+			Name: fi.StringValue(p.Pool.Name),
+		})
 		if err != nil {
 			return nil, err
 		}
-		if fi.StringValue(p.Name) == poolMember.Name {
-			found = true
-			break
+		if rs == nil {
+			return nil, nil
+		} else if len(rs) != 1 {
+			return nil, fmt.Errorf("found multiple pools with name: %s", fi.StringValue(p.Pool.Name))
 		}
+		a = rs[0]
+	}
+
+	// check is member already created
+	members, err := cloud.ListPoolMembers(a.ID, v2pools.ListMembersOpts{
+		Name: fi.StringValue(p.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list members of pool %s: %v", a.ID, err)
 	}
 	// if not found it is created by returning nil, nil
 	// this is needed for instance in initial installation
-	if !found {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	desired, err := p.desiredMembers(cloud)
+	if err != nil {
+		return nil, err
+	}
+	if !p.membersInSync(members, desired) {
+		// the members are reconciled by creating the association again
+		glog.V(2).Infof("Members %s of pool %s do not match the servers of the server group", fi.StringValue(p.Name), a.ID)
 		return nil, nil
 	}
 	pool, err := NewLBPoolTaskFromCloud(cloud, p.Lifecycle, &a, nil)
@@ -109,6 +122,7 @@ func (p *PoolAssociation) Find(context *fi.Context) (*PoolAssociation, error) {
 		ServerGroup:   p.ServerGroup,
 		InterfaceName: p.InterfaceName,
 		ProtocolPort:  p.ProtocolPort,
+		Weight:        p.Weight,
 		Lifecycle:     p.Lifecycle,
 	}
 	p.ID = actual.ID
@@ -132,36 +146,63 @@ func (_ *PoolAssociation) CheckChanges(a, e, changes *PoolAssociation) error {
 			return fi.CannotChangeField("Name")
 		}
 	}
+	if e.Weight != nil && (*e.Weight < 0 || *e.Weight > maxMemberWeight) {
+		return fmt.Errorf("weight of pool association %s must be between 0 and %d, got %d", fi.StringValue(e.Name), maxMemberWeight, *e.Weight)
+	}
 	return nil
 }
 
 func (_ *PoolAssociation) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *PoolAssociation) error {
 	if a == nil {
+		poolID := fi.StringValue(e.Pool.ID)
+		protocolPort := fi.IntValue(e.ProtocolPort)
 
-		for _, serverID := range e.ServerGroup.Members {
-			server, err := servers.Get(t.Cloud.ComputeClient(), serverID).Extract()
-			if err != nil {
-				return fmt.Errorf("Failed to find server with id `%s`: %v", serverID, err)
-			}
+		// re-running an update must not add a second member for the same address
+		existing, err := t.Cloud.ListPoolMembers(poolID, v2pools.ListMembersOpts{})
+		if err != nil {
+			return fmt.Errorf("Failed to list members of pool %s: %v", poolID, err)
+		}
+		members := make(map[string]*v2pools.Member)
+		for i := range existing {
+			members[memberKey(existing[i].Address, existing[i].ProtocolPort)] = &existing[i]
+		}
 
-			memberAddress, err := openstack.GetServerFixedIP(server, fi.StringValue(e.InterfaceName))
+		desired, err := e.desiredMembers(t.Cloud)
+		if err != nil {
+			return err
+		}
+		for _, d := range desired {
+			if member, found := members[d.key]; found {
+				glog.V(2).Infof("Pool %s already has member %s for %s", poolID, member.ID, d.key)
+				e.ID = fi.String(member.ID)
+				if err := e.updateMemberWeight(t.Cloud, member); err != nil {
+					return err
+				}
+				continue
+			}
 
-			if err != nil {
-				return fmt.Errorf("Failed to get fixed ip for associated pool: %v", err)
+			if t.Cloud.UseOctavia() {
+				// Octavia refuses new members while the previous change is still being provisioned
+				if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(e.Pool.Loadbalancer.ID)); err != nil {
+					return err
+				}
 			}
 
-			member, err := t.Cloud.AssociateToPool(server, fi.StringValue(e.Pool.ID), v2pools.CreateMemberOpts{
+			member, err := t.Cloud.AssociateToPool(d.server, poolID, v2pools.CreateMemberOpts{
 				Name:         fi.StringValue(e.Name),
-				ProtocolPort: fi.IntValue(e.ProtocolPort),
+				ProtocolPort: protocolPort,
 				SubnetID:     fi.StringValue(e.Pool.Loadbalancer.VipSubnet),
-				Address:      memberAddress,
+				Address:      d.address,
+				Weight:       e.Weight,
 			})
 			if err != nil {
 				return fmt.Errorf("Failed to create member: %v", err)
 			}
+			members[d.key] = member
 			e.ID = fi.String(member.ID)
 		}
-		return nil
+
+		return e.removeStaleMembers(t.Cloud, existing, desired)
 	} else {
 		//TODO: Update Member, this is covered as `a` will always be nil
 		glog.V(2).Infof("Openstack task PoolAssociation::RenderOpenstack Update not implemented!")
@@ -170,3 +211,126 @@ func (_ *PoolAssociation) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e,
 	glog.V(2).Infof("Openstack task PoolAssociation::RenderOpenstack did nothing")
 	return nil
 }
+
+// updateMemberWeight changes the weight of an existing member to the weight of the association
+func (e *PoolAssociation) updateMemberWeight(cloud openstack.OpenstackCloud, member *v2pools.Member) error {
+	if e.Weight == nil || member.Weight == fi.IntValue(e.Weight) {
+		return nil
+	}
+	poolID := fi.StringValue(e.Pool.ID)
+	if cloud.UseOctavia() {
+		if err := cloud.WaitForLoadBalancerActive(fi.StringValue(e.Pool.Loadbalancer.ID)); err != nil {
+			return err
+		}
+	}
+	glog.V(2).Infof("Changing weight of member %s of pool %s from %d to %d", member.ID, poolID, member.Weight, fi.IntValue(e.Weight))
+	updated, err := cloud.UpdatePoolMember(poolID, member.ID, v2pools.UpdateMemberOpts{
+		Weight: e.Weight,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to update weight of member %s of pool %s: %v", member.ID, poolID, err)
+	}
+	*member = *updated
+	return nil
+}
+
+// desiredMember is the pool member of a server of the server group
+type desiredMember struct {
+	key     string
+	address string
+	server  *servers.Server
+}
+
+// desiredMembers returns the pool members of the servers of the server group, addressed by their fixed ip on the interface
+func (e *PoolAssociation) desiredMembers(cloud openstack.OpenstackCloud) ([]desiredMember, error) {
+	var desired []desiredMember
+	for _, serverID := range e.ServerGroup.Members {
+		server, err := servers.Get(cloud.ComputeClient(), serverID).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find server with id `%s`: %v", serverID, err)
+		}
+
+		memberAddress, err := openstack.GetServerFixedIP(server, fi.StringValue(e.InterfaceName))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get fixed ip for associated pool: %v", err)
+		}
+		desired = append(desired, desiredMember{
+			key:     memberKey(memberAddress, fi.IntValue(e.ProtocolPort)),
+			address: memberAddress,
+			server:  server,
+		})
+	}
+	return desired, nil
+}
+
+// membersInSync returns true if the members created by the association match the servers of the server group
+func (e *PoolAssociation) membersInSync(members []v2pools.Member, desired []desiredMember) bool {
+	actual := make(map[string]bool)
+	for _, m := range members {
+		if m.Name != fi.StringValue(e.Name) {
+			continue
+		}
+		if e.Weight != nil && m.Weight != fi.IntValue(e.Weight) {
+			// the weight is reconciled by creating the association again
+			return false
+		}
+		actual[memberKey(m.Address, m.ProtocolPort)] = true
+	}
+	for _, d := range desired {
+		if !actual[d.key] {
+			return false
+		}
+	}
+	if len(desired) == 0 {
+		// stale members are only removed once a server of the group is known
+		return true
+	}
+	for key := range actual {
+		if !containsMember(desired, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeStaleMembers removes the members created by the association whose address matches none of the servers
+// of the server group, e.g. those of a master replaced during a rolling update
+func (e *PoolAssociation) removeStaleMembers(cloud openstack.OpenstackCloud, members []v2pools.Member, desired []desiredMember) error {
+	if len(desired) == 0 {
+		// without a known server every member would be considered stale
+		return nil
+	}
+	poolID := fi.StringValue(e.Pool.ID)
+	for _, m := range members {
+		if m.Name != fi.StringValue(e.Name) || containsMember(desired, memberKey(m.Address, m.ProtocolPort)) {
+			continue
+		}
+		if cloud.UseOctavia() {
+			if err := cloud.WaitForLoadBalancerActive(fi.StringValue(e.Pool.Loadbalancer.ID)); err != nil {
+				return err
+			}
+		}
+		glog.Infof("Removing stale member %s (%s) from pool %s", m.ID, memberKey(m.Address, m.ProtocolPort), poolID)
+		if err := cloud.DeletePoolMember(poolID, m.ID); err != nil {
+			return fmt.Errorf("Failed to remove stale member %s from pool %s: %v", m.ID, poolID, err)
+		}
+	}
+	return nil
+}
+
+func containsMember(members []desiredMember, key string) bool {
+	for _, m := range members {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// maxMemberWeight is the highest weight accepted for a pool member
+const maxMemberWeight = 256
+
+// memberKey identifies a pool member by its address and port
+func memberKey(address string, port int) string {
+	return fmt.Sprintf("%s:%d", address, port)
+}
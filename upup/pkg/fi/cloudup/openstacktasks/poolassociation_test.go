@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// newMemberTestServer serves servers named server-<n> with the fixed ip 10.0.0.<n>
+func newMemberTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.HasPrefix(r.URL.Path, "/servers/server-") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/servers/")
+		n := strings.TrimPrefix(id, "server-")
+		fmt.Fprintf(w, `{"server": {"id": %q, "addresses": {"cluster": [{"addr": "10.0.0.%s", "version": 4, "OS-EXT-IPS:type": "fixed"}]}}}`, id, n)
+	}))
+}
+
+func newMemberTestTask(servers ...string) *PoolAssociation {
+	return &PoolAssociation{
+		Name:          fi.String("master"),
+		Pool:          &LBPool{ID: fi.String("pool-1"), Loadbalancer: &LB{VipSubnet: fi.String("subnet-1")}},
+		ServerGroup:   &ServerGroup{Members: servers},
+		InterfaceName: fi.String("cluster"),
+		ProtocolPort:  fi.Int(443),
+	}
+}
+
+func TestPoolAssociationSkipsExistingMembers(t *testing.T) {
+	server := newMemberTestServer()
+	defer server.Close()
+
+	cloud := &mockCloud{
+		computeClient: newTestServiceClient(server),
+		members: map[string][]v2pools.Member{
+			"pool-1": {{ID: "member-1", Address: "10.0.0.1", ProtocolPort: 443}},
+		},
+	}
+	e := newMemberTestTask("server-1")
+
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cloud.members["pool-1"]) != 1 {
+		t.Errorf("expected no duplicate member, got %v", cloud.members["pool-1"])
+	}
+	if fi.StringValue(e.ID) != "member-1" {
+		t.Errorf("expected existing member to be used, got %q", fi.StringValue(e.ID))
+	}
+}
+
+func TestPoolAssociationAddsNewMembers(t *testing.T) {
+	server := newMemberTestServer()
+	defer server.Close()
+
+	cloud := &mockCloud{
+		computeClient: newTestServiceClient(server),
+		members: map[string][]v2pools.Member{
+			"pool-1": {
+				{ID: "member-1", Address: "10.0.0.1", ProtocolPort: 443},
+				{ID: "member-2", Address: "10.0.0.2", ProtocolPort: 80},
+			},
+		},
+	}
+	e := newMemberTestTask("server-1", "server-2", "server-3")
+
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var added []string
+	for _, m := range cloud.members["pool-1"][2:] {
+		added = append(added, memberKey(m.Address, m.ProtocolPort))
+	}
+	if fmt.Sprint(added) != "[10.0.0.2:443 10.0.0.3:443]" {
+		t.Errorf("unexpected members added: %v", added)
+	}
+}
+
+func TestPoolAssociationRemovesStaleMembers(t *testing.T) {
+	server := newMemberTestServer()
+	defer server.Close()
+
+	cloud := &mockCloud{
+		computeClient: newTestServiceClient(server),
+		pools:         []v2pools.Pool{{ID: "pool-1", Name: "api"}},
+		members: map[string][]v2pools.Member{
+			"pool-1": {
+				{ID: "member-1", Name: "master", Address: "10.0.0.1", ProtocolPort: 443},
+				{ID: "member-2", Name: "master", Address: "10.0.0.2", ProtocolPort: 443},
+				{ID: "member-3", Name: "other", Address: "10.0.0.9", ProtocolPort: 443},
+			},
+		},
+	}
+	// server-2 was replaced by server-3 during a rolling update
+	e := newMemberTestTask("server-1", "server-3")
+
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding members: %v", err)
+	}
+	if a != nil {
+		t.Fatalf("expected the stale members to be reconciled, got %+v", a)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var keys []string
+	for _, m := range cloud.members["pool-1"] {
+		keys = append(keys, m.Name+"="+memberKey(m.Address, m.ProtocolPort))
+	}
+	if fmt.Sprint(keys) != "[master=10.0.0.1:443 other=10.0.0.9:443 master=10.0.0.3:443]" {
+		t.Errorf("unexpected members after reconciling: %v", keys)
+	}
+
+	a, err = e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding members: %v", err)
+	}
+	if a == nil {
+		t.Errorf("expected the members to be in sync after reconciling")
+	}
+}
+
+func TestPoolAssociationKeepsMembersWithoutServers(t *testing.T) {
+	cloud := &mockCloud{
+		members: map[string][]v2pools.Member{
+			"pool-1": {{ID: "member-1", Name: "master", Address: "10.0.0.1", ProtocolPort: 443}},
+		},
+	}
+	e := newMemberTestTask()
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cloud.members["pool-1"]) != 1 {
+		t.Errorf("expected members to be kept while no server is known, got %v", cloud.members["pool-1"])
+	}
+}
+
+func TestPoolAssociationDrainsMembers(t *testing.T) {
+	server := newMemberTestServer()
+	defer server.Close()
+
+	cloud := &mockCloud{
+		computeClient: newTestServiceClient(server),
+		pools:         []v2pools.Pool{{ID: "pool-1", Name: "api"}},
+		members: map[string][]v2pools.Member{
+			"pool-1": {{ID: "member-1", Name: "master", Address: "10.0.0.1", ProtocolPort: 443, Weight: 1}},
+		},
+	}
+	e := newMemberTestTask("server-1", "server-2")
+	e.Weight = fi.Int(0)
+
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding members: %v", err)
+	}
+	if a != nil {
+		t.Fatalf("expected the weight to be reconciled, got %+v", a)
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var weights []string
+	for _, m := range cloud.members["pool-1"] {
+		weights = append(weights, fmt.Sprintf("%s=%d", memberKey(m.Address, m.ProtocolPort), m.Weight))
+	}
+	if fmt.Sprint(weights) != "[10.0.0.1:443=0 10.0.0.2:443=0]" {
+		t.Errorf("expected members to be drained without removing them, got %v", weights)
+	}
+}
+
+func TestPoolAssociationRejectsInvalidWeight(t *testing.T) {
+	for _, weight := range []int{-1, maxMemberWeight + 1} {
+		e := newMemberTestTask()
+		e.Weight = fi.Int(weight)
+		if err := e.CheckChanges(nil, e, e); err == nil {
+			t.Errorf("expected weight %d to be rejected", weight)
+		}
+	}
+}
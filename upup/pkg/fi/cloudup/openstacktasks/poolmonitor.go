@@ -0,0 +1,174 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/monitors"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// monitorTypeUDPConnect is the health monitor type compatible with UDP pools
+const monitorTypeUDPConnect = "UDP-CONNECT"
+
+//go:generate fitask -type=PoolMonitor
+type PoolMonitor struct {
+	ID        *string
+	Name      *string
+	Lifecycle *fi.Lifecycle
+	Pool      *LBPool
+	// Type is the health check performed against the members, e.g. TCP or HTTP, UDP pools require UDP-CONNECT
+	Type *string
+	// Delay is the time in seconds between health checks
+	Delay *int
+	// Timeout is the time in seconds a health check waits for a reply
+	Timeout *int
+	// MaxRetries is the number of failed checks before a member is marked unhealthy
+	MaxRetries *int
+	// URLPath is the path requested by HTTP and HTTPS health checks
+	URLPath *string
+}
+
+// GetDependencies returns the dependencies of the PoolMonitor task
+func (e *PoolMonitor) GetDependencies(tasks map[string]fi.Task) []fi.Task {
+	var deps []fi.Task
+	for _, task := range tasks {
+		if _, ok := task.(*LBPool); ok {
+			deps = append(deps, task)
+		}
+	}
+	return deps
+}
+
+var _ fi.CompareWithID = &PoolMonitor{}
+
+func (m *PoolMonitor) CompareWithID() *string {
+	return m.ID
+}
+
+func (m *PoolMonitor) Find(context *fi.Context) (*PoolMonitor, error) {
+	if m.Pool == nil || m.Pool.ID == nil {
+		return nil, nil
+	}
+
+	cloud := context.Cloud.(openstack.OpenstackCloud)
+	monitorList, err := cloud.ListMonitors(monitors.ListOpts{
+		ID:     fi.StringValue(m.ID),
+		Name:   fi.StringValue(m.Name),
+		PoolID: fi.StringValue(m.Pool.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list pool monitors: %v", err)
+	}
+	if len(monitorList) == 0 {
+		return nil, nil
+	}
+	if len(monitorList) > 1 {
+		return nil, fmt.Errorf("Multiple pool monitors found for name %s", fi.StringValue(m.Name))
+	}
+
+	monitor := monitorList[0]
+	actual := &PoolMonitor{
+		ID:         fi.String(monitor.ID),
+		Name:       fi.String(monitor.Name),
+		Lifecycle:  m.Lifecycle,
+		Pool:       m.Pool,
+		Type:       fi.String(monitor.Type),
+		Delay:      fi.Int(monitor.Delay),
+		Timeout:    fi.Int(monitor.Timeout),
+		MaxRetries: fi.Int(monitor.MaxRetries),
+	}
+	if monitor.URLPath != "" {
+		actual.URLPath = fi.String(monitor.URLPath)
+	}
+	m.ID = actual.ID
+	return actual, nil
+}
+
+func (m *PoolMonitor) Run(context *fi.Context) error {
+	return fi.DefaultDeltaRunMethod(m, context)
+}
+
+func (_ *PoolMonitor) CheckChanges(a, e, changes *PoolMonitor) error {
+	if a == nil {
+		if e.Name == nil {
+			return fi.RequiredField("Name")
+		}
+		if e.Pool == nil {
+			return fi.RequiredField("Pool")
+		}
+		if e.Type == nil {
+			return fi.RequiredField("Type")
+		}
+	} else {
+		if changes.ID != nil {
+			return fi.CannotChangeField("ID")
+		}
+		if changes.Name != nil {
+			return fi.CannotChangeField("Name")
+		}
+		if changes.Pool != nil {
+			return fi.CannotChangeField("Pool")
+		}
+		if changes.Type != nil {
+			return fi.CannotChangeField("Type")
+		}
+	}
+	if e.Pool != nil && e.Pool.protocol() == v2pools.ProtocolUDP && fi.StringValue(e.Type) != monitorTypeUDPConnect {
+		return fmt.Errorf("pool monitor %s: UDP pools require a %s health monitor", fi.StringValue(e.Name), monitorTypeUDPConnect)
+	}
+	return nil
+}
+
+func (_ *PoolMonitor) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *PoolMonitor) error {
+	// the loadbalancer is immutable while a previous change is being provisioned
+	if err := t.Cloud.WaitForLoadBalancerActive(fi.StringValue(e.Pool.Loadbalancer.ID)); err != nil {
+		return err
+	}
+
+	if a == nil {
+		monitor, err := t.Cloud.CreateMonitor(monitors.CreateOpts{
+			Name:       fi.StringValue(e.Name),
+			PoolID:     fi.StringValue(e.Pool.ID),
+			Type:       fi.StringValue(e.Type),
+			Delay:      fi.IntValue(e.Delay),
+			Timeout:    fi.IntValue(e.Timeout),
+			MaxRetries: fi.IntValue(e.MaxRetries),
+			URLPath:    fi.StringValue(e.URLPath),
+		})
+		if err != nil {
+			return fmt.Errorf("error creating pool monitor: %v", err)
+		}
+		e.ID = fi.String(monitor.ID)
+		return nil
+	}
+
+	_, err := t.Cloud.UpdatePoolMonitor(fi.StringValue(a.ID), monitors.UpdateOpts{
+		Delay:      fi.IntValue(e.Delay),
+		Timeout:    fi.IntValue(e.Timeout),
+		MaxRetries: fi.IntValue(e.MaxRetries),
+		URLPath:    fi.StringValue(e.URLPath),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating pool monitor %s: %v", fi.StringValue(a.ID), err)
+	}
+	e.ID = a.ID
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"testing"
+
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestPoolMonitorCreateAndUpdate(t *testing.T) {
+	cloud := &mockCloud{}
+	target := openstack.NewOpenstackAPITarget(cloud)
+	context := &fi.Context{Cloud: cloud}
+
+	pool := &LBPool{
+		ID:           fi.String("pool-1"),
+		Name:         fi.String("api-https"),
+		Loadbalancer: &LB{ID: fi.String("lb-1")},
+	}
+	monitor := &PoolMonitor{
+		Name:       fi.String("api-https"),
+		Pool:       pool,
+		Type:       fi.String("TCP"),
+		Delay:      fi.Int(60),
+		Timeout:    fi.Int(30),
+		MaxRetries: fi.Int(3),
+	}
+
+	actual, err := monitor.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error finding monitor: %v", err)
+	}
+	if actual != nil {
+		t.Fatalf("expected no monitor, got %+v", actual)
+	}
+	if err := monitor.CheckChanges(nil, monitor, monitor); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := monitor.RenderOpenstack(target, nil, monitor, monitor); err != nil {
+		t.Fatalf("unexpected error creating monitor: %v", err)
+	}
+	if len(cloud.monitors) != 1 || cloud.monitors[0].Pools[0].ID != "pool-1" || cloud.monitors[0].Delay != 60 {
+		t.Fatalf("expected a monitor for pool-1, got %+v", cloud.monitors)
+	}
+	if len(cloud.lbWaits) != 1 || cloud.lbWaits[0] != "lb-1" {
+		t.Errorf("expected to wait for lb-1, got %v", cloud.lbWaits)
+	}
+
+	changed := &PoolMonitor{
+		Name:       fi.String("api-https"),
+		Pool:       pool,
+		Type:       fi.String("TCP"),
+		Delay:      fi.Int(20),
+		Timeout:    fi.Int(10),
+		MaxRetries: fi.Int(5),
+	}
+	actual, err = changed.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error finding monitor: %v", err)
+	}
+	if actual == nil || fi.IntValue(actual.Delay) != 60 {
+		t.Fatalf("expected existing monitor, got %+v", actual)
+	}
+	if err := changed.RenderOpenstack(target, actual, changed, changed); err != nil {
+		t.Fatalf("unexpected error updating monitor: %v", err)
+	}
+	if len(cloud.monitors) != 1 {
+		t.Fatalf("expected monitor to be updated in place, got %+v", cloud.monitors)
+	}
+	m := cloud.monitors[0]
+	if m.Delay != 20 || m.Timeout != 10 || m.MaxRetries != 5 {
+		t.Errorf("expected updated timings, got %+v", m)
+	}
+}
+
+func TestPoolMonitorCannotChangeType(t *testing.T) {
+	monitor := &PoolMonitor{Name: fi.String("api-https"), Type: fi.String("HTTP")}
+	changes := &PoolMonitor{Type: fi.String("HTTP")}
+	if err := monitor.CheckChanges(&PoolMonitor{}, monitor, changes); err == nil {
+		t.Errorf("expected error changing monitor type")
+	}
+}
+
+func TestUDPPoolRequiresUDPMonitor(t *testing.T) {
+	pool := &LBPool{
+		Name:         fi.String("dns-udp"),
+		Protocol:     fi.String("UDP"),
+		Loadbalancer: &LB{ID: fi.String("lb-1")},
+	}
+	grid := []struct {
+		monitorType string
+		valid       bool
+	}{
+		{monitorType: "TCP"},
+		{monitorType: "HTTP"},
+		{monitorType: "UDP-CONNECT", valid: true},
+	}
+	for _, g := range grid {
+		monitor := &PoolMonitor{Name: fi.String("dns-udp"), Pool: pool, Type: fi.String(g.monitorType)}
+		err := monitor.CheckChanges(nil, monitor, monitor)
+		if g.valid && err != nil {
+			t.Errorf("unexpected error for UDP pool with %s health monitor: %v", g.monitorType, err)
+		}
+		if !g.valid && err == nil {
+			t.Errorf("expected error for UDP pool with %s health monitor", g.monitorType)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
@@ -31,7 +32,22 @@ type Port struct {
 	Name           *string
 	Network        *Network
 	SecurityGroups []*SecurityGroup
-	Lifecycle      *fi.Lifecycle
+	// Subnets pins the port to a fixed IP on each subnet, e.g. an IPv4 and an IPv6 subnet for dual-stack instances.
+	// When unset Neutron picks the subnets of the network.
+	Subnets []*Subnet
+	// AllowedAddressPairs lets the port send and receive traffic of other addresses, e.g. of pods or a virtual IP,
+	// which the anti-spoofing rules of Neutron would drop otherwise
+	AllowedAddressPairs []ports.AddressPair
+	// PortSecurityEnabled toggles the anti-spoofing rules and the security groups of the port, which some CNIs
+	// require to be off. Disabling port security also disables the security groups of the port.
+	// When unset the default of the network applies.
+	PortSecurityEnabled *bool
+	// AdditionalSecurityGroups are the names or IDs of the additional security groups of the instance, which the
+	// instance adds to the port itself. They are kept on the port, but are not managed by the port.
+	AdditionalSecurityGroups []string
+	// Tags are the Neutron tags of the port, which is found by its name and tags
+	Tags      []string
+	Lifecycle *fi.Lifecycle
 }
 
 // GetDependencies returns the dependencies of the Port task
@@ -75,19 +91,86 @@ func NewPortTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecycl
 	}
 	if find != nil {
 		find.ID = actual.ID
+		// the fixed IPs of existing ports are not changed
+		actual.Subnets = find.Subnets
+		actual.AllowedAddressPairs = presentAddressPairs(port.AllowedAddressPairs, find.AllowedAddressPairs)
+		actual.Tags = actualTags(port.Tags, find.Tags)
+		additional, err := resolveSecurityGroups(cloud, find.AdditionalSecurityGroups)
+		if err != nil {
+			return nil, err
+		}
+		actual.SecurityGroups = withoutSecurityGroups(sgs, additional)
+		actual.AdditionalSecurityGroups = find.AdditionalSecurityGroups
+		if find.PortSecurityEnabled != nil {
+			enabled, err := cloud.GetPortSecurityEnabled(port.ID)
+			if err != nil {
+				return nil, err
+			}
+			actual.PortSecurityEnabled = enabled
+			if !fi.BoolValue(enabled) {
+				// the port has no security groups without port security
+				actual.SecurityGroups = find.SecurityGroups
+			}
+		}
 	}
 	return actual, nil
 }
 
+// withoutSecurityGroups returns the security groups of the port without the excluded ones, e.g. the additional
+// security groups of the instance
+func withoutSecurityGroups(existing []*SecurityGroup, excluded []string) []*SecurityGroup {
+	ids := sets.NewString(excluded...)
+	var kept []*SecurityGroup
+	for _, sg := range existing {
+		if !ids.Has(fi.StringValue(sg.ID)) {
+			kept = append(kept, sg)
+		}
+	}
+	return kept
+}
+
+// presentAddressPairs returns the wanted address pairs which the port already has, pairs added
+// to the port by others are ignored. A pair without a MAC address matches the pair Neutron
+// created for it with the MAC address of the port.
+func presentAddressPairs(existing []ports.AddressPair, wanted []ports.AddressPair) []ports.AddressPair {
+	var present []ports.AddressPair
+	for _, w := range wanted {
+		for _, e := range existing {
+			if w.IPAddress == e.IPAddress && (w.MACAddress == "" || w.MACAddress == e.MACAddress) {
+				present = append(present, w)
+				break
+			}
+		}
+	}
+	return present
+}
+
 func (s *Port) Find(context *fi.Context) (*Port, error) {
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if err := dropUnsupportedTags(cloud, &s.Tags); err != nil {
+		return nil, err
+	}
 	opt := ports.ListOpts{
 		Name: fi.StringValue(s.Name),
+		Tags: openstack.TagFilter(s.Tags),
 	}
 	rs, err := cloud.ListPorts(opt)
 	if err != nil {
 		return nil, err
 	}
+	if rs == nil {
+		var all []ports.Port
+		untagged, err := findUntagged(s.Tags, func() (int, error) {
+			all, err = cloud.ListPorts(ports.ListOpts{Name: fi.StringValue(s.Name)})
+			return len(all), err
+		}, func(i int) []string { return all[i].Tags })
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range untagged {
+			rs = append(rs, all[i])
+		}
+	}
 	if rs == nil {
 		return nil, nil
 	} else if len(rs) != 1 {
@@ -113,38 +196,114 @@ func (_ *Port) CheckChanges(a, e, changes *Port) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
-		if e.Network != nil {
+		if changes.Network != nil {
 			return fi.CannotChangeField("Network")
 		}
 	}
 	return nil
 }
 
+// securityGroupIDs returns the IDs of the security groups of the port, which is empty when port security is disabled
+func (e *Port) securityGroupIDs() []string {
+	sgs := make([]string, 0, len(e.SecurityGroups))
+	if e.PortSecurityEnabled != nil && !*e.PortSecurityEnabled {
+		return sgs
+	}
+	for _, sg := range e.SecurityGroups {
+		sgs = append(sgs, fi.StringValue(sg.ID))
+	}
+	return sgs
+}
+
 func (_ *Port) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *Port) error {
 	if a == nil {
 		glog.V(2).Infof("Creating Port with name: %q", fi.StringValue(e.Name))
 
-		sgs := make([]string, len(e.SecurityGroups))
-		for i, sg := range e.SecurityGroups {
-			sgs[i] = fi.StringValue(sg.ID)
-		}
-
+		sgs := e.securityGroupIDs()
 		opt := ports.CreateOpts{
 			Name:           fi.StringValue(e.Name),
 			NetworkID:      fi.StringValue(e.Network.ID),
 			SecurityGroups: &sgs,
 		}
+		if len(e.Subnets) > 0 {
+			fixedIPs := make([]ports.IP, len(e.Subnets))
+			for i, subnet := range e.Subnets {
+				fixedIPs[i] = ports.IP{SubnetID: fi.StringValue(subnet.ID)}
+			}
+			opt.FixedIPs = fixedIPs
+		}
+		if len(e.AllowedAddressPairs) > 0 {
+			opt.AllowedAddressPairs = e.AllowedAddressPairs
+		}
 
-		v, err := t.Cloud.CreatePort(opt)
+		var createOpts ports.CreateOptsBuilder = opt
+		if e.PortSecurityEnabled != nil {
+			createOpts = openstack.PortSecurityCreateOpts{CreateOptsBuilder: opt, PortSecurityEnabled: e.PortSecurityEnabled}
+		}
+
+		v, err := t.Cloud.CreatePort(createOpts)
 		if err != nil {
 			return fmt.Errorf("Error creating port: %v", err)
 		}
 
 		e.ID = fi.String(v.ID)
 		glog.V(2).Infof("Creating a new Openstack port, id=%s", v.ID)
+		if len(e.Tags) > 0 {
+			return renderTags(t.Cloud, openstack.ResourceTypePort, v.ID, nil, e.Tags)
+		}
 		return nil
 	}
 	e.ID = a.ID
+	if changes.Tags != nil {
+		if err := renderTags(t.Cloud, openstack.ResourceTypePort, fi.StringValue(a.ID), a.Tags, e.Tags); err != nil {
+			return err
+		}
+	}
+	if changes.PortSecurityEnabled != nil {
+		// Neutron refuses to disable port security on a port which still has security groups, so both are updated together
+		sgs := e.securityGroupIDs()
+		opt := openstack.PortSecurityUpdateOpts{
+			UpdateOptsBuilder:   ports.UpdateOpts{SecurityGroups: &sgs},
+			PortSecurityEnabled: e.PortSecurityEnabled,
+		}
+		glog.V(2).Infof("Updating port security of Openstack port %s to %v", fi.StringValue(e.ID), fi.BoolValue(e.PortSecurityEnabled))
+		if _, err := t.Cloud.UpdatePort(fi.StringValue(a.ID), opt); err != nil {
+			return fmt.Errorf("Error updating port: %v", err)
+		}
+	}
+	if changes.SecurityGroups != nil && changes.PortSecurityEnabled == nil {
+		additional, err := resolveSecurityGroups(t.Cloud, e.AdditionalSecurityGroups)
+		if err != nil {
+			return err
+		}
+		// the additional security groups of the instance stay on the port
+		sgs := append(e.securityGroupIDs(), additional...)
+		glog.V(2).Infof("Updating security groups of Openstack port %s to %v", fi.StringValue(e.ID), sgs)
+		if _, err := t.Cloud.UpdatePort(fi.StringValue(a.ID), ports.UpdateOpts{SecurityGroups: &sgs}); err != nil {
+			return fmt.Errorf("Error updating port: %v", err)
+		}
+	}
+	if changes.AllowedAddressPairs != nil {
+		port, err := t.Cloud.GetPort(fi.StringValue(a.ID))
+		if err != nil {
+			return fmt.Errorf("Error getting port: %v", err)
+		}
+		if port == nil {
+			return fmt.Errorf("port %s no longer exists", fi.StringValue(a.ID))
+		}
+		// Neutron replaces the allowed address pairs, so the pairs of the port are kept
+		pairs := port.AllowedAddressPairs
+		for _, pair := range e.AllowedAddressPairs {
+			if len(presentAddressPairs(port.AllowedAddressPairs, []ports.AddressPair{pair})) == 0 {
+				pairs = append(pairs, pair)
+			}
+		}
+		glog.V(2).Infof("Updating allowed address pairs of Openstack port %s", fi.StringValue(e.ID))
+		if _, err := t.Cloud.UpdatePort(fi.StringValue(a.ID), ports.UpdateOpts{AllowedAddressPairs: &pairs}); err != nil {
+			return fmt.Errorf("Error updating port: %v", err)
+		}
+		return nil
+	}
 	glog.V(2).Infof("Using an existing Openstack port, id=%s", fi.StringValue(e.ID))
 	return nil
 }
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"reflect"
+	"testing"
+
+	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestPortCreateFixedIPs(t *testing.T) {
+	grid := []struct {
+		subnets  []*Subnet
+		expected interface{}
+	}{
+		{subnets: nil, expected: nil},
+		{
+			subnets: []*Subnet{
+				{ID: fi.String("subnet-v4"), Name: fi.String("nodes-v4")},
+				{ID: fi.String("subnet-v6"), Name: fi.String("nodes-v6")},
+			},
+			expected: []ports.IP{{SubnetID: "subnet-v4"}, {SubnetID: "subnet-v6"}},
+		},
+	}
+	for _, g := range grid {
+		cloud := &mockCloud{}
+		e := &Port{
+			Name:    fi.String("port-nodes-1"),
+			Network: &Network{ID: fi.String("net-1")},
+			Subnets: g.subnets,
+		}
+		if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, nil); err != nil {
+			t.Fatalf("unexpected error creating port: %v", err)
+		}
+		if len(cloud.portRequests) != 1 {
+			t.Fatalf("expected a port to be created, got %d", len(cloud.portRequests))
+		}
+		if !reflect.DeepEqual(cloud.portRequests[0].FixedIPs, g.expected) {
+			t.Errorf("expected fixed ips %v, got %v", g.expected, cloud.portRequests[0].FixedIPs)
+		}
+	}
+}
+
+func TestPortAddsAllowedAddressPairs(t *testing.T) {
+	cloud := &mockCloud{
+		ports: []ports.Port{
+			{
+				ID:        "port-1",
+				Name:      "port-nodes-1",
+				NetworkID: "net-1",
+				AllowedAddressPairs: []ports.AddressPair{
+					{IPAddress: "100.96.0.0/11", MACAddress: "fa:16:3e:00:00:01"},
+					{IPAddress: "10.0.0.100", MACAddress: "fa:16:3e:00:00:01"},
+				},
+			},
+		},
+	}
+	e := &Port{
+		Name:    fi.String("port-nodes-1"),
+		Network: &Network{ID: fi.String("net-1")},
+		AllowedAddressPairs: []ports.AddressPair{
+			{IPAddress: "100.96.0.0/11"},
+			{IPAddress: "10.0.0.200"},
+		},
+	}
+
+	context, err := fi.NewContext(openstack.NewOpenstackAPITarget(cloud), nil, cloud, nil, nil, nil, true, map[string]fi.Task{"Port/port-nodes-1": e})
+	if err != nil {
+		t.Fatalf("error building context: %v", err)
+	}
+	if err := e.Run(context); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []ports.AddressPair{
+		{IPAddress: "100.96.0.0/11", MACAddress: "fa:16:3e:00:00:01"},
+		{IPAddress: "10.0.0.100", MACAddress: "fa:16:3e:00:00:01"},
+		{IPAddress: "10.0.0.200"},
+	}
+	if !reflect.DeepEqual(cloud.ports[0].AllowedAddressPairs, expected) {
+		t.Errorf("expected address pairs %v, got %v", expected, cloud.ports[0].AllowedAddressPairs)
+	}
+
+	// all pairs are present now, so the port is left alone
+	actual, err := e.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := &Port{}
+	if fi.BuildChanges(actual, e, changes) && changes.AllowedAddressPairs != nil {
+		t.Errorf("expected no address pair changes, got %v", changes.AllowedAddressPairs)
+	}
+}
+
+func TestPortIgnoresAdditionalSecurityGroups(t *testing.T) {
+	cloud := &mockCloud{
+		ports: []ports.Port{
+			{
+				ID:             "port-1",
+				Name:           "port-nodes-1",
+				NetworkID:      "net-1",
+				SecurityGroups: []string{"sg-1", "sg-additional"},
+			},
+		},
+		securityGroups: []sg.SecGroup{
+			{ID: "sg-1", Name: "nodes"},
+			{ID: "sg-additional", Name: "additional"},
+		},
+	}
+	e := &Port{
+		Name:                     fi.String("port-nodes-1"),
+		Network:                  &Network{ID: fi.String("net-1")},
+		SecurityGroups:           []*SecurityGroup{{ID: fi.String("sg-1"), Name: fi.String("nodes")}},
+		AdditionalSecurityGroups: []string{"additional"},
+	}
+	context, err := fi.NewContext(openstack.NewOpenstackAPITarget(cloud), nil, cloud, nil, nil, nil, true, map[string]fi.Task{"Port/port-nodes-1": e})
+	if err != nil {
+		t.Fatalf("error building context: %v", err)
+	}
+
+	// the additional security group of the instance does not make the port differ
+	actual, err := e.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := &Port{}
+	if fi.BuildChanges(actual, e, changes) && changes.SecurityGroups != nil {
+		t.Errorf("expected no security group changes, got %v", changes.SecurityGroups)
+	}
+
+	// a security group which kops no longer wants is removed, the additional security group is kept
+	cloud.ports[0].SecurityGroups = []string{"sg-1", "sg-old", "sg-additional"}
+	if err := e.Run(context); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cloud.ports[0].SecurityGroups, []string{"sg-1", "sg-additional"}) {
+		t.Errorf("expected security groups sg-1 and sg-additional, got %v", cloud.ports[0].SecurityGroups)
+	}
+}
+
+func TestPortSecurityEnabled(t *testing.T) {
+	cloud := &mockCloud{}
+	e := &Port{
+		Name:                fi.String("port-nodes-1"),
+		Network:             &Network{ID: fi.String("net-1")},
+		SecurityGroups:      []*SecurityGroup{{ID: fi.String("sg-1"), Name: fi.String("nodes")}},
+		PortSecurityEnabled: fi.Bool(false),
+	}
+	context, err := fi.NewContext(openstack.NewOpenstackAPITarget(cloud), nil, cloud, nil, nil, nil, true, map[string]fi.Task{"Port/port-nodes-1": e})
+	if err != nil {
+		t.Fatalf("error building context: %v", err)
+	}
+	if err := e.Run(context); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cloud.ports) != 1 || len(cloud.ports[0].SecurityGroups) != 0 {
+		t.Fatalf("expected a port without security groups, got %v", cloud.ports)
+	}
+	if enabled := cloud.portSecurity[cloud.ports[0].ID]; enabled == nil || *enabled {
+		t.Fatalf("expected port security to be disabled, got %v", enabled)
+	}
+
+	// nothing changes while port security stays disabled
+	actual, err := e.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := &Port{}
+	if fi.BuildChanges(actual, e, changes) {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	// enabling port security restores the security groups
+	e.PortSecurityEnabled = fi.Bool(true)
+	if err := e.Run(context); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cloud.ports[0].SecurityGroups, []string{"sg-1"}) {
+		t.Errorf("expected security group sg-1, got %v", cloud.ports[0].SecurityGroups)
+	}
+	if enabled := cloud.portSecurity[cloud.ports[0].ID]; enabled == nil || !*enabled {
+		t.Errorf("expected port security to be enabled, got %v", enabled)
+	}
+}
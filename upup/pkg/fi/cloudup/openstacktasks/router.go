@@ -27,8 +27,10 @@ import (
 
 //go:generate fitask -type=Router
 type Router struct {
-	ID        *string
-	Name      *string
+	ID   *string
+	Name *string
+	// Tags are the Neutron tags of the router, which is found by its name and tags
+	Tags      []string
 	Lifecycle *fi.Lifecycle
 }
 
@@ -46,20 +48,38 @@ func NewRouterTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecy
 	}
 	if find != nil {
 		find.ID = actual.ID
+		actual.Tags = actualTags(router.Tags, find.Tags)
 	}
 	return actual, nil
 }
 
 func (n *Router) Find(context *fi.Context) (*Router, error) {
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if err := dropUnsupportedTags(cloud, &n.Tags); err != nil {
+		return nil, err
+	}
 	opt := routers.ListOpts{
 		Name: fi.StringValue(n.Name),
 		ID:   fi.StringValue(n.ID),
+		Tags: openstack.TagFilter(n.Tags),
 	}
 	rs, err := cloud.ListRouters(opt)
 	if err != nil {
 		return nil, err
 	}
+	if rs == nil {
+		var all []routers.Router
+		untagged, err := findUntagged(n.Tags, func() (int, error) {
+			all, err = cloud.ListRouters(routers.ListOpts{Name: fi.StringValue(n.Name), ID: fi.StringValue(n.ID)})
+			return len(all), err
+		}, func(i int) []string { return all[i].Tags })
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range untagged {
+			rs = append(rs, all[i])
+		}
+	}
 	if rs == nil {
 		return nil, nil
 	} else if len(rs) != 1 {
@@ -120,9 +140,15 @@ func (_ *Router) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes
 		}
 		e.ID = fi.String(v.ID)
 		glog.V(2).Infof("Creating a new Openstack router, id=%s", v.ID)
+		if len(e.Tags) > 0 {
+			return renderTags(t.Cloud, openstack.ResourceTypeRouter, v.ID, nil, e.Tags)
+		}
 		return nil
 	}
 	e.ID = a.ID
+	if changes.Tags != nil {
+		return renderTags(t.Cloud, openstack.ResourceTypeRouter, fi.StringValue(a.ID), a.Tags, e.Tags)
+	}
 	glog.V(2).Infof("Using an existing Openstack router, id=%s", fi.StringValue(e.ID))
 	return nil
 }
@@ -21,6 +21,7 @@ import (
 
 	"github.com/golang/glog"
 	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 )
@@ -30,7 +31,9 @@ type SecurityGroup struct {
 	ID          *string
 	Name        *string
 	Description *string
-	Lifecycle   *fi.Lifecycle
+	// Tags are the Neutron tags of the security group, which is found by its name and tags
+	Tags      []string
+	Lifecycle *fi.Lifecycle
 }
 
 var _ fi.CompareWithID = &SecurityGroup{}
@@ -41,17 +44,34 @@ func (s *SecurityGroup) CompareWithID() *string {
 
 func (s *SecurityGroup) Find(context *fi.Context) (*SecurityGroup, error) {
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if err := dropUnsupportedTags(cloud, &s.Tags); err != nil {
+		return nil, err
+	}
 	return s.getSecurityGroupByName(cloud)
 }
 
 func (s *SecurityGroup) getSecurityGroupByName(cloud openstack.OpenstackCloud) (*SecurityGroup, error) {
 	opt := sg.ListOpts{
 		Name: fi.StringValue(s.Name),
+		Tags: openstack.TagFilter(s.Tags),
 	}
 	gs, err := cloud.ListSecurityGroups(opt)
 	if err != nil {
 		return nil, err
 	}
+	if len(gs) == 0 {
+		var all []sg.SecGroup
+		untagged, err := findUntagged(s.Tags, func() (int, error) {
+			all, err = cloud.ListSecurityGroups(sg.ListOpts{Name: fi.StringValue(s.Name)})
+			return len(all), err
+		}, func(i int) []string { return all[i].Tags })
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range untagged {
+			gs = append(gs, all[i])
+		}
+	}
 	n := len(gs)
 	if n == 0 {
 		return nil, nil
@@ -63,6 +83,7 @@ func (s *SecurityGroup) getSecurityGroupByName(cloud openstack.OpenstackCloud) (
 		ID:          fi.String(g.ID),
 		Name:        fi.String(g.Name),
 		Description: fi.String(g.Description),
+		Tags:        actualTags(g.Tags, s.Tags),
 		Lifecycle:   s.Lifecycle,
 	}
 	s.ID = actual.ID
@@ -104,9 +125,127 @@ func (_ *SecurityGroup) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, c
 		}
 
 		e.ID = fi.String(g.ID)
+		if len(e.Tags) > 0 {
+			return renderTags(t.Cloud, openstack.ResourceTypeSecurityGroup, g.ID, nil, e.Tags)
+		}
 		return nil
 	}
+	if changes.Tags != nil {
+		return renderTags(t.Cloud, openstack.ResourceTypeSecurityGroup, fi.StringValue(a.ID), a.Tags, e.Tags)
+	}
 
 	glog.V(2).Infof("Openstack task SecurityGroup::RenderOpenstack did nothing")
 	return nil
 }
+
+// FindDeletions returns the rules of the security group which are not part of the model.
+// The egress rules Neutron creates with every security group are kept, unless the model manages egress rules.
+func (s *SecurityGroup) FindDeletions(c *fi.Context) ([]fi.Deletion, error) {
+	if s.ID == nil {
+		return nil, nil
+	}
+
+	var expected []*SecurityGroupRule
+	managesEgress := false
+	for _, t := range c.AllTasks() {
+		er, ok := t.(*SecurityGroupRule)
+		if !ok || er.SecGroup != s {
+			continue
+		}
+		if er.RemoteGroup != nil && er.RemoteGroup.ID == nil {
+			glog.V(4).Infof("Deletion skipping find of SecurityGroupRule in %s, because RemoteGroup was not found", fi.StringValue(s.Name))
+			return nil, nil
+		}
+		if fi.StringValue(er.Direction) == string(sgr.DirEgress) {
+			managesEgress = true
+		}
+		expected = append(expected, er)
+	}
+
+	cloud := c.Cloud.(openstack.OpenstackCloud)
+	rs, err := cloud.ListSecurityGroupRules(sgr.ListOpts{
+		SecGroupID: fi.StringValue(s.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var removals []fi.Deletion
+	for i := range rs {
+		rule := rs[i]
+		if !managesEgress && isDefaultEgressRule(rule) {
+			continue
+		}
+		found := false
+		for _, er := range expected {
+			if er.matches(rule) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removals = append(removals, &deleteSecurityGroupRule{
+				rule:          rule,
+				securityGroup: s,
+			})
+		}
+	}
+	return removals, nil
+}
+
+// isDefaultEgressRule returns true for the allow-all egress rules Neutron adds to new security groups
+func isDefaultEgressRule(rule sgr.SecGroupRule) bool {
+	return rule.Direction == string(sgr.DirEgress) &&
+		rule.Protocol == "" &&
+		rule.PortRangeMin == 0 &&
+		rule.PortRangeMax == 0 &&
+		rule.RemoteIPPrefix == "" &&
+		rule.RemoteGroupID == ""
+}
+
+type deleteSecurityGroupRule struct {
+	rule          sgr.SecGroupRule
+	securityGroup *SecurityGroup
+}
+
+var _ fi.Deletion = &deleteSecurityGroupRule{}
+
+func (d *deleteSecurityGroupRule) Delete(t fi.Target) error {
+	glog.V(2).Infof("deleting security group rule %v", d.Item())
+
+	target, ok := t.(*openstack.OpenstackAPITarget)
+	if !ok {
+		return fmt.Errorf("unexpected target type for deletion: %T", t)
+	}
+	err := target.Cloud.DeleteSecurityGroupRule(d.rule.ID)
+	if err != nil {
+		return fmt.Errorf("error revoking SecurityGroupRule: %v", err)
+	}
+	return nil
+}
+
+func (d *deleteSecurityGroupRule) TaskName() string {
+	return "SecurityGroupRule"
+}
+
+func (d *deleteSecurityGroupRule) Item() string {
+	s := fi.StringValue(d.securityGroup.Name) + ":"
+	p := d.rule
+	s += fmt.Sprintf(" %s", p.Direction)
+	if p.PortRangeMin != 0 {
+		s += fmt.Sprintf(" port=%d", p.PortRangeMin)
+		if p.PortRangeMax != p.PortRangeMin {
+			s += fmt.Sprintf("-%d", p.PortRangeMax)
+		}
+	}
+	if p.Protocol != "" {
+		s += fmt.Sprintf(" protocol=%s", p.Protocol)
+	}
+	if p.RemoteGroupID != "" {
+		s += fmt.Sprintf(" remote_group_id=%s", p.RemoteGroupID)
+	}
+	if p.RemoteIPPrefix != "" {
+		s += fmt.Sprintf(" remote_ip_prefix=%s", p.RemoteIPPrefix)
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func findRuleDeletions(t *testing.T, cloud *mockCloud, group *SecurityGroup, rules ...*SecurityGroupRule) []string {
+	tasks := map[string]fi.Task{"SecurityGroup/nodes": group}
+	for i, r := range rules {
+		r.SecGroup = group
+		tasks[fmt.Sprintf("SecurityGroupRule/%d", i)] = r
+	}
+
+	target := openstack.NewOpenstackAPITarget(cloud)
+	context, err := fi.NewContext(target, nil, cloud, nil, nil, nil, true, tasks)
+	if err != nil {
+		t.Fatalf("error building context: %v", err)
+	}
+	deletions, err := group.FindDeletions(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, d := range deletions {
+		if err := d.Delete(target); err != nil {
+			t.Fatalf("unexpected error deleting rule: %v", err)
+		}
+	}
+
+	var remaining []string
+	for _, r := range cloud.rules {
+		remaining = append(remaining, r.ID)
+	}
+	sort.Strings(remaining)
+	return remaining
+}
+
+func TestSecurityGroupFindDeletions(t *testing.T) {
+	cloud := &mockCloud{
+		rules: []sgr.SecGroupRule{
+			{ID: "default-egress-v4", SecGroupID: "sg-1", Direction: "egress", EtherType: "IPv4"},
+			{ID: "default-egress-v6", SecGroupID: "sg-1", Direction: "egress", EtherType: "IPv6"},
+			{ID: "expected-ssh", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIPPrefix: "10.0.0.0/8"},
+			{ID: "expected-icmp", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "icmp"},
+			{ID: "stale-ssh", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22, RemoteIPPrefix: "0.0.0.0/0"},
+			{ID: "stale-remote-group", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 53, PortRangeMax: 53, RemoteGroupID: "sg-3"},
+			{ID: "other-group", SecGroupID: "sg-2", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 22, PortRangeMax: 22},
+		},
+	}
+	group := &SecurityGroup{ID: fi.String("sg-1"), Name: fi.String("nodes")}
+
+	remaining := findRuleDeletions(t, cloud, group,
+		&SecurityGroupRule{
+			Direction:      fi.String("ingress"),
+			EtherType:      fi.String("IPv4"),
+			Protocol:       fi.String("tcp"),
+			PortRangeMin:   Int(22),
+			PortRangeMax:   Int(22),
+			RemoteIPPrefix: fi.String("10.0.0.0/8"),
+		},
+		&SecurityGroupRule{
+			Direction:    fi.String("ingress"),
+			EtherType:    fi.String("IPv4"),
+			Protocol:     fi.String("icmp"),
+			PortRangeMin: Int(-1),
+			PortRangeMax: Int(-1),
+		},
+	)
+
+	expected := []string{"default-egress-v4", "default-egress-v6", "expected-icmp", "expected-ssh", "other-group"}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("expected remaining rules %v, got %v", expected, remaining)
+	}
+}
+
+func TestSecurityGroupFindDeletionsManagedEgress(t *testing.T) {
+	cloud := &mockCloud{
+		rules: []sgr.SecGroupRule{
+			{ID: "default-egress-v4", SecGroupID: "sg-1", Direction: "egress", EtherType: "IPv4"},
+			{ID: "default-egress-v6", SecGroupID: "sg-1", Direction: "egress", EtherType: "IPv6"},
+		},
+	}
+	group := &SecurityGroup{ID: fi.String("sg-1"), Name: fi.String("nodes")}
+
+	remaining := findRuleDeletions(t, cloud, group,
+		&SecurityGroupRule{
+			Direction: fi.String("egress"),
+			EtherType: fi.String("IPv4"),
+		},
+	)
+
+	expected := []string{"default-egress-v4"}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("expected remaining rules %v, got %v", expected, remaining)
+	}
+}
+
+func TestSecurityGroupFindDeletionsWaitsForRemoteGroup(t *testing.T) {
+	cloud := &mockCloud{
+		rules: []sgr.SecGroupRule{
+			{ID: "dns", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "udp", PortRangeMin: 53, PortRangeMax: 53, RemoteGroupID: "sg-2"},
+		},
+	}
+	group := &SecurityGroup{ID: fi.String("sg-1"), Name: fi.String("nodes")}
+
+	remaining := findRuleDeletions(t, cloud, group,
+		&SecurityGroupRule{
+			Direction:    fi.String("ingress"),
+			EtherType:    fi.String("IPv4"),
+			Protocol:     fi.String("udp"),
+			PortRangeMin: Int(53),
+			PortRangeMax: Int(53),
+			RemoteGroup:  &SecurityGroup{Name: fi.String("masters")},
+		},
+	)
+
+	if len(remaining) != 1 {
+		t.Errorf("rules should not be deleted before the remote group is known, got %v", remaining)
+	}
+}
@@ -70,6 +70,10 @@ func (r *SecurityGroupRule) Find(context *fi.Context) (*SecurityGroupRule, error
 	if r.SecGroup == nil || r.SecGroup.ID == nil {
 		return nil, nil
 	}
+	if r.RemoteGroup != nil && r.RemoteGroup.ID == nil {
+		// the remote group does not exist yet, so neither can a rule referencing it
+		return nil, nil
+	}
 
 	cloud := context.Cloud.(openstack.OpenstackCloud)
 
@@ -85,10 +89,17 @@ func (r *SecurityGroupRule) Find(context *fi.Context) (*SecurityGroupRule, error
 	if r.RemoteGroup != nil {
 		opt.RemoteGroupID = fi.StringValue(r.RemoteGroup.ID)
 	}
-	rs, err := cloud.ListSecurityGroupRules(opt)
+	found, err := cloud.ListSecurityGroupRules(opt)
 	if err != nil {
 		return nil, err
 	}
+	// Neutron does not filter on an unset remote, so a CIDR rule would also match the rules for a remote group
+	var rs []sgr.SecGroupRule
+	for _, rule := range found {
+		if r.matches(rule) {
+			rs = append(rs, rule)
+		}
+	}
 	n := len(rs)
 	if n == 0 {
 		return nil, nil
@@ -104,11 +115,11 @@ func (r *SecurityGroupRule) Find(context *fi.Context) (*SecurityGroupRule, error
 		PortRangeMin:   Int(rule.PortRangeMin),
 		Protocol:       fi.String(rule.Protocol),
 		RemoteIPPrefix: fi.String(rule.RemoteIPPrefix),
-		RemoteGroup: &SecurityGroup{
-			ID: fi.String(rule.RemoteGroupID),
-		},
-		SecGroup:  &SecurityGroup{ID: fi.String(rule.SecGroupID)},
-		Lifecycle: r.Lifecycle,
+		SecGroup:       &SecurityGroup{ID: fi.String(rule.SecGroupID)},
+		Lifecycle:      r.Lifecycle,
+	}
+	if rule.RemoteGroupID != "" {
+		actual.RemoteGroup = &SecurityGroup{ID: fi.String(rule.RemoteGroupID)}
 	}
 	r.ID = actual.ID
 	return actual, nil
@@ -160,10 +171,14 @@ func (_ *SecurityGroupRule) RenderOpenstack(t *openstack.OpenstackAPITarget, a,
 			RemoteIPPrefix: fi.StringValue(e.RemoteIPPrefix),
 		}
 		if e.RemoteGroup != nil {
+			// without the id the rule would allow traffic from everywhere instead of from the remote group
+			if e.RemoteGroup.ID == nil {
+				return fmt.Errorf("remote group %s of SecurityGroupRule in SG %s has not been created", fi.StringValue(e.RemoteGroup.GetName()), fi.StringValue(e.SecGroup.GetName()))
+			}
 			opt.RemoteGroupID = fi.StringValue(e.RemoteGroup.ID)
 		}
 
-		r, err := t.Cloud.CreateSecurityGroupRule(opt)
+		r, err := t.Cloud.EnsureSecurityGroupRule(opt)
 		if err != nil {
 			return fmt.Errorf("error creating SecurityGroupRule in SG %s: %v", fi.StringValue(e.SecGroup.GetName()), err)
 		}
@@ -175,3 +190,27 @@ func (_ *SecurityGroupRule) RenderOpenstack(t *openstack.OpenstackAPITarget, a,
 	glog.V(2).Infof("Openstack task SecurityGroupRule::RenderOpenstack did nothing")
 	return nil
 }
+
+// matches returns true if the rule task describes the given Neutron rule
+func (r *SecurityGroupRule) matches(rule sgr.SecGroupRule) bool {
+	if fi.StringValue(r.Direction) != rule.Direction || fi.StringValue(r.EtherType) != rule.EtherType {
+		return false
+	}
+	if fi.StringValue(r.Protocol) != rule.Protocol {
+		return false
+	}
+	if openstack.NormalizeRulePort(IntValue(r.PortRangeMin)) != openstack.NormalizeRulePort(rule.PortRangeMin) {
+		return false
+	}
+	if openstack.NormalizeRulePort(IntValue(r.PortRangeMax)) != openstack.NormalizeRulePort(rule.PortRangeMax) {
+		return false
+	}
+	if fi.StringValue(r.RemoteIPPrefix) != rule.RemoteIPPrefix {
+		return false
+	}
+	remoteGroupID := ""
+	if r.RemoteGroup != nil {
+		remoteGroupID = fi.StringValue(r.RemoteGroup.ID)
+	}
+	return remoteGroupID == rule.RemoteGroupID
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"testing"
+
+	sgr "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestSecurityGroupRuleFindRemoteGroup(t *testing.T) {
+	cloud := &mockCloud{
+		rules: []sgr.SecGroupRule{
+			{ID: "from-anywhere", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 10250, PortRangeMax: 10250},
+			{ID: "from-masters", SecGroupID: "sg-1", Direction: "ingress", EtherType: "IPv4", Protocol: "tcp", PortRangeMin: 10250, PortRangeMax: 10250, RemoteGroupID: "sg-2"},
+		},
+	}
+	context := &fi.Context{Cloud: cloud}
+
+	grid := []struct {
+		remoteGroup *SecurityGroup
+		expected    string
+	}{
+		{remoteGroup: nil, expected: "from-anywhere"},
+		{remoteGroup: &SecurityGroup{ID: fi.String("sg-2"), Name: fi.String("masters")}, expected: "from-masters"},
+		{remoteGroup: &SecurityGroup{ID: fi.String("sg-3"), Name: fi.String("bastions")}},
+		{remoteGroup: &SecurityGroup{Name: fi.String("bastions")}},
+	}
+	for _, g := range grid {
+		rule := &SecurityGroupRule{
+			Direction:    fi.String("ingress"),
+			EtherType:    fi.String("IPv4"),
+			Protocol:     fi.String("tcp"),
+			PortRangeMin: Int(10250),
+			PortRangeMax: Int(10250),
+			SecGroup:     &SecurityGroup{ID: fi.String("sg-1"), Name: fi.String("nodes")},
+			RemoteGroup:  g.remoteGroup,
+		}
+		actual, err := rule.Find(context)
+		if err != nil {
+			t.Errorf("remote group %v: unexpected error %v", g.remoteGroup, err)
+			continue
+		}
+		if g.expected == "" {
+			if actual != nil {
+				t.Errorf("remote group %v: expected no rule to be found, got %s", g.remoteGroup, fi.StringValue(actual.ID))
+			}
+			continue
+		}
+		if actual == nil || fi.StringValue(actual.ID) != g.expected {
+			t.Errorf("remote group %v: expected rule %s, got %v", g.remoteGroup, g.expected, actual)
+			continue
+		}
+		if (actual.RemoteGroup == nil) != (g.remoteGroup == nil) {
+			t.Errorf("remote group %v: unexpected remote group %v of the found rule", g.remoteGroup, actual.RemoteGroup)
+		}
+	}
+}
+
+func TestSecurityGroupRuleRenderRemoteGroup(t *testing.T) {
+	cloud := &mockCloud{}
+	target := openstack.NewOpenstackAPITarget(cloud)
+
+	rule := &SecurityGroupRule{
+		Direction:   fi.String("ingress"),
+		EtherType:   fi.String("IPv4"),
+		Protocol:    fi.String("udp"),
+		SecGroup:    &SecurityGroup{ID: fi.String("sg-1"), Name: fi.String("nodes")},
+		RemoteGroup: &SecurityGroup{Name: fi.String("masters")},
+	}
+	if err := rule.RenderOpenstack(target, nil, rule, nil); err == nil {
+		t.Errorf("expected an error rendering a rule whose remote group has no id")
+	}
+	if len(cloud.rules) != 0 {
+		t.Fatalf("expected no rule to be created, got %v", cloud.rules)
+	}
+
+	rule.RemoteGroup.ID = fi.String("sg-2")
+	if err := rule.RenderOpenstack(target, nil, rule, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cloud.rules) != 1 || cloud.rules[0].RemoteGroupID != "sg-2" {
+		t.Errorf("expected a rule with remote group sg-2, got %v", cloud.rules)
+	}
+	if fi.StringValue(rule.ID) != cloud.rules[0].ID {
+		t.Errorf("expected the rule id to be set, got %v", fi.StringValue(rule.ID))
+	}
+}
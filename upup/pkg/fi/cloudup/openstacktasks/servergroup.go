@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"k8s.io/kops/upup/pkg/fi"
@@ -50,36 +51,28 @@ func (s *ServerGroup) Find(context *fi.Context) (*ServerGroup, error) {
 		return nil, nil
 	}
 	cloud := context.Cloud.(openstack.OpenstackCloud)
-	//TODO: move to cloud, add vfs backoff
-
-	page, err := servergroups.List(cloud.ComputeClient()).AllPages()
+	policies, err := supportedServerGroupPolicies(cloud.ComputeClient(), s.Policies)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to list server groups: %v", err)
+		return nil, err
 	}
-	serverGroups, err := servergroups.ExtractServerGroups(page)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to extract server groups: %v", err)
+	s.Policies = policies
+
+	serverGroup, err := getServerGroupByName(context, fi.StringValue(s.Name))
+	if err == openstack.ErrServerGroupNotFound {
+		return nil, nil
 	}
-	var actual *ServerGroup
-	for _, serverGroup := range serverGroups {
-		if serverGroup.Name == *s.Name {
-			if actual != nil {
-				return nil, fmt.Errorf("Found multiple server groups with name %s", fi.StringValue(s.Name))
-			}
-			actual = &ServerGroup{
-				Name:        fi.String(serverGroup.Name),
-				ClusterName: s.ClusterName,
-				IGName:      s.IGName,
-				ID:          fi.String(serverGroup.ID),
-				Members:     serverGroup.Members,
-				Lifecycle:   s.Lifecycle,
-				Policies:    serverGroup.Policies,
-				MaxSize:     fi.Int32(int32(len(serverGroup.Members))),
-			}
-		}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find server group %s: %v", fi.StringValue(s.Name), err)
 	}
-	if actual == nil {
-		return nil, nil
+	actual := &ServerGroup{
+		Name:        fi.String(serverGroup.Name),
+		ClusterName: s.ClusterName,
+		IGName:      s.IGName,
+		ID:          fi.String(serverGroup.ID),
+		Members:     serverGroup.Members,
+		Lifecycle:   s.Lifecycle,
+		Policies:    serverGroup.Policies,
+		MaxSize:     fi.Int32(int32(len(serverGroup.Members))),
 	}
 
 	// ignore if IG is scaled up, this is handled in instancetasks
@@ -92,6 +85,15 @@ func (s *ServerGroup) Find(context *fi.Context) (*ServerGroup, error) {
 	return actual, nil
 }
 
+// getServerGroupByName returns the server group with the given name, or ErrServerGroupNotFound.
+// The API target lists the server groups once for all server group tasks.
+func getServerGroupByName(context *fi.Context, name string) (*servergroups.ServerGroup, error) {
+	if t, ok := context.Target.(*openstack.OpenstackAPITarget); ok {
+		return t.GetServerGroupByName(name)
+	}
+	return context.Cloud.(openstack.OpenstackCloud).GetServerGroupByName(name)
+}
+
 func (s *ServerGroup) Run(context *fi.Context) error {
 	return fi.DefaultDeltaRunMethod(s, context)
 }
@@ -108,10 +110,61 @@ func (_ *ServerGroup) CheckChanges(a, e, changes *ServerGroup) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
+		if changes.Policies != nil && !samePolicies(a.Policies, e.Policies) {
+			return fmt.Errorf("server group %q has policies %v, changing them to %v requires the server group to be recreated, which nova does not allow in place: "+
+				"replace the instance group to apply the new policy", fi.StringValue(a.Name), a.Policies, e.Policies)
+		}
 	}
 	return nil
 }
 
+// supportedServerGroupPolicies replaces soft policies by their strict counterpart
+// when the compute service does not support the microversion which introduced them
+func supportedServerGroupPolicies(client *gophercloud.ServiceClient, policies []string) ([]string, error) {
+	soft := false
+	for _, policy := range policies {
+		soft = soft || strings.HasPrefix(policy, "soft-")
+	}
+	if !soft {
+		return policies, nil
+	}
+	supported, err := openstack.SupportsMicroversion(client, openstack.SoftServerGroupPolicyMicroversion)
+	if err != nil {
+		return nil, fmt.Errorf("error checking the compute microversions: %v", err)
+	}
+	if supported {
+		return policies, nil
+	}
+	var result []string
+	for _, policy := range policies {
+		if strings.HasPrefix(policy, "soft-") {
+			strict := strings.TrimPrefix(policy, "soft-")
+			glog.Warningf("Server group policy %q requires compute microversion %s, using %q instead", policy, openstack.SoftServerGroupPolicyMicroversion, strict)
+			policy = strict
+		}
+		result = append(result, policy)
+	}
+	return result, nil
+}
+
+// samePolicies returns true if both lists contain the same policies, regardless of order
+func samePolicies(l, r []string) bool {
+	if len(l) != len(r) {
+		return false
+	}
+	policies := make(map[string]int)
+	for _, p := range l {
+		policies[p]++
+	}
+	for _, p := range r {
+		if policies[p] == 0 {
+			return false
+		}
+		policies[p]--
+	}
+	return true
+}
+
 func (_ *ServerGroup) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *ServerGroup) error {
 	if a == nil {
 		glog.V(2).Infof("Creating ServerGroup with Name:%q", fi.StringValue(e.Name))
@@ -121,7 +174,7 @@ func (_ *ServerGroup) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, cha
 			Policies: e.Policies,
 		}
 
-		g, err := t.Cloud.CreateServerGroup(opt)
+		g, err := t.CreateServerGroup(opt)
 		if err != nil {
 			return fmt.Errorf("error creating ServerGroup: %v", err)
 		}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func TestServerGroupPolicyChange(t *testing.T) {
+	actual := &ServerGroup{
+		ID:       fi.String("sg-1"),
+		Name:     fi.String("cluster-master"),
+		Policies: []string{"anti-affinity"},
+	}
+	expected := &ServerGroup{
+		ID:       fi.String("sg-1"),
+		Name:     fi.String("cluster-master"),
+		Policies: []string{"soft-anti-affinity"},
+	}
+	changes := &ServerGroup{Policies: expected.Policies}
+
+	err := (&ServerGroup{}).CheckChanges(actual, expected, changes)
+	if err == nil {
+		t.Fatalf("expected error when changing the server group policy")
+	}
+	if !strings.Contains(err.Error(), "replace the instance group") {
+		t.Errorf("expected error to explain the instance group must be replaced, got %v", err)
+	}
+}
+
+func TestServerGroupPolicyUnchanged(t *testing.T) {
+	actual := &ServerGroup{
+		ID:       fi.String("sg-1"),
+		Name:     fi.String("cluster-master"),
+		Policies: []string{"anti-affinity"},
+	}
+	expected := &ServerGroup{
+		ID:       fi.String("sg-1"),
+		Name:     fi.String("cluster-master"),
+		Policies: []string{"anti-affinity"},
+		MaxSize:  fi.Int32(3),
+	}
+	changes := &ServerGroup{MaxSize: expected.MaxSize}
+
+	if err := (&ServerGroup{}).CheckChanges(actual, expected, changes); err != nil {
+		t.Errorf("unexpected error for unchanged policy: %v", err)
+	}
+}
+
+func TestSupportedServerGroupPolicies(t *testing.T) {
+	grid := []struct {
+		maxMicroversion string
+		policies        []string
+		expected        []string
+	}{
+		{maxMicroversion: "2.15", policies: []string{"soft-anti-affinity"}, expected: []string{"soft-anti-affinity"}},
+		{maxMicroversion: "2.60", policies: []string{"soft-affinity"}, expected: []string{"soft-affinity"}},
+		{maxMicroversion: "2.14", policies: []string{"soft-anti-affinity"}, expected: []string{"anti-affinity"}},
+		{maxMicroversion: "", policies: []string{"soft-affinity"}, expected: []string{"affinity"}},
+		{maxMicroversion: "", policies: []string{"anti-affinity"}, expected: []string{"anti-affinity"}},
+	}
+	for _, g := range grid {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"version": {"id": "v2.1", "status": "CURRENT", "version": %q, "min_version": "2.1"}}`, g.maxMicroversion)
+		}))
+		// the client requests the default microversion, the supported microversions of the server decide
+		actual, err := supportedServerGroupPolicies(newTestServiceClient(server), g.policies)
+		server.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(actual, g.expected) {
+			t.Errorf("maximum microversion %q: expected %v for %v, got %v", g.maxMicroversion, g.expected, g.policies, actual)
+		}
+	}
+}
+
+func TestServerGroupFindListsOncePerTarget(t *testing.T) {
+	cloud := &mockCloud{
+		serverGroups: []servergroups.ServerGroup{
+			{ID: "sg-1", Name: "cluster-master", Policies: []string{"anti-affinity"}},
+		},
+	}
+	context := &fi.Context{Cloud: cloud, Target: openstack.NewOpenstackAPITarget(cloud)}
+
+	master := &ServerGroup{Name: fi.String("cluster-master"), Policies: []string{"anti-affinity"}}
+	actual, err := master.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual == nil || fi.StringValue(actual.ID) != "sg-1" {
+		t.Fatalf("expected to find server group sg-1, got %v", actual)
+	}
+
+	nodes := &ServerGroup{Name: fi.String("cluster-nodes"), Policies: []string{"anti-affinity"}}
+	actual, err = nodes.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual != nil {
+		t.Fatalf("expected no server group, got %v", actual)
+	}
+	if err := nodes.RenderOpenstack(context.Target.(*openstack.OpenstackAPITarget), nil, nodes, nodes); err != nil {
+		t.Fatalf("unexpected error creating server group: %v", err)
+	}
+
+	// the server group created by the target is found without listing again
+	actual, err = (&ServerGroup{Name: fi.String("cluster-nodes")}).Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual == nil || fi.StringValue(actual.ID) != fi.StringValue(nodes.ID) {
+		t.Errorf("expected to find the created server group %s, got %v", fi.StringValue(nodes.ID), actual)
+	}
+	if cloud.serverGroupLists != 1 {
+		t.Errorf("expected the server groups to be listed once, got %d", cloud.serverGroupLists)
+	}
+}
+
+func TestServerGroupWithDuplicateName(t *testing.T) {
+	cloud := &mockCloud{
+		serverGroups: []servergroups.ServerGroup{
+			{ID: "sg-1", Name: "cluster-master"},
+			{ID: "sg-2", Name: "cluster-master"},
+		},
+	}
+	e := &ServerGroup{Name: fi.String("cluster-master")}
+	_, err := e.Find(&fi.Context{Cloud: cloud})
+	if err == nil || !strings.Contains(err.Error(), "found multiple server groups") {
+		t.Errorf("expected an error for the duplicate server groups, got %v", err)
+	}
+}
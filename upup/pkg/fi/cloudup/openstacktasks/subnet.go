@@ -18,6 +18,7 @@ package openstacktasks
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/golang/glog"
 	"github.com/gophercloud/gophercloud"
@@ -33,7 +34,19 @@ type Subnet struct {
 	Network    *Network
 	CIDR       *string
 	DNSServers []*string
-	Lifecycle  *fi.Lifecycle
+	// CheckMetadataService warns if an existing subnet has no access to the metadata service, the model sets it
+	// when instances on the subnet read their metadata from the metadata service instead of a config drive
+	CheckMetadataService *bool
+	// MetadataRoute adds a host route to the metadata service when the subnet is created
+	MetadataRoute *bool
+	// IPVersion is 4 or 6, subnets are IPv4 unless set
+	IPVersion *int
+	// IPv6AddressMode and IPv6RAMode are the address and router advertisement modes of IPv6 subnets
+	IPv6AddressMode *string
+	IPv6RAMode      *string
+	// Tags are the Neutron tags of the subnet, which is found by its name and tags
+	Tags      []string
+	Lifecycle *fi.Lifecycle
 }
 
 // GetDependencies returns the dependencies of the Port task
@@ -49,6 +62,14 @@ func (e *Subnet) GetDependencies(tasks map[string]fi.Task) []fi.Task {
 
 var _ fi.CompareWithID = &Subnet{}
 
+// ipVersion returns the IP version of the subnet, IPv4 unless set
+func (s *Subnet) ipVersion() int {
+	if s.IPVersion == nil {
+		return 4
+	}
+	return *s.IPVersion
+}
+
 func (s *Subnet) CompareWithID() *string {
 	return s.ID
 }
@@ -75,32 +96,106 @@ func NewSubnetTaskFromCloud(cloud openstack.OpenstackCloud, lifecycle *fi.Lifecy
 	}
 	if find != nil {
 		find.ID = actual.ID
+		// existing subnets are not updated, only checked for access to the metadata service
+		actual.CheckMetadataService = find.CheckMetadataService
+		actual.MetadataRoute = find.MetadataRoute
+		actual.IPVersion = find.IPVersion
+		actual.IPv6AddressMode = find.IPv6AddressMode
+		actual.IPv6RAMode = find.IPv6RAMode
+		actual.Tags = actualTags(subnet.Tags, find.Tags)
+		if fi.BoolValue(find.CheckMetadataService) {
+			if warning := openstack.MetadataServiceWarning(subnet); warning != "" {
+				glog.Warning(warning)
+			}
+		}
 	}
 	return actual, nil
 }
 
 func (s *Subnet) Find(context *fi.Context) (*Subnet, error) {
 	cloud := context.Cloud.(openstack.OpenstackCloud)
+	if err := dropUnsupportedTags(cloud, &s.Tags); err != nil {
+		return nil, err
+	}
 	opt := subnets.ListOpts{
 		ID:         fi.StringValue(s.ID),
 		Name:       fi.StringValue(s.Name),
 		NetworkID:  fi.StringValue(s.Network.ID),
 		CIDR:       fi.StringValue(s.CIDR),
 		EnableDHCP: fi.Bool(true),
-		IPVersion:  4,
+		IPVersion:  s.ipVersion(),
+		Tags:       openstack.TagFilter(s.Tags),
 	}
 	rs, err := cloud.ListSubnets(opt)
 	if err != nil {
 		return nil, err
 	}
 	if rs == nil {
-		return nil, nil
+		var all []subnets.Subnet
+		untagged, err := findUntagged(s.Tags, func() (int, error) {
+			opt.Tags = ""
+			all, err = cloud.ListSubnets(opt)
+			return len(all), err
+		}, func(i int) []string { return all[i].Tags })
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range untagged {
+			rs = append(rs, all[i])
+		}
+	}
+	if rs == nil {
+		return s.findByCIDR(cloud)
 	} else if len(rs) != 1 {
 		return nil, fmt.Errorf("found multiple subnets with name: %s", fi.StringValue(s.Name))
 	}
 	return NewSubnetTaskFromCloud(cloud, s.Lifecycle, &rs[0], s)
 }
 
+// findByCIDR looks for a pre-provisioned subnet with the desired CIDR on the target network.
+// A subnet with a matching CIDR is adopted regardless of its name, while a subnet whose CIDR
+// overlaps the desired one is reported as a conflict.
+func (s *Subnet) findByCIDR(cloud openstack.OpenstackCloud) (*Subnet, error) {
+	if s.Network == nil || s.Network.ID == nil || s.CIDR == nil {
+		return nil, nil
+	}
+	_, cidr, err := net.ParseCIDR(fi.StringValue(s.CIDR))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CIDR %q for subnet %s: %v", fi.StringValue(s.CIDR), fi.StringValue(s.Name), err)
+	}
+
+	rs, err := cloud.ListSubnets(subnets.ListOpts{
+		NetworkID: fi.StringValue(s.Network.ID),
+		IPVersion: s.ipVersion(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range rs {
+		_, existing, err := net.ParseCIDR(rs[i].CIDR)
+		if err != nil {
+			glog.Warningf("ignoring subnet %s with invalid CIDR %q: %v", rs[i].ID, rs[i].CIDR, err)
+			continue
+		}
+		if existing.String() == cidr.String() {
+			glog.V(2).Infof("Adopting existing Openstack subnet %s (%s) with CIDR %s", rs[i].Name, rs[i].ID, rs[i].CIDR)
+			actual, err := NewSubnetTaskFromCloud(cloud, s.Lifecycle, &rs[i], s)
+			if err != nil {
+				return nil, err
+			}
+			// The adopted subnet keeps its own name and tags, it is not tagged for the cluster so that it is not
+			// deleted together with the cluster. Reporting the desired name and tags avoids a rename and tagging.
+			actual.Name = s.Name
+			actual.Tags = s.Tags
+			return actual, nil
+		}
+		if existing.Contains(cidr.IP) || cidr.Contains(existing.IP) {
+			return nil, fmt.Errorf("subnet %s CIDR %s overlaps existing subnet %s (%s) with CIDR %s", fi.StringValue(s.Name), fi.StringValue(s.CIDR), rs[i].Name, rs[i].ID, rs[i].CIDR)
+		}
+	}
+	return nil, nil
+}
+
 func (s *Subnet) Run(context *fi.Context) error {
 	return fi.DefaultDeltaRunMethod(s, context)
 }
@@ -120,13 +215,13 @@ func (_ *Subnet) CheckChanges(a, e, changes *Subnet) error {
 		if changes.Name != nil {
 			return fi.CannotChangeField("Name")
 		}
-		if e.DNSServers != nil {
+		if changes.DNSServers != nil {
 			return fi.CannotChangeField("DNSServers")
 		}
-		if e.Network != nil {
+		if changes.Network != nil {
 			return fi.CannotChangeField("Network")
 		}
-		if e.CIDR != nil {
+		if changes.CIDR != nil {
 			return fi.CannotChangeField("CIDR")
 		}
 	}
@@ -140,10 +235,14 @@ func (_ *Subnet) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes
 		opt := subnets.CreateOpts{
 			Name:       fi.StringValue(e.Name),
 			NetworkID:  fi.StringValue(e.Network.ID),
-			IPVersion:  gophercloud.IPv4,
+			IPVersion:  gophercloud.IPVersion(e.ipVersion()),
 			CIDR:       fi.StringValue(e.CIDR),
 			EnableDHCP: fi.Bool(true),
 		}
+		if e.ipVersion() == 6 {
+			opt.IPv6AddressMode = fi.StringValue(e.IPv6AddressMode)
+			opt.IPv6RAMode = fi.StringValue(e.IPv6RAMode)
+		}
 
 		if len(e.DNSServers) > 0 {
 			dnsNameSrv := make([]string, len(e.DNSServers))
@@ -152,6 +251,14 @@ func (_ *Subnet) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes
 			}
 			opt.DNSNameservers = dnsNameSrv
 		}
+		// the metadata service is only reachable over IPv4
+		if fi.BoolValue(e.MetadataRoute) && e.ipVersion() == 4 {
+			route, err := openstack.MetadataHostRoute(fi.StringValue(e.CIDR), "")
+			if err != nil {
+				return fmt.Errorf("error building metadata route for subnet %s: %v", fi.StringValue(e.Name), err)
+			}
+			opt.HostRoutes = []subnets.HostRoute{route}
+		}
 		v, err := t.Cloud.CreateSubnet(opt)
 		if err != nil {
 			return fmt.Errorf("Error creating subnet: %v", err)
@@ -159,9 +266,15 @@ func (_ *Subnet) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes
 
 		e.ID = fi.String(v.ID)
 		glog.V(2).Infof("Creating a new Openstack subnet, id=%s", v.ID)
+		if len(e.Tags) > 0 {
+			return renderTags(t.Cloud, openstack.ResourceTypeSubnet, v.ID, nil, e.Tags)
+		}
 		return nil
 	}
 	e.ID = a.ID
+	if changes.Tags != nil {
+		return renderTags(t.Cloud, openstack.ResourceTypeSubnet, fi.StringValue(a.ID), a.Tags, e.Tags)
+	}
 	glog.V(2).Infof("Using an existing Openstack subnet, id=%s", fi.StringValue(e.ID))
 	return nil
 }
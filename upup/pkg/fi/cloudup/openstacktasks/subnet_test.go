@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func newSubnetTestCloud(existing ...subnets.Subnet) *mockCloud {
+	return &mockCloud{
+		networks: []networks.Network{{ID: "net-1", Name: "cluster"}},
+		subnets:  existing,
+	}
+}
+
+func newSubnetTask(name, cidr string) *Subnet {
+	return &Subnet{
+		Name:    fi.String(name),
+		Network: &Network{ID: fi.String("net-1"), Name: fi.String("cluster")},
+		CIDR:    fi.String(cidr),
+	}
+}
+
+func TestSubnetAdoptByCIDR(t *testing.T) {
+	cloud := newSubnetTestCloud(subnets.Subnet{ID: "existing", Name: "preprovisioned", NetworkID: "net-1", CIDR: "10.0.1.0/24"})
+	e := newSubnetTask("subnet-a", "10.0.1.0/24")
+
+	actual, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual == nil {
+		t.Fatalf("expected subnet to be adopted")
+	}
+	if fi.StringValue(actual.ID) != "existing" || fi.StringValue(e.ID) != "existing" {
+		t.Errorf("expected adopted subnet ID to be populated, got actual=%q expected=%q", fi.StringValue(actual.ID), fi.StringValue(e.ID))
+	}
+	if fi.StringValue(actual.Name) != "subnet-a" {
+		t.Errorf("adopted subnet should not report a name change, got %q", fi.StringValue(actual.Name))
+	}
+}
+
+func TestSubnetCreate(t *testing.T) {
+	cloud := newSubnetTestCloud(subnets.Subnet{ID: "other", Name: "other", NetworkID: "net-1", CIDR: "10.0.2.0/24"})
+	e := newSubnetTask("subnet-a", "10.0.1.0/24")
+
+	actual, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual != nil {
+		t.Fatalf("expected no existing subnet, got %v", actual)
+	}
+
+	err = e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+	if err != nil {
+		t.Fatalf("unexpected error creating subnet: %v", err)
+	}
+	if len(cloud.subnets) != 2 {
+		t.Fatalf("expected subnet to be created, found %d subnets", len(cloud.subnets))
+	}
+	if fi.StringValue(e.ID) != cloud.subnets[1].ID {
+		t.Errorf("expected ID %q, got %q", cloud.subnets[1].ID, fi.StringValue(e.ID))
+	}
+}
+
+func TestSubnetCIDROverlap(t *testing.T) {
+	cloud := newSubnetTestCloud(subnets.Subnet{ID: "existing", Name: "wide", NetworkID: "net-1", CIDR: "10.0.0.0/16"})
+	e := newSubnetTask("subnet-a", "10.0.1.0/24")
+
+	_, err := e.Find(&fi.Context{Cloud: cloud})
+	if err == nil {
+		t.Fatalf("expected overlap error")
+	}
+	if !strings.Contains(err.Error(), "overlaps") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubnetCreateWithMetadataRoute(t *testing.T) {
+	cloud := newSubnetTestCloud()
+	e := newSubnetTask("subnet-a", "10.0.1.0/24")
+	e.MetadataRoute = fi.Bool(true)
+
+	err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+	if err != nil {
+		t.Fatalf("unexpected error creating subnet: %v", err)
+	}
+	if len(cloud.subnets) != 1 {
+		t.Fatalf("expected subnet to be created, found %d subnets", len(cloud.subnets))
+	}
+	routes := cloud.subnets[0].HostRoutes
+	if len(routes) != 1 || routes[0].DestinationCIDR != openstack.MetadataServiceCIDR || routes[0].NextHop != "10.0.1.1" {
+		t.Errorf("expected metadata route via 10.0.1.1, got %+v", routes)
+	}
+}
+
+func TestSubnetAdoptedKeepsMetadataSettings(t *testing.T) {
+	cloud := newSubnetTestCloud(subnets.Subnet{ID: "existing", Name: "preprovisioned", NetworkID: "net-1", CIDR: "10.0.1.0/24"})
+	e := newSubnetTask("subnet-a", "10.0.1.0/24")
+	e.CheckMetadataService = fi.Bool(true)
+	e.MetadataRoute = fi.Bool(true)
+
+	actual, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !fi.BoolValue(actual.CheckMetadataService) || !fi.BoolValue(actual.MetadataRoute) {
+		t.Errorf("existing subnet should not report metadata changes, got %+v", actual)
+	}
+}
+
+func TestSubnetCreateIPv6(t *testing.T) {
+	cloud := newSubnetTestCloud(subnets.Subnet{ID: "v4", Name: "v4", NetworkID: "net-1", CIDR: "10.0.1.0/24", IPVersion: 4})
+	e := newSubnetTask("subnet-a", "2001:db8::/64")
+	e.IPVersion = fi.Int(6)
+	e.IPv6AddressMode = fi.String("slaac")
+	e.IPv6RAMode = fi.String("slaac")
+	e.MetadataRoute = fi.Bool(true)
+
+	actual, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual != nil {
+		t.Fatalf("an IPv4 subnet should not be found for an IPv6 subnet, got %v", actual)
+	}
+
+	err = e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e)
+	if err != nil {
+		t.Fatalf("unexpected error creating subnet: %v", err)
+	}
+	if len(cloud.subnets) != 2 {
+		t.Fatalf("expected subnet to be created, found %d subnets", len(cloud.subnets))
+	}
+	created := cloud.subnets[1]
+	if created.IPVersion != 6 || created.IPv6AddressMode != "slaac" || created.IPv6RAMode != "slaac" {
+		t.Errorf("expected an IPv6 slaac subnet, got %+v", created)
+	}
+	if len(created.HostRoutes) != 0 {
+		t.Errorf("expected no metadata route on an IPv6 subnet, got %+v", created.HostRoutes)
+	}
+
+	actual, err = e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual == nil || fi.StringValue(actual.ID) != created.ID {
+		t.Errorf("expected the IPv6 subnet to be found, got %v", actual)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// hasTags returns true if the resource has all the tags
+func hasTags(resourceTags []string, tags []string) bool {
+	for _, tag := range tags {
+		if !containsTag(resourceTags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// actualTags returns the tags of the task if the resource has all of them, so that tags added to
+// the resource by others cause no changes, and the tags of the resource otherwise
+func actualTags(resourceTags []string, tags []string) []string {
+	if hasTags(resourceTags, tags) {
+		return tags
+	}
+	return resourceTags
+}
+
+// hasClusterTag returns true if one of the tags marks the resource as a resource of a cluster
+func hasClusterTag(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, openstack.TagClusterName+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// findUntagged is used when no resource carries the tags of the task. Resources created before kops tagged them
+// are then adopted by name, unless a cluster tag marks them as resources of another cluster. list lists the
+// resources by name and returns their number, tagsOf returns the tags of the i-th of them; the indexes of the
+// resources which can be adopted are returned.
+func findUntagged(tags []string, list func() (int, error), tagsOf func(i int) []string) ([]int, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	n, err := list()
+	if err != nil {
+		return nil, err
+	}
+	var untagged []int
+	for i := 0; i < n; i++ {
+		if !hasClusterTag(tagsOf(i)) {
+			untagged = append(untagged, i)
+		}
+	}
+	return untagged, nil
+}
+
+// dropUnsupportedTags clears the tags of a task when Neutron does not have the tag extension,
+// the resource is then found by its name only and left untagged
+func dropUnsupportedTags(cloud openstack.OpenstackCloud, tags *[]string) error {
+	if len(*tags) == 0 {
+		return nil
+	}
+	supported, err := cloud.HasExtension(openstack.ServiceNetwork, openstack.ExtensionTags)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		glog.V(4).Infof("Neutron does not have the %s extension, ignoring tags %v", openstack.ExtensionTags, *tags)
+		*tags = nil
+	}
+	return nil
+}
+
+// dropUnsupportedLBTags clears the tags of a loadbalancer task when the loadbalancer service cannot tag
+// loadbalancers, which needs Octavia API version 2.5. The loadbalancer is then left untagged.
+func dropUnsupportedLBTags(cloud openstack.OpenstackCloud, tags *[]string) error {
+	if len(*tags) == 0 {
+		return nil
+	}
+	supported, err := cloud.SupportsLBTags()
+	if err != nil {
+		return err
+	}
+	if !supported {
+		glog.V(4).Infof("The loadbalancer service does not support tags, ignoring tags %v", *tags)
+		*tags = nil
+	}
+	return nil
+}
+
+// mergeTags returns the tags of the resource followed by the tags of the task it does not have yet
+func mergeTags(actual []string, tags []string) []string {
+	merged := append([]string(nil), actual...)
+	for _, tag := range tags {
+		if !containsTag(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// renderTags adds the tags of the task to an existing resource, keeping the tags added by others
+func renderTags(cloud openstack.OpenstackCloud, resourceType string, resourceID string, actual []string, tags []string) error {
+	merged := mergeTags(actual, tags)
+	glog.V(2).Infof("Tagging Openstack %s %s with %v", resourceType, resourceID, tags)
+	if err := cloud.SetResourceTags(resourceType, resourceID, merged); err != nil {
+		return fmt.Errorf("Error tagging %s %s: %v", resourceType, resourceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+//go:generate fitask -type=Trunk
+type Trunk struct {
+	ID   *string
+	Name *string
+	// Port is the parent port of the trunk, carrying the untagged traffic of the instance.
+	// Neutron only creates trunks on ports which are not yet bound to an instance.
+	Port *Port
+	// SubPorts are the networks carried by the trunk as VLANs, the trunk creates a port on each of them
+	SubPorts  []*TrunkSubPort
+	Lifecycle *fi.Lifecycle
+}
+
+// TrunkSubPort is a network carried by the trunk as a VLAN
+type TrunkSubPort struct {
+	// Network is the name or ID of the network
+	Network *string
+	// SegmentationID is the VLAN ID of the network on the trunk
+	SegmentationID *int
+}
+
+// GetDependencies returns the dependencies of the Trunk task
+func (e *Trunk) GetDependencies(tasks map[string]fi.Task) []fi.Task {
+	var deps []fi.Task
+	for _, task := range tasks {
+		if _, ok := task.(*Port); ok {
+			deps = append(deps, task)
+		}
+	}
+	return deps
+}
+
+var _ fi.CompareWithID = &Trunk{}
+
+func (e *Trunk) CompareWithID() *string {
+	return e.ID
+}
+
+func (e *Trunk) Find(c *fi.Context) (*Trunk, error) {
+	if e == nil || e.Name == nil {
+		return nil, nil
+	}
+	cloud := c.Cloud.(openstack.OpenstackCloud)
+	supported, err := cloud.HasExtension(openstack.ServiceNetwork, openstack.ExtensionTrunk)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return nil, fmt.Errorf("trunk %s requires the trunk extension of Neutron, which the cloud does not have", fi.StringValue(e.Name))
+	}
+
+	trunks, err := cloud.ListTrunks(openstack.TrunkListOpts{Name: fi.StringValue(e.Name)})
+	if err != nil {
+		return nil, err
+	}
+	if len(trunks) == 0 {
+		return nil, nil
+	} else if len(trunks) != 1 {
+		return nil, fmt.Errorf("found multiple trunks with name: %s", fi.StringValue(e.Name))
+	}
+
+	trunk := trunks[0]
+	actual := &Trunk{
+		ID:        fi.String(trunk.ID),
+		Name:      fi.String(trunk.Name),
+		Port:      &Port{ID: fi.String(trunk.PortID)},
+		SubPorts:  presentSubPorts(trunk.SubPorts, e.SubPorts),
+		Lifecycle: e.Lifecycle,
+	}
+	e.ID = actual.ID
+	return actual, nil
+}
+
+// presentSubPorts returns the wanted subports whose VLAN the trunk already carries
+func presentSubPorts(existing []openstack.SubPort, wanted []*TrunkSubPort) []*TrunkSubPort {
+	var present []*TrunkSubPort
+	for _, w := range wanted {
+		for _, e := range existing {
+			if e.SegmentationType == openstack.SegmentationTypeVLAN && e.SegmentationID == fi.IntValue(w.SegmentationID) {
+				present = append(present, w)
+				break
+			}
+		}
+	}
+	return present
+}
+
+func (e *Trunk) Run(c *fi.Context) error {
+	return fi.DefaultDeltaRunMethod(e, c)
+}
+
+func (_ *Trunk) CheckChanges(a, e, changes *Trunk) error {
+	if a == nil {
+		if e.Name == nil {
+			return fi.RequiredField("Name")
+		}
+		if e.Port == nil {
+			return fi.RequiredField("Port")
+		}
+	} else {
+		if changes.ID != nil {
+			return fi.CannotChangeField("ID")
+		}
+		if changes.Name != nil {
+			return fi.CannotChangeField("Name")
+		}
+		if changes.Port != nil {
+			return fi.CannotChangeField("Port")
+		}
+	}
+	vlans := make(map[int]bool)
+	for _, sp := range e.SubPorts {
+		if sp.Network == nil {
+			return fi.RequiredField("SubPorts.Network")
+		}
+		id := fi.IntValue(sp.SegmentationID)
+		if id < 1 || id > 4094 {
+			return fmt.Errorf("VLAN ID of the subport of trunk %s on network %s must be between 1 and 4094, got %d", fi.StringValue(e.Name), fi.StringValue(sp.Network), id)
+		}
+		if vlans[id] {
+			return fmt.Errorf("trunk %s has multiple subports with VLAN ID %d", fi.StringValue(e.Name), id)
+		}
+		vlans[id] = true
+	}
+	return nil
+}
+
+func (_ *Trunk) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *Trunk) error {
+	if a == nil {
+		glog.V(2).Infof("Creating Trunk with name: %q", fi.StringValue(e.Name))
+
+		subPorts, err := e.ensureSubPorts(t.Cloud, e.SubPorts)
+		if err != nil {
+			return err
+		}
+		v, err := t.Cloud.CreateTrunk(openstack.TrunkCreateOpts{
+			Name:     fi.StringValue(e.Name),
+			PortID:   fi.StringValue(e.Port.ID),
+			SubPorts: subPorts,
+		})
+		if err != nil {
+			return fmt.Errorf("Error creating trunk: %v", err)
+		}
+		e.ID = fi.String(v.ID)
+		glog.V(2).Infof("Creating a new Openstack trunk, id=%s", v.ID)
+		return nil
+	}
+
+	e.ID = a.ID
+	if changes.SubPorts != nil {
+		var missing []*TrunkSubPort
+		for _, sp := range e.SubPorts {
+			if !containsSubPort(a.SubPorts, sp) {
+				missing = append(missing, sp)
+			}
+		}
+		subPorts, err := e.ensureSubPorts(t.Cloud, missing)
+		if err != nil {
+			return err
+		}
+		if len(subPorts) > 0 {
+			glog.V(2).Infof("Adding %d subports to Openstack trunk %s", len(subPorts), fi.StringValue(a.ID))
+			if _, err := t.Cloud.AddTrunkSubPorts(fi.StringValue(a.ID), subPorts); err != nil {
+				return fmt.Errorf("Error adding subports to trunk: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func containsSubPort(subPorts []*TrunkSubPort, sp *TrunkSubPort) bool {
+	for _, s := range subPorts {
+		if fi.IntValue(s.SegmentationID) == fi.IntValue(sp.SegmentationID) {
+			return true
+		}
+	}
+	return false
+}
+
+// subPortName returns the name of the port of the subport with the VLAN ID, which ends with the name of the trunk
+func (e *Trunk) subPortName(segmentationID int) string {
+	return fmt.Sprintf("vlan%d-%s", segmentationID, fi.StringValue(e.Name))
+}
+
+// ensureSubPorts creates the ports of the subports, reusing those left behind by an earlier failed attempt.
+// The ports share the MAC address and security groups of the parent port, as instances usually configure
+// the VLAN interfaces on top of the parent interface.
+func (e *Trunk) ensureSubPorts(cloud openstack.OpenstackCloud, wanted []*TrunkSubPort) ([]openstack.SubPort, error) {
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+	parent, err := cloud.GetPort(fi.StringValue(e.Port.ID))
+	if err != nil {
+		return nil, fmt.Errorf("error getting parent port of trunk %s: %v", fi.StringValue(e.Name), err)
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("parent port %s of trunk %s not found", fi.StringValue(e.Port.ID), fi.StringValue(e.Name))
+	}
+
+	var subPorts []openstack.SubPort
+	for _, sp := range wanted {
+		segmentationID := fi.IntValue(sp.SegmentationID)
+		name := e.subPortName(segmentationID)
+		existing, err := cloud.ListPorts(ports.ListOpts{Name: name})
+		if err != nil {
+			return nil, fmt.Errorf("error listing ports: %v", err)
+		}
+		var portID string
+		if len(existing) > 0 {
+			portID = existing[0].ID
+		} else {
+			network, err := findNetwork(cloud, fi.StringValue(sp.Network))
+			if err != nil {
+				return nil, fmt.Errorf("invalid network of the subport of trunk %s with VLAN ID %d: %v", fi.StringValue(e.Name), segmentationID, err)
+			}
+			sgs := append([]string{}, parent.SecurityGroups...)
+			glog.V(2).Infof("Creating port %q for VLAN %d of trunk %s", name, segmentationID, fi.StringValue(e.Name))
+			port, err := cloud.CreatePort(ports.CreateOpts{
+				Name:           name,
+				NetworkID:      network.ID,
+				MACAddress:     parent.MACAddress,
+				SecurityGroups: &sgs,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error creating subport of trunk %s: %v", fi.StringValue(e.Name), err)
+			}
+			portID = port.ID
+		}
+		subPorts = append(subPorts, openstack.SubPort{
+			PortID:           portID,
+			SegmentationType: openstack.SegmentationTypeVLAN,
+			SegmentationID:   segmentationID,
+		})
+	}
+	return subPorts, nil
+}
+
+// findNetwork returns the network with the given ID or name
+func findNetwork(cloud openstack.OpenstackCloud, nameOrID string) (*networks.Network, error) {
+	byID, err := cloud.ListNetworks(networks.ListOpts{ID: nameOrID})
+	if err != nil {
+		return nil, fmt.Errorf("error listing networks: %v", err)
+	}
+	if len(byID) == 1 {
+		return &byID[0], nil
+	}
+	byName, err := cloud.ListNetworks(networks.ListOpts{Name: nameOrID})
+	if err != nil {
+		return nil, fmt.Errorf("error listing networks: %v", err)
+	}
+	switch len(byName) {
+	case 0:
+		return nil, fmt.Errorf("network %q not found", nameOrID)
+	case 1:
+		return &byName[0], nil
+	default:
+		return nil, fmt.Errorf("found multiple networks with name %q", nameOrID)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func newTrunkTestCloud() *mockCloud {
+	return &mockCloud{
+		networks: []networks.Network{
+			{ID: "net-storage", Name: "storage"},
+			{ID: "net-pods", Name: "pods"},
+		},
+		ports: []ports.Port{
+			{ID: "port-1", Name: "port-nodes-1", MACAddress: "fa:16:3e:00:00:01", SecurityGroups: []string{"sg-nodes"}},
+		},
+	}
+}
+
+func TestTrunkCreate(t *testing.T) {
+	cloud := newTrunkTestCloud()
+	e := &Trunk{
+		Name: fi.String("trunk-nodes-1"),
+		Port: &Port{ID: fi.String("port-1")},
+		SubPorts: []*TrunkSubPort{
+			{Network: fi.String("storage"), SegmentationID: fi.Int(100)},
+		},
+	}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), nil, e, e); err != nil {
+		t.Fatalf("unexpected error creating trunk: %v", err)
+	}
+
+	if len(cloud.portRequests) != 1 {
+		t.Fatalf("expected a subport to be created, got %d", len(cloud.portRequests))
+	}
+	port := cloud.portRequests[0]
+	if port.Name != "vlan100-trunk-nodes-1" || port.NetworkID != "net-storage" || port.MACAddress != "fa:16:3e:00:00:01" || !reflect.DeepEqual(*port.SecurityGroups, []string{"sg-nodes"}) {
+		t.Errorf("unexpected subport %+v", port)
+	}
+	if len(cloud.trunks) != 1 {
+		t.Fatalf("expected a trunk to be created, got %d", len(cloud.trunks))
+	}
+	expected := []openstack.SubPort{{PortID: cloud.ports[1].ID, SegmentationType: "vlan", SegmentationID: 100}}
+	if cloud.trunks[0].PortID != "port-1" || !reflect.DeepEqual(cloud.trunks[0].SubPorts, expected) {
+		t.Errorf("unexpected trunk %+v", cloud.trunks[0])
+	}
+}
+
+func TestTrunkAddsSubPorts(t *testing.T) {
+	cloud := newTrunkTestCloud()
+	cloud.trunks = []openstack.Trunk{
+		{
+			ID:       "trunk-1",
+			Name:     "trunk-nodes-1",
+			PortID:   "port-1",
+			SubPorts: []openstack.SubPort{{PortID: "port-storage", SegmentationType: "vlan", SegmentationID: 100}},
+		},
+	}
+	e := &Trunk{
+		Name: fi.String("trunk-nodes-1"),
+		Port: &Port{ID: fi.String("port-1")},
+		SubPorts: []*TrunkSubPort{
+			{Network: fi.String("storage"), SegmentationID: fi.Int(100)},
+			{Network: fi.String("net-pods"), SegmentationID: fi.Int(200)},
+		},
+	}
+	a, err := e.Find(&fi.Context{Cloud: cloud})
+	if err != nil {
+		t.Fatalf("unexpected error finding trunk: %v", err)
+	}
+	if a == nil || len(a.SubPorts) != 1 {
+		t.Fatalf("expected the trunk to be found with one of the subports, got %+v", a)
+	}
+	changes := &Trunk{SubPorts: e.SubPorts}
+	if err := e.RenderOpenstack(openstack.NewOpenstackAPITarget(cloud), a, e, changes); err != nil {
+		t.Fatalf("unexpected error updating trunk: %v", err)
+	}
+
+	if len(cloud.portRequests) != 1 || cloud.portRequests[0].NetworkID != "net-pods" {
+		t.Fatalf("expected a subport on the pods network to be created, got %+v", cloud.portRequests)
+	}
+	subPorts := cloud.trunks[0].SubPorts
+	if len(subPorts) != 2 || subPorts[1].SegmentationID != 200 {
+		t.Errorf("expected the VLAN 200 subport to be added, got %+v", subPorts)
+	}
+}
+
+func TestTrunkRequiresExtension(t *testing.T) {
+	cloud := newTrunkTestCloud()
+	cloud.missingExtensions = []string{openstack.ExtensionTrunk}
+	e := &Trunk{
+		Name: fi.String("trunk-nodes-1"),
+		Port: &Port{ID: fi.String("port-1")},
+	}
+	_, err := e.Find(&fi.Context{Cloud: cloud})
+	if err == nil || !strings.Contains(err.Error(), "requires the trunk extension") {
+		t.Fatalf("expected missing extension error, got %v", err)
+	}
+}
+
+func TestTrunkCheckChanges(t *testing.T) {
+	grid := []struct {
+		subPorts []*TrunkSubPort
+		err      string
+	}{
+		{subPorts: []*TrunkSubPort{{Network: fi.String("storage"), SegmentationID: fi.Int(100)}}},
+		{subPorts: []*TrunkSubPort{{Network: fi.String("storage"), SegmentationID: fi.Int(4095)}}, err: "must be between 1 and 4094"},
+		{
+			subPorts: []*TrunkSubPort{
+				{Network: fi.String("storage"), SegmentationID: fi.Int(100)},
+				{Network: fi.String("pods"), SegmentationID: fi.Int(100)},
+			},
+			err: "multiple subports with VLAN ID 100",
+		},
+	}
+	for _, g := range grid {
+		e := &Trunk{Name: fi.String("trunk-nodes-1"), Port: &Port{ID: fi.String("port-1")}, SubPorts: g.subPorts}
+		err := e.CheckChanges(nil, e, e)
+		if g.err == "" && err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if g.err != "" && (err == nil || !strings.Contains(err.Error(), g.err)) {
+			t.Errorf("expected error %q, got %v", g.err, err)
+		}
+	}
+}
@@ -18,6 +18,8 @@ package openstacktasks
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/golang/glog"
 	cinderv2 "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
@@ -34,6 +36,52 @@ type Volume struct {
 	SizeGB           *int64
 	Tags             map[string]string
 	Lifecycle        *fi.Lifecycle
+	// EtcdVolumeSize overrides SizeGB when the volume is tagged as an etcd volume
+	EtcdVolumeSize *int64
+	// EtcdVolumeType overrides VolumeType when the volume is tagged as an etcd volume
+	EtcdVolumeType *string
+	// Device is the device name requested when the volume is attached, nova may not honour it
+	Device *string
+	// Multiattach creates a volume which can be attached to several servers at once, the volume type has to support it
+	Multiattach *bool
+	// Encrypted creates the volume with an encrypted volume type, an encrypted type is selected when VolumeType is not set
+	Encrypted *bool
+}
+
+// metadata returns the tags of the volume, together with the requested device
+func (c *Volume) metadata() map[string]string {
+	if c.Device == nil {
+		return c.Tags
+	}
+	metadata := make(map[string]string)
+	for k, v := range c.Tags {
+		metadata[k] = v
+	}
+	metadata[openstack.TagVolumeDevice] = fi.StringValue(c.Device)
+	return metadata
+}
+
+// isEtcdVolume returns true if the volume carries the tag of an etcd cluster
+func (c *Volume) isEtcdVolume() bool {
+	for k := range c.Tags {
+		if strings.HasPrefix(k, openstack.TagNameEtcdClusterPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEtcdSizing uses the etcd specific size and type for etcd volumes
+func (c *Volume) applyEtcdSizing() {
+	if !c.isEtcdVolume() {
+		return
+	}
+	if c.EtcdVolumeSize != nil {
+		c.SizeGB = c.EtcdVolumeSize
+	}
+	if c.EtcdVolumeType != nil {
+		c.VolumeType = c.EtcdVolumeType
+	}
 }
 
 var _ fi.CompareWithID = &Volume{}
@@ -67,6 +115,10 @@ func (c *Volume) Find(context *fi.Context) (*Volume, error) {
 		SizeGB:           fi.Int64(int64(v.Size)),
 		Tags:             v.Metadata,
 		Lifecycle:        c.Lifecycle,
+		EtcdVolumeSize:   c.EtcdVolumeSize,
+		EtcdVolumeType:   c.EtcdVolumeType,
+		Multiattach:      fi.Bool(v.Multiattach),
+		Encrypted:        fi.Bool(v.Encrypted),
 	}
 	// remove tags "readonly" and "attached_mode", openstack are adding these and if not removed
 	// kops will always try to update volumes
@@ -76,6 +128,10 @@ func (c *Volume) Find(context *fi.Context) (*Volume, error) {
 	if _, ok := actual.Tags["attached_mode"]; ok {
 		delete(actual.Tags, "attached_mode")
 	}
+	if device, ok := actual.Tags[openstack.TagVolumeDevice]; ok {
+		actual.Device = fi.String(device)
+		delete(actual.Tags, openstack.TagVolumeDevice)
+	}
 	c.ID = actual.ID
 	c.AvailabilityZone = actual.AvailabilityZone
 	return actual, nil
@@ -86,6 +142,7 @@ func (c *Volume) Run(context *fi.Context) error {
 	for k, v := range cloud.GetCloudTags() {
 		c.Tags[k] = v
 	}
+	c.applyEtcdSizing()
 
 	return fi.DefaultDeltaRunMethod(c, context)
 }
@@ -98,7 +155,7 @@ func (_ *Volume) CheckChanges(a, e, changes *Volume) error {
 		if e.AvailabilityZone == nil {
 			return fi.RequiredField("AvailabilityZone")
 		}
-		if e.VolumeType == nil {
+		if e.VolumeType == nil && !fi.BoolValue(e.Encrypted) {
 			return fi.RequiredField("VolumeType")
 		}
 		if e.SizeGB == nil {
@@ -117,41 +174,144 @@ func (_ *Volume) CheckChanges(a, e, changes *Volume) error {
 		if changes.SizeGB != nil {
 			return fi.CannotChangeField("SizeGB")
 		}
+		if changes.Multiattach != nil {
+			return fi.CannotChangeField("Multiattach")
+		}
+		if changes.Encrypted != nil {
+			return fi.CannotChangeField("Encrypted")
+		}
 	}
 	return nil
 }
 
+// validateVolumeType fails if the volume type is not available, listing the valid volume types
+func validateVolumeType(cloud openstack.OpenstackCloud, volumeType string) error {
+	volumeTypes, err := cloud.ListVolumeTypes()
+	if err != nil {
+		return fmt.Errorf("error listing volume types: %v", err)
+	}
+	var names []string
+	for _, t := range volumeTypes {
+		if t.Name == volumeType || t.ID == volumeType {
+			return nil
+		}
+		names = append(names, t.Name)
+	}
+	return fmt.Errorf("volume type %q not found, valid volume types are: %s", volumeType, strings.Join(names, ", "))
+}
+
+// selectEncryptedVolumeType returns the volume type if it is encrypted, or the first encrypted volume type by name
+// when no volume type is given. The encrypted volume types have to be created by the administrator of the cloud.
+// Only the encryption types of the candidates are read, each of them is a request to cinder.
+func selectEncryptedVolumeType(cloud openstack.OpenstackCloud, volumeType string) (string, error) {
+	volumeTypes, err := cloud.ListVolumeTypes()
+	if err != nil {
+		return "", fmt.Errorf("error listing volume types: %v", err)
+	}
+	if volumeType != "" {
+		var names []string
+		for _, t := range volumeTypes {
+			if t.Name != volumeType && t.ID != volumeType {
+				names = append(names, t.Name)
+				continue
+			}
+			encrypted, err := cloud.VolumeTypeEncrypted(t.ID)
+			if openstack.IsEncryptionTypeHidden(err) {
+				return "", fmt.Errorf("cannot check whether volume type %q is encrypted: %v", volumeType, err)
+			}
+			if err != nil {
+				return "", err
+			}
+			if !encrypted {
+				return "", fmt.Errorf("volume type %q is not encrypted, it needs an encryption type", volumeType)
+			}
+			return volumeType, nil
+		}
+		return "", fmt.Errorf("volume type %q not found, valid volume types are: %s", volumeType, strings.Join(names, ", "))
+	}
+
+	sort.Slice(volumeTypes, func(i, j int) bool { return volumeTypes[i].Name < volumeTypes[j].Name })
+	var hidden []string
+	for _, t := range volumeTypes {
+		encrypted, err := cloud.VolumeTypeEncrypted(t.ID)
+		if openstack.IsEncryptionTypeHidden(err) {
+			hidden = append(hidden, t.Name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if encrypted {
+			return t.Name, nil
+		}
+	}
+	if len(hidden) > 0 {
+		return "", fmt.Errorf("no encrypted volume type found, the policy of the cloud hides the encryption type of volume types %s: "+
+			"set the encrypted volume type in the cluster spec", strings.Join(hidden, ", "))
+	}
+	return "", fmt.Errorf("no encrypted volume type found, the cloud administrator has to create a volume type with an encryption type")
+}
+
+// storageZone returns the cinder availability zone of a volume used by servers in the compute zone, the zone
+// of the same name or the only zone of cinder. Without a compute zone cinder places the volume in its default zone.
+func storageZone(cloud openstack.OpenstackCloud, computeZone *string) (string, error) {
+	if fi.StringValue(computeZone) == "" {
+		return "", nil
+	}
+	storageAZ, err := cloud.GetStorageAZFromCompute(fi.StringValue(computeZone))
+	if err != nil {
+		return "", fmt.Errorf("Failed to get storage availability zone: %s", err)
+	}
+	return storageAZ.ZoneName, nil
+}
+
 func (_ *Volume) RenderOpenstack(t *openstack.OpenstackAPITarget, a, e, changes *Volume) error {
 	if a == nil {
 		glog.V(2).Infof("Creating PersistentVolume with Name:%q", fi.StringValue(e.Name))
+		volumeType := fi.StringValue(e.VolumeType)
+		if fi.BoolValue(e.Encrypted) {
+			selected, err := selectEncryptedVolumeType(t.Cloud, volumeType)
+			if err != nil {
+				return err
+			}
+			volumeType = selected
+		} else if err := validateVolumeType(t.Cloud, volumeType); err != nil {
+			return err
+		}
 
-		storageAZ, err := t.Cloud.GetStorageAZFromCompute(fi.StringValue(e.AvailabilityZone))
+		zone, err := storageZone(t.Cloud, e.AvailabilityZone)
 		if err != nil {
-			return fmt.Errorf("Failed to get storage availability zone: %s", err)
+			return err
 		}
 
 		opt := cinderv2.CreateOpts{
 			Size:             int(*e.SizeGB),
-			AvailabilityZone: storageAZ.ZoneName,
-			Metadata:         e.Tags,
+			AvailabilityZone: zone,
+			Metadata:         e.metadata(),
 			Name:             fi.StringValue(e.Name),
-			VolumeType:       fi.StringValue(e.VolumeType),
+			VolumeType:       volumeType,
+		}
+
+		var createOpts cinderv2.CreateOptsBuilder = opt
+		if fi.BoolValue(e.Multiattach) {
+			createOpts = openstack.MultiattachCreateOpts{CreateOptsBuilder: opt, Multiattach: true}
 		}
 
-		v, err := t.Cloud.CreateVolume(opt)
+		v, err := t.Cloud.CreateVolume(createOpts)
 		if err != nil {
 			return fmt.Errorf("error creating PersistentVolume: %v", err)
 		}
 
 		e.ID = fi.String(v.ID)
 		e.AvailabilityZone = fi.String(v.AvailabilityZone)
+		e.VolumeType = fi.String(volumeType)
 		return nil
 	}
 
-	if changes != nil && changes.Tags != nil {
+	if changes != nil && (changes.Tags != nil || changes.Device != nil) {
 		glog.V(2).Infof("Update the tags on volume %q: %v, the differences are %v", fi.StringValue(e.ID), e.Tags, changes.Tags)
 
-		err := t.Cloud.SetVolumeTags(fi.StringValue(e.ID), e.Tags)
+		err := t.Cloud.SetVolumeTags(fi.StringValue(e.ID), e.metadata())
 		if err != nil {
 			return fmt.Errorf("error updating the tags on volume %q: %v", fi.StringValue(e.ID), err)
 		}
@@ -0,0 +1,273 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstacktasks
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+func newEtcdSizedVolume(name string, tags map[string]string) *Volume {
+	return &Volume{
+		Name:             fi.String(name),
+		AvailabilityZone: fi.String("nova"),
+		VolumeType:       fi.String("standard"),
+		SizeGB:           fi.Int64(20),
+		Tags:             tags,
+		EtcdVolumeSize:   fi.Int64(5),
+		EtcdVolumeType:   fi.String("fast-ssd"),
+	}
+}
+
+func TestVolumeEtcdSizing(t *testing.T) {
+	grid := []struct {
+		name         string
+		tags         map[string]string
+		expectedSize int
+		expectedType string
+	}{
+		{
+			name:         "etcd-main",
+			tags:         map[string]string{openstack.TagNameEtcdClusterPrefix + "main": "a/a"},
+			expectedSize: 5,
+			expectedType: "fast-ssd",
+		},
+		{
+			name:         "data",
+			tags:         map[string]string{openstack.TagNameRolePrefix + "master": "1"},
+			expectedSize: 20,
+			expectedType: "standard",
+		},
+	}
+	for _, g := range grid {
+		cloud := &mockCloud{}
+		context := &fi.Context{
+			Cloud:         cloud,
+			Target:        openstack.NewOpenstackAPITarget(cloud),
+			CheckExisting: true,
+		}
+		v := newEtcdSizedVolume(g.name, g.tags)
+		if err := v.Run(context); err != nil {
+			t.Fatalf("unexpected error creating volume %s: %v", g.name, err)
+		}
+
+		if len(cloud.volumes) != 1 {
+			t.Fatalf("expected one volume to be created, got %d", len(cloud.volumes))
+		}
+		if cloud.volumes[0].Size != g.expectedSize {
+			t.Errorf("expected volume %s to have size %d, got %d", g.name, g.expectedSize, cloud.volumes[0].Size)
+		}
+		if cloud.volumes[0].VolumeType != g.expectedType {
+			t.Errorf("expected volume %s to have type %s, got %s", g.name, g.expectedType, cloud.volumes[0].VolumeType)
+		}
+
+		// a second run must find the volume unchanged
+		v = newEtcdSizedVolume(g.name, g.tags)
+		if err := v.Run(context); err != nil {
+			t.Errorf("unexpected error on second run of volume %s: %v", g.name, err)
+		}
+		if len(cloud.volumes) != 1 {
+			t.Errorf("expected volume %s not to be recreated", g.name)
+		}
+	}
+}
+
+func TestVolumeRequestedDevice(t *testing.T) {
+	cloud := &mockCloud{}
+	context := &fi.Context{
+		Cloud:         cloud,
+		Target:        openstack.NewOpenstackAPITarget(cloud),
+		CheckExisting: true,
+	}
+	newVolume := func(device string) *Volume {
+		v := newEtcdSizedVolume("etcd-main", map[string]string{openstack.TagNameEtcdClusterPrefix + "main": "a/a"})
+		v.Device = fi.String(device)
+		return v
+	}
+
+	if err := newVolume("/dev/vdb").Run(context); err != nil {
+		t.Fatalf("unexpected error creating volume: %v", err)
+	}
+	if len(cloud.volumes) != 1 || cloud.volumes[0].Metadata[openstack.TagVolumeDevice] != "/dev/vdb" {
+		t.Fatalf("expected requested device to be stored with the volume, got %+v", cloud.volumes)
+	}
+
+	v := newVolume("/dev/vdb")
+	actual, err := v.Find(context)
+	if err != nil {
+		t.Fatalf("unexpected error finding volume: %v", err)
+	}
+	if fi.StringValue(actual.Device) != "/dev/vdb" {
+		t.Errorf("expected device to be read back, got %q", fi.StringValue(actual.Device))
+	}
+	if _, found := actual.Tags[openstack.TagVolumeDevice]; found {
+		t.Errorf("device should not be reported as a tag")
+	}
+
+	if err := newVolume("/dev/vdc").Run(context); err != nil {
+		t.Fatalf("unexpected error updating volume: %v", err)
+	}
+	if cloud.volumes[0].Metadata[openstack.TagVolumeDevice] != "/dev/vdc" {
+		t.Errorf("expected requested device to be updated, got %v", cloud.volumes[0].Metadata)
+	}
+	if cloud.volumes[0].Metadata[openstack.TagNameEtcdClusterPrefix+"main"] != "a/a" {
+		t.Errorf("expected tags to be kept when updating the device, got %v", cloud.volumes[0].Metadata)
+	}
+}
+
+func TestVolumeUnknownType(t *testing.T) {
+	cloud := &mockCloud{
+		volumeTypes: []openstack.VolumeType{{ID: "type-1", Name: "standard"}, {ID: "type-3", Name: "ceph"}},
+	}
+	context := &fi.Context{
+		Cloud:         cloud,
+		Target:        openstack.NewOpenstackAPITarget(cloud),
+		CheckExisting: true,
+	}
+	v := newEtcdSizedVolume("etcd-main", map[string]string{openstack.TagNameEtcdClusterPrefix + "main": "a/a"})
+	err := v.Run(context)
+	if err == nil {
+		t.Fatalf("expected error creating volume with unknown type")
+	}
+	if !strings.Contains(err.Error(), `"fast-ssd"`) || !strings.Contains(err.Error(), "standard, ceph") {
+		t.Errorf("expected error to list the valid volume types, got %v", err)
+	}
+	if len(cloud.volumes) != 0 {
+		t.Errorf("expected no volume to be created, got %+v", cloud.volumes)
+	}
+}
+
+func TestVolumeMultiattach(t *testing.T) {
+	cloud := &mockCloud{}
+	context := &fi.Context{
+		Cloud:         cloud,
+		Target:        openstack.NewOpenstackAPITarget(cloud),
+		CheckExisting: true,
+	}
+	newVolume := func(multiattach bool) *Volume {
+		v := newEtcdSizedVolume("shared", map[string]string{})
+		v.Multiattach = fi.Bool(multiattach)
+		return v
+	}
+
+	if err := newVolume(true).Run(context); err != nil {
+		t.Fatalf("unexpected error creating volume: %v", err)
+	}
+	if len(cloud.volumes) != 1 || !cloud.volumes[0].Multiattach {
+		t.Fatalf("expected a multiattach volume to be created, got %+v", cloud.volumes)
+	}
+	if err := newVolume(true).Run(context); err != nil {
+		t.Errorf("unexpected error running unchanged volume: %v", err)
+	}
+	if err := newVolume(false).Run(context); err == nil || !strings.Contains(err.Error(), "Multiattach") {
+		t.Errorf("expected error changing multiattach of an existing volume, got %v", err)
+	}
+}
+
+func TestVolumeEncrypted(t *testing.T) {
+	grid := []struct {
+		volumeType   *string
+		volumeTypes  []openstack.VolumeType
+		encrypted    []string
+		hidden       []string
+		expectedType string
+		// requests is the number of encryption types read
+		requests int
+		err      string
+	}{
+		{
+			volumeTypes: []openstack.VolumeType{
+				{ID: "type-1", Name: "standard"},
+				{ID: "type-3", Name: "luks-ssd"},
+				{ID: "type-2", Name: "luks"},
+			},
+			encrypted:    []string{"type-2", "type-3"},
+			expectedType: "luks",
+			requests:     1,
+		},
+		{
+			volumeType: fi.String("luks-ssd"),
+			volumeTypes: []openstack.VolumeType{
+				{ID: "type-2", Name: "luks"},
+				{ID: "type-3", Name: "luks-ssd"},
+			},
+			encrypted:    []string{"type-2", "type-3"},
+			expectedType: "luks-ssd",
+			requests:     1,
+		},
+		{
+			volumeType:  fi.String("standard"),
+			volumeTypes: []openstack.VolumeType{{ID: "type-1", Name: "standard"}, {ID: "type-2", Name: "luks"}},
+			encrypted:   []string{"type-2"},
+			err:         `volume type "standard" is not encrypted`,
+		},
+		{
+			volumeTypes: []openstack.VolumeType{{ID: "type-1", Name: "standard"}},
+			err:         "no encrypted volume type found",
+		},
+		{
+			volumeType:  fi.String("luks"),
+			volumeTypes: []openstack.VolumeType{{ID: "type-2", Name: "luks"}},
+			hidden:      []string{"type-2"},
+			err:         `cannot check whether volume type "luks" is encrypted: volume type type-2: the policy of the cloud hides the encryption type`,
+		},
+		{
+			volumeTypes: []openstack.VolumeType{{ID: "type-1", Name: "standard"}, {ID: "type-2", Name: "luks"}},
+			hidden:      []string{"type-1", "type-2"},
+			err:         "the policy of the cloud hides the encryption type of volume types luks, standard",
+		},
+	}
+	for _, g := range grid {
+		cloud := &mockCloud{volumeTypes: g.volumeTypes, encryptedVolumeTypes: g.encrypted, hiddenVolumeTypes: g.hidden}
+		context := &fi.Context{
+			Cloud:         cloud,
+			Target:        openstack.NewOpenstackAPITarget(cloud),
+			CheckExisting: true,
+		}
+		v := &Volume{
+			Name:             fi.String("etcd-main"),
+			AvailabilityZone: fi.String("nova"),
+			VolumeType:       g.volumeType,
+			SizeGB:           fi.Int64(20),
+			Tags:             map[string]string{openstack.TagNameEtcdClusterPrefix + "main": "a/a"},
+			Encrypted:        fi.Bool(true),
+		}
+		err := v.Run(context)
+		if g.err != "" {
+			if err == nil || !strings.Contains(err.Error(), g.err) {
+				t.Errorf("expected error %q, got %v", g.err, err)
+			}
+			if len(cloud.volumes) != 0 {
+				t.Errorf("expected no volume to be created, got %+v", cloud.volumes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if len(cloud.volumes) != 1 || cloud.volumes[0].VolumeType != g.expectedType || !cloud.volumes[0].Encrypted {
+			t.Errorf("expected an encrypted volume of type %q, got %+v", g.expectedType, cloud.volumes)
+		}
+		if cloud.encryptionRequests != g.requests {
+			t.Errorf("expected %d encryption types to be read, got %d", g.requests, cloud.encryptionRequests)
+		}
+	}
+}
@@ -37,6 +37,7 @@ import (
 	nodeauthorizer "k8s.io/kops/pkg/model/components/node-authorizer"
 	"k8s.io/kops/upup/models"
 	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
 	"k8s.io/kops/upup/pkg/fi/loader"
 	"k8s.io/kops/util/pkg/reflectutils"
 	"k8s.io/kops/util/pkg/vfs"
@@ -234,6 +235,12 @@ func (c *populateClusterSpec) run(clientset simple.Clientset) error {
 		return err
 	}
 
+	if osCloud, ok := cloud.(openstack.OpenstackCloud); ok {
+		if err := openstack.PopulateFloatingNetworkID(osCloud, &cluster.Spec); err != nil {
+			return err
+		}
+	}
+
 	if cluster.Spec.DNSZone == "" && !dns.IsGossipHostname(cluster.ObjectMeta.Name) {
 		dns, err := cloud.DNS()
 		if err != nil {
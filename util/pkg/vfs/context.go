@@ -204,15 +204,28 @@ func (c *VFSContext) readHttpLocation(httpURL string, httpHeaders map[string]str
 // RetryWithBackoff runs until a condition function returns true, or until Steps attempts have been taken
 // As compared to wait.ExponentialBackoff, this function returns the results from the function on the final attempt
 func RetryWithBackoff(backoff wait.Backoff, condition func() (bool, error)) (bool, error) {
+	return RetryWithBackoffContext(context.Background(), backoff, condition)
+}
+
+// RetryWithBackoffContext is RetryWithBackoff, but stops retrying as soon as the context is done,
+// returning the error of the context
+func RetryWithBackoffContext(ctx context.Context, backoff wait.Backoff, condition func() (bool, error)) (bool, error) {
 	duration := backoff.Duration
 	i := 0
 	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		if i != 0 {
 			adjusted := duration
 			if backoff.Jitter > 0.0 {
 				adjusted = wait.Jitter(duration, backoff.Jitter)
 			}
-			time.Sleep(adjusted)
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(adjusted):
+			}
 			duration = time.Duration(float64(duration) * backoff.Factor)
 		}
 
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRetryWithBackoffContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	backoff := wait.Backoff{Duration: time.Hour, Factor: 1, Steps: 5}
+
+	attempts := 0
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	done, err := RetryWithBackoffContext(ctx, backoff, func() (bool, error) {
+		attempts++
+		return false, fmt.Errorf("not ready")
+	})
+	if done {
+		t.Errorf("expected retries to be aborted")
+	}
+	if err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt before the cancellation, got %d", attempts)
+	}
+}
+
+func TestRetryWithBackoffContextDone(t *testing.T) {
+	backoff := wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 5}
+
+	attempts := 0
+	done, err := RetryWithBackoffContext(context.Background(), backoff, func() (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	})
+	if !done || err != nil {
+		t.Errorf("expected success, got %v %v", done, err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/client-go/util/homedir"
+)
+
+// cloudProfile is the profile of a cloud in the clouds.yaml file of the openstack CLI
+type cloudProfile struct {
+	AuthType   string           `json:"auth_type,omitempty"`
+	Auth       cloudProfileAuth `json:"auth,omitempty"`
+	RegionName string           `json:"region_name,omitempty"`
+}
+
+type cloudProfileAuth struct {
+	AuthURL                     string `json:"auth_url,omitempty"`
+	Username                    string `json:"username,omitempty"`
+	UserID                      string `json:"user_id,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	ProjectName                 string `json:"project_name,omitempty"`
+	ProjectID                   string `json:"project_id,omitempty"`
+	TenantName                  string `json:"tenant_name,omitempty"`
+	TenantID                    string `json:"tenant_id,omitempty"`
+	UserDomainName              string `json:"user_domain_name,omitempty"`
+	UserDomainID                string `json:"user_domain_id,omitempty"`
+	ProjectDomainName           string `json:"project_domain_name,omitempty"`
+	ProjectDomainID             string `json:"project_domain_id,omitempty"`
+	DomainName                  string `json:"domain_name,omitempty"`
+	DomainID                    string `json:"domain_id,omitempty"`
+	ApplicationCredentialID     string `json:"application_credential_id,omitempty"`
+	ApplicationCredentialName   string `json:"application_credential_name,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+}
+
+// cloudProfileEnv maps the OS_* environment variables overriding the selected profile to its keys,
+// an empty section is the top level of the profile
+var cloudProfileEnv = []struct {
+	env     string
+	section string
+	key     string
+}{
+	{"OS_AUTH_TYPE", "", "auth_type"},
+	{"OS_REGION_NAME", "", "region_name"},
+	{"OS_AUTH_URL", "auth", "auth_url"},
+	{"OS_USERNAME", "auth", "username"},
+	{"OS_USER_ID", "auth", "user_id"},
+	{"OS_USERID", "auth", "user_id"},
+	{"OS_PASSWORD", "auth", "password"},
+	{"OS_PROJECT_NAME", "auth", "project_name"},
+	{"OS_PROJECT_ID", "auth", "project_id"},
+	{"OS_TENANT_NAME", "auth", "tenant_name"},
+	{"OS_TENANT_ID", "auth", "tenant_id"},
+	{"OS_USER_DOMAIN_NAME", "auth", "user_domain_name"},
+	{"OS_USER_DOMAIN_ID", "auth", "user_domain_id"},
+	{"OS_PROJECT_DOMAIN_NAME", "auth", "project_domain_name"},
+	{"OS_PROJECT_DOMAIN_ID", "auth", "project_domain_id"},
+	{"OS_DOMAIN_NAME", "auth", "domain_name"},
+	{"OS_DOMAIN_ID", "auth", "domain_id"},
+	{"OS_APPLICATION_CREDENTIAL_ID", "auth", "application_credential_id"},
+	{"OS_APPLICATION_CREDENTIAL_NAME", "auth", "application_credential_name"},
+	{"OS_APPLICATION_CREDENTIAL_SECRET", "auth", "application_credential_secret"},
+}
+
+// cloudsConfigFile returns the first existing file of the given name in the directories searched by the openstack CLI,
+// or the file set in the environment variable. An empty name is returned when there is none.
+func cloudsConfigFile(env string, name string) string {
+	if f := os.Getenv(env); f != "" {
+		return f
+	}
+	dirs := []string{"."}
+	if home := homedir.HomeDir(); home != "" {
+		dirs = append(dirs, filepath.Join(home, ".config", "openstack"))
+	}
+	dirs = append(dirs, "/etc/openstack")
+	for _, dir := range dirs {
+		f := filepath.Join(dir, name)
+		if _, err := os.Stat(f); err == nil {
+			return f
+		}
+	}
+	return ""
+}
+
+// readCloudProfile reads the profile of the cloud from the file, nil is returned if the file has no such profile
+func readCloudProfile(filename string, cloud string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filename, err)
+	}
+	// clouds.yaml holds the profiles of several clouds
+	var config struct {
+		Clouds map[string]map[string]interface{} `json:"clouds"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", filename, err)
+	}
+	return config.Clouds[cloud], nil
+}
+
+// mergeCloudProfile merges the values of src into dst, the values of src take precedence
+func mergeCloudProfile(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		srcSection, srcIsSection := v.(map[string]interface{})
+		dstSection, dstIsSection := dst[k].(map[string]interface{})
+		if srcIsSection && dstIsSection {
+			mergeCloudProfile(dstSection, srcSection)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// getCloudProfile returns the profile of the cloud selected by OS_CLOUD, merged from clouds.yaml, secure.yaml
+// and the OS_* environment variables like the openstack CLI does
+func getCloudProfile() (*cloudProfile, error) {
+	cloud := os.Getenv("OS_CLOUD")
+	if cloud == "" {
+		return nil, fmt.Errorf("OS_CLOUD is not set")
+	}
+	cloudsFile := cloudsConfigFile("OS_CLIENT_CONFIG_FILE", "clouds.yaml")
+	if cloudsFile == "" {
+		return nil, fmt.Errorf("clouds.yaml not found")
+	}
+	glog.V(2).Infof("using openstack cloud %q of %s", cloud, cloudsFile)
+	profile, err := readCloudProfile(cloudsFile, cloud)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("cloud %q not found in %s", cloud, cloudsFile)
+	}
+
+	// secure.yaml keeps the secrets of the profiles apart from clouds.yaml
+	if secureFile := cloudsConfigFile("OS_CLIENT_SECURE_FILE", "secure.yaml"); secureFile != "" {
+		secure, err := readCloudProfile(secureFile, cloud)
+		if err != nil {
+			return nil, err
+		}
+		mergeCloudProfile(profile, secure)
+	}
+
+	overrides := map[string]interface{}{}
+	for _, e := range cloudProfileEnv {
+		value := os.Getenv(e.env)
+		if value == "" {
+			continue
+		}
+		if e.section == "" {
+			overrides[e.key] = value
+			continue
+		}
+		section, ok := overrides[e.section].(map[string]interface{})
+		if !ok {
+			section = map[string]interface{}{}
+			overrides[e.section] = section
+		}
+		section[e.key] = value
+	}
+	mergeCloudProfile(profile, overrides)
+
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cloud %q: %v", cloud, err)
+	}
+	result := &cloudProfile{}
+	if err := yaml.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("error parsing cloud %q of %s: %v", cloud, cloudsFile, err)
+	}
+	return result, nil
+}
+
+// authOptions builds the keystone v3 credentials of the profile
+func (p *cloudProfile) authOptions() (gophercloud.AuthOptions, error) {
+	auth := p.Auth
+	userDomainID := firstNonEmpty(auth.UserDomainID, auth.DomainID)
+	userDomainName := firstNonEmpty(auth.UserDomainName, auth.DomainName)
+
+	if p.AuthType == "v3applicationcredential" || auth.ApplicationCredentialID != "" || auth.ApplicationCredentialName != "" {
+		return applicationCredentialAuthOptions(
+			auth.AuthURL,
+			auth.ApplicationCredentialID,
+			auth.ApplicationCredentialName,
+			auth.ApplicationCredentialSecret,
+			auth.UserID,
+			auth.Username,
+			userDomainID,
+			userDomainName,
+		)
+	}
+	if p.AuthType != "" && p.AuthType != "password" && p.AuthType != "v3password" {
+		return gophercloud.AuthOptions{}, fmt.Errorf("unsupported auth_type %q", p.AuthType)
+	}
+
+	opt := gophercloud.AuthOptions{
+		IdentityEndpoint: auth.AuthURL,
+		UserID:           auth.UserID,
+		Username:         auth.Username,
+		Password:         auth.Password,
+		DomainID:         userDomainID,
+		DomainName:       userDomainName,
+		TenantID:         firstNonEmpty(auth.ProjectID, auth.TenantID),
+		TenantName:       firstNonEmpty(auth.ProjectName, auth.TenantName),
+		AllowReauth:      true,
+	}
+	if opt.IdentityEndpoint == "" {
+		return opt, fmt.Errorf("missing auth_url")
+	}
+	if opt.Password == "" {
+		return opt, fmt.Errorf("missing password")
+	}
+	if opt.UserID == "" && opt.Username == "" {
+		return opt, fmt.Errorf("missing username and user_id")
+	}
+	if opt.TenantID == "" && opt.TenantName != "" && (auth.ProjectDomainID != "" || auth.ProjectDomainName != "") {
+		// the project may live in another domain than the user
+		opt.Scope = &gophercloud.AuthScope{
+			ProjectName: opt.TenantName,
+			DomainID:    auth.ProjectDomainID,
+			DomainName:  auth.ProjectDomainName,
+		}
+		if opt.Scope.DomainID != "" {
+			opt.Scope.DomainName = ""
+		}
+	}
+	return opt, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// cloudsYAMLCredentialProvider reads the credentials of the cloud selected by OS_CLOUD from clouds.yaml
+type cloudsYAMLCredentialProvider struct{}
+
+func (cloudsYAMLCredentialProvider) Name() string {
+	return "clouds.yaml"
+}
+
+func (cloudsYAMLCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	profile, err := getCloudProfile()
+	if err != nil {
+		return gophercloud.AuthOptions{}, err
+	}
+	opt, err := profile.authOptions()
+	if err != nil {
+		return opt, fmt.Errorf("invalid cloud %q: %v", os.Getenv("OS_CLOUD"), err)
+	}
+	return opt, nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+// OpenstackCredentialProvider supplies the credentials used to authenticate to keystone.
+// Retrieve is called again whenever the token expires, so providers can hand out refreshed credentials.
+type OpenstackCredentialProvider interface {
+	// Name identifies the provider in messages
+	Name() string
+	// Retrieve returns the current credentials
+	Retrieve() (gophercloud.AuthOptions, error)
+}
+
+var (
+	customOpenstackCredentialProvidersMutex sync.Mutex
+	customOpenstackCredentialProviders      []OpenstackCredentialProvider
+)
+
+// RegisterOpenstackCredentialProvider adds a credential provider, e.g. backed by Vault or the metadata service.
+// Registered providers are consulted in order, before a token, clouds.yaml, the application credential, the environment and the config file.
+func RegisterOpenstackCredentialProvider(provider OpenstackCredentialProvider) {
+	customOpenstackCredentialProvidersMutex.Lock()
+	defer customOpenstackCredentialProvidersMutex.Unlock()
+
+	customOpenstackCredentialProviders = append(customOpenstackCredentialProviders, provider)
+}
+
+// applicationCredentialAuthOptions builds the options for authenticating with a keystone v3 application credential.
+// Application credentials are bound to their project, so no project scope or password is sent.
+func applicationCredentialAuthOptions(authURL, id, name, secret, userID, username, domainID, domainName string) (gophercloud.AuthOptions, error) {
+	opt := gophercloud.AuthOptions{
+		IdentityEndpoint:            authURL,
+		ApplicationCredentialID:     id,
+		ApplicationCredentialName:   name,
+		ApplicationCredentialSecret: secret,
+		AllowReauth:                 true,
+	}
+	if authURL == "" {
+		return opt, fmt.Errorf("missing auth url for application credential")
+	}
+	if secret == "" {
+		return opt, fmt.Errorf("missing secret for application credential")
+	}
+	if id == "" {
+		// an application credential referenced by name belongs to a user
+		if userID == "" && username == "" {
+			return opt, fmt.Errorf("missing user for application credential %q", name)
+		}
+		if userID == "" && domainID == "" && domainName == "" {
+			return opt, fmt.Errorf("missing user domain for application credential %q", name)
+		}
+		opt.UserID = userID
+		opt.Username = username
+		opt.DomainID = domainID
+		opt.DomainName = domainName
+	}
+	return opt, nil
+}
+
+// applicationCredentialProvider reads an application credential from the OS_APPLICATION_CREDENTIAL_* environment variables
+type applicationCredentialProvider struct{}
+
+func (applicationCredentialProvider) Name() string {
+	return "application credential"
+}
+
+func (applicationCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	id := os.Getenv("OS_APPLICATION_CREDENTIAL_ID")
+	name := os.Getenv("OS_APPLICATION_CREDENTIAL_NAME")
+	if id == "" && name == "" {
+		return gophercloud.AuthOptions{}, fmt.Errorf("OS_APPLICATION_CREDENTIAL_ID and OS_APPLICATION_CREDENTIAL_NAME are not set")
+	}
+	return applicationCredentialAuthOptions(
+		os.Getenv("OS_AUTH_URL"),
+		id,
+		name,
+		os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"),
+		os.Getenv("OS_USERID"),
+		os.Getenv("OS_USERNAME"),
+		os.Getenv("OS_DOMAIN_ID"),
+		os.Getenv("OS_DOMAIN_NAME"),
+	)
+}
+
+// tokenCredentialProvider reads a pre-issued token from OS_TOKEN, which is used instead of authenticating again
+type tokenCredentialProvider struct{}
+
+func (tokenCredentialProvider) Name() string {
+	return "token"
+}
+
+func (tokenCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	token := os.Getenv("OS_TOKEN")
+	if token == "" {
+		return gophercloud.AuthOptions{}, fmt.Errorf("OS_TOKEN is not set")
+	}
+	authURL := os.Getenv("OS_AUTH_URL")
+	if authURL == "" {
+		return gophercloud.AuthOptions{}, fmt.Errorf("missing OS_AUTH_URL for OS_TOKEN")
+	}
+	return gophercloud.AuthOptions{
+		IdentityEndpoint: authURL,
+		TokenID:          token,
+	}, nil
+}
+
+// envCredentialProvider reads the credentials from the OS_* environment variables
+type envCredentialProvider struct{}
+
+func (envCredentialProvider) Name() string {
+	return "environment"
+}
+
+func (envCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	opt, err := openstack.AuthOptionsFromEnv()
+	if err != nil {
+		return opt, err
+	}
+	opt.AllowReauth = true
+	return opt, nil
+}
+
+// fileCredentialProvider reads the credentials from the openstack config file
+type fileCredentialProvider struct {
+	config OpenstackConfig
+}
+
+func (p fileCredentialProvider) Name() string {
+	return "config file"
+}
+
+func (p fileCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	return p.config.getCredentialFromFile()
+}
+
+// credentialProviders returns the registered providers followed by the built-in ones
+func (oc OpenstackConfig) credentialProviders() []OpenstackCredentialProvider {
+	customOpenstackCredentialProvidersMutex.Lock()
+	defer customOpenstackCredentialProvidersMutex.Unlock()
+
+	var providers []OpenstackCredentialProvider
+	providers = append(providers, customOpenstackCredentialProviders...)
+	providers = append(providers, tokenCredentialProvider{}, cloudsYAMLCredentialProvider{}, applicationCredentialProvider{}, envCredentialProvider{}, fileCredentialProvider{config: oc})
+	return providers
+}
+
+// GetCredentialProvider returns the first credential provider which can supply credentials, together with the credentials
+func (oc OpenstackConfig) GetCredentialProvider() (OpenstackCredentialProvider, gophercloud.AuthOptions, error) {
+	var problems []string
+	for _, provider := range oc.credentialProviders() {
+		opt, err := provider.Retrieve()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", provider.Name(), err))
+			continue
+		}
+		return provider, opt, nil
+	}
+	return nil, gophercloud.AuthOptions{}, fmt.Errorf("could not find openstack credentials (%s)", strings.Join(problems, "; "))
+}
+
+// AuthenticateOpenstackClient authenticates the client with the credentials of the provider.
+// When reauthentication is allowed the credentials are retrieved again from the provider before a new token is requested.
+func AuthenticateOpenstackClient(pc *gophercloud.ProviderClient, provider OpenstackCredentialProvider, opt gophercloud.AuthOptions) error {
+	if opt.TokenID != "" && opt.Password == "" && opt.ApplicationCredentialSecret == "" {
+		return authenticateWithToken(pc, opt.TokenID)
+	}
+	if err := openstack.Authenticate(pc, opt); err != nil {
+		return err
+	}
+	if !opt.AllowReauth {
+		return nil
+	}
+
+	pc.ReauthFunc = func() error {
+		refreshed, err := provider.Retrieve()
+		if err != nil {
+			return fmt.Errorf("error refreshing openstack credentials from %s: %v", provider.Name(), err)
+		}
+		// authenticate a throw-away client without reauthentication, so a failure is not retried
+		refreshed.AllowReauth = false
+		tac, err := openstack.NewClient(refreshed.IdentityEndpoint)
+		if err != nil {
+			return err
+		}
+		tac.HTTPClient = pc.HTTPClient
+		tac.UserAgent = pc.UserAgent
+		tac.SetThrowaway(true)
+		if err := openstack.Authenticate(tac, refreshed); err != nil {
+			return err
+		}
+		pc.CopyTokenFrom(tac)
+		return nil
+	}
+	return nil
+}
+
+// authenticateWithToken uses a pre-issued token instead of requesting a new one. The token is validated against
+// keystone, which also returns the service catalog. The token can not be renewed, so it has to outlive the command.
+func authenticateWithToken(pc *gophercloud.ProviderClient, token string) error {
+	pc.SetToken(token)
+	identity, err := openstack.NewIdentityV3(pc, gophercloud.EndpointOpts{})
+	if err != nil {
+		return err
+	}
+	result := tokens3.Get(identity, token)
+	if result.Err != nil {
+		switch result.Err.(type) {
+		case gophercloud.ErrDefault401, gophercloud.ErrDefault404:
+			return fmt.Errorf("the openstack token is expired or invalid, a new token has to be issued: %v", result.Err)
+		}
+		return fmt.Errorf("error validating openstack token: %v", result.Err)
+	}
+	t, err := result.ExtractToken()
+	if err != nil {
+		return fmt.Errorf("error validating openstack token: %v", err)
+	}
+	if !t.ExpiresAt.IsZero() && t.ExpiresAt.Before(time.Now()) {
+		return fmt.Errorf("the openstack token expired at %s, a new token has to be issued", t.ExpiresAt)
+	}
+	glog.V(2).Infof("using openstack token expiring at %s", t.ExpiresAt)
+	// keep the validated token like the result of an authentication, which holds the service catalog and expiry
+	if err := pc.SetTokenAndAuthResult(tokens3.CreateResult(result)); err != nil {
+		return err
+	}
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return fmt.Errorf("error reading service catalog of openstack token: %v", err)
+	}
+	pc.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
+		return openstack.V3EndpointURL(catalog, opts)
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+type fakeCredentialProvider struct {
+	retrieved int
+	opt       gophercloud.AuthOptions
+	err       error
+}
+
+func (p *fakeCredentialProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeCredentialProvider) Retrieve() (gophercloud.AuthOptions, error) {
+	p.retrieved++
+	return p.opt, p.err
+}
+
+func withCredentialProviders(providers ...OpenstackCredentialProvider) func() {
+	customOpenstackCredentialProvidersMutex.Lock()
+	defer customOpenstackCredentialProvidersMutex.Unlock()
+
+	previous := customOpenstackCredentialProviders
+	customOpenstackCredentialProviders = providers
+	return func() {
+		customOpenstackCredentialProvidersMutex.Lock()
+		defer customOpenstackCredentialProvidersMutex.Unlock()
+		customOpenstackCredentialProviders = previous
+	}
+}
+
+func TestGetCredentialProviderPrefersRegisteredProviders(t *testing.T) {
+	failing := &fakeCredentialProvider{err: fmt.Errorf("vault is sealed")}
+	working := &fakeCredentialProvider{opt: gophercloud.AuthOptions{Username: "vault-user"}}
+	defer withCredentialProviders(failing, working)()
+
+	provider, opt, err := OpenstackConfig{}.GetCredentialProvider()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider != working {
+		t.Errorf("expected the working provider to be chosen, got %s", provider.Name())
+	}
+	if opt.Username != "vault-user" {
+		t.Errorf("unexpected credentials %+v", opt)
+	}
+	if failing.retrieved != 1 {
+		t.Errorf("expected the failing provider to be consulted once, got %d", failing.retrieved)
+	}
+}
+
+func TestAuthenticateOpenstackClientRefreshesCredentials(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", requests))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": {"catalog": []}}`))
+	}))
+	defer server.Close()
+
+	provider := &fakeCredentialProvider{
+		opt: gophercloud.AuthOptions{
+			IdentityEndpoint: server.URL + "/v3/",
+			Username:         "user",
+			Password:         "password",
+			DomainName:       "default",
+			AllowReauth:      true,
+		},
+	}
+
+	pc := &gophercloud.ProviderClient{IdentityBase: server.URL + "/", IdentityEndpoint: server.URL + "/v3/"}
+	if err := AuthenticateOpenstackClient(pc, provider, provider.opt); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+	if pc.Token() != "token-1" {
+		t.Fatalf("unexpected token %q", pc.Token())
+	}
+
+	if err := pc.Reauthenticate(""); err != nil {
+		t.Fatalf("unexpected error reauthenticating: %v", err)
+	}
+	if provider.retrieved != 1 {
+		t.Errorf("expected credentials to be retrieved again, got %d retrievals", provider.retrieved)
+	}
+	if pc.Token() != "token-2" {
+		t.Errorf("expected refreshed token, got %q", pc.Token())
+	}
+}
+
+func TestAuthenticateOpenstackClientRefreshFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": {"catalog": []}}`))
+	}))
+	defer server.Close()
+
+	opt := gophercloud.AuthOptions{
+		IdentityEndpoint: server.URL + "/v3/",
+		Username:         "user",
+		Password:         "password",
+		DomainName:       "default",
+		AllowReauth:      true,
+	}
+	provider := &fakeCredentialProvider{err: fmt.Errorf("lease expired")}
+
+	pc := &gophercloud.ProviderClient{IdentityBase: server.URL + "/", IdentityEndpoint: server.URL + "/v3/"}
+	if err := AuthenticateOpenstackClient(pc, provider, opt); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+	if err := pc.Reauthenticate(""); err == nil {
+		t.Errorf("expected error when the provider cannot refresh credentials")
+	}
+}
+
+func setCredentialEnv(env map[string]string) func() {
+	names := []string{
+		"OS_AUTH_URL", "OS_USERID", "OS_USERNAME", "OS_PASSWORD", "OS_DOMAIN_ID", "OS_DOMAIN_NAME",
+		"OS_TENANT_ID", "OS_TENANT_NAME", "OS_PROJECT_ID", "OS_PROJECT_NAME",
+		"OS_APPLICATION_CREDENTIAL_ID", "OS_APPLICATION_CREDENTIAL_NAME", "OS_APPLICATION_CREDENTIAL_SECRET",
+		"OS_USE_OCTAVIA", "OPENSTACK_CREDENTIAL_FILE",
+		"OS_CLOUD", "OS_CLIENT_CONFIG_FILE", "OS_CLIENT_SECURE_FILE", "OS_REGION_NAME", "OS_PROJECT_DOMAIN_NAME",
+		"OS_TOKEN",
+	}
+	previous := make(map[string]string)
+	for _, name := range names {
+		if v, found := os.LookupEnv(name); found {
+			previous[name] = v
+		}
+		os.Unsetenv(name)
+	}
+	os.Setenv("OPENSTACK_CREDENTIAL_FILE", filepath.Join(os.TempDir(), "kops-missing-openstack-config"))
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+			if v, found := previous[name]; found {
+				os.Setenv(name, v)
+			}
+		}
+	}
+}
+
+func TestApplicationCredentialFromEnv(t *testing.T) {
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{
+		"OS_AUTH_URL":                      "https://keystone.example.com/v3/",
+		"OS_APPLICATION_CREDENTIAL_ID":     "app-cred-id",
+		"OS_APPLICATION_CREDENTIAL_SECRET": "secret",
+		"OS_PROJECT_NAME":                  "ignored",
+	})()
+
+	provider, opt, err := OpenstackConfig{}.GetCredentialProvider()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "application credential" {
+		t.Errorf("expected application credential provider, got %s", provider.Name())
+	}
+	if opt.ApplicationCredentialID != "app-cred-id" || opt.ApplicationCredentialSecret != "secret" {
+		t.Errorf("unexpected application credential %+v", opt)
+	}
+	if opt.TenantName != "" || opt.Password != "" {
+		t.Errorf("application credential should not be project scoped, got %+v", opt)
+	}
+}
+
+func TestApplicationCredentialMissingSecret(t *testing.T) {
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{
+		"OS_AUTH_URL":                  "https://keystone.example.com/v3/",
+		"OS_APPLICATION_CREDENTIAL_ID": "app-cred-id",
+	})()
+
+	if _, _, err := (OpenstackConfig{}).GetCredentialProvider(); err == nil {
+		t.Errorf("expected error without application credential secret")
+	}
+}
+
+func TestApplicationCredentialFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openstack-config")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config")
+	content := `[Default]
+identity = https://keystone.example.com/v3/
+application_credential_name = kops
+application_credential_secret = secret
+user = ci
+domain_name = Default
+`
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatalf("error writing config: %v", err)
+	}
+
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{"OPENSTACK_CREDENTIAL_FILE": config})()
+
+	opt, err := OpenstackConfig{}.GetCredential()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opt.ApplicationCredentialName != "kops" || opt.Username != "ci" || opt.DomainName != "Default" || opt.TenantName != "" {
+		t.Errorf("unexpected application credential %+v", opt)
+	}
+}
+
+func TestAuthenticateWithApplicationCredential(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": {"catalog": []}}`))
+	}))
+	defer server.Close()
+
+	opt, err := applicationCredentialAuthOptions(server.URL+"/v3/", "app-cred-id", "", "secret", "", "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc := &gophercloud.ProviderClient{IdentityBase: server.URL + "/", IdentityEndpoint: server.URL + "/v3/"}
+	if err := AuthenticateOpenstackClient(pc, &fakeCredentialProvider{opt: opt}, opt); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+
+	auth := request["auth"].(map[string]interface{})
+	if _, found := auth["scope"]; found {
+		t.Errorf("application credential request should not be scoped: %v", auth["scope"])
+	}
+	identity := auth["identity"].(map[string]interface{})
+	if fmt.Sprint(identity["methods"]) != "[application_credential]" {
+		t.Errorf("unexpected auth methods %v", identity["methods"])
+	}
+}
+
+func TestGetUseOctavia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kops-openstack")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(config, []byte("[LoadBalancer]\nuse-octavia = true\n"), 0600); err != nil {
+		t.Fatalf("error writing config: %v", err)
+	}
+
+	enabled, disabled := true, false
+	grid := []struct {
+		env      map[string]string
+		expected *bool
+	}{
+		{env: map[string]string{}, expected: nil},
+		{env: map[string]string{"OPENSTACK_CREDENTIAL_FILE": config}, expected: &enabled},
+		{env: map[string]string{"OPENSTACK_CREDENTIAL_FILE": config, "OS_USE_OCTAVIA": "false"}, expected: &disabled},
+	}
+	for _, g := range grid {
+		restore := setCredentialEnv(g.env)
+		actual, err := OpenstackConfig{}.GetUseOctavia()
+		restore()
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", g.env, err)
+			continue
+		}
+		if (actual == nil) != (g.expected == nil) || (actual != nil && *actual != *g.expected) {
+			t.Errorf("%v: expected %v, got %v", g.env, g.expected, actual)
+		}
+	}
+
+	defer setCredentialEnv(map[string]string{"OS_USE_OCTAVIA": "maybe"})()
+	if _, err := (OpenstackConfig{}).GetUseOctavia(); err == nil {
+		t.Errorf("expected an error for an invalid value")
+	}
+}
+
+func writeCloudsYAML(t *testing.T, dir string) {
+	clouds := `clouds:
+  dev:
+    auth:
+      auth_url: https://keystone.dev.example.com/v3/
+      username: dev
+      password: dev-secret
+      project_name: dev
+      user_domain_name: Default
+    region_name: DevRegion
+  prod:
+    auth:
+      auth_url: https://keystone.example.com/v3/
+      username: ci
+      project_name: kops
+      user_domain_name: Users
+      project_domain_name: Projects
+    region_name: RegionOne
+`
+	secure := `clouds:
+  prod:
+    auth:
+      password: prod-secret
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "clouds.yaml"), []byte(clouds), 0600); err != nil {
+		t.Fatalf("error writing clouds.yaml: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secure.yaml"), []byte(secure), 0600); err != nil {
+		t.Fatalf("error writing secure.yaml: %v", err)
+	}
+}
+
+func TestCredentialFromCloudsYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kops-openstack")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeCloudsYAML(t, dir)
+
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{
+		"OS_CLOUD":              "prod",
+		"OS_CLIENT_CONFIG_FILE": filepath.Join(dir, "clouds.yaml"),
+		"OS_CLIENT_SECURE_FILE": filepath.Join(dir, "secure.yaml"),
+		"OS_PROJECT_NAME":       "kops-ci",
+	})()
+
+	provider, opt, err := OpenstackConfig{}.GetCredentialProvider()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "clouds.yaml" {
+		t.Errorf("expected credentials from clouds.yaml, got %s", provider.Name())
+	}
+	if opt.IdentityEndpoint != "https://keystone.example.com/v3/" || opt.Username != "ci" || opt.Password != "prod-secret" || opt.DomainName != "Users" {
+		t.Errorf("unexpected credentials %+v", opt)
+	}
+	if opt.Scope == nil || opt.Scope.ProjectName != "kops-ci" || opt.Scope.DomainName != "Projects" {
+		t.Errorf("expected the project of the environment in its own domain, got %+v", opt.Scope)
+	}
+
+	region, err := OpenstackConfig{}.GetRegion()
+	if err != nil {
+		t.Fatalf("unexpected error getting region: %v", err)
+	}
+	if region != "RegionOne" {
+		t.Errorf("expected region of the cloud, got %q", region)
+	}
+}
+
+func TestCredentialFromCloudsYAMLMissingCloud(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kops-openstack")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeCloudsYAML(t, dir)
+
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{
+		"OS_CLOUD":              "staging",
+		"OS_CLIENT_CONFIG_FILE": filepath.Join(dir, "clouds.yaml"),
+		"OS_CLIENT_SECURE_FILE": filepath.Join(dir, "secure.yaml"),
+	})()
+
+	_, err = OpenstackConfig{}.GetCredential()
+	if err == nil || !strings.Contains(err.Error(), `cloud "staging" not found`) {
+		t.Errorf("expected missing cloud to be reported, got %v", err)
+	}
+}
+
+func newTokenServer(t *testing.T, expiresAt string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("X-Auth-Token") != "token" || r.Header.Get("X-Subject-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [{"type": "compute", "endpoints": [{"interface": "public", "region": "RegionOne", "url": "%s/compute/v2.1"}]}]}}`, expiresAt, server.URL)
+	}))
+	return server
+}
+
+func TestAuthenticateWithToken(t *testing.T) {
+	server := newTokenServer(t, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	defer server.Close()
+
+	defer withCredentialProviders()()
+	defer setCredentialEnv(map[string]string{
+		"OS_TOKEN":    "token",
+		"OS_AUTH_URL": server.URL + "/v3/",
+		"OS_USERNAME": "ci",
+		"OS_PASSWORD": "secret",
+	})()
+
+	provider, opt, err := OpenstackConfig{}.GetCredentialProvider()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "token" {
+		t.Errorf("expected the token to be preferred, got %s", provider.Name())
+	}
+	pc := &gophercloud.ProviderClient{IdentityBase: server.URL + "/", IdentityEndpoint: server.URL + "/v3/"}
+	if err := AuthenticateOpenstackClient(pc, provider, opt); err != nil {
+		t.Fatalf("unexpected error authenticating: %v", err)
+	}
+	if pc.Token() != "token" {
+		t.Errorf("expected the token to be used, got %q", pc.Token())
+	}
+	endpoint, err := pc.EndpointLocator(gophercloud.EndpointOpts{Type: "compute", Region: "RegionOne", Availability: gophercloud.AvailabilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected error locating endpoint: %v", err)
+	}
+	if endpoint != server.URL+"/compute/v2.1/" {
+		t.Errorf("unexpected endpoint %q", endpoint)
+	}
+}
+
+func TestAuthenticateWithExpiredToken(t *testing.T) {
+	server := newTokenServer(t, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	defer server.Close()
+
+	for _, token := range []string{"token", "revoked"} {
+		pc := &gophercloud.ProviderClient{IdentityBase: server.URL + "/", IdentityEndpoint: server.URL + "/v3/"}
+		opt := gophercloud.AuthOptions{IdentityEndpoint: server.URL + "/v3/", TokenID: token}
+		err := AuthenticateOpenstackClient(pc, &fakeCredentialProvider{opt: opt}, opt)
+		if err == nil || !strings.Contains(err.Error(), "a new token has to be issued") {
+			t.Errorf("expected token %q to be rejected, got %v", token, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// openstackProxy selects the proxy for requests to the openstack endpoints
+type openstackProxy struct {
+	httpProxy  *url.URL
+	httpsProxy *url.URL
+	noProxy    []string
+}
+
+// getenv returns the first non-empty environment variable of the given names
+func getenv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func parseProxyURL(name, value string) (*url.URL, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s %q: %v", name, value, err)
+	}
+	return u, nil
+}
+
+// newOpenstackProxyFromEnv reads the proxy settings from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func newOpenstackProxyFromEnv() (*openstackProxy, error) {
+	httpProxy, err := parseProxyURL("HTTP_PROXY", getenv("HTTP_PROXY", "http_proxy"))
+	if err != nil {
+		return nil, err
+	}
+	httpsProxy, err := parseProxyURL("HTTPS_PROXY", getenv("HTTPS_PROXY", "https_proxy"))
+	if err != nil {
+		return nil, err
+	}
+	if httpsProxy == nil {
+		httpsProxy = httpProxy
+	}
+
+	p := &openstackProxy{
+		httpProxy:  httpProxy,
+		httpsProxy: httpsProxy,
+	}
+	for _, host := range strings.Split(getenv("NO_PROXY", "no_proxy"), ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			p.noProxy = append(p.noProxy, host)
+		}
+	}
+	return p, nil
+}
+
+// Proxy returns the proxy for the request, or nil if the request should be sent directly
+func (p *openstackProxy) Proxy(req *http.Request) (*url.URL, error) {
+	proxy := p.httpProxy
+	if req.URL.Scheme == "https" {
+		proxy = p.httpsProxy
+	}
+	if proxy == nil || p.bypass(req.URL.Hostname()) {
+		return nil, nil
+	}
+	return proxy, nil
+}
+
+// bypass returns true if the host matches an entry of NO_PROXY
+func (p *openstackProxy) bypass(host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range p.noProxy {
+		if entry == "*" {
+			return true
+		}
+		if ip != nil {
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTLSConfig returns the tls configuration for the openstack endpoints.
+// The CA bundle is read from OS_CACERT or ca_file in the Global section of the config file,
+// and certificate verification is only skipped when OS_INSECURE or insecure is set to true.
+func (oc OpenstackConfig) GetTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("OS_CACERT")
+	insecure := os.Getenv("OS_INSECURE")
+	if caFile == "" || insecure == "" {
+		if values, err := oc.getSection("Global", []string{"ca_file", "insecure"}); err == nil {
+			if caFile == "" {
+				caFile = values["ca_file"]
+			}
+			if insecure == "" {
+				insecure = values["insecure"]
+			}
+		}
+	}
+
+	tlsconfig := &tls.Config{}
+	if insecure != "" {
+		skip, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for openstack insecure setting: %v", insecure, err)
+		}
+		if skip {
+			glog.Warningf("TLS certificate verification of the openstack endpoints is disabled")
+			tlsconfig.InsecureSkipVerify = true
+		}
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading openstack CA file %q: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in openstack CA file %q", caFile)
+		}
+		tlsconfig.RootCAs = pool
+	}
+	return tlsconfig, nil
+}
+
+// NewHTTPClient returns the http client used to talk to the openstack endpoints
+func (oc OpenstackConfig) NewHTTPClient() (http.Client, error) {
+	proxy, err := newOpenstackProxyFromEnv()
+	if err != nil {
+		return http.Client{}, err
+	}
+
+	tlsconfig, err := oc.GetTLSConfig()
+	if err != nil {
+		return http.Client{}, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig: tlsconfig,
+		Proxy:           proxy.Proxy,
+	}
+	return http.Client{
+		Transport: transport,
+	}, nil
+}
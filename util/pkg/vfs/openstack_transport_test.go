@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vfs
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setProxyEnv(env map[string]string) func() {
+	names := []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"}
+	previous := make(map[string]string)
+	for _, name := range names {
+		if v, found := os.LookupEnv(name); found {
+			previous[name] = v
+		}
+		os.Unsetenv(name)
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+			if v, found := previous[name]; found {
+				os.Setenv(name, v)
+			}
+		}
+	}
+}
+
+func TestOpenstackProxy(t *testing.T) {
+	defer setProxyEnv(map[string]string{
+		"HTTPS_PROXY": "proxy.example.com:3128",
+		"NO_PROXY":    "internal.example.com, .cloud.local,10.0.0.0/8",
+	})()
+
+	proxy, err := newOpenstackProxyFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	grid := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://keystone.example.com:5000/v3/", expected: "http://proxy.example.com:3128"},
+		{url: "http://keystone.example.com:5000/v3/", expected: ""},
+		{url: "https://internal.example.com:5000/v3/", expected: ""},
+		{url: "https://keystone.cloud.local/v3/", expected: ""},
+		{url: "https://10.1.2.3:8774/v2.1/", expected: ""},
+		{url: "https://192.168.1.1:8774/v2.1/", expected: "http://proxy.example.com:3128"},
+	}
+	for _, g := range grid {
+		req, err := http.NewRequest(http.MethodGet, g.url, nil)
+		if err != nil {
+			t.Fatalf("error building request: %v", err)
+		}
+		actual, err := proxy.Proxy(req)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", g.url, err)
+			continue
+		}
+		actualURL := ""
+		if actual != nil {
+			actualURL = actual.String()
+		}
+		if actualURL != g.expected {
+			t.Errorf("unexpected proxy for %s: expected %q, got %q", g.url, g.expected, actualURL)
+		}
+	}
+}
+
+func TestOpenstackHTTPClientUsesProxy(t *testing.T) {
+	defer setProxyEnv(map[string]string{"https_proxy": "http://proxy.example.com:3128"})()
+
+	client, err := OpenstackConfig{}.NewHTTPClient()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://keystone.example.com/v3/", nil)
+	actual, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || actual == nil || actual.Host != "proxy.example.com:3128" {
+		t.Errorf("expected request to use the configured proxy, got %v (%v)", actual, err)
+	}
+}
+
+func setTLSEnv(env map[string]string) func() {
+	names := []string{"OS_CACERT", "OS_INSECURE", "OPENSTACK_CREDENTIAL_FILE"}
+	previous := make(map[string]string)
+	for _, name := range names {
+		if v, found := os.LookupEnv(name); found {
+			previous[name] = v
+		}
+		os.Unsetenv(name)
+	}
+	// do not pick up the settings of the user running the tests
+	os.Setenv("OPENSTACK_CREDENTIAL_FILE", filepath.Join(os.TempDir(), "kops-missing-openstack-config"))
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+			if v, found := previous[name]; found {
+				os.Setenv(name, v)
+			}
+		}
+	}
+}
+
+func TestOpenstackHTTPClientTLSVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer setProxyEnv(nil)()
+
+	dir, err := ioutil.TempDir("", "openstack-tls")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatalf("error writing CA file: %v", err)
+	}
+
+	grid := []struct {
+		name    string
+		env     map[string]string
+		success bool
+	}{
+		{name: "default", env: nil, success: false},
+		{name: "ca file", env: map[string]string{"OS_CACERT": caFile}, success: true},
+		{name: "insecure", env: map[string]string{"OS_INSECURE": "true"}, success: true},
+		{name: "not insecure", env: map[string]string{"OS_INSECURE": "false"}, success: false},
+	}
+	for _, g := range grid {
+		restore := setTLSEnv(g.env)
+		client, err := OpenstackConfig{}.NewHTTPClient()
+		if err != nil {
+			restore()
+			t.Errorf("%s: unexpected error building client: %v", g.name, err)
+			continue
+		}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if g.success != (err == nil) {
+			t.Errorf("%s: expected success=%v, got error %v", g.name, g.success, err)
+		}
+		restore()
+	}
+}
+
+func TestOpenstackTLSConfigInvalidCAFile(t *testing.T) {
+	defer setTLSEnv(map[string]string{"OS_CACERT": filepath.Join(os.TempDir(), "kops-missing-ca.pem")})()
+
+	if _, err := (OpenstackConfig{}).GetTLSConfig(); err == nil {
+		t.Errorf("expected error for missing CA file")
+	}
+}
@@ -18,14 +18,13 @@ package vfs
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -46,7 +45,7 @@ func NewSwiftClient() (*gophercloud.ServiceClient, error) {
 	config := OpenstackConfig{}
 
 	// Check if env credentials are valid first
-	authOption, err := config.GetCredential()
+	credentialProvider, authOption, err := config.GetCredentialProvider()
 	if err != nil {
 		return nil, err
 	}
@@ -56,16 +55,14 @@ func NewSwiftClient() (*gophercloud.ServiceClient, error) {
 		return nil, fmt.Errorf("error building openstack provider client: %v", err)
 	}
 
-	tlsconfig := &tls.Config{}
-	tlsconfig.InsecureSkipVerify = true
-	transport := &http.Transport{TLSClientConfig: tlsconfig}
-	pc.HTTPClient = http.Client{
-		Transport: transport,
+	pc.HTTPClient, err = config.NewHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error building openstack http client: %v", err)
 	}
 
 	glog.V(2).Info("authenticating to keystone")
 
-	err = openstack.Authenticate(pc, authOption)
+	err = AuthenticateOpenstackClient(pc, credentialProvider, authOption)
 	if err != nil {
 		return nil, fmt.Errorf("error building openstack authenticated client: %v", err)
 	}
@@ -78,6 +75,9 @@ func NewSwiftClient() (*gophercloud.ServiceClient, error) {
 			return nil, err
 		}
 	} else {
+		if serviceRegion := config.GetServiceRegion("object-store"); serviceRegion != "" {
+			region = serviceRegion
+		}
 		endpointOpt = gophercloud.EndpointOpts{
 			Type:   "object-store",
 			Region: region,
@@ -130,17 +130,10 @@ func (oc OpenstackConfig) getSection(name string, items []string) (map[string]st
 	return values, nil
 }
 
+// GetCredential returns the credentials of the first credential provider which can supply them
 func (oc OpenstackConfig) GetCredential() (gophercloud.AuthOptions, error) {
-
-	// prioritize environment config
-	env, enverr := openstack.AuthOptionsFromEnv()
-	if enverr != nil {
-		glog.Warningf("Could not initialize swift from environment: %v", enverr)
-		// fallback to config file
-		return oc.getCredentialFromFile()
-	}
-	return env, nil
-
+	_, opt, err := oc.GetCredentialProvider()
+	return opt, err
 }
 
 func (oc OpenstackConfig) GetRegion() (string, error) {
@@ -155,6 +148,16 @@ func (oc OpenstackConfig) GetRegion() (string, error) {
 		return region, nil
 	}
 
+	if os.Getenv("OS_CLOUD") != "" {
+		profile, err := getCloudProfile()
+		if err != nil {
+			return "", err
+		}
+		if profile.RegionName != "" {
+			return profile.RegionName, nil
+		}
+	}
+
 	items := []string{"region"}
 	// TODO: Unsure if this is the correct section for region
 	values, err := oc.getSection("Global", items)
@@ -164,15 +167,46 @@ func (oc OpenstackConfig) GetRegion() (string, error) {
 	return values["region"], nil
 }
 
+// GetServiceRegion returns the region of a service which runs in another region than the cloud, as configured by
+// OS_<SERVICE>_REGION_NAME or <service>-region in the Global section of the config file, e.g. OS_DNS_REGION_NAME
+// or dns-region. An empty region is returned when it is not configured.
+func (oc OpenstackConfig) GetServiceRegion(service string) string {
+	env := "OS_" + strings.ToUpper(strings.Replace(service, "-", "_", -1)) + "_REGION_NAME"
+	if region := os.Getenv(env); region != "" {
+		return region
+	}
+	key := service + "-region"
+	values, err := oc.getSection("Global", []string{key})
+	if err != nil {
+		glog.V(4).Infof("%s not found in openstack config: %v", key, err)
+		return ""
+	}
+	return values[key]
+}
+
 func (oc OpenstackConfig) getCredentialFromFile() (gophercloud.AuthOptions, error) {
 	opt := gophercloud.AuthOptions{}
 	name := "Default"
-	items := []string{"identity", "user", "user_id", "password", "domain_id", "domain_name", "tenant_id", "tenant_name"}
+	items := []string{"identity", "user", "user_id", "password", "domain_id", "domain_name", "tenant_id", "tenant_name",
+		"application_credential_id", "application_credential_name", "application_credential_secret"}
 	values, err := oc.getSection(name, items)
 	if err != nil {
 		return opt, err
 	}
 
+	if values["application_credential_id"] != "" || values["application_credential_name"] != "" {
+		return applicationCredentialAuthOptions(
+			values["identity"],
+			values["application_credential_id"],
+			values["application_credential_name"],
+			values["application_credential_secret"],
+			values["user_id"],
+			values["user"],
+			values["domain_id"],
+			values["domain_name"],
+		)
+	}
+
 	for _, c1 := range []string{"identity", "password"} {
 		if values[c1] == "" {
 			return opt, fmt.Errorf("missing %s in section of %s", c1, name)
@@ -199,6 +233,20 @@ func (oc OpenstackConfig) getCredentialFromFile() (gophercloud.AuthOptions, erro
 	return opt, nil
 }
 
+// GetServiceEndpoint returns the endpoint of the service configured in its section of the config file,
+// or else the endpoint of the service type in the region
+func (oc OpenstackConfig) GetServiceEndpoint(name string, serviceType string, region string) gophercloud.EndpointOpts {
+	opt, err := oc.GetServiceConfig(name)
+	if err != nil {
+		glog.V(4).Infof("using %s endpoint in region %q: %v", serviceType, region, err)
+		return gophercloud.EndpointOpts{
+			Type:   serviceType,
+			Region: region,
+		}
+	}
+	return opt
+}
+
 func (oc OpenstackConfig) GetServiceConfig(name string) (gophercloud.EndpointOpts, error) {
 	opt := gophercloud.EndpointOpts{}
 	items := []string{"service_type", "service_name", "region", "availability"}
@@ -219,6 +267,29 @@ func (oc OpenstackConfig) GetServiceConfig(name string) (gophercloud.EndpointOpt
 	return opt, nil
 }
 
+// GetUseOctavia returns whether loadbalancers are managed through Octavia, as configured by OS_USE_OCTAVIA
+// or use-octavia in the LoadBalancer section of the config file. Nil is returned when it is not configured.
+func (oc OpenstackConfig) GetUseOctavia() (*bool, error) {
+	value := os.Getenv("OS_USE_OCTAVIA")
+	if value == "" {
+		values, err := oc.getSection("LoadBalancer", []string{"use-octavia"})
+		if err != nil {
+			glog.V(4).Infof("use-octavia not found in openstack config: %v", err)
+			return nil, nil
+		}
+		value = values["use-octavia"]
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	useOctavia, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid use-octavia value %q: %v", value, err)
+	}
+	return &useOctavia, nil
+}
+
 // SwiftPath is a vfs path for Openstack Cloud Storage.
 type SwiftPath struct {
 	client *gophercloud.ServiceClient